@@ -6,7 +6,9 @@ import clsx from 'clsx';
 
 interface BudgetStatus {
   id: string;
+  category_id: string;
   category: string;
+  category_type?: string;
   limit: number;
   spent: number;
   percentage: number;
@@ -35,6 +37,8 @@ export default function BudgetSection({ month }: BudgetSectionProps) {
 
   // Form States
   const [selectedCategory, setSelectedCategory] = useState('');
+  // 修改時類別可能已封存，不在類別選單中
+  const [editingCategoryName, setEditingCategoryName] = useState('');
   const [amount, setAmount] = useState('');
 
   // 新增類別相關狀態
@@ -75,11 +79,12 @@ export default function BudgetSection({ month }: BudgetSectionProps) {
 
     if (budget) {
       setEditMode(true);
-      setSelectedCategory(budget.category);
+      setSelectedCategory(budget.category_id);
+      setEditingCategoryName(budget.category);
       setAmount(budget.limit.toString());
     } else {
       setEditMode(false);
-      if (categories.length > 0) setSelectedCategory(categories[0].name);
+      if (categories.length > 0) setSelectedCategory(categories[0].id);
       setAmount('');
     }
     setIsModalOpen(true);
@@ -111,7 +116,7 @@ export default function BudgetSection({ month }: BudgetSectionProps) {
       });
       setCategories(updatedList);
 
-      setSelectedCategory(res.data.name);
+      setSelectedCategory(res.data.id);
       setIsAddingCategory(false);
       setNewCategoryName('');
     } catch (error) {
@@ -123,7 +128,7 @@ export default function BudgetSection({ month }: BudgetSectionProps) {
   const cancelAddCategory = () => {
     setIsAddingCategory(false);
     setNewCategoryName('');
-    if (categories.length > 0) setSelectedCategory(categories[0].name);
+    if (categories.length > 0) setSelectedCategory(categories[0].id);
   };
 
   // 5. 儲存預算
@@ -131,7 +136,7 @@ export default function BudgetSection({ month }: BudgetSectionProps) {
     if (!selectedCategory || !amount) return;
     try {
       await axios.post('/api/v1/budgets', {
-        category: selectedCategory,
+        category_id: selectedCategory,
         amount: Number(amount),
         year_month: month,
       });
@@ -281,10 +286,13 @@ export default function BudgetSection({ month }: BudgetSectionProps) {
                       disabled={editMode}
                     >
                       {categories.map((c) => (
-                        <option key={c.id} value={c.name}>
+                        <option key={c.id} value={c.id}>
                           {c.name}
                         </option>
                       ))}
+                      {editMode && !categories.some((c) => c.id === selectedCategory) && (
+                        <option value={selectedCategory}>{editingCategoryName}</option>
+                      )}
 
                       {!editMode && (
                         <>
@@ -2,7 +2,7 @@
 import { useEffect, useState, type FormEvent } from 'react';
 import axios from 'axios';
 import { useNavigate } from 'react-router-dom';
-import { Lock, User, Eye, EyeOff, Moon, Sun } from 'lucide-react'; // 1. 新增引入 Eye, EyeOff
+import { Lock, User, Eye, EyeOff, Moon, Sun, ShieldCheck } from 'lucide-react'; // 1. 新增引入 Eye, EyeOff
 import { useAuth } from '../context/AuthContext';
 import { useTheme } from '../context/ThemeContext';
 
@@ -13,7 +13,12 @@ export default function Login() {
   const [password, setPassword] = useState('');
   // 2. 新增控制密碼顯示的狀態
   const [showPassword, setShowPassword] = useState(false);
+  // 兩步驟驗證：密碼正確後由後端回傳 challenge，再輸入驗證碼完成登入
+  const [challenge, setChallenge] = useState('');
+  const [code, setCode] = useState('');
   const [error, setError] = useState('');
+  // 後端有設定 OIDC 時才顯示單一登入按鈕
+  const [oidcEnabled, setOidcEnabled] = useState(false);
   const { login } = useAuth();
   const { theme, toggleTheme } = useTheme();
   const navigate = useNavigate();
@@ -23,18 +28,49 @@ export default function Login() {
     document.title = 'FinTrack | Login';
   }, []);
 
+  useEffect(() => {
+    axios
+      .get(`${AUTH_BASE_URL}/oidc`)
+      .then((res) => setOidcEnabled(Boolean(res.data?.enabled)))
+      .catch(() => setOidcEnabled(false));
+
+    // IdP 導回失敗時，後端會在網址帶上 oidc_error
+    const params = new URLSearchParams(window.location.search);
+    if (params.get('oidc_error')) {
+      setError(params.get('oidc_error') === 'not_linked' ? '此外部帳號尚未連結到任何帳號' : '單一登入失敗，請再試一次');
+    }
+  }, []);
+
   const handleSubmit = async (e: FormEvent) => {
     e.preventDefault();
     setError('');
 
     try {
-      await axios.post(`${AUTH_BASE_URL}/login`, {
-        username,
-        password,
-      });
+      if (challenge) {
+        // 6 位數為驗證器 App 的驗證碼，其餘視為復原碼
+        const isTotp = /^\d{6}$/.test(code.trim());
+        await axios.post(`${AUTH_BASE_URL}/login/verify`, {
+          challenge,
+          code: isTotp ? code.trim() : undefined,
+          recovery_code: isTotp ? undefined : code.trim(),
+        });
+      } else {
+        const res = await axios.post(`${AUTH_BASE_URL}/login`, {
+          username,
+          password,
+        });
+        if (res.data?.mfa_required) {
+          setChallenge(res.data.challenge);
+          return;
+        }
+      }
       login();
       navigate('/');
     } catch (err) {
+      if (challenge) {
+        setError('驗證碼錯誤或已逾時');
+        return;
+      }
       setError('帳號或密碼錯誤');
     }
   };
@@ -65,6 +101,26 @@ export default function Login() {
         )}
 
         <form onSubmit={handleSubmit} className="space-y-6">
+          {challenge ? (
+          <div>
+            <label className="block text-sm font-medium text-gray-700 dark:text-neutral-200 mb-2">兩步驟驗證碼</label>
+            <div className="relative">
+              <div className="absolute inset-y-0 left-0 pl-3 flex items-center pointer-events-none text-gray-400 dark:text-neutral-500">
+                <ShieldCheck size={18} />
+              </div>
+              <input
+                type="text"
+                inputMode="numeric"
+                autoComplete="one-time-code"
+                value={code}
+                onChange={(event) => setCode(event.target.value)}
+                className="w-full pl-10 pr-4 py-2.5 border border-gray-300 rounded-lg focus:ring-2 focus:ring-indigo-500 focus:border-indigo-500 outline-none transition dark:border-neutral-700 dark:bg-neutral-950 dark:text-neutral-100 dark:placeholder:text-neutral-500 dark:focus:ring-neutral-700 dark:focus:border-neutral-600"
+                placeholder="請輸入驗證器 App 的 6 位數驗證碼或復原碼"
+              />
+            </div>
+          </div>
+          ) : (
+          <>
           <div>
             <label className="block text-sm font-medium text-gray-700 dark:text-neutral-200 mb-2">使用者名稱</label>
             <div className="relative">
@@ -112,14 +168,25 @@ export default function Login() {
               </button>
             </div>
           </div>
+          </>
+          )}
 
           <button
             type="submit"
             className="w-full bg-indigo-600 text-white py-3 rounded-xl font-bold hover:bg-indigo-700 transition shadow-lg shadow-indigo-200 dark:bg-neutral-200 dark:text-neutral-900 dark:hover:bg-white dark:shadow-none"
           >
-            登入系統
+            {challenge ? '驗證' : '登入系統'}
           </button>
         </form>
+
+        {oidcEnabled && !challenge && (
+          <a
+            href={`${AUTH_BASE_URL}/oidc/login`}
+            className="mt-4 block w-full text-center border border-gray-300 text-gray-700 py-3 rounded-xl font-bold hover:bg-gray-50 transition dark:border-neutral-700 dark:text-neutral-200 dark:hover:bg-neutral-800"
+          >
+            使用單一登入 (SSO)
+          </a>
+        )}
       </div>
     </div>
   );
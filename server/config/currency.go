@@ -0,0 +1,16 @@
+package config
+
+import (
+	"os"
+	"strings"
+)
+
+// DefaultCurrency 讀取環境變數 DEFAULT_CURRENCY (ISO 4217，例如 "TWD")
+// 用於沒有設定主要幣別的使用者，以及加入幣別之前建立的舊資料
+func DefaultCurrency() string {
+	currency := strings.ToUpper(strings.TrimSpace(os.Getenv("DEFAULT_CURRENCY")))
+	if len(currency) != 3 {
+		return "TWD"
+	}
+	return currency
+}
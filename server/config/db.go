@@ -53,39 +53,177 @@ func GetCollection(collectionName string) *mongo.Collection {
 	return DB.Database(DBName).Collection(collectionName)
 }
 
-// CreateIndexes 初始化資料庫索引
-func CreateIndexes() {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// CreateIndexes 初始化資料庫索引 (由 migrations 呼叫，可重複執行)
+// 個別索引失敗只記錄警告並繼續，最後回傳失敗的數量
+func CreateIndexes(ctx context.Context, db *mongo.Database) error {
+	failed := 0
+	coll := db.Collection("transactions")
 
-	coll := GetCollection("transactions")
-
-	// 1. Compound Index: Owner (Asc) + Date (Desc)
+	// 1. Compound Index: LedgerID (Asc) + Date (Desc)
 	// 用於: GetTransactions (sort by date), GetWeeklyHabits
 	_, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
 		Keys: bson.D{
-			{Key: "owner", Value: 1},
+			{Key: "ledger_id", Value: 1},
 			{Key: "date", Value: -1},
 		},
-		Options: options.Index().SetName("idx_owner_date"),
+		Options: options.Index().SetName("idx_ledger_date"),
 	})
 	if err != nil {
-		log.Printf("⚠️ 無法建立 idx_owner_date 索引: %v", err)
+		log.Printf("⚠️ 無法建立 idx_ledger_date 索引: %v", err)
+		failed++
 	}
 
-	// 2. Compound Index: Owner + Category + Date
+	// 2. Compound Index: LedgerID + Category + Date
 	// 用於: GetDashboardStats, GetCategoryStats (lookup)
 	_, err = coll.Indexes().CreateOne(ctx, mongo.IndexModel{
 		Keys: bson.D{
-			{Key: "owner", Value: 1},
+			{Key: "ledger_id", Value: 1},
 			{Key: "category_id", Value: 1},
 			{Key: "date", Value: -1},
 		},
-		Options: options.Index().SetName("idx_owner_cat_date"),
+		Options: options.Index().SetName("idx_ledger_cat_date"),
+	})
+	if err != nil {
+		log.Printf("⚠️ 無法建立 idx_ledger_cat_date 索引: %v", err)
+		failed++
+	}
+
+	// 3. Unique Index: users.username
+	// 用於: Login, AuthRequired (依帳號查詢使用者) 並避免重複註冊
+	_, err = db.Collection("users").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "username", Value: 1}},
+		Options: options.Index().SetName("idx_username").SetUnique(true),
 	})
 	if err != nil {
-		log.Printf("⚠️ 無法建立 idx_owner_cat_date 索引: %v", err)
+		log.Printf("⚠️ 無法建立 idx_username 索引: %v", err)
+		failed++
 	}
 
+	// 4. sessions: token_hash 唯一索引 + expires_at TTL 索引 (到期自動清除) + 依使用者列出
+	sessions := db.Collection("sessions")
+	_, err = sessions.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "token_hash", Value: 1}},
+		Options: options.Index().SetName("idx_token_hash").SetUnique(true),
+	})
+	if err != nil {
+		log.Printf("⚠️ 無法建立 idx_token_hash 索引: %v", err)
+		failed++
+	}
+	_, err = sessions.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetName("idx_expires_at").SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		log.Printf("⚠️ 無法建立 idx_expires_at 索引: %v", err)
+		failed++
+	}
+	_, err = sessions.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "username", Value: 1}, {Key: "last_seen_at", Value: -1}},
+		Options: options.Index().SetName("idx_username_last_seen"),
+	})
+	if err != nil {
+		log.Printf("⚠️ 無法建立 sessions idx_username_last_seen 索引: %v", err)
+		failed++
+	}
+
+	// 5. access_tokens: token_hash 唯一索引 (用於 Bearer 驗證)
+	_, err = db.Collection("access_tokens").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "token_hash", Value: 1}},
+		Options: options.Index().SetName("idx_token_hash").SetUnique(true),
+	})
+	if err != nil {
+		log.Printf("⚠️ 無法建立 access_tokens idx_token_hash 索引: %v", err)
+		failed++
+	}
+
+	// 6. login_challenges: 兩步驟驗證的短效 challenge，到期自動清除
+	challenges := db.Collection("login_challenges")
+	_, err = challenges.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "token_hash", Value: 1}},
+		Options: options.Index().SetName("idx_token_hash").SetUnique(true),
+	})
+	if err != nil {
+		log.Printf("⚠️ 無法建立 login_challenges idx_token_hash 索引: %v", err)
+		failed++
+	}
+	_, err = challenges.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetName("idx_expires_at").SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		log.Printf("⚠️ 無法建立 login_challenges idx_expires_at 索引: %v", err)
+		failed++
+	}
+
+	// 7. login_attempts: 最後一次失敗 24 小時後自動清除計數
+	_, err = db.Collection("login_attempts").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "last_failure_at", Value: 1}},
+		Options: options.Index().SetName("idx_last_failure_at").SetExpireAfterSeconds(24 * 60 * 60),
+	})
+	if err != nil {
+		log.Printf("⚠️ 無法建立 login_attempts idx_last_failure_at 索引: %v", err)
+		failed++
+	}
+
+	// 8. ledgers: 依成員查詢帳本
+	_, err = db.Collection("ledgers").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "members.username", Value: 1}},
+		Options: options.Index().SetName("idx_members_username"),
+	})
+	if err != nil {
+		log.Printf("⚠️ 無法建立 ledgers idx_members_username 索引: %v", err)
+		failed++
+	}
+
+	// 9. audit_log: 依帳本或操作者查詢稽核紀錄 (新到舊)
+	_, err = db.Collection("audit_log").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "ledger_id", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().SetName("idx_ledger_created_at"),
+		},
+		{
+			Keys:    bson.D{{Key: "actor", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().SetName("idx_actor_created_at"),
+		},
+	})
+	if err != nil {
+		log.Printf("⚠️ 無法建立 audit_log 索引: %v", err)
+		failed++
+	}
+
+	// 10. users: 外部身分 (issuer + subject) 只能連結到一個帳號
+	_, err = db.Collection("users").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "identities.issuer", Value: 1}, {Key: "identities.subject", Value: 1}},
+		Options: options.Index().
+			SetName("idx_identities").
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"identities.subject": bson.M{"$exists": true}}),
+	})
+	if err != nil {
+		log.Printf("⚠️ 無法建立 users idx_identities 索引: %v", err)
+		failed++
+	}
+
+	// 11. oidc_states: state 唯一索引 + 過期自動清除
+	oidcStates := db.Collection("oidc_states")
+	_, err = oidcStates.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "state_hash", Value: 1}},
+			Options: options.Index().SetName("idx_state_hash").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetName("idx_expires_at").SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		log.Printf("⚠️ 無法建立 oidc_states 索引: %v", err)
+		failed++
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d 個索引建立失敗", failed)
+	}
 	fmt.Println("✅ 資料庫索引初始化完成")
+	return nil
 }
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"os"
+	"strings"
+)
+
+// OIDCConfig 外部身分提供者 (OpenID Connect) 設定
+type OIDCConfig struct {
+	// IssuerURL: IdP 的 issuer，會從 {issuer}/.well-known/openid-configuration 取得端點
+	IssuerURL string
+	// ClientID / ClientSecret: 在 IdP 註冊的用戶端 (public client 可不設 secret，僅靠 PKCE)
+	ClientID     string
+	ClientSecret string
+	// RedirectURL: IdP 導回的網址，需指向 /api/v1/auth/oidc/callback
+	RedirectURL string
+	// Scopes: 要求的 scope，至少包含 openid
+	Scopes []string
+	// PostLoginURL: 登入完成後導向的前端頁面
+	PostLoginURL string
+	// AutoProvision: 第一次登入且尚未連結時是否自動建立帳號
+	AutoProvision bool
+}
+
+// Enabled 是否已設定 OIDC 登入
+func (c OIDCConfig) Enabled() bool {
+	return c.IssuerURL != "" && c.ClientID != "" && c.RedirectURL != ""
+}
+
+// OIDCSettings 讀取環境變數
+//   - OIDC_ISSUER_URL, OIDC_CLIENT_ID, OIDC_CLIENT_SECRET, OIDC_REDIRECT_URL (必要，secret 除外)
+//   - OIDC_SCOPES: 以空白或逗號分隔，預設 "openid profile email"
+//   - OIDC_POST_LOGIN_URL: 預設 "/"
+//   - OIDC_AUTO_PROVISION: 設為 false 時只允許已連結的帳號登入
+func OIDCSettings() OIDCConfig {
+	settings := OIDCConfig{
+		IssuerURL:     os.Getenv("OIDC_ISSUER_URL"),
+		ClientID:      os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret:  os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:   os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:        []string{"openid", "profile", "email"},
+		PostLoginURL:  os.Getenv("OIDC_POST_LOGIN_URL"),
+		AutoProvision: os.Getenv("OIDC_AUTO_PROVISION") != "false",
+	}
+
+	if scopes := strings.FieldsFunc(os.Getenv("OIDC_SCOPES"), func(r rune) bool {
+		return r == ' ' || r == ','
+	}); len(scopes) > 0 {
+		settings.Scopes = scopes
+		hasOpenID := false
+		for _, scope := range scopes {
+			if scope == "openid" {
+				hasOpenID = true
+			}
+		}
+		if !hasOpenID {
+			settings.Scopes = append([]string{"openid"}, scopes...)
+		}
+	}
+
+	if settings.PostLoginURL == "" {
+		settings.PostLoginURL = "/"
+	}
+
+	return settings
+}
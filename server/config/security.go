@@ -0,0 +1,56 @@
+package config
+
+import (
+	"net/http"
+	"os"
+	"strings"
+)
+
+// AllowedOrigins 讀取環境變數 ALLOWED_ORIGINS (逗號分隔)，例如 "https://fintrack.com,http://localhost:5173"
+// 同時用於 CORS 與 CSRF 的來源檢查
+func AllowedOrigins() []string {
+	allowOrigins := os.Getenv("ALLOWED_ORIGINS")
+	if allowOrigins == "" {
+		// 如果沒設定，預設只允許本機 (開發用)
+		return []string{"http://localhost:5173"}
+	}
+
+	var origins []string
+	for _, origin := range strings.Split(allowOrigins, ",") {
+		origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+		if origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// CookieSettings 工作階段 Cookie 的屬性
+type CookieSettings struct {
+	Domain   string
+	Secure   bool
+	SameSite http.SameSite
+}
+
+// SessionCookieSettings 讀取 Cookie 相關環境變數
+//   - COOKIE_SAMESITE: lax (預設) / strict / none
+//   - COOKIE_SECURE: true 時只透過 HTTPS 傳送 (SameSite=None 時強制為 true)
+//   - COOKIE_DOMAIN: 需要跨子網域共用時設定，預設為目前網域
+func SessionCookieSettings() CookieSettings {
+	settings := CookieSettings{
+		Domain:   os.Getenv("COOKIE_DOMAIN"),
+		Secure:   os.Getenv("COOKIE_SECURE") == "true",
+		SameSite: http.SameSiteLaxMode,
+	}
+
+	switch strings.ToLower(os.Getenv("COOKIE_SAMESITE")) {
+	case "strict":
+		settings.SameSite = http.SameSiteStrictMode
+	case "none":
+		// 瀏覽器不接受沒有 Secure 的 SameSite=None Cookie
+		settings.SameSite = http.SameSiteNoneMode
+		settings.Secure = true
+	}
+
+	return settings
+}
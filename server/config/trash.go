@@ -0,0 +1,17 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// TrashRetention 讀取環境變數 TRASH_RETENTION_DAYS (預設 30 天)
+// 垃圾桶中的資料超過這個天數後，會由每日排程永久刪除
+func TrashRetention() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("TRASH_RETENTION_DAYS"))
+	if err != nil || days <= 0 {
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
@@ -0,0 +1,237 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"server/config"
+	"server/models"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 個人存取權杖的權限範圍
+const (
+	ScopeRead              = "read"               // 只能讀取 (GET)
+	ScopeTransactionsWrite = "transactions:write" // 讀取 + 新增/修改/刪除交易
+	ScopeAdmin             = "admin"              // 等同登入後的完整權限
+)
+
+// 權杖前綴，方便在 log 或 secret scanner 中辨識
+const accessTokenPrefix = "ftk_"
+
+var errAccessTokenInvalid = errors.New("access token invalid")
+
+type CreateAccessTokenInput struct {
+	Name          string   `json:"name" binding:"required"`
+	Scopes        []string `json:"scopes" binding:"required"`
+	ExpiresInDays int      `json:"expires_in_days"` // 0 代表永不過期
+}
+
+func validScope(scope string) bool {
+	switch scope {
+	case ScopeRead, ScopeTransactionsWrite, ScopeAdmin:
+		return true
+	}
+	return false
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// bearerToken 從 Authorization: Bearer <token> 取出權杖
+func bearerToken(c *gin.Context) (string, bool) {
+	header := c.GetHeader("Authorization")
+	if header == "" {
+		return "", false
+	}
+	parts := strings.SplitN(header, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return "", false
+	}
+	token := strings.TrimSpace(parts[1])
+	return token, token != ""
+}
+
+// loadAccessToken 驗證權杖是否存在且未過期，並更新最後使用時間
+func loadAccessToken(ctx context.Context, token string) (models.AccessToken, error) {
+	collection := config.GetCollection("access_tokens")
+	var accessToken models.AccessToken
+	if err := collection.FindOne(ctx, bson.M{"token_hash": hashToken(token)}).Decode(&accessToken); err != nil {
+		return models.AccessToken{}, errAccessTokenInvalid
+	}
+
+	now := time.Now()
+	if accessToken.ExpiresAt != nil && now.After(*accessToken.ExpiresAt) {
+		return models.AccessToken{}, errAccessTokenInvalid
+	}
+
+	collection.UpdateOne(ctx, bson.M{"_id": accessToken.ID}, bson.M{"$set": bson.M{"last_used_at": now}})
+	return accessToken, nil
+}
+
+// tokenAllows 判斷權杖的 scope 是否允許目前的請求
+func tokenAllows(scopes []string, c *gin.Context) bool {
+	if hasScope(scopes, ScopeAdmin) {
+		return true
+	}
+
+	method := c.Request.Method
+	if method == http.MethodGet || method == http.MethodHead {
+		return hasScope(scopes, ScopeRead) || hasScope(scopes, ScopeTransactionsWrite)
+	}
+
+	if hasScope(scopes, ScopeTransactionsWrite) {
+		// 同時支援 /api/v1/transactions 與 /api/v1/ledgers/:ledgerId/transactions
+		path := c.FullPath()
+		return strings.HasPrefix(path, "/api/v1/transactions") || strings.HasPrefix(path, "/api/v1/ledgers/:ledgerId/transactions")
+	}
+	return false
+}
+
+// SessionRequired 只允許瀏覽器登入 (或 admin 權杖) 使用的 API，例如管理權杖本身
+func SessionRequired(c *gin.Context) {
+	if scopes, ok := c.Get("tokenScopes"); ok && !hasScope(scopes.([]string), ScopeAdmin) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "權限不足"})
+		return
+	}
+	c.Next()
+}
+
+// currentSessionID 取得目前請求的工作階段 ID (以權杖驗證時為 NilObjectID)
+func currentSessionID(c *gin.Context) primitive.ObjectID {
+	if id, ok := c.Get("sessionID"); ok {
+		return id.(primitive.ObjectID)
+	}
+	return primitive.NilObjectID
+}
+
+// GetAccessTokens 列出目前使用者的個人存取權杖 (不含權杖本身)
+func GetAccessTokens(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(string)
+	collection := config.GetCollection("access_tokens")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := collection.Find(ctx, bson.M{"username": currentUser}, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法讀取權杖"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var tokens []models.AccessToken
+	if err = cursor.All(ctx, &tokens); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "解析失敗"})
+		return
+	}
+
+	if tokens == nil {
+		tokens = []models.AccessToken{}
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// CreateAccessToken 建立個人存取權杖，原始權杖只會在建立時回傳一次
+func CreateAccessToken(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(string)
+	var input CreateAccessTokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "名稱不可為空"})
+		return
+	}
+	if len(input.Scopes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "至少需要一個 scope"})
+		return
+	}
+	for _, scope := range input.Scopes {
+		if !validScope(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "scope 必須是 read、transactions:write 或 admin"})
+			return
+		}
+	}
+	if input.ExpiresInDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_in_days 不可小於 0"})
+		return
+	}
+
+	secret, err := newSessionToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法產生權杖"})
+		return
+	}
+	token := accessTokenPrefix + secret
+
+	now := time.Now()
+	accessToken := models.AccessToken{
+		ID:        primitive.NewObjectID(),
+		Username:  currentUser,
+		Name:      name,
+		TokenHash: hashToken(token),
+		Prefix:    token[:len(accessTokenPrefix)+4],
+		Scopes:    input.Scopes,
+		CreatedAt: now,
+	}
+	if input.ExpiresInDays > 0 {
+		expiresAt := now.AddDate(0, 0, input.ExpiresInDays)
+		accessToken.ExpiresAt = &expiresAt
+	}
+
+	collection := config.GetCollection("access_tokens")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := collection.InsertOne(ctx, accessToken); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法寫入資料庫"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"token": token, "access_token": accessToken})
+}
+
+// RevokeAccessToken 撤銷個人存取權杖
+func RevokeAccessToken(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(string)
+	idParam := c.Param("id")
+	objID, err := primitive.ObjectIDFromHex(idParam)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的 ID"})
+		return
+	}
+
+	collection := config.GetCollection("access_tokens")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := collection.DeleteOne(ctx, bson.M{"_id": objID, "username": currentUser})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "撤銷失敗"})
+		return
+	}
+
+	if result.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到該權杖"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "權杖已撤銷"})
+}
@@ -0,0 +1,621 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"server/models"
+	"server/repository"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	maxBalanceDays   = 366 // 每日餘額最多回傳幾天
+	maxBalanceMonths = 120 // 每月餘額最多回傳幾個月
+)
+
+// accountResponse 帳戶資料加上目前餘額 (以帳戶幣別計算)
+type accountResponse struct {
+	models.Account
+	Balance models.Money `json:"balance" swaggertype:"number"`
+}
+
+// accountFlow 帳戶某一天的流入 (收入與轉入) 與流出 (支出與轉出)，以帳戶幣別計算
+type accountFlow struct {
+	Inflow  models.Money
+	Outflow models.Money
+}
+
+// validDate 檢查 "YYYY-MM-DD" 格式的日期
+func validDate(date string) bool {
+	_, err := time.Parse("2006-01-02", date)
+	return err == nil
+}
+
+// openingBalanceAt 回傳 date 當天計入的開帳餘額 (開帳日之前為 0)
+func openingBalanceAt(account models.Account, date string) models.Money {
+	if account.OpeningDate != "" && date < account.OpeningDate {
+		return 0
+	}
+	return account.OpeningBalance
+}
+
+// accountChanged 修改資料時是否改到另一個帳戶 (to 為 nil 代表不修改、零值代表不指定帳戶，兩者都不需要檢查帳戶)
+func accountChanged(from, to *primitive.ObjectID) bool {
+	if to == nil || to.IsZero() {
+		return false
+	}
+	return from == nil || *from != *to
+}
+
+// checkAccountUsable 檢查新增或修改資料時選擇的帳戶是否存在且未封存，不可使用時直接回應錯誤
+func (h *Handler) checkAccountUsable(ctx context.Context, c *gin.Context, ledgerID, accountID primitive.ObjectID) bool {
+	_, ok := h.usableAccount(ctx, c, ledgerID, accountID)
+	return ok
+}
+
+// usableAccount 與 checkAccountUsable 相同，並回傳帳戶
+func (h *Handler) usableAccount(ctx context.Context, c *gin.Context, ledgerID, accountID primitive.ObjectID) (models.Account, bool) {
+	account, err := h.accounts.Get(ctx, ledgerID, accountID)
+	if err == repository.ErrNotFound {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "找不到帳戶"})
+		return account, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法讀取帳戶"})
+		return account, false
+	}
+	if account.Archived {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "帳戶已封存，請選擇其他帳戶"})
+		return account, false
+	}
+	return account, true
+}
+
+// accountFlows 計算帳戶在 endDate (含) 之前每一天的流入與流出，金額以交易日的匯率換算成帳戶幣別
+// 開帳日之前的交易不計入；找不到匯率的金額不計入，幣別記錄在 missing
+func (h *Handler) accountFlows(ctx context.Context, ledgerID primitive.ObjectID, accounts []models.Account, endDate string, missing map[string]bool) (map[primitive.ObjectID]map[string]accountFlow, error) {
+	flows := make(map[primitive.ObjectID]map[string]accountFlow, len(accounts))
+	if len(accounts) == 0 {
+		return flows, nil
+	}
+
+	byID := make(map[primitive.ObjectID]models.Account, len(accounts))
+	ids := make([]primitive.ObjectID, 0, len(accounts))
+	for _, account := range accounts {
+		byID[account.ID] = account
+		ids = append(ids, account.ID)
+		flows[account.ID] = make(map[string]accountFlow)
+	}
+
+	totals, err := h.transactions.SumByAccount(ctx, repository.TransactionFilter{
+		LedgerID:   ledgerID,
+		EndDate:    endDate,
+		AccountIDs: ids,
+	})
+	if err != nil {
+		return nil, err
+	}
+	categories, err := h.categoryIndex(ctx, ledgerID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 每個幣別一個 converter，同一個請求內共用匯率快取
+	converters := make(map[string]*currencyConverter)
+	for _, total := range totals {
+		account, ok := byID[total.AccountID]
+		if !ok || (account.OpeningDate != "" && total.Date < account.OpeningDate) {
+			continue
+		}
+		// 轉帳依方向計入，一般交易依類別的型別
+		inflow := total.Kind == models.TransactionTransferIn
+		if total.Kind == "" {
+			category, ok := categories[total.CategoryID]
+			if !ok || (category.Type != "income" && category.Type != "expense") {
+				continue
+			}
+			inflow = category.Type == "income"
+		} else if total.Kind != models.TransactionTransferOut && !inflow {
+			continue
+		}
+
+		converter, ok := converters[account.Currency]
+		if !ok {
+			converter = h.converterTo(account.Currency)
+			converters[account.Currency] = converter
+		}
+		amount, ok := converter.convert(ctx, total.Total, total.Currency, total.Date)
+		if !ok {
+			continue
+		}
+
+		flow := flows[account.ID][total.Date]
+		if inflow {
+			flow.Inflow += amount
+		} else {
+			flow.Outflow += amount
+		}
+		flows[account.ID][total.Date] = flow
+	}
+
+	for _, converter := range converters {
+		for currency := range converter.missing {
+			missing[currency] = true
+		}
+	}
+	return flows, nil
+}
+
+// accountBalances 計算帳戶在 date 當天結束時的餘額 (開帳餘額 + 收入 + 轉入 - 支出 - 轉出)
+func (h *Handler) accountBalances(ctx context.Context, ledgerID primitive.ObjectID, accounts []models.Account, date string, missing map[string]bool) (map[primitive.ObjectID]models.Money, error) {
+	flows, err := h.accountFlows(ctx, ledgerID, accounts, date, missing)
+	if err != nil {
+		return nil, err
+	}
+	balances := make(map[primitive.ObjectID]models.Money, len(accounts))
+	for _, account := range accounts {
+		balance := openingBalanceAt(account, date)
+		for _, flow := range flows[account.ID] {
+			balance += flow.Inflow - flow.Outflow
+		}
+		balances[account.ID] = balance
+	}
+	return balances, nil
+}
+
+// writeMissingRates 有找不到匯率的幣別時寫入 X-Missing-Exchange-Rates
+func writeMissingRates(c *gin.Context, missing map[string]bool) {
+	converter := currencyConverter{missing: missing}
+	converter.writeMissingHeader(c)
+}
+
+// accountParam 讀取路徑中的帳戶並確認屬於此帳本，找不到時直接回應錯誤
+func (h *Handler) accountParam(ctx context.Context, c *gin.Context, ledgerID primitive.ObjectID) (models.Account, bool) {
+	objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的 ID"})
+		return models.Account{}, false
+	}
+	account, err := h.accounts.Get(ctx, ledgerID, objID)
+	if err == repository.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到帳戶"})
+		return account, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法讀取帳戶"})
+		return account, false
+	}
+	return account, true
+}
+
+// GetAccounts godoc
+// @Summary      取得帳戶列表
+// @Description  取得帳本的所有帳戶與今天的餘額 (預設不含已封存的帳戶，include_archived=true 時全部回傳)
+// @Tags         Accounts
+// @Produce      json
+// @Param        include_archived query bool false "是否包含已封存的帳戶"
+// @Success      200  {array}  accountResponse
+// @Router       /accounts [get]
+func (h *Handler) GetAccounts(c *gin.Context) {
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	accounts, err := h.accounts.List(ctx, ledgerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法讀取帳戶"})
+		return
+	}
+	if c.Query("include_archived") != "true" {
+		active := make([]models.Account, 0, len(accounts))
+		for _, account := range accounts {
+			if !account.Archived {
+				active = append(active, account)
+			}
+		}
+		accounts = active
+	}
+
+	missing := make(map[string]bool)
+	balances, err := h.accountBalances(ctx, ledgerID, accounts, time.Now().Format("2006-01-02"), missing)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "餘額計算失敗"})
+		return
+	}
+
+	response := make([]accountResponse, 0, len(accounts))
+	for _, account := range accounts {
+		response = append(response, accountResponse{Account: account, Balance: balances[account.ID]})
+	}
+
+	writeMissingRates(c, missing)
+	c.JSON(http.StatusOK, response)
+}
+
+// CreateAccount godoc
+// @Summary      新增帳戶
+// @Description  新增現金、銀行帳戶、信用卡或電子錢包，未指定幣別時使用使用者的主要幣別
+// @Tags         Accounts
+// @Accept       json
+// @Produce      json
+// @Param        account body models.Account true "帳戶資料"
+// @Success      200  {object}  models.Account
+// @Router       /accounts [post]
+func (h *Handler) CreateAccount(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(string)
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
+	var input models.Account
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "名稱不可為空"})
+		return
+	}
+	if !models.ValidAccountType(input.Type) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type 必須是 cash、bank、credit_card 或 e_wallet"})
+		return
+	}
+	if input.OpeningDate != "" && !validDate(input.OpeningDate) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "opening_date 格式錯誤，請使用 YYYY-MM-DD"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	currency, ok := h.resolveCurrency(ctx, c, input.Currency)
+	if !ok {
+		return
+	}
+
+	maxOrder, err := h.accounts.MaxOrder(ctx, ledgerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法取得排序資訊"})
+		return
+	}
+
+	input.ID = primitive.NewObjectID()
+	input.Currency = currency
+	input.Order = maxOrder + 1
+	input.Owner = currentUser
+	input.LedgerID = ledgerID
+	input.Archived = false
+	input.DeletedAt = nil
+	input.CreatedAt = time.Now()
+	input.UpdatedAt = time.Now()
+
+	if err := h.accounts.Create(ctx, input); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法寫入資料庫"})
+		return
+	}
+
+	h.recordAudit(ctx, c, AuditCreate, "account", input.ID, nil, input)
+
+	c.JSON(http.StatusOK, input)
+}
+
+// UpdateAccount godoc
+// @Summary      更新帳戶
+// @Description  更新帳戶內容、排序或封存狀態 (opening_date 傳空字串代表不限開帳日)
+// @Tags         Accounts
+// @Accept       json
+// @Produce      json
+// @Param        id   path      string  true  "帳戶 ID"
+// @Success      200  {object}  models.Account
+// @Router       /accounts/{id} [put]
+func (h *Handler) UpdateAccount(c *gin.Context) {
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
+	objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的 ID"})
+		return
+	}
+
+	var input struct {
+		Name           *string       `json:"name"`
+		Type           *string       `json:"type"`
+		Currency       *string       `json:"currency"`
+		OpeningBalance *models.Money `json:"opening_balance"`
+		OpeningDate    *string       `json:"opening_date"`
+		Order          *int          `json:"order"`
+		Archived       *bool         `json:"archived"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	changes := repository.AccountUpdate{
+		Type:           input.Type,
+		OpeningBalance: input.OpeningBalance,
+		OpeningDate:    input.OpeningDate,
+		Order:          input.Order,
+		Archived:       input.Archived,
+	}
+	if input.Name != nil {
+		trimmed := strings.TrimSpace(*input.Name)
+		if trimmed == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "名稱不可為空"})
+			return
+		}
+		changes.Name = &trimmed
+	}
+	if input.Type != nil && !models.ValidAccountType(*input.Type) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type 必須是 cash、bank、credit_card 或 e_wallet"})
+		return
+	}
+	if input.Currency != nil {
+		currency, err := models.NormalizeCurrency(*input.Currency)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "幣別格式錯誤，請使用 ISO 4217 代碼 (例如 TWD)"})
+			return
+		}
+		changes.Currency = &currency
+	}
+	if input.OpeningDate != nil && *input.OpeningDate != "" && !validDate(*input.OpeningDate) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "opening_date 格式錯誤，請使用 YYYY-MM-DD"})
+		return
+	}
+	if input.Order != nil && *input.Order < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "order 必須大於 0"})
+		return
+	}
+
+	if changes.Name == nil && changes.Type == nil && changes.Currency == nil && changes.OpeningBalance == nil &&
+		changes.OpeningDate == nil && changes.Order == nil && changes.Archived == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "沒有要更新的欄位"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// 只能修改此帳本的帳戶
+	before, after, err := h.accounts.Update(ctx, ledgerID, objID, changes)
+	if err == repository.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到帳戶"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改失敗"})
+		return
+	}
+
+	h.recordAudit(ctx, c, AuditUpdate, "account", objID, before, after)
+
+	c.JSON(http.StatusOK, after)
+}
+
+// DeleteAccount godoc
+// @Summary      刪除帳戶
+// @Description  將帳戶移到垃圾桶；仍有交易或固定支出使用此帳戶時回傳 409，請改為封存
+// @Tags         Accounts
+// @Produce      json
+// @Param        id   path      string  true  "帳戶 ID"
+// @Success      200  {object}  map[string]interface{}
+// @Router       /accounts/{id} [delete]
+func (h *Handler) DeleteAccount(c *gin.Context) {
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	account, ok := h.accountParam(ctx, c, ledgerID)
+	if !ok {
+		return
+	}
+
+	transactions, err := h.transactions.CountByAccount(ctx, ledgerID, account.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "刪除失敗"})
+		return
+	}
+	fixedExpenses, err := h.fixedExpenses.CountByAccount(ctx, ledgerID, account.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "刪除失敗"})
+		return
+	}
+	if transactions > 0 || fixedExpenses > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "仍有交易或固定支出使用此帳戶，請改為封存",
+			"dependents": gin.H{
+				"transactions":   transactions,
+				"fixed_expenses": fixedExpenses,
+			},
+		})
+		return
+	}
+
+	deleted, err := h.accounts.Delete(ctx, ledgerID, account.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "刪除失敗或無權限"})
+		return
+	}
+
+	h.recordAudit(ctx, c, AuditDelete, "account", account.ID, deleted, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "刪除成功"})
+}
+
+// GetAccountBalance godoc
+// @Summary      取得帳戶餘額
+// @Description  計算帳戶在指定日期 (預設今天) 結束時的餘額，以帳戶幣別表示
+// @Tags         Accounts
+// @Produce      json
+// @Param        id   path      string  true  "帳戶 ID"
+// @Param        date query     string  false "日期 (YYYY-MM-DD)"
+// @Success      200  {object}  map[string]interface{}
+// @Router       /accounts/{id}/balance [get]
+func (h *Handler) GetAccountBalance(c *gin.Context) {
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
+	date := c.DefaultQuery("date", time.Now().Format("2006-01-02"))
+	if !validDate(date) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date 格式錯誤，請使用 YYYY-MM-DD"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	account, ok := h.accountParam(ctx, c, ledgerID)
+	if !ok {
+		return
+	}
+
+	missing := make(map[string]bool)
+	balances, err := h.accountBalances(ctx, ledgerID, []models.Account{account}, date, missing)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "餘額計算失敗"})
+		return
+	}
+
+	writeMissingRates(c, missing)
+	c.JSON(http.StatusOK, gin.H{
+		"account_id": account.ID,
+		"date":       date,
+		"balance":    balances[account.ID],
+		"currency":   account.Currency,
+	})
+}
+
+// GetAccountBalanceHistory godoc
+// @Summary      取得帳戶餘額走勢
+// @Description  依日或月列出帳戶在每個區間結束時的餘額與區間內的流入、流出
+// @Description  預設 interval=day 為最近 30 天、interval=month 為最近 12 個月
+// @Tags         Accounts
+// @Produce      json
+// @Param        id         path   string true  "帳戶 ID"
+// @Param        start_date query  string false "開始日期 (YYYY-MM-DD)"
+// @Param        end_date   query  string false "結束日期 (YYYY-MM-DD)，預設今天"
+// @Param        interval   query  string false "day 或 month"
+// @Success      200  {object}  map[string]interface{}
+// @Router       /accounts/{id}/balance/history [get]
+func (h *Handler) GetAccountBalanceHistory(c *gin.Context) {
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
+	location := time.Now().Location()
+
+	interval := c.DefaultQuery("interval", "day")
+	if interval != "day" && interval != "month" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "interval 必須是 day 或 month"})
+		return
+	}
+
+	now := time.Now()
+	end := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location)
+	if raw := c.Query("end_date"); raw != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", raw, location)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "end_date 格式錯誤，請使用 YYYY-MM-DD"})
+			return
+		}
+		end = parsed
+	}
+
+	var start time.Time
+	if raw := c.Query("start_date"); raw != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", raw, location)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "start_date 格式錯誤，請使用 YYYY-MM-DD"})
+			return
+		}
+		start = parsed
+	} else if interval == "day" {
+		start = end.AddDate(0, 0, -29)
+	} else {
+		start = time.Date(end.Year(), end.Month()-11, 1, 0, 0, 0, 0, location)
+	}
+	if start.After(end) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "start_date 不可晚於 end_date"})
+		return
+	}
+
+	// 每個區間的開始與結束日 (月份的第一個區間從該月 1 日開始，最後一個區間到 end_date 為止)
+	type period struct {
+		label      string
+		start, end time.Time
+	}
+	var periods []period
+	if interval == "day" {
+		for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+			if len(periods) == maxBalanceDays {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "日期區間過長，interval=day 最多 366 天"})
+				return
+			}
+			periods = append(periods, period{label: day.Format("2006-01-02"), start: day, end: day})
+		}
+	} else {
+		for month := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, location); !month.After(end); month = month.AddDate(0, 1, 0) {
+			if len(periods) == maxBalanceMonths {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "日期區間過長，interval=month 最多 120 個月"})
+				return
+			}
+			monthEnd := month.AddDate(0, 1, -1)
+			if monthEnd.After(end) {
+				monthEnd = end
+			}
+			periods = append(periods, period{label: month.Format("2006-01"), start: month, end: monthEnd})
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	account, ok := h.accountParam(ctx, c, ledgerID)
+	if !ok {
+		return
+	}
+
+	missing := make(map[string]bool)
+	flows, err := h.accountFlows(ctx, ledgerID, []models.Account{account}, end.Format("2006-01-02"), missing)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "餘額計算失敗"})
+		return
+	}
+	dailyFlows := flows[account.ID]
+	dates := make([]string, 0, len(dailyFlows))
+	for date := range dailyFlows {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+
+	// 依日期順序累加流入與流出，區間開始前的交易只計入餘額
+	var running models.Money
+	next := 0
+	points := make([]gin.H, 0, len(periods))
+	for _, p := range periods {
+		periodStart := p.start.Format("2006-01-02")
+		periodEnd := p.end.Format("2006-01-02")
+		var inflow, outflow models.Money
+		for ; next < len(dates) && dates[next] <= periodEnd; next++ {
+			flow := dailyFlows[dates[next]]
+			running += flow.Inflow - flow.Outflow
+			if dates[next] >= periodStart {
+				inflow += flow.Inflow
+				outflow += flow.Outflow
+			}
+		}
+		points = append(points, gin.H{
+			"period":  p.label,
+			"date":    periodEnd,
+			"balance": openingBalanceAt(account, periodEnd) + running,
+			"inflow":  inflow,
+			"outflow": outflow,
+		})
+	}
+
+	writeMissingRates(c, missing)
+	c.JSON(http.StatusOK, gin.H{
+		"account_id": account.ID,
+		"currency":   account.Currency,
+		"interval":   interval,
+		"points":     points,
+	})
+}
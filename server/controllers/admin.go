@@ -0,0 +1,448 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"server/config"
+	"server/migrations"
+	"server/models"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AdminRequired 只允許 admin 角色的使用者 (需接在 AuthRequired 之後)
+func AdminRequired(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(string)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := findUser(ctx, currentUser)
+	if err != nil || user.Role != models.RoleAdmin {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "需要管理員權限"})
+		return
+	}
+	c.Next()
+}
+
+// EnsureAdminUsers 將環境變數 ADMIN_USERS (逗號分隔) 中的帳號設為 admin
+func EnsureAdminUsers() {
+	raw := os.Getenv("ADMIN_USERS")
+	if raw == "" {
+		return
+	}
+
+	var usernames []string
+	for _, name := range strings.Split(raw, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			usernames = append(usernames, name)
+		}
+	}
+	if len(usernames) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := config.GetCollection("users").UpdateMany(ctx,
+		bson.M{"username": bson.M{"$in": usernames}},
+		bson.M{"$set": bson.M{"role": models.RoleAdmin}},
+	)
+	if err != nil {
+		log.Printf("⚠️ 無法設定管理員帳號: %v", err)
+	}
+}
+
+// UnlockUser 清除帳號的登入失敗紀錄，立即解除鎖定
+func UnlockUser(c *gin.Context) {
+	username := c.Param("username")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := config.GetCollection("login_attempts").DeleteOne(ctx, bson.M{"_id": userAttemptKey(username)}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "解除鎖定失敗"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已解除鎖定"})
+}
+
+// guestUsername 是共用的展示帳號
+const guestUsername = "guest"
+
+type AdminCreateUserInput struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	Role     string `json:"role"`
+}
+
+type AdminUpdateUserInput struct {
+	Role     *string `json:"role"`
+	Disabled *bool   `json:"disabled"`
+}
+
+type AdminResetPasswordInput struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// validUserRole 檢查使用者角色是否合法
+func validUserRole(role string) bool {
+	return role == models.RoleUser || role == models.RoleAdmin
+}
+
+// guestPassword 重設展示帳號時使用的密碼 (環境變數 GUEST_PASSWORD，預設沿用舊版密碼)
+func guestPassword() string {
+	if password := os.Getenv("GUEST_PASSWORD"); password != "" {
+		return password
+	}
+	return migrations.LegacyUsers[guestUsername]
+}
+
+// countByOwner 統計各使用者建立的資料筆數
+func countByOwner(ctx context.Context, collection string) (map[string]int64, error) {
+	cursor, err := config.GetCollection(collection).Aggregate(ctx, mongo.Pipeline{
+		// 垃圾桶中的資料不計入
+		{{Key: "$match", Value: bson.M{"deleted_at": nil}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$owner"},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		Owner string `bson:"_id"`
+		Count int64  `bson:"count"`
+	}
+	if err = cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(results))
+	for _, r := range results {
+		counts[r.Owner] = r.Count
+	}
+	return counts, nil
+}
+
+// revokeUserAccess 撤銷使用者所有工作階段與存取權杖 (停用、重設密碼時使用)
+func revokeUserAccess(ctx context.Context, username string) {
+	if err := revokeUserSessions(ctx, username, primitive.NilObjectID); err != nil {
+		log.Printf("⚠️ 無法撤銷使用者 %s 的工作階段: %v", username, err)
+	}
+	if _, err := config.GetCollection("access_tokens").DeleteMany(ctx, bson.M{"username": username}); err != nil {
+		log.Printf("⚠️ 無法撤銷使用者 %s 的存取權杖: %v", username, err)
+	}
+}
+
+// wipeUserData 清空使用者獨自擁有的帳本資料 (交易、類別、預算、固定支出)
+// 與他人共用的帳本不會被清除，避免誤刪其他成員的資料
+func wipeUserData(ctx context.Context, username string) (int64, error) {
+	cursor, err := config.GetCollection("ledgers").Find(ctx, bson.M{"members.username": username})
+	if err != nil {
+		return 0, err
+	}
+	var ledgers []models.Ledger
+	if err = cursor.All(ctx, &ledgers); err != nil {
+		return 0, err
+	}
+
+	var deleted int64
+	for _, ledger := range ledgers {
+		if len(ledger.Members) != 1 {
+			continue
+		}
+		for _, name := range ledgerCollections {
+			result, err := config.GetCollection(name).DeleteMany(ctx, bson.M{"ledger_id": ledger.ID})
+			if err != nil {
+				return deleted, err
+			}
+			deleted += result.DeletedCount
+		}
+	}
+	return deleted, nil
+}
+
+// GetUsers 列出所有使用者與各自的資料筆數
+func GetUsers(c *gin.Context) {
+	collection := config.GetCollection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "username", Value: 1}}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法讀取使用者"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var users []models.User
+	if err = cursor.All(ctx, &users); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "資料解析失敗"})
+		return
+	}
+
+	counts := make(map[string]map[string]int64)
+	for _, name := range []string{"transactions", "categories", "fixed_expenses"} {
+		byOwner, err := countByOwner(ctx, name)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "統計資料筆數失敗"})
+			return
+		}
+		counts[name] = byOwner
+	}
+
+	response := make([]gin.H, 0, len(users))
+	for _, user := range users {
+		response = append(response, gin.H{
+			"id":           user.ID.Hex(),
+			"username":     user.Username,
+			"role":         user.Role,
+			"disabled":     user.Disabled,
+			"totp_enabled": user.TOTPEnabled,
+			"has_password": user.PasswordHash != "",
+			"identities":   len(user.Identities),
+			"created_at":   user.CreatedAt,
+			"usage": gin.H{
+				"transactions":   counts["transactions"][user.Username],
+				"categories":     counts["categories"][user.Username],
+				"fixed_expenses": counts["fixed_expenses"][user.Username],
+			},
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// AdminCreateUser 由管理員建立帳號 (不受 ALLOW_SIGNUP 限制)
+func AdminCreateUser(c *gin.Context) {
+	var input AdminCreateUserInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "請輸入帳號密碼"})
+		return
+	}
+
+	username := strings.TrimSpace(input.Username)
+	if username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "帳號不可為空"})
+		return
+	}
+	if len(input.Password) < minPasswordLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "密碼長度至少 8 個字元"})
+		return
+	}
+	if input.Role == "" {
+		input.Role = models.RoleUser
+	}
+	if !validUserRole(input.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role 必須是 user 或 admin"})
+		return
+	}
+
+	hash, err := HashPassword(input.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法處理密碼"})
+		return
+	}
+
+	user := models.User{
+		ID:           primitive.NewObjectID(),
+		Username:     username,
+		PasswordHash: hash,
+		Role:         input.Role,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := config.GetCollection("users").InsertOne(ctx, user); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "帳號已存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法建立帳號"})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// AdminUpdateUser 修改角色或停用/啟用帳號
+func AdminUpdateUser(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(string)
+	username := c.Param("username")
+
+	var input AdminUpdateUserInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updateFields := bson.M{"updated_at": time.Now()}
+	if input.Role != nil {
+		if !validUserRole(*input.Role) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "role 必須是 user 或 admin"})
+			return
+		}
+		updateFields["role"] = *input.Role
+	}
+	if input.Disabled != nil {
+		updateFields["disabled"] = *input.Disabled
+	}
+	if len(updateFields) == 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "沒有要更新的欄位"})
+		return
+	}
+
+	// 避免管理員把自己鎖在外面
+	if username == currentUser && ((input.Role != nil && *input.Role != models.RoleAdmin) || (input.Disabled != nil && *input.Disabled)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不能停用自己或移除自己的管理員權限"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := config.GetCollection("users").UpdateOne(ctx, bson.M{"username": username}, bson.M{"$set": updateFields})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失敗"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到使用者"})
+		return
+	}
+
+	// 停用後立即登出所有裝置
+	if input.Disabled != nil && *input.Disabled {
+		revokeUserAccess(ctx, username)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "更新成功"})
+}
+
+// AdminResetPassword 重設使用者密碼，並登出該使用者所有裝置
+func AdminResetPassword(c *gin.Context) {
+	username := c.Param("username")
+	var input AdminResetPasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "請輸入新密碼"})
+		return
+	}
+	if len(input.Password) < minPasswordLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "密碼長度至少 8 個字元"})
+		return
+	}
+
+	hash, err := HashPassword(input.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法處理密碼"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := config.GetCollection("users").UpdateOne(ctx,
+		bson.M{"username": username},
+		bson.M{"$set": bson.M{"password_hash": hash, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "重設密碼失敗"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到使用者"})
+		return
+	}
+
+	revokeUserAccess(ctx, username)
+
+	c.JSON(http.StatusOK, gin.H{"message": "密碼已重設"})
+}
+
+// WipeUserData 清空使用者的資料 (帳號本身保留)
+func WipeUserData(c *gin.Context) {
+	username := c.Param("username")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if _, err := findUser(ctx, username); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到使用者"})
+		return
+	}
+
+	deleted, err := wipeUserData(ctx, username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "清除資料失敗"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "資料已清除", "deleted": deleted})
+}
+
+// ResetGuest 將展示帳號還原為初始狀態：清空資料、還原密碼、關閉兩步驟驗證並登出所有裝置
+func ResetGuest(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	hash, err := HashPassword(guestPassword())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法處理密碼"})
+		return
+	}
+
+	now := time.Now()
+	_, err = config.GetCollection("users").UpdateOne(ctx,
+		bson.M{"username": guestUsername},
+		bson.M{
+			"$set": bson.M{
+				"password_hash": hash,
+				"role":          models.RoleUser,
+				"totp_enabled":  false,
+				"updated_at":    now,
+			},
+			"$unset": bson.M{
+				"disabled":       "",
+				"totp_secret":    "",
+				"totp_last_step": "",
+				"recovery_codes": "",
+				"identities":     "",
+			},
+			"$setOnInsert": bson.M{
+				"_id":        primitive.NewObjectID(),
+				"username":   guestUsername,
+				"created_at": now,
+			},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "重設展示帳號失敗"})
+		return
+	}
+
+	deleted, err := wipeUserData(ctx, guestUsername)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "清除資料失敗"})
+		return
+	}
+
+	revokeUserAccess(ctx, guestUsername)
+	config.GetCollection("login_attempts").DeleteOne(ctx, bson.M{"_id": userAttemptKey(guestUsername)})
+
+	c.JSON(http.StatusOK, gin.H{"message": "展示帳號已重設", "deleted": deleted})
+}
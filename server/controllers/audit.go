@@ -0,0 +1,186 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"server/config"
+	"server/models"
+	"server/repository"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 稽核紀錄的 action
+const (
+	AuditCreate      = "create"
+	AuditUpdate      = "update"
+	AuditDelete      = "delete"
+	AuditRestore     = "restore" // 從垃圾桶復原
+	AuditPurge       = "purge"   // 從垃圾桶永久刪除
+	AuditMerge       = "merge"   // 類別或標籤合併到另一個類別或標籤
+	AuditLogin       = "login"
+	AuditLoginFailed = "login_failed"
+	AuditLogout      = "logout"
+)
+
+// 系統排程產生資料時的 actor
+const auditSystemActor = "system"
+
+// insertAuditLog 寫入稽核紀錄；失敗只記 log，不影響原本的操作
+func insertAuditLog(ctx context.Context, logs repository.AuditLogRepository, entry models.AuditLog) {
+	entry.ID = primitive.NewObjectID()
+	entry.CreatedAt = time.Now()
+	if err := logs.Insert(ctx, entry); err != nil {
+		log.Printf("⚠️ 無法寫入稽核紀錄 (%s %s %s): %v", entry.Actor, entry.Action, entry.Entity, err)
+	}
+}
+
+// authAuditLogs 登入、登出等帳號流程不經過 Handler，直接寫入 MongoDB 的 audit_log
+func authAuditLogs() repository.AuditLogRepository {
+	return repository.NewMongoRepositories(config.DB.Database(config.DBName)).AuditLogs
+}
+
+// recordAudit 記錄一次資料異動，actor 與帳本取自目前請求
+func (h *Handler) recordAudit(ctx context.Context, c *gin.Context, action, entity string, entityID primitive.ObjectID, before, after interface{}) {
+	h.recordAuditKey(ctx, c, action, entity, entityID.Hex(), before, after)
+}
+
+// recordAuditKey 與 recordAudit 相同，但資料以字串識別 (例如標籤名稱)
+func (h *Handler) recordAuditKey(ctx context.Context, c *gin.Context, action, entity, entityID string, before, after interface{}) {
+	entry := models.AuditLog{
+		Action:    action,
+		Entity:    entity,
+		EntityID:  entityID,
+		Actor:     c.GetString("currentUser"),
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Before:    before,
+		After:     after,
+	}
+	if id, ok := c.Get("ledgerID"); ok {
+		ledgerID := id.(primitive.ObjectID)
+		entry.LedgerID = &ledgerID
+	}
+	insertAuditLog(ctx, h.auditLogs, entry)
+}
+
+// recordAuthEvent 記錄登入、登出等帳號事件 (登入失敗時沒有工作階段 ID)
+func recordAuthEvent(ctx context.Context, c *gin.Context, action, username string, sessionID primitive.ObjectID) {
+	entry := models.AuditLog{
+		Action:    action,
+		Entity:    "session",
+		Actor:     username,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+	if !sessionID.IsZero() {
+		entry.EntityID = sessionID.Hex()
+	}
+	insertAuditLog(ctx, authAuditLogs(), entry)
+}
+
+// queryAuditLogs 依查詢參數篩選、分頁並回傳稽核紀錄
+// 支援: action, entity, entity_id, actor, start, end (YYYY-MM-DD), page, limit
+func queryAuditLogs(c *gin.Context, filter bson.M) {
+	collection := config.GetCollection("audit_log")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	page := 1
+	limit := 50
+	if p, err := strconv.Atoi(c.Query("page")); err == nil && p > 0 {
+		page = p
+	}
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	if limit > 200 {
+		limit = 200
+	}
+
+	for _, key := range []string{"action", "entity", "entity_id", "actor"} {
+		if value := c.Query(key); value != "" {
+			filter[key] = value
+		}
+	}
+
+	start := c.Query("start")
+	end := c.Query("end")
+	if start != "" || end != "" {
+		dateFilter := bson.M{}
+		if start != "" {
+			t, err := time.ParseInLocation("2006-01-02", start, time.Local)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "start 格式錯誤，請使用 YYYY-MM-DD"})
+				return
+			}
+			dateFilter["$gte"] = t
+		}
+		if end != "" {
+			t, err := time.ParseInLocation("2006-01-02", end, time.Local)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "end 格式錯誤，請使用 YYYY-MM-DD"})
+				return
+			}
+			// end 當天也包含在內
+			dateFilter["$lt"] = t.AddDate(0, 0, 1)
+		}
+		filter["created_at"] = dateFilter
+	}
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法計算總數"})
+		return
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit))
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法讀取稽核紀錄"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var logs []models.AuditLog
+	if err = cursor.All(ctx, &logs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "資料解析失敗"})
+		return
+	}
+
+	if logs == nil {
+		logs = []models.AuditLog{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": logs,
+		"meta": gin.H{
+			"total":       total,
+			"page":        page,
+			"limit":       limit,
+			"total_pages": (int(total) + limit - 1) / limit,
+		},
+	})
+}
+
+// GetAuditLogs 取得目前帳本的資料異動紀錄
+func GetAuditLogs(c *gin.Context) {
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
+	queryAuditLogs(c, bson.M{"ledger_id": ledgerID})
+}
+
+// GetAuthAuditLogs 取得自己的登入、登出紀錄
+func GetAuthAuditLogs(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(string)
+	queryAuditLogs(c, bson.M{"actor": currentUser, "entity": "session"})
+}
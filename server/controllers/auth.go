@@ -1,26 +1,66 @@
 package controllers
 
 import (
+	"context"
+	"log"
 	"net/http"
+	"os"
+	"server/config"
+	"server/models"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
 )
 
-// 1. 定義多組使用者 (帳號 -> 密碼)
-var USERS = map[string]string{
-	"chongzhe": "20001025Jonas",
-	"yunchen":  "20000722Jenny",
-	"moon":     "19670706Moon",
-	"guest":    "guest123456",
-}
-
 const COOKIE_NAME = "fintrack_session"
 
+// 密碼最短長度
+const minPasswordLength = 8
+
 type LoginInput struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
 }
 
+type ChangePasswordInput struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+type DeleteAccountInput struct {
+	// Password: 只用外部身分登入 (沒有密碼) 的帳號不需要
+	Password string `json:"password"`
+}
+
+// HashPassword 使用 bcrypt 產生密碼雜湊
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func checkPassword(user models.User, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) == nil
+}
+
+func findUser(ctx context.Context, username string) (models.User, error) {
+	var user models.User
+	err := config.GetCollection("users").FindOne(ctx, bson.M{"username": username}).Decode(&user)
+	return user, err
+}
+
+// signupEnabled 是否開放自行註冊 (環境變數 ALLOW_SIGNUP=true)
+func signupEnabled() bool {
+	return os.Getenv("ALLOW_SIGNUP") == "true"
+}
+
 // Login 登入
 func Login(c *gin.Context) {
 	var input LoginInput
@@ -29,59 +69,296 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	// 2. 檢查帳號是否存在，以及密碼是否正確
-	validPassword, exists := USERS[input.Username]
-	if !exists || validPassword != input.Password {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// 1. 暴力破解防護 (帳號或 IP 失敗次數過多時暫時拒絕)，並檢查帳號密碼
+	user, result, wait := passwordLogin(ctx, mongoLoginAttempts{}, findUser, input, c.ClientIP(), time.Now())
+	switch result {
+	case loginLocked:
+		abortLoginLocked(c, wait)
+		return
+	case loginFailed:
+		recordAuthEvent(ctx, c, AuditLoginFailed, input.Username, primitive.NilObjectID)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "帳號或密碼錯誤"})
 		return
+	case loginDisabled:
+		c.JSON(http.StatusForbidden, gin.H{"error": "帳號已停用"})
+		return
+	case loginNeedsSecondFactor:
+		// 2. 已啟用兩步驟驗證：先回傳短效 challenge，由 VerifyLogin 完成登入
+		challenge, err := createLoginChallenge(ctx, user.Username)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "無法建立登入狀態"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"mfa_required": true, "challenge": challenge})
+		return
+	}
+
+	// 3. 登入成功：建立伺服器端工作階段，Cookie 只存放隨機 token
+	session, err := createSession(ctx, c, user.Username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法建立登入狀態"})
+		return
+	}
+	recordAuthEvent(ctx, c, AuditLogin, user.Username, session.ID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "登入成功", "user": user.Username})
+}
+
+// Register 註冊新帳號 (需設定 ALLOW_SIGNUP=true)
+func Register(c *gin.Context) {
+	if !signupEnabled() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "目前未開放註冊"})
+		return
+	}
+
+	var input LoginInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "請輸入帳號密碼"})
+		return
+	}
+
+	username := strings.TrimSpace(input.Username)
+	if username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "帳號不可為空"})
+		return
+	}
+	if len(input.Password) < minPasswordLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "密碼長度至少 8 個字元"})
+		return
+	}
+
+	hash, err := HashPassword(input.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法處理密碼"})
+		return
+	}
+
+	user := models.User{
+		ID:           primitive.NewObjectID(),
+		Username:     username,
+		PasswordHash: hash,
+		Role:         models.RoleUser,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// users.username 有唯一索引，重複註冊會回傳 duplicate key
+	if _, err := config.GetCollection("users").InsertOne(ctx, user); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "帳號已存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法建立帳號"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "註冊成功", "user": user.Username})
+}
+
+// ChangePassword 修改目前登入者的密碼
+func ChangePassword(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(string)
+	var input ChangePasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "請輸入舊密碼與新密碼"})
+		return
+	}
+	if len(input.NewPassword) < minPasswordLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "密碼長度至少 8 個字元"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := findUser(ctx, currentUser)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到使用者"})
+		return
+	}
+	// 只用外部身分登入的帳號沒有舊密碼，可以直接設定
+	if user.PasswordHash != "" && !checkPassword(user, input.OldPassword) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "舊密碼錯誤"})
+		return
 	}
 
-	// 3. 登入成功：將「使用者名稱」存入 Cookie
-	// SetCookie(name, value, maxAge(秒), path, domain, secure, httpOnly)
-	// 3600*24*7 = 7天過期
-	// HttpOnly=true: 防止 XSS 攻擊 (JS 讀不到)
-	c.SetCookie(COOKIE_NAME, input.Username, 3600*24*7, "/", "", false, true)
+	hash, err := HashPassword(input.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法處理密碼"})
+		return
+	}
+
+	_, err = config.GetCollection("users").UpdateOne(ctx,
+		bson.M{"_id": user.ID},
+		bson.M{"$set": bson.M{"password_hash": hash, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改密碼失敗"})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "登入成功", "user": input.Username})
+	// 密碼變更後，其他裝置上的登入狀態全部失效
+	if err := revokeUserSessions(ctx, currentUser, currentSessionID(c)); err != nil {
+		log.Printf("⚠️ 無法撤銷使用者 %s 的其他工作階段: %v", currentUser, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "密碼已更新"})
+}
+
+// DeleteAccount 刪除目前登入者的帳號，並退出所有帳本
+func DeleteAccount(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(string)
+	var input DeleteAccountInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "請輸入密碼確認"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, err := findUser(ctx, currentUser)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到使用者"})
+		return
+	}
+	if !confirmAccountOwner(c, user, input.Password, time.Now()) {
+		return
+	}
+
+	// 先退出所有帳本 (只有自己的帳本會連同資料刪除)，再刪除帳號本身
+	if err := leaveAllLedgers(ctx, currentUser); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "刪除資料失敗"})
+		return
+	}
+
+	if _, err := config.GetCollection("users").DeleteOne(ctx, bson.M{"_id": user.ID}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "刪除帳號失敗"})
+		return
+	}
+
+	if err := revokeUserSessions(ctx, currentUser, primitive.NilObjectID); err != nil {
+		log.Printf("⚠️ 無法撤銷使用者 %s 的工作階段: %v", currentUser, err)
+	}
+	if _, err := config.GetCollection("access_tokens").DeleteMany(ctx, bson.M{"username": currentUser}); err != nil {
+		log.Printf("⚠️ 無法撤銷使用者 %s 的存取權杖: %v", currentUser, err)
+	}
+
+	clearSessionCookie(c)
+	c.JSON(http.StatusOK, gin.H{"message": "帳號已刪除"})
+}
+
+// confirmAccountOwner 刪除帳號前確認是本人操作
+// 有密碼的帳號需輸入密碼；只用外部身分登入的帳號沒有密碼，改為要求剛登入 (或剛重新以外部身分驗證) 的瀏覽器工作階段
+func confirmAccountOwner(c *gin.Context, user models.User, password string, now time.Time) bool {
+	if user.PasswordHash != "" {
+		if !checkPassword(user, password) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "密碼錯誤"})
+			return false
+		}
+		return true
+	}
+
+	createdAt, ok := c.Get("sessionCreatedAt")
+	if !ok || now.Sub(createdAt.(time.Time)) > reauthMaxAge {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "請重新登入後再刪除帳號", "reauth_required": true})
+		return false
+	}
+	return true
 }
 
 // Logout 登出
 func Logout(c *gin.Context) {
-	// 將 Cookie 時間設為 -1 即為刪除
-	c.SetCookie(COOKIE_NAME, "", -1, "/", "", false, true)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// 伺服器端也要讓工作階段失效，避免舊 Cookie 被重複使用
+	if session, err := loadSession(ctx, c); err == nil {
+		if err := revokeSession(ctx, session.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "登出失敗"})
+			return
+		}
+		recordAuthEvent(ctx, c, AuditLogout, session.Username, session.ID)
+	}
+
+	clearSessionCookie(c)
 	c.JSON(http.StatusOK, gin.H{"message": "已登出"})
 }
 
 // CheckAuth 檢查登入狀態 (給前端用)
 func CheckAuth(c *gin.Context) {
-	username, err := c.Cookie(COOKIE_NAME)
-	if err != nil || username == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"authenticated": false})
-		return
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	session, err := loadSession(ctx, c)
+	var user models.User
+	if err == nil {
+		user, err = findUser(ctx, session.Username)
 	}
-	if _, exists := USERS[username]; !exists {
+	if err != nil || user.Disabled {
 		c.JSON(http.StatusUnauthorized, gin.H{"authenticated": false})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"authenticated": true, "user": username})
+	baseCurrency := user.BaseCurrency
+	if baseCurrency == "" {
+		baseCurrency = config.DefaultCurrency()
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"authenticated": true,
+		"user":          session.Username,
+		"base_currency": baseCurrency,
+	})
+}
+
+// activeUser 帳號仍存在且未停用 (停用或刪除後，既有的工作階段與權杖立即失效)
+func activeUser(ctx context.Context, username string) bool {
+	user, err := findUser(ctx, username)
+	return err == nil && !user.Disabled
 }
 
 // Middleware: AuthRequired
+// 支援兩種驗證方式：Authorization: Bearer <個人存取權杖>，或瀏覽器的工作階段 Cookie
 func AuthRequired(c *gin.Context) {
-	username, err := c.Cookie(COOKIE_NAME)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-	// 如果沒有 Cookie 或內容不對，直接擋下
-	if err != nil || username == "" {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "未授權"})
+	if token, ok := bearerToken(c); ok {
+		accessToken, err := loadAccessToken(ctx, token)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "未授權"})
+			return
+		}
+		if !activeUser(ctx, accessToken.Username) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "未授權"})
+			return
+		}
+		if !tokenAllows(accessToken.Scopes, c) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "權杖權限不足"})
+			return
+		}
+
+		c.Set("currentUser", accessToken.Username)
+		c.Set("tokenScopes", accessToken.Scopes)
+		c.Next()
 		return
 	}
 
-	if _, exists := USERS[username]; !exists {
+	// 如果沒有 Cookie、token 無效或已過期，直接擋下
+	session, err := loadSession(ctx, c)
+	if err != nil || !activeUser(ctx, session.Username) {
 		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "未授權"})
 		return
 	}
 
 	// 把 currentUser 存入 Context，讓後面的 API 知道是誰在操作
-	c.Set("currentUser", username)
+	c.Set("currentUser", session.Username)
+	c.Set("sessionID", session.ID)
+	c.Set("sessionCreatedAt", session.CreatedAt)
 	c.Next() // 通過驗證，繼續執行
 }
@@ -3,52 +3,76 @@ package controllers
 import (
 	"context"
 	"net/http"
-	"server/config"
 	"server/models"
+	"server/repository"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // SetBudget 新增或修改預算 (Upsert: 同月份同類別則更新，否則新增)
-func SetBudget(c *gin.Context) {
+func (h *Handler) SetBudget(c *gin.Context) {
 	currentUser := c.MustGet("currentUser").(string)
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
 	var input models.Budget
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	input.Owner = currentUser
-	collection := config.GetCollection("budgets")
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	// 搜尋條件：同一個月 + 同一個類別
-	filter := bson.M{
-		"category":   input.Category,
-		"year_month": input.YearMonth,
-		"owner":      currentUser,
+	// 未指定幣別時使用使用者的主要幣別
+	currency, ok := h.resolveCurrency(ctx, c, input.Currency)
+	if !ok {
+		return
+	}
+
+	input.Owner = currentUser
+	input.LedgerID = ledgerID
+	input.Currency = currency
+	input.DeletedAt = nil
+
+	// 已封存的類別只能修改既有的預算
+	category, err := h.categories.Get(ctx, ledgerID, input.CategoryID)
+	if err == repository.ErrNotFound {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "找不到類別"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法讀取類別"})
+		return
+	}
+	if category.Archived {
+		if _, err := h.budgets.Find(ctx, ledgerID, input.YearMonth, input.CategoryID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "類別已封存，請選擇其他類別"})
+			return
+		}
 	}
-	update := bson.M{"$set": input}
-	opts := options.Update().SetUpsert(true)
 
-	_, err := collection.UpdateOne(ctx, filter, update, opts)
+	// 同一個月 + 同一個類別則更新，新增時 before 為 nil (供稽核紀錄使用)
+	before, after, err := h.budgets.Upsert(ctx, input)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "設定預算失敗"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "預算已儲存"})
+	if before == nil {
+		h.recordAudit(ctx, c, AuditCreate, "budget", after.ID, nil, after)
+	} else {
+		h.recordAudit(ctx, c, AuditUpdate, "budget", after.ID, before, after)
+	}
+
+	after.CategoryName = category.Name
+	after.CategoryType = category.Type
+	c.JSON(http.StatusOK, gin.H{"message": "預算已儲存", "data": after})
 }
 
 // DeleteBudget 刪除預算
-func DeleteBudget(c *gin.Context) {
-	currentUser := c.MustGet("currentUser").(string)
+func (h *Handler) DeleteBudget(c *gin.Context) {
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
 	idParam := c.Param("id")
 	objID, err := primitive.ObjectIDFromHex(idParam)
 	if err != nil {
@@ -56,37 +80,40 @@ func DeleteBudget(c *gin.Context) {
 		return
 	}
 
-	collection := config.GetCollection("budgets")
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	filter := bson.M{"_id": objID, "owner": currentUser}
-	_, err = collection.DeleteOne(ctx, filter)
-	if err != nil {
+	deleted, err := h.budgets.Delete(ctx, ledgerID, objID)
+	if err != nil && err != repository.ErrNotFound {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "刪除失敗"})
 		return
 	}
+	if err == nil {
+		h.recordAudit(ctx, c, AuditDelete, "budget", objID, deleted, nil)
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "刪除成功"})
 }
 
 // GetBudgetStatus 取得指定月份的預算執行狀況
-func GetBudgetStatus(c *gin.Context) {
-	currentUser := c.MustGet("currentUser").(string)
+// 上層類別的支出包含所有子類別；view=tree 時子類別的預算放在最近一個有預算的上層類別的 children 中
+func (h *Handler) GetBudgetStatus(c *gin.Context) {
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
 	// 讀取月份參數，預設為當月 (格式 2026-01)
 	queryMonth := c.DefaultQuery("month", time.Now().Format("2006-01"))
+	view, ok := statsView(c)
+	if !ok {
+		return
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	// 1. 取得該月份設定的所有預算
-	budgetColl := config.GetCollection("budgets")
-	cursor, err := budgetColl.Find(ctx, bson.M{"year_month": queryMonth, "owner": currentUser})
+	budgets, err := h.budgets.ListByMonth(ctx, ledgerID, queryMonth)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法讀取預算"})
 		return
 	}
-	var budgets []models.Budget
-	cursor.All(ctx, &budgets)
 
 	// 若該月無預算，回傳空陣列
 	if len(budgets) == 0 {
@@ -94,120 +121,125 @@ func GetBudgetStatus(c *gin.Context) {
 		return
 	}
 
-	// 2. 取得有預算的類別名稱列表
-	categoryNames := make([]string, 0, len(budgets))
-	for _, b := range budgets {
-		categoryNames = append(categoryNames, b.Category)
-	}
-
-	// 3. 取得類別 ID 映射 (Name -> ID)
-	catColl := config.GetCollection("categories")
-	catCursor, err := catColl.Find(ctx, bson.M{"owner": currentUser, "name": bson.M{"$in": categoryNames}})
+	// 2. 取得預算所屬的類別 (已封存的類別也包含在內)
+	categories, err := h.categoryIndex(ctx, ledgerID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法讀取分類資料"})
 		return
 	}
-	defer catCursor.Close(ctx)
-
-	var categories []models.Category
-	if err = catCursor.All(ctx, &categories); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "解析分類資料失敗"})
-		return
-	}
-
-	catIDMap := make(map[string]primitive.ObjectID, len(categories))
-	catTypeMap := make(map[string]string, len(categories))
-	categoryIDs := make([]primitive.ObjectID, 0, len(categories))
 
-	for _, cat := range categories {
-		catIDMap[cat.Name] = cat.ID
-		catTypeMap[cat.Name] = cat.Type
-		categoryIDs = append(categoryIDs, cat.ID)
+	// 3. 只統計有設定預算的支出類別與其子類別
+	tree := newCategoryTree(categories)
+	var categoryIDs []primitive.ObjectID
+	counted := make(map[primitive.ObjectID]bool)
+	for _, b := range budgets {
+		if category, ok := categories[b.CategoryID]; !ok || category.Type == "income" {
+			continue
+		}
+		for _, id := range append([]primitive.ObjectID{b.CategoryID}, tree.descendants(b.CategoryID)...) {
+			if !counted[id] {
+				counted[id] = true
+				categoryIDs = append(categoryIDs, id)
+			}
+		}
 	}
 
 	// 4. 一次性聚合查詢：計算所有相關類別的本月支出總和
 	parseTime, _ := time.Parse("2006-01", queryMonth)
 	startStr := parseTime.Format("2006-01-02")
-	endStr := parseTime.AddDate(0, 1, 0).Format("2006-01-02")
-
-	transColl := config.GetCollection("transactions")
-	pipeline := mongo.Pipeline{
-		{{Key: "$match", Value: bson.D{
-			{Key: "owner", Value: currentUser},
-			{Key: "category_id", Value: bson.M{"$in": categoryIDs}},
-			{Key: "date", Value: bson.D{
-				{Key: "$gte", Value: startStr},
-				{Key: "$lt", Value: endStr},
-			}},
-		}}},
-		{{Key: "$group", Value: bson.D{
-			{Key: "_id", Value: "$category_id"},
-			{Key: "total", Value: bson.D{{Key: "$sum", Value: "$amount"}}},
-		}}},
-	}
-
-	// 使用索引優化查詢
-	opts := options.Aggregate().SetHint("idx_owner_cat_date")
-
-	cursorAgg, err := transColl.Aggregate(ctx, pipeline, opts)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "統計預算失敗"})
-		return
-	}
-	var aggResults []struct {
-		CategoryID primitive.ObjectID `bson:"_id"`
-		Total      float64            `bson:"total"`
-	}
-	if err = cursorAgg.All(ctx, &aggResults); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "解析統計失敗"})
-		return
-	}
+	endStr := parseTime.AddDate(0, 1, -1).Format("2006-01-02")
+
+	// 各幣別依交易日期的匯率換算成主要幣別
+	converter := h.newConverter(ctx, c)
 
 	// 轉為 Map 方便查找
-	expenseMap := make(map[primitive.ObjectID]float64)
-	for _, res := range aggResults {
-		expenseMap[res.CategoryID] = res.Total
+	expenseMap := make(map[primitive.ObjectID]models.Money)
+	if len(categoryIDs) > 0 {
+		sums, err := h.transactions.SumByCategory(ctx, repository.TransactionFilter{
+			LedgerID:    ledgerID,
+			StartDate:   startStr,
+			EndDate:     endStr,
+			CategoryIDs: categoryIDs,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "統計預算失敗"})
+			return
+		}
+		for _, res := range converter.convertTotals(ctx, sums) {
+			expenseMap[res.CategoryID] += res.Total
+		}
+	}
+	// 上層類別的支出包含子類別
+	expenseMap = rollUp(tree, expenseMap)
+
+	// 預算上限以月底 (當月則為今天) 的匯率換算成主要幣別
+	limitDate := endStr
+	if today := time.Now().Format("2006-01-02"); today < limitDate {
+		limitDate = today
 	}
 
 	// 5. 組裝回傳資料
 	var statusList []gin.H
+	byCategory := make(map[primitive.ObjectID]gin.H, len(budgets))
+	budgetCategoryIDs := make([]primitive.ObjectID, 0, len(budgets))
 
 	for _, b := range budgets {
-		catType := catTypeMap[b.Category]
-
-		// 收入類別不計算預算消耗
-		if catType == "income" {
-			statusList = append(statusList, gin.H{
-				"id":         b.ID.Hex(),
-				"category":   b.Category,
-				"limit":      b.Amount,
-				"spent":      0.0,
-				"percentage": 0.0,
-				"year_month": b.YearMonth,
-			})
-			continue
+		category := categories[b.CategoryID]
+		limit, converted := converter.convert(ctx, b.Amount, b.Currency, limitDate)
+		currency := converter.base
+		if !converted {
+			// 找不到匯率時維持原幣別金額，並由 header 提示
+			limit = b.Amount
+			currency = b.Currency
 		}
 
-		catID, ok := catIDMap[b.Category]
-		spent := 0.0
-		if ok {
-			spent = expenseMap[catID]
+		// 收入類別不計算預算消耗；上限無法換算時與支出的幣別不同，percentage 為 null
+		spent := models.Money(0)
+		percentage := new(float64)
+		if category.Type != "income" {
+			spent = expenseMap[b.CategoryID]
+			if !converted {
+				percentage = nil
+			} else if limit > 0 {
+				*percentage = float64(spent) / float64(limit) * 100
+			}
 		}
 
-		percentage := 0.0
-		if b.Amount > 0 {
-			percentage = (spent / b.Amount) * 100
+		status := gin.H{
+			"id":            b.ID.Hex(),
+			"category_id":   b.CategoryID.Hex(),
+			"category":      category.Name,
+			"category_type": category.Type,
+			"limit":         limit,
+			"spent":         spent,
+			"percentage":    percentage,
+			"year_month":    b.YearMonth,
+			"currency":      currency,
 		}
-
-		statusList = append(statusList, gin.H{
-			"id":         b.ID.Hex(),
-			"category":   b.Category,
-			"limit":      b.Amount,
-			"spent":      spent,
-			"percentage": percentage,
-			"year_month": b.YearMonth,
+		if !converted {
+			status["spent_currency"] = converter.base
+		}
+		if parent, ok := tree.parent(b.CategoryID); ok {
+			status["parent_id"] = parent.Hex()
+		}
+		statusList = append(statusList, status)
+		byCategory[b.CategoryID] = status
+		budgetCategoryIDs = append(budgetCategoryIDs, b.CategoryID)
+	}
+
+	if view == viewTree {
+		statusList = nestCategories(tree, budgetCategoryIDs, func(a, b primitive.ObjectID) bool {
+			if categories[a].Order != categories[b].Order {
+				return categories[a].Order < categories[b].Order
+			}
+			return categories[a].Name < categories[b].Name
+		}, func(id primitive.ObjectID, children []gin.H) gin.H {
+			status := byCategory[id]
+			status["children"] = children
+			return status
 		})
 	}
 
+	converter.writeMissingHeader(c)
 	c.JSON(http.StatusOK, statusList)
 }
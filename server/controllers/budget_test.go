@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"server/models"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestBudgetStatusWithoutExchangeRate(t *testing.T) {
+	t.Setenv("DEFAULT_CURRENCY", "TWD")
+	l := newTestLedger(t)
+	ctx := context.Background()
+	food := l.category("餐飲", "expense")
+	travel := l.category("旅遊", "expense")
+	gifts := l.category("禮物", "expense")
+
+	if err := l.repos.ExchangeRates.Upsert(ctx, models.ExchangeRate{Date: "2026-03-01", Base: "USD", Quote: "TWD", Rate: 32}); err != nil {
+		t.Fatal(err)
+	}
+	for _, budget := range []models.Budget{
+		{CategoryID: food, Amount: models.NewMoneyFromFloat(1000), Currency: "TWD"},
+		{CategoryID: gifts, Amount: models.NewMoneyFromFloat(100), Currency: "USD"},
+		{CategoryID: travel, Amount: models.NewMoneyFromFloat(500), Currency: "EUR"},
+	} {
+		budget.ID = primitive.NewObjectID()
+		budget.YearMonth = "2026-03"
+		budget.LedgerID = l.ledgerID
+		if _, _, err := l.repos.Budgets.Upsert(ctx, budget); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l.transaction(food, 250, "2026-03-05")
+	l.transaction(gifts, 800, "2026-03-06")
+	l.transaction(travel, 100, "2026-03-07")
+
+	var statuses []struct {
+		CategoryID    string   `json:"category_id"`
+		Limit         float64  `json:"limit"`
+		Spent         float64  `json:"spent"`
+		Percentage    *float64 `json:"percentage"`
+		Currency      string   `json:"currency"`
+		SpentCurrency string   `json:"spent_currency"`
+	}
+	l.do(http.MethodGet, "/budgets/status?month=2026-03", nil, http.StatusOK, &statuses)
+	if len(statuses) != 3 {
+		t.Fatalf("got %d budgets, want 3", len(statuses))
+	}
+
+	for _, status := range statuses {
+		switch status.CategoryID {
+		case food.Hex(), gifts.Hex():
+			// 可以換算的預算以主要幣別回傳上限與百分比
+			wantLimit := map[string]float64{food.Hex(): 1000, gifts.Hex(): 3200}[status.CategoryID]
+			wantPercentage := map[string]float64{food.Hex(): 25, gifts.Hex(): 25}[status.CategoryID]
+			if status.Currency != "TWD" || status.Limit != wantLimit || status.Percentage == nil || *status.Percentage != wantPercentage || status.SpentCurrency != "" {
+				t.Errorf("budget %s = %+v, want limit %v TWD at %v%%", status.CategoryID, status, wantLimit, wantPercentage)
+			}
+		case travel.Hex():
+			// 找不到 EUR 匯率：上限維持 EUR，支出仍是 TWD，不計算百分比
+			if status.Currency != "EUR" || status.Limit != 500 || status.Spent != 100 || status.SpentCurrency != "TWD" || status.Percentage != nil {
+				t.Errorf("budget without a rate = %+v, want limit 500 EUR, spent 100 TWD and no percentage", status)
+			}
+		}
+	}
+}
@@ -2,58 +2,42 @@ package controllers
 
 import (
 	"context"
+	"fmt"
 	"net/http"
-	"server/config"
 	"server/models"
+	"server/repository"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// GetCategories 取得所有類別
-func GetCategories(c *gin.Context) {
+// GetCategories 取得所有類別 (預設不含已封存的類別，include_archived=true 時全部回傳)
+func (h *Handler) GetCategories(c *gin.Context) {
 	currentUser := c.MustGet("currentUser").(string)
-	collection := config.GetCollection("categories")
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	filter := bson.M{"owner": currentUser}
-	opts := options.Find().SetSort(bson.D{{Key: "order", Value: 1}, {Key: "name", Value: 1}})
-	cursor, err := collection.Find(ctx, filter, opts)
+	categories, err := h.categories.List(ctx, ledgerID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法讀取類別"})
 		return
 	}
-	defer cursor.Close(ctx)
-
-	var categories []models.Category
-	if err = cursor.All(ctx, &categories); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "解析失敗"})
-		return
-	}
 
 	if len(categories) == 0 {
 		defaults := []models.Category{
-			{ID: primitive.NewObjectID(), Name: "🍛 餐飲", Type: "expense", Order: 1, Owner: currentUser},
-			{ID: primitive.NewObjectID(), Name: "🚘 交通", Type: "expense", Order: 2, Owner: currentUser},
-			{ID: primitive.NewObjectID(), Name: "🛍️ 購物", Type: "expense", Order: 3, Owner: currentUser},
-			{ID: primitive.NewObjectID(), Name: "🏠 居住", Type: "expense", Order: 4, Owner: currentUser},
-			{ID: primitive.NewObjectID(), Name: "🎬 娛樂", Type: "expense", Order: 5, Owner: currentUser},
-			{ID: primitive.NewObjectID(), Name: "💊 醫療", Type: "expense", Order: 6, Owner: currentUser},
-			{ID: primitive.NewObjectID(), Name: "💰 薪水", Type: "income", Order: 7, Owner: currentUser},
+			{ID: primitive.NewObjectID(), Name: "🍛 餐飲", Type: "expense", Order: 1, Owner: currentUser, LedgerID: ledgerID},
+			{ID: primitive.NewObjectID(), Name: "🚘 交通", Type: "expense", Order: 2, Owner: currentUser, LedgerID: ledgerID},
+			{ID: primitive.NewObjectID(), Name: "🛍️ 購物", Type: "expense", Order: 3, Owner: currentUser, LedgerID: ledgerID},
+			{ID: primitive.NewObjectID(), Name: "🏠 居住", Type: "expense", Order: 4, Owner: currentUser, LedgerID: ledgerID},
+			{ID: primitive.NewObjectID(), Name: "🎬 娛樂", Type: "expense", Order: 5, Owner: currentUser, LedgerID: ledgerID},
+			{ID: primitive.NewObjectID(), Name: "💊 醫療", Type: "expense", Order: 6, Owner: currentUser, LedgerID: ledgerID},
+			{ID: primitive.NewObjectID(), Name: "💰 薪水", Type: "income", Order: 7, Owner: currentUser, LedgerID: ledgerID},
 		}
 
-		var docs []interface{}
-		for _, d := range defaults {
-			docs = append(docs, d)
-		}
-
-		if _, err := collection.InsertMany(ctx, docs); err != nil {
+		if err := h.categories.CreateMany(ctx, defaults); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "無法初始化預設類別"})
 			return
 		}
@@ -62,12 +46,41 @@ func GetCategories(c *gin.Context) {
 		return
 	}
 
+	if c.Query("include_archived") != "true" {
+		active := make([]models.Category, 0, len(categories))
+		for _, category := range categories {
+			if !category.Archived {
+				active = append(active, category)
+			}
+		}
+		categories = active
+	}
+
 	c.JSON(http.StatusOK, categories)
 }
 
+// checkCategoryUsable 檢查新增或修改資料時選擇的類別是否存在且未封存，不可使用時直接回應錯誤
+func (h *Handler) checkCategoryUsable(ctx context.Context, c *gin.Context, ledgerID, categoryID primitive.ObjectID) bool {
+	category, err := h.categories.Get(ctx, ledgerID, categoryID)
+	if err == repository.ErrNotFound {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "找不到類別"})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法讀取類別"})
+		return false
+	}
+	if category.Archived {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "類別已封存，請選擇其他類別"})
+		return false
+	}
+	return true
+}
+
 // CreateCategory 新增類別
-func CreateCategory(c *gin.Context) {
+func (h *Handler) CreateCategory(c *gin.Context) {
 	currentUser := c.MustGet("currentUser").(string)
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
 	var input models.Category
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -76,39 +89,51 @@ func CreateCategory(c *gin.Context) {
 
 	input.ID = primitive.NewObjectID()
 	input.Owner = currentUser
-	collection := config.GetCollection("categories")
+	input.LedgerID = ledgerID
+	input.Archived = false
+	input.DeletedAt = nil
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	if input.ParentID != nil {
+		categories, err := h.categoryIndex(ctx, ledgerID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "無法讀取類別"})
+			return
+		}
+		tree := newCategoryTree(categories)
+		if msg := validateCategoryParent(tree, primitive.NilObjectID, *input.ParentID, input.Type); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+		// 未指定型別時沿用上層類別
+		if input.Type == "" {
+			input.Type = categories[*input.ParentID].Type
+		}
+	}
+
 	if input.Order <= 0 {
-		var last models.Category
-		err := collection.FindOne(
-			ctx,
-			bson.M{"owner": currentUser},
-			options.FindOne().SetSort(bson.D{{Key: "order", Value: -1}}),
-		).Decode(&last)
-		if err != nil && err != mongo.ErrNoDocuments {
+		maxOrder, err := h.categories.MaxOrder(ctx, ledgerID)
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "無法取得排序資訊"})
 			return
 		}
-		if err == mongo.ErrNoDocuments {
-			input.Order = 1
-		} else {
-			input.Order = last.Order + 1
-		}
+		input.Order = maxOrder + 1
 	}
 
-	_, err := collection.InsertOne(ctx, input)
-	if err != nil {
+	if err := h.categories.Create(ctx, input); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法寫入資料庫"})
 		return
 	}
+
+	h.recordAudit(ctx, c, AuditCreate, "category", input.ID, nil, input)
+
 	c.JSON(http.StatusOK, input)
 }
 
 // UpdateCategory 修改類別內容
-func UpdateCategory(c *gin.Context) {
-	currentUser := c.MustGet("currentUser").(string)
+func (h *Handler) UpdateCategory(c *gin.Context) {
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
 	idParam := c.Param("id")
 	objID, err := primitive.ObjectIDFromHex(idParam)
 	if err != nil {
@@ -120,80 +145,229 @@ func UpdateCategory(c *gin.Context) {
 		Name  *string `json:"name"`
 		Type  *string `json:"type"`
 		Order *int    `json:"order"`
+		// ParentID: 空字串代表移到最上層
+		ParentID *string `json:"parent_id"`
 	}
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	catCollection := config.GetCollection("categories")
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	var oldCategory models.Category
-	err = catCollection.FindOne(ctx, bson.M{"_id": objID, "owner": currentUser}).Decode(&oldCategory)
+	categories, err := h.categoryIndex(ctx, ledgerID)
 	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法讀取類別"})
+		return
+	}
+	current, ok := categories[objID]
+	if !ok {
 		c.JSON(http.StatusNotFound, gin.H{"error": "找不到類別"})
 		return
 	}
+	tree := newCategoryTree(categories)
 
-	updateFields := bson.M{}
+	changes := repository.CategoryUpdate{Type: input.Type, Order: input.Order}
 	if input.Name != nil {
 		trimmed := strings.TrimSpace(*input.Name)
 		if trimmed == "" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "名稱不可為空"})
 			return
 		}
-		updateFields["name"] = trimmed
+		changes.Name = &trimmed
 	}
 	if input.Type != nil {
 		if *input.Type != "income" && *input.Type != "expense" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "type 必須是 income 或 expense"})
 			return
 		}
-		updateFields["type"] = *input.Type
 	}
 	if input.Order != nil {
 		if *input.Order < 1 {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "order 必須大於 0"})
 			return
 		}
-		updateFields["order"] = *input.Order
 	}
-	if len(updateFields) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "沒有要更新的欄位"})
+	if input.ParentID != nil {
+		parentID := primitive.NilObjectID
+		if *input.ParentID != "" {
+			if parentID, err = primitive.ObjectIDFromHex(*input.ParentID); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "無效的上層類別 ID"})
+				return
+			}
+		}
+		changes.ParentID = &parentID
+	}
+
+	// 子類別的型別必須與上層相同
+	newType := current.Type
+	if changes.Type != nil {
+		newType = *changes.Type
+	}
+	if changes.ParentID != nil && !changes.ParentID.IsZero() {
+		if msg := validateCategoryParent(tree, objID, *changes.ParentID, newType); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+	} else if changes.ParentID == nil && newType != current.Type {
+		if parent, ok := tree.parent(objID); ok && categories[parent].Type != "" && categories[parent].Type != newType {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "子類別的型別必須與上層類別相同"})
+			return
+		}
+	}
+	if newType != current.Type && len(tree.children[objID]) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "有子類別的類別不可修改型別"})
 		return
 	}
 
-	// 只能修改自己的類別
-	filter := bson.M{"_id": objID, "owner": currentUser}
-	update := bson.M{"$set": updateFields}
+	if changes.Name == nil && changes.Type == nil && changes.Order == nil && changes.ParentID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "沒有要更新的欄位"})
+		return
+	}
 
-	result, err := catCollection.UpdateOne(ctx, filter, update)
-	if err != nil || result.MatchedCount == 0 {
+	// 只能修改此帳本的類別
+	oldCategory, newCategory, err := h.categories.Update(ctx, ledgerID, objID, changes)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改失敗或無權限"})
 		return
 	}
 
-	newName := oldCategory.Name
-	if input.Name != nil {
-		newName = strings.TrimSpace(*input.Name)
+	h.recordAudit(ctx, c, AuditUpdate, "category", objID, oldCategory, newCategory)
+
+	c.JSON(http.StatusOK, gin.H{"message": "修改成功"})
+}
+
+// categoryDependents 參照某個類別的資料筆數 (包含垃圾桶中的資料)
+type categoryDependents struct {
+	Transactions  int64 `json:"transactions"`
+	FixedExpenses int64 `json:"fixed_expenses"`
+	Budgets       int64 `json:"budgets"`
+	Children      int64 `json:"children"`
+}
+
+func (d categoryDependents) empty() bool {
+	return d.Transactions == 0 && d.FixedExpenses == 0 && d.Budgets == 0 && d.Children == 0
+}
+
+func (h *Handler) countCategoryDependents(ctx context.Context, ledgerID primitive.ObjectID, category models.Category) (categoryDependents, error) {
+	var counts categoryDependents
+	var err error
+	if counts.Transactions, err = h.transactions.CountByCategory(ctx, ledgerID, category.ID); err != nil {
+		return counts, err
+	}
+	if counts.FixedExpenses, err = h.fixedExpenses.CountByCategory(ctx, ledgerID, category.ID); err != nil {
+		return counts, err
+	}
+	if counts.Budgets, err = h.budgets.CountByCategory(ctx, ledgerID, category.ID); err != nil {
+		return counts, err
+	}
+	categories, err := h.categoryIndex(ctx, ledgerID)
+	if err != nil {
+		return counts, err
 	}
-	if oldCategory.Name != newName {
-		budgetCollection := config.GetCollection("budgets")
+	counts.Children = int64(len(newCategoryTree(categories).children[category.ID]))
+	return counts, nil
+}
 
-		budgetCollection.UpdateMany(ctx,
-			bson.M{"category": oldCategory.Name, "owner": currentUser},
-			bson.M{"$set": bson.M{"category": newName}},
-		)
+// mergeTarget 讀取並檢查合併的目標類別，不可使用時直接回應錯誤
+func (h *Handler) mergeTarget(ctx context.Context, c *gin.Context, ledgerID primitive.ObjectID, source models.Category, targetHex string) (models.Category, bool) {
+	targetID, err := primitive.ObjectIDFromHex(targetHex)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的目標類別 ID"})
+		return models.Category{}, false
+	}
+	if targetID == source.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "目標類別不可與原類別相同"})
+		return models.Category{}, false
+	}
+	target, err := h.categories.Get(ctx, ledgerID, targetID)
+	if err == repository.ErrNotFound {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "找不到目標類別"})
+		return target, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法讀取類別"})
+		return target, false
+	}
+	if target.Archived {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "目標類別已封存"})
+		return target, false
+	}
+	if source.Type != "" && target.Type != "" && source.Type != target.Type {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "收入與支出類別不可合併"})
+		return target, false
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "修改成功"})
+	// source 的子類別會移到 target 底下
+	categories, err := h.categoryIndex(ctx, ledgerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法讀取類別"})
+		return target, false
+	}
+	tree := newCategoryTree(categories)
+	for _, descendant := range tree.descendants(source.ID) {
+		if descendant == target.ID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "目標類別不可為原類別的子類別"})
+			return target, false
+		}
+	}
+	for _, child := range tree.children[source.ID] {
+		if tree.depth(target.ID)+tree.height(child) > maxCategoryDepth {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("子類別移到目標類別底下後會超過 %d 層", maxCategoryDepth)})
+			return target, false
+		}
+	}
+	return target, true
+}
+
+// mergeCategory 將 source 的交易、固定支出、預算與子類別移到 target，再把 source 移到垃圾桶
+// 預算同月份 target 已有設定時，source 的預算移到垃圾桶
+func (h *Handler) mergeCategory(ctx context.Context, c *gin.Context, ledgerID primitive.ObjectID, source, target models.Category) (gin.H, error) {
+	categories, err := h.categoryIndex(ctx, ledgerID)
+	if err != nil {
+		return nil, err
+	}
+	children := newCategoryTree(categories).children[source.ID]
+	for _, child := range children {
+		if _, _, err := h.categories.Update(ctx, ledgerID, child, repository.CategoryUpdate{ParentID: &target.ID}); err != nil {
+			return nil, err
+		}
+	}
+
+	transactions, err := h.transactions.ReassignCategory(ctx, ledgerID, source.ID, target.ID)
+	if err != nil {
+		return nil, err
+	}
+	fixedExpenses, err := h.fixedExpenses.ReassignCategory(ctx, ledgerID, source.ID, target.ID)
+	if err != nil {
+		return nil, err
+	}
+	budgetsMoved, budgetsTrashed, err := h.budgets.MergeCategory(ctx, ledgerID, source.ID, target.ID)
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := h.categories.Delete(ctx, ledgerID, source.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := gin.H{
+		"target_id":       target.ID,
+		"transactions":    transactions,
+		"fixed_expenses":  fixedExpenses,
+		"budgets_moved":   budgetsMoved,
+		"budgets_trashed": budgetsTrashed,
+		"children":        len(children),
+	}
+	h.recordAudit(ctx, c, AuditMerge, "category", source.ID, deleted, result)
+	return result, nil
 }
 
 // DeleteCategory 刪除類別
-func DeleteCategory(c *gin.Context) {
-	currentUser := c.MustGet("currentUser").(string)
+// 仍有交易、固定支出、預算或子類別使用此類別時必須指定 target_id，這些資料會先移到目標類別 (等同合併)
+func (h *Handler) DeleteCategory(c *gin.Context) {
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
 	idParam := c.Param("id")
 	objID, err := primitive.ObjectIDFromHex(idParam)
 	if err != nil {
@@ -201,18 +375,125 @@ func DeleteCategory(c *gin.Context) {
 		return
 	}
 
-	collection := config.GetCollection("categories")
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	// 只能刪除自己的類別
-	filter := bson.M{"_id": objID, "owner": currentUser}
+	// 只能刪除此帳本的類別
+	category, err := h.categories.Get(ctx, ledgerID, objID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到類別"})
+		return
+	}
+
+	if targetHex := c.Query("target_id"); targetHex != "" {
+		target, ok := h.mergeTarget(ctx, c, ledgerID, category, targetHex)
+		if !ok {
+			return
+		}
+		result, err := h.mergeCategory(ctx, c, ledgerID, category, target)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "刪除失敗"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "刪除成功", "moved": result})
+		return
+	}
+
+	dependents, err := h.countCategoryDependents(ctx, ledgerID, category)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "刪除失敗"})
+		return
+	}
+	if !dependents.empty() {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":      "仍有資料使用此類別，請指定 target_id 將資料移到其他類別",
+			"dependents": dependents,
+		})
+		return
+	}
 
-	result, err := collection.DeleteOne(ctx, filter)
-	if err != nil || result.DeletedCount == 0 {
+	deleted, err := h.categories.Delete(ctx, ledgerID, objID)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "刪除失敗或無權限"})
 		return
 	}
 
+	h.recordAudit(ctx, c, AuditDelete, "category", objID, deleted, nil)
+
 	c.JSON(http.StatusOK, gin.H{"message": "刪除成功"})
 }
+
+// MergeCategory 將類別合併到另一個類別 (body: {"target_id": "..."})，原類別會移到垃圾桶
+func (h *Handler) MergeCategory(c *gin.Context) {
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
+	objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的 ID"})
+		return
+	}
+
+	var input struct {
+		TargetID string `json:"target_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	source, err := h.categories.Get(ctx, ledgerID, objID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到類別"})
+		return
+	}
+	target, ok := h.mergeTarget(ctx, c, ledgerID, source, input.TargetID)
+	if !ok {
+		return
+	}
+
+	result, err := h.mergeCategory(ctx, c, ledgerID, source, target)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "合併失敗"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "合併成功", "moved": result})
+}
+
+// ArchiveCategory 封存類別 (不再出現在選單中，既有資料與報表不受影響)
+func (h *Handler) ArchiveCategory(c *gin.Context) {
+	h.setCategoryArchived(c, true)
+}
+
+// UnarchiveCategory 取消封存類別
+func (h *Handler) UnarchiveCategory(c *gin.Context) {
+	h.setCategoryArchived(c, false)
+}
+
+func (h *Handler) setCategoryArchived(c *gin.Context, archived bool) {
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
+	objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的 ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	before, after, err := h.categories.Update(ctx, ledgerID, objID, repository.CategoryUpdate{Archived: &archived})
+	if err == repository.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到類別"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改失敗"})
+		return
+	}
+
+	h.recordAudit(ctx, c, AuditUpdate, "category", objID, before, after)
+
+	c.JSON(http.StatusOK, after)
+}
@@ -0,0 +1,210 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"server/models"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxCategoryDepth 類別最多幾層 (例如 餐飲 → 午餐 → 便當)
+const maxCategoryDepth = 3
+
+// 統計 API 的 view 參數
+const (
+	viewFlat = "flat" // 每個類別一筆，金額只含該類別本身的交易 (預設)
+	viewTree = "tree" // 依上下層排成樹狀，上層金額包含所有子類別
+)
+
+// statsView 讀取 view 參數，格式錯誤時直接回應錯誤
+func statsView(c *gin.Context) (string, bool) {
+	view := c.DefaultQuery("view", viewFlat)
+	if view != viewFlat && view != viewTree {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "view 必須是 flat 或 tree"})
+		return "", false
+	}
+	return view, true
+}
+
+// categoryTree 帳本類別的上下層關係
+// 上層類別已刪除 (不在 categories 中) 的類別視為最上層
+type categoryTree struct {
+	categories map[primitive.ObjectID]models.Category
+	children   map[primitive.ObjectID][]primitive.ObjectID
+}
+
+func newCategoryTree(categories map[primitive.ObjectID]models.Category) categoryTree {
+	tree := categoryTree{
+		categories: categories,
+		children:   make(map[primitive.ObjectID][]primitive.ObjectID),
+	}
+	for id := range categories {
+		if parent, ok := tree.parent(id); ok {
+			tree.children[parent] = append(tree.children[parent], id)
+		}
+	}
+	return tree
+}
+
+// parent 回傳仍存在的上層類別
+func (t categoryTree) parent(id primitive.ObjectID) (primitive.ObjectID, bool) {
+	category, ok := t.categories[id]
+	if !ok || category.ParentID == nil {
+		return primitive.NilObjectID, false
+	}
+	if _, ok := t.categories[*category.ParentID]; !ok {
+		return primitive.NilObjectID, false
+	}
+	return *category.ParentID, true
+}
+
+// ancestors 由近到遠列出所有上層類別 (資料異常形成循環時停止)
+func (t categoryTree) ancestors(id primitive.ObjectID) []primitive.ObjectID {
+	var result []primitive.ObjectID
+	seen := map[primitive.ObjectID]bool{id: true}
+	for {
+		parent, ok := t.parent(id)
+		if !ok || seen[parent] {
+			return result
+		}
+		seen[parent] = true
+		result = append(result, parent)
+		id = parent
+	}
+}
+
+// descendants 列出所有子孫類別
+func (t categoryTree) descendants(id primitive.ObjectID) []primitive.ObjectID {
+	var result []primitive.ObjectID
+	seen := map[primitive.ObjectID]bool{id: true}
+	queue := []primitive.ObjectID{id}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, child := range t.children[current] {
+			if !seen[child] {
+				seen[child] = true
+				result = append(result, child)
+				queue = append(queue, child)
+			}
+		}
+	}
+	return result
+}
+
+// depth 類別在第幾層 (最上層為 1)
+func (t categoryTree) depth(id primitive.ObjectID) int {
+	return len(t.ancestors(id)) + 1
+}
+
+// height 以此類別為根的子樹有幾層 (沒有子類別為 1)
+func (t categoryTree) height(id primitive.ObjectID) int {
+	base := t.depth(id)
+	height := 1
+	for _, descendant := range t.descendants(id) {
+		if h := t.depth(descendant) - base + 1; h > height {
+			height = h
+		}
+	}
+	return height
+}
+
+// rollUp 將每個類別本身的金額 (或筆數) 加到所有上層類別，回傳包含子類別的合計
+func rollUp[N ~int64](t categoryTree, own map[primitive.ObjectID]N) map[primitive.ObjectID]N {
+	total := make(map[primitive.ObjectID]N, len(own))
+	for id, amount := range own {
+		total[id] += amount
+		for _, ancestor := range t.ancestors(id) {
+			total[ancestor] += amount
+		}
+	}
+	return total
+}
+
+// withAncestors 回傳 ids 與其所有上層類別 (樹狀顯示時，沒有金額的上層類別也要出現)
+func (t categoryTree) withAncestors(ids []primitive.ObjectID) []primitive.ObjectID {
+	seen := make(map[primitive.ObjectID]bool, len(ids))
+	var result []primitive.ObjectID
+	add := func(id primitive.ObjectID) {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	for _, id := range ids {
+		add(id)
+		for _, ancestor := range t.ancestors(id) {
+			add(ancestor)
+		}
+	}
+	return result
+}
+
+// nestCategories 將 ids 依上下層排成樹狀：每個類別掛在 ids 中最近的上層類別底下，沒有的即為最上層
+// 同一層依 less 排序，node 負責以子節點組出該類別的節點
+func nestCategories[T any](t categoryTree, ids []primitive.ObjectID, less func(a, b primitive.ObjectID) bool, node func(id primitive.ObjectID, children []T) T) []T {
+	included := make(map[primitive.ObjectID]bool, len(ids))
+	for _, id := range ids {
+		included[id] = true
+	}
+
+	children := make(map[primitive.ObjectID][]primitive.ObjectID)
+	var roots []primitive.ObjectID
+	for _, id := range ids {
+		parent, found := primitive.NilObjectID, false
+		for _, ancestor := range t.ancestors(id) {
+			if included[ancestor] {
+				parent, found = ancestor, true
+				break
+			}
+		}
+		if found {
+			children[parent] = append(children[parent], id)
+		} else {
+			roots = append(roots, id)
+		}
+	}
+
+	var build func(level []primitive.ObjectID) []T
+	build = func(level []primitive.ObjectID) []T {
+		sort.SliceStable(level, func(i, j int) bool { return less(level[i], level[j]) })
+		nodes := make([]T, 0, len(level))
+		for _, id := range level {
+			nodes = append(nodes, node(id, build(children[id])))
+		}
+		return nodes
+	}
+	return build(roots)
+}
+
+// validateCategoryParent 檢查類別 (id 為零值代表新類別) 是否可以放在 parentID 底下，不可時回傳錯誤訊息
+func validateCategoryParent(t categoryTree, id, parentID primitive.ObjectID, categoryType string) string {
+	parent, ok := t.categories[parentID]
+	if !ok {
+		return "找不到上層類別"
+	}
+	if parentID == id {
+		return "上層類別不可為自己"
+	}
+	if !id.IsZero() {
+		for _, descendant := range t.descendants(id) {
+			if descendant == parentID {
+				return "上層類別不可為自己的子類別"
+			}
+		}
+	}
+	if categoryType != "" && parent.Type != "" && categoryType != parent.Type {
+		return "子類別的型別必須與上層類別相同"
+	}
+	height := 1
+	if !id.IsZero() {
+		height = t.height(id)
+	}
+	if t.depth(parentID)+height > maxCategoryDepth {
+		return fmt.Sprintf("類別最多只能有 %d 層", maxCategoryDepth)
+	}
+	return ""
+}
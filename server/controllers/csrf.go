@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"net/http"
+	"net/url"
+	"server/config"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CSRFProtection 驗證會修改資料的請求來源 (Origin / Referer)
+// Cookie 會被瀏覽器自動帶上，因此 POST/PUT/DELETE 必須來自 ALLOWED_ORIGINS 或與 API 同網域的頁面。
+// 使用 Bearer 權杖的請求不依賴 Cookie，不需檢查。
+func CSRFProtection(c *gin.Context) {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		c.Next()
+		return
+	}
+
+	if _, ok := bearerToken(c); ok {
+		c.Next()
+		return
+	}
+
+	origin := c.GetHeader("Origin")
+	if origin == "" || origin == "null" {
+		// 部分瀏覽器在同網域請求時不送 Origin，改用 Referer 判斷
+		origin = c.GetHeader("Referer")
+	}
+
+	if !trustedOrigin(c, origin) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "請求來源驗證失敗"})
+		return
+	}
+
+	c.Next()
+}
+
+// trustedOrigin 判斷來源是否為允許的網域，或與 API 同一個 host (正式環境前端與 API 同站)
+func trustedOrigin(c *gin.Context, raw string) bool {
+	if raw == "" {
+		return false
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return false
+	}
+
+	origin := u.Scheme + "://" + u.Host
+	for _, allowed := range config.AllowedOrigins() {
+		if strings.EqualFold(origin, allowed) {
+			return true
+		}
+	}
+
+	return strings.EqualFold(u.Host, c.Request.Host)
+}
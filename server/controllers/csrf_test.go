@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCSRFProtection(t *testing.T) {
+	// 設定值可以有結尾的斜線與大寫，比對時忽略
+	t.Setenv("ALLOWED_ORIGINS", "https://app.fintrack.tw/, HTTPS://Admin.FinTrack.tw")
+
+	router := gin.New()
+	router.Use(CSRFProtection)
+	router.Any("/api/v1/transactions", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		want    int
+	}{
+		{"GET 不檢查", http.MethodGet, nil, http.StatusOK},
+		{"允許的 Origin", http.MethodPost, map[string]string{"Origin": "https://app.fintrack.tw"}, http.StatusOK},
+		{"Origin 大小寫不同", http.MethodPut, map[string]string{"Origin": "https://APP.FinTrack.tw"}, http.StatusOK},
+		{"設定值為大寫", http.MethodDelete, map[string]string{"Origin": "https://admin.fintrack.tw"}, http.StatusOK},
+		{"與 API 同一個 host", http.MethodPost, map[string]string{"Origin": "http://example.com"}, http.StatusOK},
+		{"只有 Referer", http.MethodPost, map[string]string{"Referer": "https://app.fintrack.tw/settings?tab=2"}, http.StatusOK},
+		{"Origin 為 null 時改用 Referer", http.MethodPost, map[string]string{"Origin": "null", "Referer": "https://app.fintrack.tw/"}, http.StatusOK},
+		{"兩者都沒有", http.MethodPost, nil, http.StatusForbidden},
+		{"跨站的 Origin", http.MethodPost, map[string]string{"Origin": "https://evil.example"}, http.StatusForbidden},
+		{"跨站的 Referer", http.MethodDelete, map[string]string{"Referer": "https://evil.example/app.fintrack.tw"}, http.StatusForbidden},
+		{"Origin 優先於 Referer", http.MethodPost, map[string]string{"Origin": "https://evil.example", "Referer": "https://app.fintrack.tw/"}, http.StatusForbidden},
+		{"相似的網域", http.MethodPost, map[string]string{"Origin": "https://app.fintrack.tw.evil.example"}, http.StatusForbidden},
+		{"scheme 不同", http.MethodPost, map[string]string{"Origin": "http://app.fintrack.tw"}, http.StatusForbidden},
+		{"無法解析的 Referer", http.MethodPost, map[string]string{"Referer": "app.fintrack.tw"}, http.StatusForbidden},
+		{"Bearer 權杖不檢查來源", http.MethodPost, map[string]string{"Authorization": "Bearer ft_token", "Origin": "https://evil.example"}, http.StatusOK},
+		{"空白的 Bearer 權杖", http.MethodPost, map[string]string{"Authorization": "Bearer ", "Origin": "https://evil.example"}, http.StatusForbidden},
+		{"其他驗證方式", http.MethodPost, map[string]string{"Authorization": "Basic dXNlcjpwYXNz", "Origin": "https://evil.example"}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/v1/transactions", nil)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d (%s)", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,297 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"server/config"
+	"server/fxrates"
+	"server/models"
+	"server/repository"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MISSING_RATES_HEADER 有金額因為找不到匯率而未計入統計時，列出這些幣別 (逗號分隔)
+const MISSING_RATES_HEADER = "X-Missing-Exchange-Rates"
+
+// baseCurrency 取得使用者的主要幣別，未設定時使用 DEFAULT_CURRENCY
+func (h *Handler) baseCurrency(ctx context.Context, username string) string {
+	currency, err := h.userSettings.BaseCurrency(ctx, username)
+	if err != nil || currency == "" {
+		return config.DefaultCurrency()
+	}
+	return currency
+}
+
+// currencyConverter 把金額換算成目前使用者的主要幣別，同一個請求內快取查過的匯率
+type currencyConverter struct {
+	rates   repository.ExchangeRateRepository
+	base    string
+	cache   map[string]float64
+	missing map[string]bool
+}
+
+// newConverter 建立換算成目前使用者主要幣別的 converter
+func (h *Handler) newConverter(ctx context.Context, c *gin.Context) *currencyConverter {
+	return h.converterTo(h.baseCurrency(ctx, c.MustGet("currentUser").(string)))
+}
+
+// converterTo 建立換算成指定幣別的 converter (例如帳戶幣別)
+func (h *Handler) converterTo(base string) *currencyConverter {
+	return &currencyConverter{
+		rates:   h.exchangeRates,
+		base:    base,
+		cache:   make(map[string]float64),
+		missing: make(map[string]bool),
+	}
+}
+
+// rate 回傳 date 當天 (或之前最近一天) 1 單位 currency 等於多少主要幣別 (直接、反向或交叉匯率)
+func (cv *currencyConverter) rate(ctx context.Context, currency, date string) (float64, bool) {
+	if currency == "" {
+		// 加入幣別之前建立的舊資料
+		currency = config.DefaultCurrency()
+	}
+	if currency == cv.base {
+		return 1, true
+	}
+
+	key := currency + "/" + date
+	if rate, ok := cv.cache[key]; ok {
+		return rate, rate > 0
+	}
+
+	rate := 0.0
+	if resolved, err := fxrates.Resolve(ctx, cv.rates, currency, cv.base, date); err == nil && resolved.Rate > 0 {
+		rate = resolved.Rate
+	}
+
+	cv.cache[key] = rate
+	if rate == 0 {
+		cv.missing[currency] = true
+		return 0, false
+	}
+	return rate, true
+}
+
+// convert 以 date 的匯率將金額換算成主要幣別，找不到匯率時回傳 false
+func (cv *currencyConverter) convert(ctx context.Context, amount models.Money, currency, date string) (models.Money, bool) {
+	rate, ok := cv.rate(ctx, currency, date)
+	if !ok {
+		return 0, false
+	}
+	if rate == 1 {
+		return amount, true
+	}
+	return amount.Mul(rate), true
+}
+
+// convertTotals 將依幣別、日期細分的加總換算成主要幣別，找不到匯率的金額不計入
+func (cv *currencyConverter) convertTotals(ctx context.Context, totals []repository.CategoryTotal) []repository.CategoryTotal {
+	converted := make([]repository.CategoryTotal, 0, len(totals))
+	for _, total := range totals {
+		amount, ok := cv.convert(ctx, total.Total, total.Currency, total.Date)
+		if !ok {
+			continue
+		}
+		total.Total = amount
+		total.Currency = cv.base
+		converted = append(converted, total)
+	}
+	return converted
+}
+
+// writeMissingHeader 有找不到匯率的幣別時寫入 X-Missing-Exchange-Rates
+func (cv *currencyConverter) writeMissingHeader(c *gin.Context) {
+	if len(cv.missing) == 0 {
+		return
+	}
+	currencies := make([]string, 0, len(cv.missing))
+	for currency := range cv.missing {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+	c.Header(MISSING_RATES_HEADER, strings.Join(currencies, ","))
+}
+
+// resolveCurrency 檢查輸入的幣別，未指定時使用目前使用者的主要幣別
+func (h *Handler) resolveCurrency(ctx context.Context, c *gin.Context, currency string) (string, bool) {
+	if strings.TrimSpace(currency) == "" {
+		return h.baseCurrency(ctx, c.MustGet("currentUser").(string)), true
+	}
+	normalized, err := models.NormalizeCurrency(currency)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "幣別格式錯誤，請使用 ISO 4217 代碼 (例如 TWD)"})
+		return "", false
+	}
+	return normalized, true
+}
+
+// UpdateBaseCurrency 設定目前使用者的主要幣別 (統計與報表換算的目標幣別)
+func (h *Handler) UpdateBaseCurrency(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(string)
+	var input struct {
+		Currency string `json:"currency" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "請輸入幣別"})
+		return
+	}
+	currency, err := models.NormalizeCurrency(input.Currency)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "幣別格式錯誤，請使用 ISO 4217 代碼 (例如 TWD)"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := h.userSettings.SetBaseCurrency(ctx, currentUser, currency); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "找不到使用者"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "設定主要幣別失敗"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"base_currency": currency})
+}
+
+// SetExchangeRate 新增或覆蓋某一天的匯率 (1 base = rate quote)
+func (h *Handler) SetExchangeRate(c *gin.Context) {
+	var input models.ExchangeRate
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	base, err := models.NormalizeCurrency(input.Base)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "base 幣別格式錯誤"})
+		return
+	}
+	quote, err := models.NormalizeCurrency(input.Quote)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "quote 幣別格式錯誤"})
+		return
+	}
+	if base == quote {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "base 與 quote 不可相同"})
+		return
+	}
+	if _, err := time.Parse("2006-01-02", input.Date); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date 格式錯誤，請使用 YYYY-MM-DD"})
+		return
+	}
+
+	input.ID = primitive.NilObjectID
+	input.Base = base
+	input.Quote = quote
+	if input.Source == "" {
+		input.Source = "manual"
+	}
+	input.UpdatedAt = time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := h.exchangeRates.Upsert(ctx, input); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法寫入匯率"})
+		return
+	}
+
+	c.JSON(http.StatusOK, input)
+}
+
+// MAX_RATE_FILE_SIZE 匯率檔案大小上限 (ECB 完整歷史約 1.5 MB)
+const MAX_RATE_FILE_SIZE = 10 << 20
+
+// ImportExchangeRates 匯入匯率檔案 (ECB XML/CSV 或 date,base,quote,rate CSV)
+// 可用 multipart 欄位 file 上傳，或直接把檔案內容放在 request body
+// query: format (預設 auto)、source (覆蓋來源名稱)、fill (預設 true，以前一天的匯率補齊空缺)
+func (h *Handler) ImportExchangeRates(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, MAX_RATE_FILE_SIZE)
+
+	var reader io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		file, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "請上傳匯率檔案 (file)"})
+			return
+		}
+		opened, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "無法讀取匯率檔案"})
+			return
+		}
+		defer opened.Close()
+		reader = opened
+	}
+
+	rates, err := fxrates.Parse(reader, c.DefaultQuery("format", fxrates.FormatAuto))
+	if err != nil {
+		var validation *fxrates.ValidationError
+		if errors.As(err, &validation) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "problems": validation.Problems})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	result, err := fxrates.Import(ctx, h.exchangeRates, rates, fxrates.Options{
+		Source:   c.Query("source"),
+		FillGaps: c.DefaultQuery("fill", "true") != "false",
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "匯入匯率失敗"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetExchangeRate 查詢某一天實際採用的匯率 (與統計換算使用相同的規則)
+// query: base、quote (必填)、date (YYYY-MM-DD，預設今天)
+func (h *Handler) GetExchangeRate(c *gin.Context) {
+	base, err := models.NormalizeCurrency(c.Query("base"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "base 幣別格式錯誤"})
+		return
+	}
+	quote, err := models.NormalizeCurrency(c.Query("quote"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "quote 幣別格式錯誤"})
+		return
+	}
+	date := c.DefaultQuery("date", time.Now().Format("2006-01-02"))
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date 格式錯誤，請使用 YYYY-MM-DD"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resolved, err := fxrates.Resolve(ctx, h.exchangeRates, base, quote, date)
+	if err == repository.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到匯率"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查詢匯率失敗"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resolved)
+}
@@ -5,27 +5,27 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"server/config"
 	"server/models"
+	"server/repository"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type fixedExpenseResponse struct {
-	ID         string    `json:"id"`
-	Amount     float64   `json:"amount"`
-	CategoryID string    `json:"category_id"`
-	Note       string    `json:"note"`
-	Owner      string    `json:"owner"`
-	Day        int       `json:"day"`
-	Type       string    `json:"type"`
-	Order      int       `json:"order"`
-	CreatedAt  time.Time `json:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at"`
+	ID         string       `json:"id"`
+	Amount     models.Money `json:"amount"`
+	Currency   string       `json:"currency"`
+	CategoryID string       `json:"category_id"`
+	AccountID  string       `json:"account_id,omitempty"`
+	Note       string       `json:"note"`
+	Owner      string       `json:"owner"`
+	Day        int          `json:"day"`
+	Type       string       `json:"type"`
+	Order      int          `json:"order"`
+	CreatedAt  time.Time    `json:"created_at"`
+	UpdatedAt  time.Time    `json:"updated_at"`
 }
 
 func toFixedExpenseResponse(exp models.FixedExpense) fixedExpenseResponse {
@@ -39,10 +39,17 @@ func toFixedExpenseResponse(exp models.FixedExpense) fixedExpenseResponse {
 		categoryID = exp.CategoryID.Hex()
 	}
 
+	accountID := ""
+	if exp.AccountID != nil && !exp.AccountID.IsZero() {
+		accountID = exp.AccountID.Hex()
+	}
+
 	return fixedExpenseResponse{
 		ID:         id,
 		Amount:     exp.Amount,
+		Currency:   exp.Currency,
 		CategoryID: categoryID,
+		AccountID:  accountID,
 		Note:       exp.Note,
 		Owner:      exp.Owner,
 		Day:        exp.Day,
@@ -62,8 +69,9 @@ func toFixedExpenseResponse(exp models.FixedExpense) fixedExpenseResponse {
 // @Param        fixedExpense body models.FixedExpense true "固定支出資料"
 // @Success      200  {object}  models.FixedExpense
 // @Router       /fixed-expenses [post]
-func CreateFixedExpense(c *gin.Context) {
+func (h *Handler) CreateFixedExpense(c *gin.Context) {
 	currentUser := c.MustGet("currentUser").(string)
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
 	var input models.FixedExpense
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -71,37 +79,54 @@ func CreateFixedExpense(c *gin.Context) {
 		return
 	}
 
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if !h.checkCategoryUsable(ctx, c, ledgerID, input.CategoryID) {
+		return
+	}
+	// 帳戶為選填，產生的交易會記在此帳戶
+	if input.AccountID != nil && input.AccountID.IsZero() {
+		input.AccountID = nil
+	}
+	if input.AccountID != nil && !h.checkAccountUsable(ctx, c, ledgerID, *input.AccountID) {
+		return
+	}
+
+	// 未指定幣別時使用使用者的主要幣別
+	currency, ok := h.resolveCurrency(ctx, c, input.Currency)
+	if !ok {
+		return
+	}
+
 	input.Owner = currentUser
+	input.LedgerID = ledgerID
 	input.ID = primitive.NewObjectID()
+	input.Currency = currency
+	input.DeletedAt = nil
 	input.CreatedAt = time.Now()
 	input.UpdatedAt = time.Now()
 
-	collection := config.GetCollection("fixed_expenses")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	// 找出目前最大的 Order
-	// 簡單作法：Find options set Sort({order: -1}), Limit(1)
-	opts := options.FindOne().SetSort(bson.D{{Key: "order", Value: -1}})
-	var maxOrderExp models.FixedExpense
-	err := collection.FindOne(ctx, bson.M{"owner": currentUser}, opts).Decode(&maxOrderExp)
-	if err == nil {
-		input.Order = maxOrderExp.Order + 1
-	} else {
-		input.Order = 1 // 第一筆
+	// 找出目前最大的 Order (沒有資料時為 0，第一筆即為 1)
+	maxOrder, err := h.fixedExpenses.MaxOrder(ctx, ledgerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法寫入固定支出設定"})
+		return
 	}
+	input.Order = maxOrder + 1
 
-	_, err = collection.InsertOne(ctx, input)
-	if err != nil {
+	if err := h.fixedExpenses.Create(ctx, input); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法寫入固定支出設定"})
 		return
 	}
 
+	h.recordAudit(ctx, c, AuditCreate, "fixed_expense", input.ID, nil, input)
+
 	// 建立當月交易紀錄
 	// 邏輯: 只有當設定的日 <= 今天，才補建當月紀錄 (代表錯過了當月的 Cron)
 	// 如果設定的日 > 今天，則交由當月的 Cron 執行 (避免重複 & 建立未來交易)
 	if input.Day <= time.Now().Day() {
-		go createTransactionForFixedExpense(input, time.Now())
+		go h.createTransactionForFixedExpense(input, time.Now())
 	}
 
 	c.JSON(http.StatusOK, toFixedExpenseResponse(input))
@@ -117,8 +142,9 @@ func CreateFixedExpense(c *gin.Context) {
 // @Param        fixedExpense body      models.FixedExpense  true  "固定支出資料"
 // @Success      200  {object}  models.FixedExpense
 // @Router       /fixed-expenses/{id} [put]
-func UpdateFixedExpense(c *gin.Context) {
+func (h *Handler) UpdateFixedExpense(c *gin.Context) {
 	currentUser := c.MustGet("currentUser").(string)
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
 	idParam := c.Param("id")
 	log.Printf("DEBUG: UpdateFixedExpense called for ID: %s by User: %s", idParam, currentUser)
 	objID, err := primitive.ObjectIDFromHex(idParam)
@@ -128,64 +154,92 @@ func UpdateFixedExpense(c *gin.Context) {
 		return
 	}
 
-	var input map[string]interface{}
+	// 允許更新的欄位 (目前主要為了 Order，但也預留其他欄位更新)，未帶的欄位為 nil
+	var input struct {
+		Order      *int          `json:"order"`
+		Amount     *models.Money `json:"amount"`
+		Currency   *string       `json:"currency"`
+		Day        *int          `json:"day"`
+		Note       *string       `json:"note"`
+		Type       *string       `json:"type"`
+		CategoryID *string       `json:"category_id"`
+		// AccountID: 空字串代表不指定帳戶
+		AccountID *string `json:"account_id"`
+	}
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	collection := config.GetCollection("fixed_expenses")
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	updateData := bson.M{
-		"updated_at": time.Now(),
-	}
-
-	// 允許更新的欄位 (目前主要為了 Order，但也預留其他欄位更新)
-	if val, ok := input["order"]; ok {
-		updateData["order"] = val
-	}
-	if val, ok := input["amount"]; ok {
-		updateData["amount"] = val
-	}
-	if val, ok := input["day"]; ok {
-		updateData["day"] = val
-	}
-	if val, ok := input["note"]; ok {
-		updateData["note"] = val
+	changes := repository.FixedExpenseUpdate{
+		Order:  input.Order,
+		Amount: input.Amount,
+		Day:    input.Day,
+		Note:   input.Note,
+		Type:   input.Type,
+	}
+	if input.Currency != nil {
+		currency, err := models.NormalizeCurrency(*input.Currency)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "幣別格式錯誤，請使用 ISO 4217 代碼 (例如 TWD)"})
+			return
+		}
+		changes.Currency = &currency
 	}
-	if val, ok := input["type"]; ok {
-		updateData["type"] = val
+	if input.CategoryID != nil {
+		if catObjID, err := primitive.ObjectIDFromHex(*input.CategoryID); err == nil {
+			changes.CategoryID = &catObjID
+		}
 	}
-	if val, ok := input["category_id"]; ok {
-		if catIDStr, ok := val.(string); ok {
-			if catObjID, err := primitive.ObjectIDFromHex(catIDStr); err == nil {
-				updateData["category_id"] = catObjID
+	if input.AccountID != nil {
+		accountID := primitive.NilObjectID
+		if *input.AccountID != "" {
+			if accountID, err = primitive.ObjectIDFromHex(*input.AccountID); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "無效的帳戶 ID"})
+				return
 			}
 		}
+		changes.AccountID = &accountID
+	}
+	if changes.CategoryID != nil || changes.AccountID != nil {
+		// 已在封存類別或帳戶中的固定支出可以修改其他欄位，但不能改到封存的類別或帳戶
+		current, err := h.fixedExpenses.Get(ctx, ledgerID, objID)
+		if err == repository.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "找不到該筆資料"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失敗"})
+			return
+		}
+		if changes.CategoryID != nil && *changes.CategoryID != current.CategoryID && !h.checkCategoryUsable(ctx, c, ledgerID, *changes.CategoryID) {
+			return
+		}
+		if accountChanged(current.AccountID, changes.AccountID) && !h.checkAccountUsable(ctx, c, ledgerID, *changes.AccountID) {
+			return
+		}
 	}
 
-	filter := bson.M{"_id": objID, "owner": currentUser}
-	update := bson.M{"$set": updateData}
-
-	result, err := collection.UpdateOne(ctx, filter, update)
+	before, after, err := h.fixedExpenses.Update(ctx, ledgerID, objID, changes)
+	if err == repository.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到該筆資料"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失敗"})
 		return
 	}
 
-	if result.MatchedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "找不到該筆資料"})
-		return
-	}
+	h.recordAudit(ctx, c, AuditUpdate, "fixed_expense", objID, before, after)
 
 	c.JSON(http.StatusOK, gin.H{"message": "更新成功"})
 }
 
 // ProcessFixedExpenses 每日檢查並執行固定支出
-func ProcessFixedExpenses() {
-	collection := config.GetCollection("fixed_expenses")
+func (h *Handler) ProcessFixedExpenses() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -197,29 +251,35 @@ func ProcessFixedExpenses() {
 	// 這裡先實作最直觀的: 只處理 Day == today)
 	// TODO: 優化月底處理邏輯
 
-	filter := bson.M{"day": today}
-	cursor, err := collection.Find(ctx, filter)
+	expenses, err := h.fixedExpenses.ListByDay(ctx, today)
 	if err != nil {
 		log.Printf("[Cron] 查詢固定支出失敗: %v", err)
 		return
 	}
-	defer cursor.Close(ctx)
-
-	var expenses []models.FixedExpense
-	if err = cursor.All(ctx, &expenses); err != nil {
-		log.Printf("[Cron] 解析固定支出失敗: %v", err)
-		return
-	}
 
 	log.Printf("[Cron] 發現 %d 筆固定支出需處理 (Day=%d)", len(expenses), today)
 
+	// 封存的帳本不能再新增資料，其固定支出也不應自動入帳
+	archived := map[primitive.ObjectID]bool{}
 	for _, exp := range expenses {
-		createTransactionForFixedExpense(exp, now)
+		skip, checked := archived[exp.LedgerID]
+		if !checked {
+			ledger, err := findLedger(ctx, exp.LedgerID)
+			if err != nil {
+				log.Printf("[Cron] 找不到固定支出 %s 的帳本: %v", exp.ID.Hex(), err)
+				continue
+			}
+			skip = ledger.Archived
+			archived[exp.LedgerID] = skip
+		}
+		if skip {
+			continue
+		}
+		h.createTransactionForFixedExpense(exp, now)
 	}
 }
 
-func createTransactionForFixedExpense(exp models.FixedExpense, dateBase time.Time) {
-	transactionCollection := config.GetCollection("transactions")
+func (h *Handler) createTransactionForFixedExpense(exp models.FixedExpense, dateBase time.Time) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -257,19 +317,30 @@ func createTransactionForFixedExpense(exp models.FixedExpense, dateBase time.Tim
 	transaction := models.Transaction{
 		ID:         primitive.NewObjectID(),
 		Amount:     exp.Amount,
+		Currency:   exp.Currency,
 		CategoryID: exp.CategoryID,
+		AccountID:  exp.AccountID,
 		Date:       dateStr,
 		Note:       fmt.Sprintf("%s (%s)", exp.Note, label),
+		LedgerID:   exp.LedgerID,
 		Owner:      exp.Owner,
 		CreatedAt:  time.Now(),
 		UpdatedAt:  time.Now(),
 	}
 
-	_, err := transactionCollection.InsertOne(ctx, transaction)
-	if err != nil {
+	if err := h.transactions.Create(ctx, transaction); err != nil {
 		log.Printf("建立固定支出交易失敗 [_id: %s]: %v", exp.ID.Hex(), err)
 	} else {
 		log.Printf("成功建立固定支出交易: %s - %s", exp.Owner, dateStr)
+		ledgerID := exp.LedgerID
+		insertAuditLog(ctx, h.auditLogs, models.AuditLog{
+			Action:   AuditCreate,
+			Entity:   "transaction",
+			EntityID: transaction.ID.Hex(),
+			LedgerID: &ledgerID,
+			Actor:    auditSystemActor,
+			After:    transaction,
+		})
 	}
 }
 
@@ -280,29 +351,17 @@ func createTransactionForFixedExpense(exp models.FixedExpense, dateBase time.Tim
 // @Produce      json
 // @Success      200  {array}  models.FixedExpense
 // @Router       /fixed-expenses [get]
-func GetFixedExpenses(c *gin.Context) {
+func (h *Handler) GetFixedExpenses(c *gin.Context) {
 	currentUser := c.MustGet("currentUser").(string)
-	collection := config.GetCollection("fixed_expenses")
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	filter := bson.M{"owner": currentUser}
-	cursor, err := collection.Find(ctx, filter)
+	expenses, err := h.fixedExpenses.List(ctx, ledgerID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法讀取資料"})
 		return
 	}
-	defer cursor.Close(ctx)
-
-	var expenses []models.FixedExpense
-	if err = cursor.All(ctx, &expenses); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "資料解析失敗"})
-		return
-	}
-
-	if expenses == nil {
-		expenses = []models.FixedExpense{}
-	}
 
 	log.Printf("DEBUG: GetFixedExpenses returning %d items for user %s", len(expenses), currentUser)
 	responses := make([]fixedExpenseResponse, 0, len(expenses))
@@ -319,8 +378,9 @@ func GetFixedExpenses(c *gin.Context) {
 // @Param        id   path      string  true  "Fixed Expense ID"
 // @Success      200  {object}  map[string]string
 // @Router       /fixed-expenses/{id} [delete]
-func DeleteFixedExpense(c *gin.Context) {
+func (h *Handler) DeleteFixedExpense(c *gin.Context) {
 	currentUser := c.MustGet("currentUser").(string)
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
 	idParam := c.Param("id")
 	log.Printf("DEBUG: DeleteFixedExpense called for ID: %s by User: %s", idParam, currentUser)
 	objID, err := primitive.ObjectIDFromHex(idParam)
@@ -330,21 +390,20 @@ func DeleteFixedExpense(c *gin.Context) {
 		return
 	}
 
-	collection := config.GetCollection("fixed_expenses")
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	filter := bson.M{"_id": objID, "owner": currentUser}
-	result, err := collection.DeleteOne(ctx, filter)
+	deleted, err := h.fixedExpenses.Delete(ctx, ledgerID, objID)
+	if err == repository.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到該筆資料"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "刪除失敗"})
 		return
 	}
 
-	if result.DeletedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "找不到該筆資料"})
-		return
-	}
+	h.recordAudit(ctx, c, AuditDelete, "fixed_expense", objID, deleted, nil)
 
 	c.JSON(http.StatusOK, gin.H{"message": "刪除成功"})
 }
@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"context"
+	"server/models"
+	"server/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Handler 提供交易、類別、預算、固定支出、帳戶、匯率與統計的 API
+// 資料存取 (包含稽核紀錄與使用者的主要幣別) 一律透過注入的 repository，不直接操作 MongoDB
+type Handler struct {
+	transactions  repository.TransactionRepository
+	revisions     repository.TransactionRevisionRepository
+	categories    repository.CategoryRepository
+	budgets       repository.BudgetRepository
+	fixedExpenses repository.FixedExpenseRepository
+	accounts      repository.AccountRepository
+	exchangeRates repository.ExchangeRateRepository
+	auditLogs     repository.AuditLogRepository
+	userSettings  repository.UserSettingsRepository
+}
+
+// NewHandler 以指定的 repositories 建立 Handler
+func NewHandler(repos repository.Repositories) *Handler {
+	return &Handler{
+		transactions:  repos.Transactions,
+		revisions:     repos.TransactionRevisions,
+		categories:    repos.Categories,
+		budgets:       repos.Budgets,
+		fixedExpenses: repos.FixedExpenses,
+		accounts:      repos.Accounts,
+		exchangeRates: repos.ExchangeRates,
+		auditLogs:     repos.AuditLogs,
+		userSettings:  repos.UserSettings,
+	}
+}
+
+// categoryIndex 取得帳本的所有類別，並以 ID 建立索引
+func (h *Handler) categoryIndex(ctx context.Context, ledgerID primitive.ObjectID) (map[primitive.ObjectID]models.Category, error) {
+	categories, err := h.categories.List(ctx, ledgerID)
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[primitive.ObjectID]models.Category, len(categories))
+	for _, category := range categories {
+		index[category.ID] = category
+	}
+	return index, nil
+}
+
+// totalsByType 依類別型別 (income / expense) 加總
+// 找不到類別的交易不計入 (與先前 $lookup + $unwind 的行為相同)
+func totalsByType(totals []repository.CategoryTotal, categories map[primitive.ObjectID]models.Category) map[string]models.Money {
+	result := map[string]models.Money{
+		"income":  0,
+		"expense": 0,
+	}
+	for _, total := range totals {
+		category, ok := categories[total.CategoryID]
+		if !ok {
+			continue
+		}
+		if category.Type == "income" || category.Type == "expense" {
+			result[category.Type] += total.Total
+		}
+	}
+	return result
+}
@@ -0,0 +1,172 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"server/models"
+	"server/repository"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const testUser = "jonas"
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// testLedger 以記憶體 repositories 建立 Handler，並掛上與 main.go 相同路徑的路由
+type testLedger struct {
+	t        *testing.T
+	router   *gin.Engine
+	repos    repository.Repositories
+	ledgerID primitive.ObjectID
+}
+
+func newTestLedger(t *testing.T) *testLedger {
+	t.Helper()
+
+	repos := repository.NewMemoryRepositories()
+	handler := NewHandler(repos)
+	ledgerID := primitive.NewObjectID()
+
+	router := gin.New()
+	rg := router.Group("/api/v1", func(c *gin.Context) {
+		c.Set("currentUser", testUser)
+		c.Set("ledgerID", ledgerID)
+		c.Next()
+	})
+	rg.POST("/transactions", handler.CreateTransaction)
+	rg.GET("/transactions", handler.GetTransactions)
+	rg.DELETE("/transactions/:id", handler.DeleteTransaction)
+	rg.GET("/stats/categories", handler.GetCategoryStats)
+	rg.GET("/stats/tags", handler.GetTagStats)
+	rg.GET("/tags", handler.GetTags)
+	rg.PUT("/tags/:tag", handler.RenameTag)
+	rg.DELETE("/tags/:tag", handler.DeleteTag)
+	rg.POST("/tags/:tag/merge", handler.MergeTag)
+	rg.POST("/transfers", handler.CreateTransfer)
+	rg.DELETE("/transfers/:id", handler.DeleteTransfer)
+	rg.GET("/budgets/status", handler.GetBudgetStatus)
+	rg.GET("/accounts/:id/balance", handler.GetAccountBalance)
+	rg.GET("/trash", handler.GetTrash)
+	rg.PUT("/auth/currency", handler.UpdateBaseCurrency)
+	rg.POST("/trash/:kind/:id/restore", handler.RestoreTrashItem)
+
+	return &testLedger{t: t, router: router, repos: repos, ledgerID: ledgerID}
+}
+
+// do 送出請求並把 JSON 回應解到 out (out 為 nil 時略過)，狀態碼不符時測試失敗
+func (l *testLedger) do(method, path string, body interface{}, wantStatus int, out interface{}) {
+	l.t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			l.t.Fatal(err)
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req := httptest.NewRequest(method, "/api/v1"+path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	l.router.ServeHTTP(w, req)
+
+	if w.Code != wantStatus {
+		l.t.Fatalf("%s %s: status = %d, want %d (%s)", method, path, w.Code, wantStatus, w.Body.String())
+	}
+	if out != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			l.t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+}
+
+func (l *testLedger) category(name, categoryType string) primitive.ObjectID {
+	l.t.Helper()
+	category := models.Category{ID: primitive.NewObjectID(), Name: name, Type: categoryType, LedgerID: l.ledgerID, Owner: testUser}
+	if err := l.repos.Categories.Create(context.Background(), category); err != nil {
+		l.t.Fatal(err)
+	}
+	return category.ID
+}
+
+func (l *testLedger) account(name string) primitive.ObjectID {
+	l.t.Helper()
+	account := models.Account{ID: primitive.NewObjectID(), Name: name, Type: models.AccountBank, Currency: "TWD", LedgerID: l.ledgerID, Owner: testUser}
+	if err := l.repos.Accounts.Create(context.Background(), account); err != nil {
+		l.t.Fatal(err)
+	}
+	return account.ID
+}
+
+func (l *testLedger) transaction(categoryID primitive.ObjectID, amount float64, date string, tags ...string) primitive.ObjectID {
+	l.t.Helper()
+	var created models.Transaction
+	l.do(http.MethodPost, "/transactions", gin.H{
+		"amount":      amount,
+		"category_id": categoryID.Hex(),
+		"date":        date,
+		"tags":        tags,
+	}, http.StatusOK, &created)
+	return created.ID
+}
+
+type transactionList struct {
+	Data []models.Transaction `json:"data"`
+	Meta struct {
+		Total        int64   `json:"total"`
+		TotalIncome  float64 `json:"total_income"`
+		TotalExpense float64 `json:"total_expense"`
+	} `json:"meta"`
+}
+
+func (l *testLedger) listMarch() transactionList {
+	l.t.Helper()
+	var list transactionList
+	l.do(http.MethodGet, "/transactions?start_date=2026-03-01&end_date=2026-03-31", nil, http.StatusOK, &list)
+	return list
+}
+
+type categoryStat struct {
+	CategoryID string  `json:"categoryId"`
+	Amount     float64 `json:"amount"`
+}
+
+type tagCount struct {
+	Tag   string `json:"tag"`
+	Count int64  `json:"count"`
+}
+
+func TestHandlerUsesUserBaseCurrency(t *testing.T) {
+	l := newTestLedger(t)
+	food := l.category("餐飲", "expense")
+
+	// 未設定時使用 DEFAULT_CURRENCY
+	t.Setenv("DEFAULT_CURRENCY", "TWD")
+	twd := l.transaction(food, 100, "2026-03-05")
+
+	l.do(http.MethodPut, "/auth/currency", gin.H{"currency": "usd"}, http.StatusOK, nil)
+	if currency, err := l.repos.UserSettings.BaseCurrency(context.Background(), testUser); err != nil || currency != "USD" {
+		t.Fatalf("BaseCurrency() = %q, %v, want USD", currency, err)
+	}
+	usd := l.transaction(food, 5, "2026-03-06")
+
+	for id, want := range map[primitive.ObjectID]string{twd: "TWD", usd: "USD"} {
+		tx, err := l.repos.Transactions.Get(context.Background(), l.ledgerID, id)
+		if err != nil || tx.Currency != want {
+			t.Errorf("transaction %s currency = %q, %v, want %s", id.Hex(), tx.Currency, err, want)
+		}
+	}
+}
@@ -0,0 +1,576 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"server/config"
+	"server/models"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LEDGER_HEADER 前端用來指定目前操作的帳本，未帶時使用者的預設帳本
+const LEDGER_HEADER = "X-Ledger-ID"
+
+// LEDGER_PARAM 路徑形式 /api/v1/ledgers/:ledgerId/... 中的帳本參數
+const LEDGER_PARAM = "ledgerId"
+
+// 帳本底下的資料 collection (刪除帳本時一併刪除)
+var ledgerCollections = []string{"transactions", "transaction_revisions", "categories", "budgets", "fixed_expenses", "accounts"}
+
+type LedgerMemberInput struct {
+	Username string `json:"username" binding:"required"`
+	Role     string `json:"role" binding:"required"`
+}
+
+type LedgerRoleInput struct {
+	Role string `json:"role" binding:"required"`
+}
+
+func validLedgerRole(role string) bool {
+	switch role {
+	case models.LedgerRoleOwner, models.LedgerRoleEditor, models.LedgerRoleViewer:
+		return true
+	}
+	return false
+}
+
+func countLedgerOwners(ledger models.Ledger) int {
+	count := 0
+	for _, m := range ledger.Members {
+		if m.Role == models.LedgerRoleOwner {
+			count++
+		}
+	}
+	return count
+}
+
+func newLedger(name, username string) models.Ledger {
+	now := time.Now()
+	return models.Ledger{
+		ID:    primitive.NewObjectID(),
+		Name:  name,
+		Owner: username,
+		Members: []models.LedgerMember{
+			{Username: username, Role: models.LedgerRoleOwner, JoinedAt: now},
+		},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// ensureDefaultLedger 確保使用者有預設帳本，沒有的話建立一本個人帳本
+func ensureDefaultLedger(ctx context.Context, user models.User) (primitive.ObjectID, error) {
+	if user.DefaultLedgerID != primitive.NilObjectID {
+		return user.DefaultLedgerID, nil
+	}
+
+	ledger := newLedger("個人帳本", user.Username)
+	if _, err := config.GetCollection("ledgers").InsertOne(ctx, ledger); err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	// 只在尚未設定時寫入，避免並行請求各自建立一本而互相覆蓋
+	result, err := config.GetCollection("users").UpdateOne(ctx,
+		bson.M{"_id": user.ID, "default_ledger_id": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"default_ledger_id": ledger.ID}},
+	)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	if result.ModifiedCount == 0 {
+		config.GetCollection("ledgers").DeleteOne(ctx, bson.M{"_id": ledger.ID})
+		latest, err := findUser(ctx, user.Username)
+		if err != nil {
+			return primitive.NilObjectID, err
+		}
+		return latest.DefaultLedgerID, nil
+	}
+	return ledger.ID, nil
+}
+
+func findLedger(ctx context.Context, id primitive.ObjectID) (models.Ledger, error) {
+	var ledger models.Ledger
+	err := config.GetCollection("ledgers").FindOne(ctx, bson.M{"_id": id}).Decode(&ledger)
+	return ledger, err
+}
+
+// Middleware: LedgerRequired (需接在 AuthRequired 之後)
+// 決定本次請求操作的帳本，並檢查目前使用者是否為成員；viewer 只能讀取
+func LedgerRequired(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(string)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// 優先順序：路徑參數 > X-Ledger-ID header > 使用者的預設帳本
+	selected := c.Param(LEDGER_PARAM)
+	if selected == "" {
+		selected = c.GetHeader(LEDGER_HEADER)
+	}
+
+	var ledgerID primitive.ObjectID
+	if selected != "" {
+		id, err := primitive.ObjectIDFromHex(selected)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "無效的帳本 ID"})
+			return
+		}
+		ledgerID = id
+	} else {
+		user, err := findUser(ctx, currentUser)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "未授權"})
+			return
+		}
+		ledgerID, err = ensureDefaultLedger(ctx, user)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "無法建立預設帳本"})
+			return
+		}
+	}
+
+	ledger, err := findLedger(ctx, ledgerID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "找不到帳本"})
+		return
+	}
+
+	role := ledger.MemberRole(currentUser)
+	if role == "" {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "不是此帳本的成員"})
+		return
+	}
+
+	method := c.Request.Method
+	readOnly := method == http.MethodGet || method == http.MethodHead
+	if role == models.LedgerRoleViewer && !readOnly {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "檢視者無法修改帳本資料"})
+		return
+	}
+	if ledger.Archived && !readOnly {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "帳本已封存，無法修改資料"})
+		return
+	}
+
+	c.Set("ledgerID", ledger.ID)
+	c.Set("ledgerRole", role)
+	c.Next()
+}
+
+// GetLedgers 列出目前使用者參與的所有帳本
+func GetLedgers(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(string)
+	collection := config.GetCollection("ledgers")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := findUser(ctx, currentUser)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授權"})
+		return
+	}
+	defaultID, err := ensureDefaultLedger(ctx, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法建立預設帳本"})
+		return
+	}
+
+	// 預設不列出已封存的帳本，?include_archived=true 時才列出
+	filter := bson.M{"members.username": currentUser}
+	if c.Query("include_archived") != "true" {
+		filter["archived"] = bson.M{"$ne": true}
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法讀取帳本"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var ledgers []models.Ledger
+	if err = cursor.All(ctx, &ledgers); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "解析失敗"})
+		return
+	}
+
+	response := make([]gin.H, 0, len(ledgers))
+	for _, l := range ledgers {
+		response = append(response, gin.H{
+			"id":         l.ID.Hex(),
+			"name":       l.Name,
+			"owner":      l.Owner,
+			"members":    l.Members,
+			"role":       l.MemberRole(currentUser),
+			"is_default": l.ID == defaultID,
+			"archived":   l.Archived,
+			"created_at": l.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// CreateLedger 建立新帳本，建立者為 owner
+func CreateLedger(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(string)
+	var input struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "名稱不可為空"})
+		return
+	}
+
+	ledger := newLedger(name, currentUser)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := config.GetCollection("ledgers").InsertOne(ctx, ledger); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法寫入資料庫"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ledger)
+}
+
+// loadOwnedLedger 讀取帳本並確認目前使用者是 owner
+func loadOwnedLedger(ctx context.Context, c *gin.Context) (models.Ledger, bool) {
+	currentUser := c.MustGet("currentUser").(string)
+	objID, err := primitive.ObjectIDFromHex(c.Param(LEDGER_PARAM))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的 ID"})
+		return models.Ledger{}, false
+	}
+
+	ledger, err := findLedger(ctx, objID)
+	if err != nil || ledger.MemberRole(currentUser) == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到帳本"})
+		return models.Ledger{}, false
+	}
+	if ledger.MemberRole(currentUser) != models.LedgerRoleOwner {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只有帳本擁有者可以管理帳本"})
+		return models.Ledger{}, false
+	}
+	return ledger, true
+}
+
+// RenameLedger 修改帳本名稱
+func RenameLedger(c *gin.Context) {
+	var input struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "名稱不可為空"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ledger, ok := loadOwnedLedger(ctx, c)
+	if !ok {
+		return
+	}
+
+	_, err := config.GetCollection("ledgers").UpdateOne(ctx,
+		bson.M{"_id": ledger.ID},
+		bson.M{"$set": bson.M{"name": name, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改失敗"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "修改成功"})
+}
+
+// ArchiveLedger 封存帳本 (資料保留、可檢視，但不能再修改)
+func ArchiveLedger(c *gin.Context) {
+	setLedgerArchived(c, true)
+}
+
+// UnarchiveLedger 取消封存
+func UnarchiveLedger(c *gin.Context) {
+	setLedgerArchived(c, false)
+}
+
+func setLedgerArchived(c *gin.Context, archived bool) {
+	currentUser := c.MustGet("currentUser").(string)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ledger, ok := loadOwnedLedger(ctx, c)
+	if !ok {
+		return
+	}
+
+	update := bson.M{"$set": bson.M{"archived": false, "updated_at": time.Now()}, "$unset": bson.M{"archived_at": ""}}
+	if archived {
+		user, err := findUser(ctx, currentUser)
+		if err == nil && user.DefaultLedgerID == ledger.ID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "無法封存預設帳本，請先切換到其他帳本"})
+			return
+		}
+		update = bson.M{"$set": bson.M{"archived": true, "archived_at": time.Now(), "updated_at": time.Now()}}
+	}
+
+	if _, err := config.GetCollection("ledgers").UpdateOne(ctx, bson.M{"_id": ledger.ID}, update); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改失敗"})
+		return
+	}
+
+	if archived {
+		c.JSON(http.StatusOK, gin.H{"message": "帳本已封存"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已取消封存"})
+}
+
+// SwitchLedger 將帳本設為目前使用者的預設帳本 (未帶 X-Ledger-ID 時使用)
+func SwitchLedger(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(string)
+	objID, err := primitive.ObjectIDFromHex(c.Param(LEDGER_PARAM))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的 ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ledger, err := findLedger(ctx, objID)
+	if err != nil || ledger.MemberRole(currentUser) == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到帳本"})
+		return
+	}
+	if ledger.Archived {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無法切換到已封存的帳本"})
+		return
+	}
+
+	_, err = config.GetCollection("users").UpdateOne(ctx,
+		bson.M{"username": currentUser},
+		bson.M{"$set": bson.M{"default_ledger_id": ledger.ID, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "切換失敗"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已切換帳本", "ledger_id": ledger.ID.Hex()})
+}
+
+// AddLedgerMember 邀請使用者加入帳本
+func AddLedgerMember(c *gin.Context) {
+	var input LedgerMemberInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !validLedgerRole(input.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role 必須是 owner、editor 或 viewer"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ledger, ok := loadOwnedLedger(ctx, c)
+	if !ok {
+		return
+	}
+	if ledger.MemberRole(input.Username) != "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "該使用者已是成員"})
+		return
+	}
+	if _, err := findUser(ctx, input.Username); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到使用者"})
+		return
+	}
+
+	member := models.LedgerMember{Username: input.Username, Role: input.Role, JoinedAt: time.Now()}
+	_, err := config.GetCollection("ledgers").UpdateOne(ctx,
+		bson.M{"_id": ledger.ID, "members.username": bson.M{"$ne": input.Username}},
+		bson.M{
+			"$push": bson.M{"members": member},
+			"$set":  bson.M{"updated_at": time.Now()},
+		},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "新增成員失敗"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已新增成員"})
+}
+
+// UpdateLedgerMember 修改成員角色
+func UpdateLedgerMember(c *gin.Context) {
+	username := c.Param("username")
+	var input LedgerRoleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !validLedgerRole(input.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role 必須是 owner、editor 或 viewer"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ledger, ok := loadOwnedLedger(ctx, c)
+	if !ok {
+		return
+	}
+
+	oldRole := ledger.MemberRole(username)
+	if oldRole == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到成員"})
+		return
+	}
+	if oldRole == models.LedgerRoleOwner && input.Role != models.LedgerRoleOwner && countLedgerOwners(ledger) == 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "帳本至少需要一位擁有者"})
+		return
+	}
+
+	_, err := config.GetCollection("ledgers").UpdateOne(ctx,
+		bson.M{"_id": ledger.ID, "members.username": username},
+		bson.M{"$set": bson.M{"members.$.role": input.Role, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改失敗"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "修改成功"})
+}
+
+// RemoveLedgerMember 移除成員 (owner 可移除任何人，一般成員只能移除自己 = 退出帳本)
+func RemoveLedgerMember(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(string)
+	username := c.Param("username")
+	objID, err := primitive.ObjectIDFromHex(c.Param(LEDGER_PARAM))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的 ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ledger, err := findLedger(ctx, objID)
+	myRole := ledger.MemberRole(currentUser)
+	if err != nil || myRole == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到帳本"})
+		return
+	}
+	if username != currentUser && myRole != models.LedgerRoleOwner {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只有帳本擁有者可以管理成員"})
+		return
+	}
+
+	role := ledger.MemberRole(username)
+	if role == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到成員"})
+		return
+	}
+	if role == models.LedgerRoleOwner && countLedgerOwners(ledger) == 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "帳本至少需要一位擁有者"})
+		return
+	}
+
+	_, err = config.GetCollection("ledgers").UpdateOne(ctx,
+		bson.M{"_id": ledger.ID},
+		bson.M{
+			"$pull": bson.M{"members": bson.M{"username": username}},
+			"$set":  bson.M{"updated_at": time.Now()},
+		},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "移除失敗"})
+		return
+	}
+
+	// 被移除的成員若以此帳本為預設，改回自己的個人帳本 (下次請求時自動建立)
+	config.GetCollection("users").UpdateOne(ctx,
+		bson.M{"username": username, "default_ledger_id": ledger.ID},
+		bson.M{"$unset": bson.M{"default_ledger_id": ""}},
+	)
+
+	c.JSON(http.StatusOK, gin.H{"message": "已移除成員"})
+}
+
+// leaveAllLedgers 刪除帳號時使用：退出所有帳本
+// 只有自己一人的帳本連同資料一起刪除；共用帳本若自己是唯一擁有者，將擁有權交給最早加入的成員
+func leaveAllLedgers(ctx context.Context, username string) error {
+	collection := config.GetCollection("ledgers")
+	cursor, err := collection.Find(ctx, bson.M{"members.username": username})
+	if err != nil {
+		return err
+	}
+	var ledgers []models.Ledger
+	if err = cursor.All(ctx, &ledgers); err != nil {
+		return err
+	}
+
+	for _, ledger := range ledgers {
+		var remaining []models.LedgerMember
+		for _, m := range ledger.Members {
+			if m.Username != username {
+				remaining = append(remaining, m)
+			}
+		}
+
+		if len(remaining) == 0 {
+			for _, name := range ledgerCollections {
+				if _, err := config.GetCollection(name).DeleteMany(ctx, bson.M{"ledger_id": ledger.ID}); err != nil {
+					return err
+				}
+			}
+			if _, err := collection.DeleteOne(ctx, bson.M{"_id": ledger.ID}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		hasOwner := false
+		for _, m := range remaining {
+			if m.Role == models.LedgerRoleOwner {
+				hasOwner = true
+				break
+			}
+		}
+		if !hasOwner {
+			remaining[0].Role = models.LedgerRoleOwner
+		}
+
+		if _, err := collection.UpdateOne(ctx,
+			bson.M{"_id": ledger.ID},
+			bson.M{"$set": bson.M{"members": remaining, "updated_at": time.Now()}},
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
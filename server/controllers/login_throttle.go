@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"server/config"
+	"server/models"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// 同一帳號允許連續失敗幾次後開始鎖定
+	userFailureThreshold = 5
+	// 同一 IP 允許連續失敗幾次後開始鎖定 (家中共用 IP，門檻放寬)
+	ipFailureThreshold = 20
+	// 第一次鎖定的時間，之後每多失敗一次加倍
+	lockoutBase = 30 * time.Second
+	// 鎖定時間上限
+	lockoutMax = time.Hour
+)
+
+func userAttemptKey(username string) string {
+	return "user:" + username
+}
+
+func ipAttemptKey(ip string) string {
+	return "ip:" + ip
+}
+
+// lockoutDuration 超過門檻後以指數成長計算鎖定時間
+func lockoutDuration(failures, threshold int) time.Duration {
+	if failures < threshold {
+		return 0
+	}
+	exp := failures - threshold
+	if exp > 16 {
+		return lockoutMax
+	}
+	d := time.Duration(float64(lockoutBase) * math.Pow(2, float64(exp)))
+	if d > lockoutMax {
+		return lockoutMax
+	}
+	return d
+}
+
+// loginAttemptStore 登入失敗次數與鎖定期限的儲存
+type loginAttemptStore interface {
+	// fail 累加失敗次數並回傳累加後的次數
+	fail(ctx context.Context, key string, now time.Time) (int, error)
+	// lock 設定鎖定期限
+	lock(ctx context.Context, key string, until time.Time) error
+	// lockedUntil 回傳 keys 中在 now 之後最晚的鎖定期限 (都沒有鎖定時為零值)
+	lockedUntil(ctx context.Context, keys []string, now time.Time) (time.Time, error)
+	// reset 清除失敗紀錄
+	reset(ctx context.Context, key string) error
+}
+
+// mongoLoginAttempts 記錄在 login_attempts collection
+type mongoLoginAttempts struct{}
+
+func (mongoLoginAttempts) fail(ctx context.Context, key string, now time.Time) (int, error) {
+	var attempt models.LoginAttempt
+	err := config.GetCollection("login_attempts").FindOneAndUpdate(ctx,
+		bson.M{"_id": key},
+		bson.M{
+			"$inc": bson.M{"failures": 1},
+			"$set": bson.M{"last_failure_at": now},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&attempt)
+	return attempt.Failures, err
+}
+
+func (mongoLoginAttempts) lock(ctx context.Context, key string, until time.Time) error {
+	_, err := config.GetCollection("login_attempts").UpdateOne(ctx, bson.M{"_id": key}, bson.M{"$set": bson.M{"locked_until": until}})
+	return err
+}
+
+func (mongoLoginAttempts) lockedUntil(ctx context.Context, keys []string, now time.Time) (time.Time, error) {
+	var attempt models.LoginAttempt
+	err := config.GetCollection("login_attempts").FindOne(ctx,
+		bson.M{"_id": bson.M{"$in": keys}, "locked_until": bson.M{"$gt": now}},
+		options.FindOne().SetSort(bson.D{{Key: "locked_until", Value: -1}}),
+	).Decode(&attempt)
+	if err == mongo.ErrNoDocuments {
+		return time.Time{}, nil
+	}
+	return attempt.LockedUntil, err
+}
+
+func (mongoLoginAttempts) reset(ctx context.Context, key string) error {
+	_, err := config.GetCollection("login_attempts").DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
+
+// loginLockedFor 回傳帳號或 IP 尚需等待的時間 (0 代表未鎖定)
+func loginLockedFor(ctx context.Context, attempts loginAttemptStore, now time.Time, keys ...string) time.Duration {
+	until, err := attempts.lockedUntil(ctx, keys, now)
+	if err != nil || !until.After(now) {
+		return 0
+	}
+	return until.Sub(now)
+}
+
+// recordLoginFailure 累加失敗次數，超過門檻時設定鎖定時間
+func recordLoginFailure(ctx context.Context, attempts loginAttemptStore, key string, threshold int, now time.Time) {
+	failures, err := attempts.fail(ctx, key, now)
+	if err != nil {
+		return
+	}
+	if d := lockoutDuration(failures, threshold); d > 0 {
+		attempts.lock(ctx, key, now.Add(d))
+	}
+}
+
+// recordCredentialFailure 密碼或第二步驗證失敗時，同時累加帳號與 IP 的失敗次數
+func recordCredentialFailure(ctx context.Context, attempts loginAttemptStore, username, ip string, now time.Time) {
+	recordLoginFailure(ctx, attempts, userAttemptKey(username), userFailureThreshold, now)
+	recordLoginFailure(ctx, attempts, ipAttemptKey(ip), ipFailureThreshold, now)
+}
+
+// resetLoginFailures 完整登入成功 (含兩步驟驗證) 後清除帳號的失敗紀錄
+// IP 的計數不清除，避免攻擊者用自己的帳號登入來重設同一 IP 的計數
+func resetLoginFailures(ctx context.Context, attempts loginAttemptStore, username string) {
+	attempts.reset(ctx, userAttemptKey(username))
+}
+
+// loginResult 登入某一步的結果
+type loginResult int
+
+const (
+	loginOK                loginResult = iota // 完整登入成功，已清除帳號的失敗次數
+	loginNeedsSecondFactor                    // 密碼正確，還需要兩步驟驗證 (失敗次數尚未清除)
+	loginFailed                               // 帳號、密碼或驗證碼錯誤，已累加失敗次數
+	loginLocked                               // 失敗次數過多，仍在鎖定期間
+	loginDisabled                             // 帳號已停用
+)
+
+// passwordLogin 登入第一步：檢查鎖定、帳號與密碼
+// 密碼正確還不算登入成功，啟用兩步驟驗證的帳號要等 secondFactorLogin 通過後才清除失敗次數
+func passwordLogin(ctx context.Context, attempts loginAttemptStore, find func(context.Context, string) (models.User, error), input LoginInput, ip string, now time.Time) (models.User, loginResult, time.Duration) {
+	if wait := loginLockedFor(ctx, attempts, now, userAttemptKey(input.Username), ipAttemptKey(ip)); wait > 0 {
+		return models.User{}, loginLocked, wait
+	}
+
+	user, err := find(ctx, input.Username)
+	if err != nil || !checkPassword(user, input.Password) {
+		recordCredentialFailure(ctx, attempts, input.Username, ip, now)
+		return models.User{}, loginFailed, 0
+	}
+	if user.Disabled {
+		return user, loginDisabled, 0
+	}
+	if user.TOTPEnabled {
+		return user, loginNeedsSecondFactor, 0
+	}
+
+	resetLoginFailures(ctx, attempts, user.Username)
+	return user, loginOK, 0
+}
+
+// secondFactorLogin 登入第二步：檢查鎖定與 TOTP 驗證碼 (或復原碼)
+// 與密碼共用鎖定計數，避免反覆重新取得 challenge 來暴力猜測驗證碼
+func secondFactorLogin(ctx context.Context, attempts loginAttemptStore, factors secondFactorStore, user models.User, input VerifyLoginInput, ip string, now time.Time) (loginResult, time.Duration) {
+	if wait := loginLockedFor(ctx, attempts, now, userAttemptKey(user.Username), ipAttemptKey(ip)); wait > 0 {
+		return loginLocked, wait
+	}
+
+	if !checkSecondFactor(ctx, factors, user, input.Code, input.RecoveryCode, now) {
+		recordCredentialFailure(ctx, attempts, user.Username, ip, now)
+		return loginFailed, 0
+	}
+
+	resetLoginFailures(ctx, attempts, user.Username)
+	return loginOK, 0
+}
+
+// abortLoginLocked 回傳 429 與 Retry-After
+func abortLoginLocked(c *gin.Context, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       "登入失敗次數過多，請稍後再試",
+		"retry_after": seconds,
+	})
+}
@@ -0,0 +1,279 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"server/models"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryLoginAttempts 記憶體版的 loginAttemptStore
+type memoryLoginAttempts map[string]*models.LoginAttempt
+
+func (m memoryLoginAttempts) fail(ctx context.Context, key string, now time.Time) (int, error) {
+	attempt, ok := m[key]
+	if !ok {
+		attempt = &models.LoginAttempt{ID: key}
+		m[key] = attempt
+	}
+	attempt.Failures++
+	return attempt.Failures, nil
+}
+
+func (m memoryLoginAttempts) lock(ctx context.Context, key string, until time.Time) error {
+	m[key].LockedUntil = until
+	return nil
+}
+
+func (m memoryLoginAttempts) lockedUntil(ctx context.Context, keys []string, now time.Time) (time.Time, error) {
+	var latest time.Time
+	for _, key := range keys {
+		if attempt, ok := m[key]; ok && attempt.LockedUntil.After(now) && attempt.LockedUntil.After(latest) {
+			latest = attempt.LockedUntil
+		}
+	}
+	return latest, nil
+}
+
+func (m memoryLoginAttempts) reset(ctx context.Context, key string) error {
+	delete(m, key)
+	return nil
+}
+
+func (m memoryLoginAttempts) failures(key string) int {
+	if attempt, ok := m[key]; ok {
+		return attempt.Failures
+	}
+	return 0
+}
+
+// loginFixture 以記憶體資料模擬登入的兩個步驟
+type loginFixture struct {
+	t        *testing.T
+	attempts memoryLoginAttempts
+	factors  *memorySecondFactors
+	users    map[string]models.User
+	now      time.Time
+}
+
+const testPassword = "correct horse"
+
+func newLoginFixture(t *testing.T, usernames ...string) *loginFixture {
+	t.Helper()
+	hash, err := HashPassword(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &loginFixture{
+		t:        t,
+		attempts: memoryLoginAttempts{},
+		factors:  newMemorySecondFactors(),
+		users:    make(map[string]models.User),
+		now:      time.Unix(1111111111, 0),
+	}
+	for _, username := range usernames {
+		f.users[username] = models.User{ID: primitive.NewObjectID(), Username: username, PasswordHash: hash}
+	}
+	return f
+}
+
+func (f *loginFixture) enableTOTP(username string) {
+	user := f.users[username]
+	user.TOTPEnabled = true
+	user.TOTPSecret = rfc6238Secret
+	f.users[username] = user
+}
+
+func (f *loginFixture) find(ctx context.Context, username string) (models.User, error) {
+	user, ok := f.users[username]
+	if !ok {
+		return user, errors.New("not found")
+	}
+	return user, nil
+}
+
+func (f *loginFixture) password(username, password, ip string) (loginResult, time.Duration) {
+	_, result, wait := passwordLogin(context.Background(), f.attempts, f.find, LoginInput{Username: username, Password: password}, ip, f.now)
+	return result, wait
+}
+
+func (f *loginFixture) secondFactor(username, code, ip string) (loginResult, time.Duration) {
+	return secondFactorLogin(context.Background(), f.attempts, f.factors, f.users[username], VerifyLoginInput{Code: code}, ip, f.now)
+}
+
+// code 目前時間的 TOTP 驗證碼
+func (f *loginFixture) code() string {
+	return mustTOTP(f.t, rfc6238Secret, f.now)
+}
+
+func (f *loginFixture) expect(step string, gotResult loginResult, gotWait time.Duration, wantResult loginResult, wantWait time.Duration) {
+	f.t.Helper()
+	if gotResult != wantResult || gotWait != wantWait {
+		f.t.Fatalf("%s = %d (wait %v), want %d (wait %v)", step, gotResult, gotWait, wantResult, wantWait)
+	}
+}
+
+func TestLockoutDuration(t *testing.T) {
+	tests := []struct {
+		failures, threshold int
+		want                time.Duration
+	}{
+		{4, userFailureThreshold, 0},
+		{5, userFailureThreshold, 30 * time.Second},
+		{6, userFailureThreshold, time.Minute},
+		{7, userFailureThreshold, 2 * time.Minute},
+		{11, userFailureThreshold, 32 * time.Minute},
+		{12, userFailureThreshold, time.Hour}, // 64 分鐘超過上限
+		{100, userFailureThreshold, time.Hour},
+		{19, ipFailureThreshold, 0},
+		{20, ipFailureThreshold, 30 * time.Second},
+		{21, ipFailureThreshold, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := lockoutDuration(tt.failures, tt.threshold); got != tt.want {
+			t.Errorf("lockoutDuration(%d, %d) = %v, want %v", tt.failures, tt.threshold, got, tt.want)
+		}
+	}
+}
+
+func TestPasswordLoginLocksUserAfterFiveFailures(t *testing.T) {
+	f := newLoginFixture(t, "jonas")
+
+	for i := 1; i < userFailureThreshold; i++ {
+		result, wait := f.password("jonas", "wrong", "10.0.0.1")
+		f.expect(fmt.Sprintf("failure %d", i), result, wait, loginFailed, 0)
+	}
+	// 第 4 次失敗後還沒有鎖定
+	result, wait := f.password("jonas", testPassword, "10.0.0.1")
+	f.expect("login before the threshold", result, wait, loginOK, 0)
+
+	// 成功登入後重新計算，連續 5 次失敗開始鎖定 30 秒，換 IP 也一樣
+	for i := 1; i <= userFailureThreshold; i++ {
+		f.password("jonas", "wrong", "10.0.0.1")
+	}
+	result, wait = f.password("jonas", testPassword, "10.0.0.2")
+	f.expect("login while locked", result, wait, loginLocked, 30*time.Second)
+
+	// 鎖定期間的嘗試不再累加；期滿後再失敗一次，鎖定時間加倍
+	f.now = f.now.Add(30 * time.Second)
+	result, wait = f.password("jonas", "wrong", "10.0.0.1")
+	f.expect("failure after the lockout", result, wait, loginFailed, 0)
+	result, wait = f.password("jonas", testPassword, "10.0.0.1")
+	f.expect("login after the sixth failure", result, wait, loginLocked, time.Minute)
+
+	// 鎖定的是帳號，不影響同一 IP 的其他帳號
+	f.users["yunchen"] = models.User{ID: primitive.NewObjectID(), Username: "yunchen", PasswordHash: f.users["jonas"].PasswordHash}
+	result, wait = f.password("yunchen", testPassword, "10.0.0.1")
+	f.expect("other user on the same IP", result, wait, loginOK, 0)
+}
+
+func TestPasswordLoginLocksIPAfterTwentyFailures(t *testing.T) {
+	f := newLoginFixture(t, "jonas")
+
+	// 每個帳號只失敗一次，累積的是 IP 的計數 (不存在的帳號也算)
+	for i := 1; i < ipFailureThreshold; i++ {
+		f.password(fmt.Sprintf("user%d", i), "wrong", "10.0.0.1")
+	}
+	result, wait := f.password("jonas", testPassword, "10.0.0.1")
+	f.expect("login before the IP threshold", result, wait, loginOK, 0)
+
+	f.password("user20", "wrong", "10.0.0.1")
+	if got := f.attempts.failures(ipAttemptKey("10.0.0.1")); got != ipFailureThreshold {
+		t.Fatalf("IP failures = %d, want %d (a successful login must not reset the IP counter)", got, ipFailureThreshold)
+	}
+	result, wait = f.password("jonas", testPassword, "10.0.0.1")
+	f.expect("login from a locked IP", result, wait, loginLocked, 30*time.Second)
+
+	result, wait = f.password("jonas", testPassword, "10.0.0.2")
+	f.expect("login from another IP", result, wait, loginOK, 0)
+}
+
+func TestSecondFactorFailuresCountTowardLockout(t *testing.T) {
+	f := newLoginFixture(t, "jonas")
+	f.enableTOTP("jonas")
+
+	for i := 0; i < 3; i++ {
+		f.password("jonas", "wrong", "10.0.0.1")
+	}
+	// 密碼正確但還沒完成第二步，失敗次數不清除
+	result, wait := f.password("jonas", testPassword, "10.0.0.1")
+	f.expect("correct password", result, wait, loginNeedsSecondFactor, 0)
+	if got := f.attempts.failures(userAttemptKey("jonas")); got != 3 {
+		t.Fatalf("user failures after the password step = %d, want 3", got)
+	}
+
+	// 錯誤的驗證碼與錯誤的密碼共用計數，第 5 次失敗後鎖定
+	for i := 0; i < 2; i++ {
+		result, wait = f.secondFactor("jonas", "000000", "10.0.0.1")
+		f.expect("wrong code", result, wait, loginFailed, 0)
+	}
+	result, wait = f.secondFactor("jonas", f.code(), "10.0.0.1")
+	f.expect("correct code while locked", result, wait, loginLocked, 30*time.Second)
+	result, wait = f.password("jonas", testPassword, "10.0.0.1")
+	f.expect("password while locked", result, wait, loginLocked, 30*time.Second)
+}
+
+func TestLoginFailuresResetOnlyAfterFullLogin(t *testing.T) {
+	f := newLoginFixture(t, "jonas")
+	f.enableTOTP("jonas")
+
+	for i := 0; i < userFailureThreshold-1; i++ {
+		f.password("jonas", "wrong", "10.0.0.1")
+	}
+	result, wait := f.password("jonas", testPassword, "10.0.0.1")
+	f.expect("correct password", result, wait, loginNeedsSecondFactor, 0)
+	if got := f.attempts.failures(userAttemptKey("jonas")); got != userFailureThreshold-1 {
+		t.Fatalf("user failures after the password step = %d, want %d", got, userFailureThreshold-1)
+	}
+
+	result, wait = f.secondFactor("jonas", f.code(), "10.0.0.1")
+	f.expect("correct code", result, wait, loginOK, 0)
+	if got := f.attempts.failures(userAttemptKey("jonas")); got != 0 {
+		t.Fatalf("user failures after a full login = %d, want 0", got)
+	}
+	// IP 的計數不因登入成功而清除
+	if got := f.attempts.failures(ipAttemptKey("10.0.0.1")); got != userFailureThreshold-1 {
+		t.Fatalf("IP failures after a full login = %d, want %d", got, userFailureThreshold-1)
+	}
+}
+
+func TestPasswordLoginDisabledUser(t *testing.T) {
+	f := newLoginFixture(t, "jonas")
+	user := f.users["jonas"]
+	user.Disabled = true
+	f.users["jonas"] = user
+
+	result, wait := f.password("jonas", testPassword, "10.0.0.1")
+	f.expect("disabled user", result, wait, loginDisabled, 0)
+	// 停用的帳號密碼錯誤時仍然累加失敗次數
+	result, wait = f.password("jonas", "wrong", "10.0.0.1")
+	f.expect("disabled user with a wrong password", result, wait, loginFailed, 0)
+}
+
+func TestAbortLoginLockedSetsRetryAfter(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	abortLoginLocked(c, 29*time.Second+100*time.Millisecond)
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429", w.Code)
+	}
+	// 不足一秒的部分無條件進位
+	if got := w.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("Retry-After = %q, want 30", got)
+	}
+	var body struct {
+		RetryAfter int `json:"retry_after"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.RetryAfter != 30 {
+		t.Errorf("retry_after = %d, %v, want 30", body.RetryAfter, err)
+	}
+}
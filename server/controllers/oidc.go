@@ -0,0 +1,685 @@
+package controllers
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"server/config"
+	"server/models"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// oidcStateCookie: 綁定發起登入的瀏覽器，callback 的 state 必須與此 Cookie 相同
+	oidcStateCookie = "fintrack_oidc_state"
+	// oidcStateTTL: 導向 IdP 後需在此時間內完成登入
+	oidcStateTTL = 10 * time.Minute
+	// oidcClockSkew: 驗證 ID token 時間時容許的誤差
+	oidcClockSkew = time.Minute
+)
+
+var errOIDCDisabled = errors.New("oidc is not configured")
+
+// oidcHTTPClient 呼叫 IdP 時使用，避免 IdP 無回應時卡住請求
+var oidcHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// oidcProvider 為 discovery 文件中會用到的欄位
+type oidcProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// discovery 文件與簽章公鑰的快取 (IdP 換 key 時會依 kid 重新抓取)
+var (
+	oidcMu       sync.Mutex
+	oidcCache    = map[string]*oidcProvider{}
+	oidcKeyCache = map[string]map[string]*rsa.PublicKey{}
+)
+
+// idTokenClaims 為 ID token 中會用到的欄位
+type idTokenClaims struct {
+	Issuer            string       `json:"iss"`
+	Subject           string       `json:"sub"`
+	Audience          oidcAudience `json:"aud"`
+	Expiry            int64        `json:"exp"`
+	IssuedAt          int64        `json:"iat"`
+	Nonce             string       `json:"nonce"`
+	Email             string       `json:"email"`
+	PreferredUsername string       `json:"preferred_username"`
+}
+
+// oidcAudience: aud 可能是字串或字串陣列
+type oidcAudience []string
+
+func (a *oidcAudience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = oidcAudience{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*a = multiple
+	return nil
+}
+
+func (a oidcAudience) contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// oidcGetJSON 以 GET 讀取 IdP 的 JSON 文件
+func oidcGetJSON(ctx context.Context, endpoint string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", endpoint, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out)
+}
+
+// discoverOIDC 取得 IdP 的端點設定
+func discoverOIDC(ctx context.Context, settings config.OIDCConfig) (*oidcProvider, error) {
+	oidcMu.Lock()
+	provider, ok := oidcCache[settings.IssuerURL]
+	oidcMu.Unlock()
+	if ok {
+		return provider, nil
+	}
+
+	provider = &oidcProvider{}
+	wellKnown := strings.TrimRight(settings.IssuerURL, "/") + "/.well-known/openid-configuration"
+	if err := oidcGetJSON(ctx, wellKnown, provider); err != nil {
+		return nil, err
+	}
+	if strings.TrimRight(provider.Issuer, "/") != strings.TrimRight(settings.IssuerURL, "/") {
+		return nil, fmt.Errorf("issuer mismatch: %s", provider.Issuer)
+	}
+	if provider.AuthorizationEndpoint == "" || provider.TokenEndpoint == "" || provider.JWKSURI == "" {
+		return nil, errors.New("discovery document is missing endpoints")
+	}
+
+	oidcMu.Lock()
+	oidcCache[settings.IssuerURL] = provider
+	oidcMu.Unlock()
+	return provider, nil
+}
+
+// fetchOIDCKeys 讀取 JWKS 中的 RSA 公鑰
+func fetchOIDCKeys(ctx context.Context, jwksURI string) (map[string]*rsa.PublicKey, error) {
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := oidcGetJSON(ctx, jwksURI, &jwks); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, key := range jwks.Keys {
+		if key.Kty != "RSA" || (key.Use != "" && key.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			continue
+		}
+		keys[key.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	return keys, nil
+}
+
+// oidcSigningKey 依 kid 取得公鑰，找不到時重新抓取一次 JWKS (IdP 可能已輪替 key)
+func oidcSigningKey(ctx context.Context, provider *oidcProvider, kid string) (*rsa.PublicKey, error) {
+	lookup := func(keys map[string]*rsa.PublicKey) *rsa.PublicKey {
+		if key, ok := keys[kid]; ok {
+			return key
+		}
+		// 沒有 kid 且只有一把 key 時直接使用
+		if kid == "" && len(keys) == 1 {
+			for _, key := range keys {
+				return key
+			}
+		}
+		return nil
+	}
+
+	oidcMu.Lock()
+	cached := oidcKeyCache[provider.JWKSURI]
+	oidcMu.Unlock()
+	if key := lookup(cached); key != nil {
+		return key, nil
+	}
+
+	keys, err := fetchOIDCKeys(ctx, provider.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	oidcMu.Lock()
+	oidcKeyCache[provider.JWKSURI] = keys
+	oidcMu.Unlock()
+
+	if key := lookup(keys); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// verifyIDToken 驗證 ID token 的簽章 (RS256)、issuer、audience、期限與 nonce
+func verifyIDToken(ctx context.Context, provider *oidcProvider, settings config.OIDCConfig, rawToken, nonce string) (idTokenClaims, error) {
+	var claims idTokenClaims
+
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return claims, errors.New("malformed id_token")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return claims, err
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return claims, err
+	}
+	if header.Alg != "RS256" {
+		return claims, fmt.Errorf("unsupported id_token alg %q", header.Alg)
+	}
+
+	key, err := oidcSigningKey(ctx, provider, header.Kid)
+	if err != nil {
+		return claims, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return claims, errors.New("invalid id_token signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return claims, err
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return claims, err
+	}
+
+	now := time.Now()
+	switch {
+	case claims.Issuer != provider.Issuer:
+		return claims, errors.New("id_token issuer mismatch")
+	case !claims.Audience.contains(settings.ClientID):
+		return claims, errors.New("id_token audience mismatch")
+	case now.After(time.Unix(claims.Expiry, 0).Add(oidcClockSkew)):
+		return claims, errors.New("id_token expired")
+	case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		return claims, errors.New("id_token nonce mismatch")
+	case claims.Subject == "":
+		return claims, errors.New("id_token has no subject")
+	}
+
+	return claims, nil
+}
+
+// exchangeOIDCCode 以 authorization code + PKCE verifier 向 IdP 換取 ID token
+func exchangeOIDCCode(ctx context.Context, provider *oidcProvider, settings config.OIDCConfig, code, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {settings.RedirectURL},
+		"client_id":     {settings.ClientID},
+		"code_verifier": {verifier},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if settings.ClientSecret != "" {
+		// client_secret_basic (RFC 6749 2.3.1)
+		req.SetBasicAuth(url.QueryEscape(settings.ClientID), url.QueryEscape(settings.ClientSecret))
+	}
+
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&result); err != nil {
+		return "", fmt.Errorf("token endpoint: %s", resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK || result.Error != "" {
+		return "", fmt.Errorf("token endpoint: %s %s", result.Error, result.ErrorDescription)
+	}
+	if result.IDToken == "" {
+		return "", errors.New("token endpoint returned no id_token")
+	}
+	return result.IDToken, nil
+}
+
+func setOIDCStateCookie(c *gin.Context, state string, maxAge int) {
+	// IdP 導回時屬於跨站的頂層導覽，SameSite=Strict 會讓 Cookie 帶不回來，因此最嚴格只用 Lax
+	settings := config.SessionCookieSettings()
+	if settings.SameSite == http.SameSiteStrictMode {
+		settings.SameSite = http.SameSiteLaxMode
+	}
+	c.SetSameSite(settings.SameSite)
+	c.SetCookie(oidcStateCookie, state, maxAge, "/", settings.Domain, settings.Secure, true)
+}
+
+// startOIDCFlow 產生 state / nonce / PKCE，並回傳 IdP 的授權網址
+// linkUsername 不為空時，callback 會把外部身分連結到該帳號
+func startOIDCFlow(ctx context.Context, c *gin.Context, linkUsername string) (string, error) {
+	settings := config.OIDCSettings()
+	if !settings.Enabled() {
+		return "", errOIDCDisabled
+	}
+
+	provider, err := discoverOIDC(ctx, settings)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := newSessionToken()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := newSessionToken()
+	if err != nil {
+		return "", err
+	}
+	verifier, err := newSessionToken()
+	if err != nil {
+		return "", err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+
+	_, err = config.GetCollection("oidc_states").InsertOne(ctx, models.OIDCState{
+		ID:           primitive.NewObjectID(),
+		StateHash:    hashToken(state),
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		LinkUsername: linkUsername,
+		ExpiresAt:    time.Now().Add(oidcStateTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	setOIDCStateCookie(c, state, int(oidcStateTTL.Seconds()))
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {settings.ClientID},
+		"redirect_uri":          {settings.RedirectURL},
+		"scope":                 {strings.Join(settings.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(provider.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return provider.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// findUserByIdentity 依外部身分找出已連結的本地帳號
+func findUserByIdentity(ctx context.Context, issuer, subject string) (models.User, error) {
+	var user models.User
+	err := config.GetCollection("users").FindOne(ctx, bson.M{
+		"identities": bson.M{"$elemMatch": bson.M{"issuer": issuer, "subject": subject}},
+	}).Decode(&user)
+	return user, err
+}
+
+// provisionOIDCUser 第一次以外部身分登入時建立本地帳號 (沒有密碼，只能透過 IdP 登入)
+func provisionOIDCUser(ctx context.Context, identity models.ExternalIdentity, claims idTokenClaims) (models.User, error) {
+	base := strings.TrimSpace(claims.PreferredUsername)
+	if base == "" && claims.Email != "" {
+		base = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+	if base == "" {
+		base = "user"
+	}
+
+	collection := config.GetCollection("users")
+	// 帳號名稱已被使用時加上流水號；不會自動併入同名的本地帳號，需由使用者自行連結
+	for i := 1; i <= 20; i++ {
+		username := base
+		if i > 1 {
+			username = fmt.Sprintf("%s-%d", base, i)
+		}
+
+		user := models.User{
+			ID:         primitive.NewObjectID(),
+			Username:   username,
+			Role:       models.RoleUser,
+			Identities: []models.ExternalIdentity{identity},
+			CreatedAt:  time.Now(),
+			UpdatedAt:  time.Now(),
+		}
+		_, err := collection.InsertOne(ctx, user)
+		if err == nil {
+			return user, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return models.User{}, err
+		}
+		// 同一個外部身分在並行的登入中已被建立
+		if existing, findErr := findUserByIdentity(ctx, identity.Issuer, identity.Subject); findErr == nil {
+			return existing, nil
+		}
+	}
+	return models.User{}, errors.New("no available username")
+}
+
+// oidcRedirect 完成或失敗後導回前端；失敗時帶上 oidc_error 供登入頁顯示
+func oidcRedirect(c *gin.Context, errorCode string) {
+	target := config.OIDCSettings().PostLoginURL
+	if errorCode != "" {
+		if u, err := url.Parse(target); err == nil {
+			query := u.Query()
+			query.Set("oidc_error", errorCode)
+			u.RawQuery = query.Encode()
+			target = u.String()
+		}
+	}
+	c.Redirect(http.StatusFound, target)
+}
+
+// GetOIDCStatus 讓前端判斷是否顯示「使用單一登入」按鈕
+func GetOIDCStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"enabled": config.OIDCSettings().Enabled()})
+}
+
+// OIDCLogin 導向 IdP 進行登入 (authorization code flow + PKCE)
+func OIDCLogin(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	authURL, err := startOIDCFlow(ctx, c, "")
+	if err == errOIDCDisabled {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未設定單一登入"})
+		return
+	}
+	if err != nil {
+		log.Printf("⚠️ OIDC 登入初始化失敗: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "無法連線到身分提供者"})
+		return
+	}
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// redeemOIDCCode 以 authorization code 換取並驗證 ID token
+// 失敗時回傳要帶給前端的 oidc_error 代碼
+func redeemOIDCCode(ctx context.Context, settings config.OIDCConfig, code string, pending models.OIDCState) (idTokenClaims, string) {
+	provider, err := discoverOIDC(ctx, settings)
+	if err != nil {
+		log.Printf("⚠️ OIDC discovery 失敗: %v", err)
+		return idTokenClaims{}, "provider"
+	}
+	rawToken, err := exchangeOIDCCode(ctx, provider, settings, code, pending.CodeVerifier)
+	if err != nil {
+		log.Printf("⚠️ OIDC token 交換失敗: %v", err)
+		return idTokenClaims{}, "token"
+	}
+	claims, err := verifyIDToken(ctx, provider, settings, rawToken, pending.Nonce)
+	if err != nil {
+		log.Printf("⚠️ OIDC ID token 驗證失敗: %v", err)
+		return idTokenClaims{}, "token"
+	}
+	return claims, ""
+}
+
+// OIDCCallback IdP 導回後交換 token、驗證 ID token，並登入或連結帳號
+func OIDCCallback(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	settings := config.OIDCSettings()
+	if !settings.Enabled() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未設定單一登入"})
+		return
+	}
+
+	if idpError := c.Query("error"); idpError != "" {
+		log.Printf("⚠️ OIDC IdP 回傳錯誤: %s %s", idpError, c.Query("error_description"))
+		oidcRedirect(c, "denied")
+		return
+	}
+
+	// 1. state 必須與發起登入時寫入的 Cookie 相同，且只能使用一次
+	state := c.Query("state")
+	cookieState, _ := c.Cookie(oidcStateCookie)
+	setOIDCStateCookie(c, "", -1)
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(cookieState)) != 1 {
+		oidcRedirect(c, "state")
+		return
+	}
+
+	var pending models.OIDCState
+	err := config.GetCollection("oidc_states").FindOneAndDelete(ctx, bson.M{
+		"state_hash": hashToken(state),
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&pending)
+	if err != nil {
+		oidcRedirect(c, "state")
+		return
+	}
+
+	// 2. 以 code + PKCE verifier 換取 ID token 並驗證
+	claims, errorCode := redeemOIDCCode(ctx, settings, c.Query("code"), pending)
+	if errorCode != "" {
+		oidcRedirect(c, errorCode)
+		return
+	}
+
+	identity := models.ExternalIdentity{
+		Issuer:   claims.Issuer,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+		LinkedAt: time.Now(),
+	}
+
+	// 3a. 連結模式：把外部身分加到已登入的本地帳號
+	if pending.LinkUsername != "" {
+		if owner, err := findUserByIdentity(ctx, identity.Issuer, identity.Subject); err == nil {
+			if owner.Username != pending.LinkUsername {
+				oidcRedirect(c, "already_linked")
+				return
+			}
+			oidcRedirect(c, "")
+			return
+		}
+
+		_, err := config.GetCollection("users").UpdateOne(ctx,
+			bson.M{"username": pending.LinkUsername},
+			bson.M{
+				"$push": bson.M{"identities": identity},
+				"$set":  bson.M{"updated_at": time.Now()},
+			},
+		)
+		if err != nil {
+			oidcRedirect(c, "link")
+			return
+		}
+		oidcRedirect(c, "")
+		return
+	}
+
+	// 3b. 登入模式：找出已連結的帳號，沒有則自動建立
+	user, err := findUserByIdentity(ctx, identity.Issuer, identity.Subject)
+	if err == mongo.ErrNoDocuments {
+		if !settings.AutoProvision {
+			oidcRedirect(c, "not_linked")
+			return
+		}
+		user, err = provisionOIDCUser(ctx, identity, claims)
+	}
+	if err != nil {
+		log.Printf("⚠️ OIDC 使用者建立失敗: %v", err)
+		oidcRedirect(c, "provision")
+		return
+	}
+	if user.Disabled {
+		oidcRedirect(c, "disabled")
+		return
+	}
+
+	session, err := createSession(ctx, c, user.Username)
+	if err != nil {
+		oidcRedirect(c, "session")
+		return
+	}
+	recordAuthEvent(ctx, c, AuditLogin, user.Username, session.ID)
+
+	oidcRedirect(c, "")
+}
+
+// GetIdentities 列出已連結的外部身分
+func GetIdentities(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(string)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := findUser(ctx, currentUser)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到使用者"})
+		return
+	}
+
+	identities := user.Identities
+	if identities == nil {
+		identities = []models.ExternalIdentity{}
+	}
+	c.JSON(http.StatusOK, identities)
+}
+
+// LinkIdentity 開始將外部身分連結到目前帳號，回傳要導向的 IdP 網址
+func LinkIdentity(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(string)
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	authURL, err := startOIDCFlow(ctx, c, currentUser)
+	if err == errOIDCDisabled {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未設定單一登入"})
+		return
+	}
+	if err != nil {
+		log.Printf("⚠️ OIDC 連結初始化失敗: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "無法連線到身分提供者"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"url": authURL})
+}
+
+// UnlinkIdentity 解除外部身分連結 (沒有密碼的帳號不能移除最後一個身分)
+func UnlinkIdentity(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(string)
+	subject := c.Param("subject")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := findUser(ctx, currentUser)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到使用者"})
+		return
+	}
+
+	found := false
+	for _, identity := range user.Identities {
+		if identity.Subject == subject {
+			found = true
+		}
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到該外部身分"})
+		return
+	}
+	if user.PasswordHash == "" && len(user.Identities) == 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "請先設定密碼，否則解除後將無法登入"})
+		return
+	}
+
+	_, err = config.GetCollection("users").UpdateOne(ctx,
+		bson.M{"_id": user.ID},
+		bson.M{
+			"$pull": bson.M{"identities": bson.M{"subject": subject}},
+			"$set":  bson.M{"updated_at": time.Now()},
+		},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "解除連結失敗"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已解除連結"})
+}
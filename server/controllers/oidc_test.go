@@ -0,0 +1,260 @@
+package controllers
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"server/config"
+	"server/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	mockIdPClientID = "fintrack"
+	mockIdPKeyID    = "test-key"
+	mockIdPSubject  = "idp-user-1"
+)
+
+// mockIdP 模擬 OIDC 身分提供者：discovery、JWKS 與 token endpoint
+// token endpoint 只接受 code 與 verifier 都正確的請求，並在 ID token 中帶上 nonce
+type mockIdP struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	code     string
+	verifier string
+	nonce    string
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &mockIdP{key: key, code: "good-code", verifier: "pkce-verifier", nonce: "expected-nonce"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcProvider{
+			Issuer:                idp.server.URL,
+			AuthorizationEndpoint: idp.server.URL + "/authorize",
+			TokenEndpoint:         idp.server.URL + "/token",
+			JWKSURI:               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": mockIdPKeyID,
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.PostForm.Get("grant_type") != "authorization_code" ||
+			r.PostForm.Get("code") != idp.code ||
+			r.PostForm.Get("code_verifier") != idp.verifier ||
+			r.PostForm.Get("client_id") != mockIdPClientID {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idp.signIDToken(t)})
+	})
+
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (m *mockIdP) settings() config.OIDCConfig {
+	return config.OIDCConfig{
+		IssuerURL:   m.server.URL,
+		ClientID:    mockIdPClientID,
+		RedirectURL: "http://localhost/api/v1/auth/oidc/callback",
+	}
+}
+
+func (m *mockIdP) signIDToken(t *testing.T) string {
+	t.Helper()
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": mockIdPKeyID, "typ": "JWT"})
+	payload, _ := json.Marshal(map[string]interface{}{
+		"iss":                m.server.URL,
+		"sub":                mockIdPSubject,
+		"aud":                mockIdPClientID,
+		"exp":                time.Now().Add(5 * time.Minute).Unix(),
+		"iat":                time.Now().Unix(),
+		"nonce":              m.nonce,
+		"email":              "jonas@example.com",
+		"preferred_username": "jonas",
+	})
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, m.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestRedeemOIDCCode(t *testing.T) {
+	idp := newMockIdP(t)
+
+	tests := []struct {
+		name      string
+		code      string
+		verifier  string
+		nonce     string
+		wantError string
+	}{
+		{name: "成功登入", code: "good-code", verifier: "pkce-verifier", nonce: "expected-nonce"},
+		{name: "錯誤的 code", code: "bad-code", verifier: "pkce-verifier", nonce: "expected-nonce", wantError: "token"},
+		{name: "PKCE verifier 不符", code: "good-code", verifier: "other-verifier", nonce: "expected-nonce", wantError: "token"},
+		{name: "nonce 不符", code: "good-code", verifier: "pkce-verifier", nonce: "other-nonce", wantError: "token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pending := models.OIDCState{CodeVerifier: tt.verifier, Nonce: tt.nonce}
+			claims, errorCode := redeemOIDCCode(context.Background(), idp.settings(), tt.code, pending)
+			if errorCode != tt.wantError {
+				t.Fatalf("errorCode = %q, want %q", errorCode, tt.wantError)
+			}
+			if tt.wantError != "" {
+				return
+			}
+			if claims.Subject != mockIdPSubject || claims.Issuer != idp.server.URL || claims.PreferredUsername != "jonas" {
+				t.Errorf("claims = %+v", claims)
+			}
+		})
+	}
+}
+
+func TestRedeemOIDCCodeProviderUnavailable(t *testing.T) {
+	idp := newMockIdP(t)
+	settings := idp.settings()
+	settings.IssuerURL = idp.server.URL + "/missing"
+
+	if _, errorCode := redeemOIDCCode(context.Background(), settings, "good-code", models.OIDCState{}); errorCode != "provider" {
+		t.Fatalf("errorCode = %q, want provider", errorCode)
+	}
+}
+
+func TestOIDCCallbackStateMismatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	idp := newMockIdP(t)
+	t.Setenv("OIDC_ISSUER_URL", idp.server.URL)
+	t.Setenv("OIDC_CLIENT_ID", mockIdPClientID)
+	t.Setenv("OIDC_REDIRECT_URL", idp.settings().RedirectURL)
+	t.Setenv("OIDC_POST_LOGIN_URL", "/login")
+
+	tests := []struct {
+		name   string
+		state  string
+		cookie string
+	}{
+		{name: "state 與 Cookie 不同", state: "from-attacker", cookie: "from-browser"},
+		{name: "沒有 Cookie", state: "from-attacker"},
+		{name: "沒有 state", cookie: "from-browser"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := url.Values{"code": {"good-code"}, "state": {tt.state}}
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/callback?"+query.Encode(), nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: tt.cookie})
+			}
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = req
+
+			OIDCCallback(c)
+
+			if w.Code != http.StatusFound {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusFound)
+			}
+			location, err := url.Parse(w.Header().Get("Location"))
+			if err != nil || location.Path != "/login" || location.Query().Get("oidc_error") != "state" {
+				t.Errorf("Location = %q, want /login?oidc_error=state", w.Header().Get("Location"))
+			}
+			if !strings.Contains(w.Header().Get("Set-Cookie"), oidcStateCookie+"=;") {
+				t.Errorf("state cookie was not cleared: %q", w.Header().Get("Set-Cookie"))
+			}
+		})
+	}
+}
+
+func TestConfirmAccountOwnerBeforeDeletion(t *testing.T) {
+	hash, err := HashPassword(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withPassword := models.User{Username: "jonas", PasswordHash: hash}
+	// provisionOIDCUser 建立的帳號沒有密碼
+	passwordless := models.User{Username: "idp-user", Identities: []models.ExternalIdentity{{Subject: mockIdPSubject}}}
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		user     models.User
+		password string
+		// sessionAge: 工作階段登入多久 (0 代表以權杖驗證，沒有工作階段)
+		sessionAge time.Duration
+		wantOK     bool
+		wantReauth bool
+	}{
+		{name: "密碼正確", user: withPassword, password: testPassword, sessionAge: time.Hour, wantOK: true},
+		{name: "密碼錯誤", user: withPassword, password: "wrong", sessionAge: time.Minute},
+		{name: "有密碼的帳號不能省略密碼", user: withPassword, sessionAge: time.Minute},
+		{name: "沒有密碼的帳號剛以外部身分登入", user: passwordless, sessionAge: time.Minute, wantOK: true},
+		{name: "沒有密碼的帳號忽略輸入的密碼", user: passwordless, password: "anything", sessionAge: time.Minute, wantOK: true},
+		{name: "沒有密碼的帳號工作階段太舊", user: passwordless, sessionAge: reauthMaxAge + time.Second, wantReauth: true},
+		{name: "沒有密碼的帳號以權杖驗證", user: passwordless, wantReauth: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			if tt.sessionAge > 0 {
+				c.Set("sessionCreatedAt", now.Add(-tt.sessionAge))
+			}
+
+			if got := confirmAccountOwner(c, tt.user, tt.password, now); got != tt.wantOK {
+				t.Fatalf("confirmAccountOwner() = %v, want %v", got, tt.wantOK)
+			}
+			if tt.wantOK {
+				return
+			}
+			if w.Code != http.StatusUnauthorized {
+				t.Fatalf("status = %d, want 401", w.Code)
+			}
+			var body struct {
+				ReauthRequired bool `json:"reauth_required"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.ReauthRequired != tt.wantReauth {
+				t.Errorf("reauth_required = %v, %v, want %v", body.ReauthRequired, err, tt.wantReauth)
+			}
+		})
+	}
+}
@@ -2,52 +2,58 @@ package controllers
 
 import (
 	"context"
+	"fmt"
 	"net/http"
-	"server/config"
+	"server/models"
+	"server/repository"
+	"sort"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type YearlyReportResponse struct {
 	Year       int                `json:"year"`
-	Summary    YearlySummary       `json:"summary"`
-	Monthly    []YearlyMonthly     `json:"monthly"`
-	ByCategory []YearlyByCategory  `json:"byCategory"`
+	Currency   string             `json:"currency"`
+	Summary    YearlySummary      `json:"summary"`
+	Monthly    []YearlyMonthly    `json:"monthly"`
+	ByCategory []YearlyByCategory `json:"byCategory"`
 }
 
 type YearlySummary struct {
-	TotalExpense      float64     `json:"totalExpense"`
-	TotalIncome       float64     `json:"totalIncome"`
-	Net               float64     `json:"net"`
-	AvgMonthlyExpense float64     `json:"avgMonthlyExpense"`
-	MaxExpenseMonth   MonthAmount `json:"maxExpenseMonth"`
-	MinExpenseMonth   MonthAmount `json:"minExpenseMonth"`
+	TotalExpense      models.Money `json:"totalExpense"`
+	TotalIncome       models.Money `json:"totalIncome"`
+	Net               models.Money `json:"net"`
+	AvgMonthlyExpense models.Money `json:"avgMonthlyExpense"`
+	MaxExpenseMonth   MonthAmount  `json:"maxExpenseMonth"`
+	MinExpenseMonth   MonthAmount  `json:"minExpenseMonth"`
 }
 
 type MonthAmount struct {
-	Month  int     `json:"month"`
-	Amount float64 `json:"amount"`
+	Month  int          `json:"month"`
+	Amount models.Money `json:"amount"`
 }
 
 type YearlyMonthly struct {
-	Month   int     `json:"month"`
-	Expense float64 `json:"expense"`
-	Income  float64 `json:"income"`
-	Net     float64 `json:"net"`
+	Month   int          `json:"month"`
+	Expense models.Money `json:"expense"`
+	Income  models.Money `json:"income"`
+	Net     models.Money `json:"net"`
 }
 
 type YearlyByCategory struct {
-	CategoryID   string  `json:"categoryId"`
-	CategoryName string  `json:"categoryName"`
-	Total        float64 `json:"total"`
-	Percent      float64 `json:"percent"`
-	Count        int64   `json:"count"`
-	AvgMonthly   float64 `json:"avgMonthly"`
+	CategoryID   string       `json:"categoryId"`
+	CategoryName string       `json:"categoryName"`
+	Total        models.Money `json:"total"`
+	Percent      float64      `json:"percent"`
+	Count        int64        `json:"count"`
+	AvgMonthly   models.Money `json:"avgMonthly"`
+	ParentID     string       `json:"parentId,omitempty"`
+	// 以下僅 view=tree: Total/Count 包含子類別，OwnTotal 為類別本身的金額
+	OwnTotal models.Money       `json:"ownTotal,omitempty"`
+	Children []YearlyByCategory `json:"children,omitempty"`
 }
 
 // GetYearlyReport godoc
@@ -56,11 +62,11 @@ type YearlyByCategory struct {
 // @Tags         Reports
 // @Produce      json
 // @Param        year query int false "Year (YYYY)"
+// @Param        view query string false "flat (default) or tree (parent totals include children)"
 // @Success      200  {object}  YearlyReportResponse
 // @Router       /reports/yearly [get]
-func GetYearlyReport(c *gin.Context) {
-	currentUser := c.MustGet("currentUser").(string)
-	collection := config.GetCollection("transactions")
+func (h *Handler) GetYearlyReport(c *gin.Context) {
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -76,129 +82,25 @@ func GetYearlyReport(c *gin.Context) {
 		}
 		year = parsedYear
 	}
-
-	start := time.Date(year, 1, 1, 0, 0, 0, 0, time.Local)
-	end := start.AddDate(1, 0, 0)
-	timezone := start.Format("-07:00")
-
-	pipeline := mongo.Pipeline{
-		{{Key: "$match", Value: bson.M{
-			"owner": currentUser,
-		}}},
-		{{Key: "$lookup", Value: bson.M{
-			"from": "categories",
-			"let":  bson.M{"catId": "$category_id", "owner": "$owner"},
-			"pipeline": bson.A{
-				bson.M{"$match": bson.M{"$expr": bson.M{"$and": bson.A{
-					bson.M{"$eq": bson.A{"$_id", "$$catId"}},
-					bson.M{"$eq": bson.A{"$owner", "$$owner"}},
-				}}}},
-				bson.M{"$project": bson.M{"_id": 1, "name": 1, "type": 1}},
-			},
-			"as": "categoryDoc",
-		}}},
-		{{Key: "$unwind", Value: bson.M{
-			"path":                       "$categoryDoc",
-			"preserveNullAndEmptyArrays": false,
-		}}},
-		{{Key: "$addFields", Value: bson.M{
-			"type": "$categoryDoc.type",
-			"dateParsed": bson.M{
-				"$ifNull": bson.A{
-					"$dateAt",
-					bson.M{"$dateFromString": bson.M{
-						"dateString": "$date",
-						"format":     "%Y-%m-%d",
-						"timezone":   timezone,
-					}},
-				},
-			},
-		}}},
-		{{Key: "$match", Value: bson.M{
-			"dateParsed": bson.M{"$gte": start, "$lt": end},
-			"type":       bson.M{"$in": bson.A{"expense", "income"}},
-		}}},
-		{{Key: "$facet", Value: bson.M{
-			"monthly": bson.A{
-				bson.M{"$group": bson.M{
-					"_id": bson.M{
-						"m": bson.M{"$month": bson.M{"date": "$dateParsed", "timezone": timezone}},
-						"t": "$type",
-					},
-					"amount": bson.M{"$sum": "$amount"},
-				}},
-				bson.M{"$group": bson.M{
-					"_id": "$_id.m",
-					"expense": bson.M{"$sum": bson.M{"$cond": bson.A{
-						bson.M{"$eq": bson.A{"$_id.t", "expense"}}, "$amount", 0,
-					}}},
-					"income": bson.M{"$sum": bson.M{"$cond": bson.A{
-						bson.M{"$eq": bson.A{"$_id.t", "income"}}, "$amount", 0,
-					}}},
-				}},
-				bson.M{"$addFields": bson.M{
-					"net": bson.M{"$subtract": bson.A{"$income", "$expense"}},
-				}},
-				bson.M{"$project": bson.M{
-					"_id":     0,
-					"month":   "$_id",
-					"expense": 1,
-					"income":  1,
-					"net":     1,
-				}},
-				bson.M{"$sort": bson.M{"month": 1}},
-			},
-			"summary": bson.A{
-				bson.M{"$group": bson.M{
-					"_id":   "$type",
-					"total": bson.M{"$sum": "$amount"},
-				}},
-				bson.M{"$group": bson.M{
-					"_id": nil,
-					"totalExpense": bson.M{"$sum": bson.M{"$cond": bson.A{
-						bson.M{"$eq": bson.A{"$_id", "expense"}}, "$total", 0,
-					}}},
-					"totalIncome": bson.M{"$sum": bson.M{"$cond": bson.A{
-						bson.M{"$eq": bson.A{"$_id", "income"}}, "$total", 0,
-					}}},
-				}},
-				bson.M{"$project": bson.M{
-					"_id":          0,
-					"totalExpense": 1,
-					"totalIncome":  1,
-				}},
-			},
-			"byCategory": bson.A{
-				bson.M{"$match": bson.M{"type": "expense"}},
-				bson.M{"$group": bson.M{
-					"_id":   "$category_id",
-					"total": bson.M{"$sum": "$amount"},
-					"count": bson.M{"$sum": 1},
-					"name":  bson.M{"$first": "$categoryDoc.name"},
-				}},
-				bson.M{"$project": bson.M{
-					"_id":          0,
-					"categoryId":   "$_id",
-					"categoryName": "$name",
-					"total":        1,
-					"count":        1,
-				}},
-				bson.M{"$sort": bson.M{"total": -1}},
-			},
-		}}},
+	view, ok := statsView(c)
+	if !ok {
+		return
 	}
 
-	cursor, err := collection.Aggregate(ctx, pipeline)
+	sums, err := h.transactions.SumByCategory(ctx, repository.TransactionFilter{
+		LedgerID:  ledgerID,
+		StartDate: fmt.Sprintf("%04d-01-01", year),
+		EndDate:   fmt.Sprintf("%04d-12-31", year),
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "failed to compute report",
 		})
 		return
 	}
-	defer cursor.Close(ctx)
 
-	var facets []bson.M
-	if err = cursor.All(ctx, &facets); err != nil {
+	categories, err := h.categoryIndex(ctx, ledgerID)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "failed to parse report",
 		})
@@ -210,195 +112,120 @@ func GetYearlyReport(c *gin.Context) {
 		MaxExpenseMonth: MonthAmount{Month: 0, Amount: 0},
 		MinExpenseMonth: MonthAmount{Month: 0, Amount: 0},
 	}
-	byCategory := []YearlyByCategory{}
-
-	if len(facets) > 0 {
-		facet := facets[0]
 
-		summaryDocs := toBsonMArray(facet["summary"])
-		if len(summaryDocs) > 0 {
-			summary.TotalExpense = toFloat64(summaryDocs[0]["totalExpense"])
-			summary.TotalIncome = toFloat64(summaryDocs[0]["totalIncome"])
+	// 各幣別依交易日期的匯率換算成主要幣別
+	converter := h.newConverter(ctx, c)
+	monthlyMap := make(map[int]YearlyMonthly)
+	ownTotals := make(map[primitive.ObjectID]models.Money)
+	ownCounts := make(map[primitive.ObjectID]int64)
+	for _, sum := range converter.convertTotals(ctx, sums) {
+		category, ok := categories[sum.CategoryID]
+		if !ok || (category.Type != "expense" && category.Type != "income") {
+			continue
 		}
-		summary.Net = summary.TotalIncome - summary.TotalExpense
-		summary.AvgMonthlyExpense = summary.TotalExpense / 12
-
-		monthlyMap := make(map[int]YearlyMonthly)
-		for _, doc := range toBsonMArray(facet["monthly"]) {
-			month := toInt(doc["month"])
-			expense := toFloat64(doc["expense"])
-			income := toFloat64(doc["income"])
-			monthlyMap[month] = YearlyMonthly{
-				Month:   month,
-				Expense: expense,
-				Income:  income,
-				Net:     income - expense,
-			}
+		month, err := strconv.Atoi(sum.Date[5:7])
+		if err != nil {
+			continue
 		}
 
-		for m := 1; m <= 12; m++ {
-			item, ok := monthlyMap[m]
-			if !ok {
-				item = YearlyMonthly{Month: m}
-			}
-			item.Net = item.Income - item.Expense
-			monthly = append(monthly, item)
+		item := monthlyMap[month]
+		item.Month = month
+		if category.Type == "expense" {
+			item.Expense += sum.Total
+			summary.TotalExpense += sum.Total
+			ownTotals[category.ID] += sum.Total
+			ownCounts[category.ID] += sum.Count
+		} else {
+			item.Income += sum.Total
+			summary.TotalIncome += sum.Total
 		}
+		monthlyMap[month] = item
+	}
+	summary.Net = summary.TotalIncome - summary.TotalExpense
+	summary.AvgMonthlyExpense = summary.TotalExpense.DivRound(12)
 
-		if summary.TotalExpense > 0 && len(monthly) > 0 {
-			maxMonth := monthly[0]
-			minMonth := monthly[0]
-			for _, item := range monthly[1:] {
-				if item.Expense > maxMonth.Expense {
-					maxMonth = item
-				}
-				if item.Expense < minMonth.Expense {
-					minMonth = item
-				}
-			}
-			summary.MaxExpenseMonth = MonthAmount{Month: maxMonth.Month, Amount: maxMonth.Expense}
-			summary.MinExpenseMonth = MonthAmount{Month: minMonth.Month, Amount: minMonth.Expense}
+	for m := 1; m <= 12; m++ {
+		item, ok := monthlyMap[m]
+		if !ok {
+			item = YearlyMonthly{Month: m}
 		}
+		item.Net = item.Income - item.Expense
+		monthly = append(monthly, item)
+	}
 
-		for _, doc := range toBsonMArray(facet["byCategory"]) {
-			total := toFloat64(doc["total"])
-			percent := 0.0
-			if summary.TotalExpense > 0 {
-				percent = total / summary.TotalExpense * 100
+	if summary.TotalExpense > 0 && len(monthly) > 0 {
+		maxMonth := monthly[0]
+		minMonth := monthly[0]
+		for _, item := range monthly[1:] {
+			if item.Expense > maxMonth.Expense {
+				maxMonth = item
+			}
+			if item.Expense < minMonth.Expense {
+				minMonth = item
 			}
-			byCategory = append(byCategory, YearlyByCategory{
-				CategoryID:   toString(doc["categoryId"]),
-				CategoryName: toString(doc["categoryName"]),
-				Total:        total,
-				Percent:      percent,
-				Count:        toInt64(doc["count"]),
-				AvgMonthly:   total / 12,
-			})
 		}
+		summary.MaxExpenseMonth = MonthAmount{Month: maxMonth.Month, Amount: maxMonth.Expense}
+		summary.MinExpenseMonth = MonthAmount{Month: minMonth.Month, Amount: minMonth.Expense}
 	}
 
-	response := YearlyReportResponse{
-		Year:       year,
-		Summary:    summary,
-		Monthly:    monthly,
-		ByCategory: byCategory,
+	tree := newCategoryTree(categories)
+	totals, counts := ownTotals, ownCounts
+	ids := make([]primitive.ObjectID, 0, len(ownTotals))
+	for id := range ownTotals {
+		ids = append(ids, id)
 	}
-
-	c.JSON(http.StatusOK, response)
-}
-
-func toBsonMArray(value interface{}) []bson.M {
-	if value == nil {
-		return nil
-	}
-	var raw []interface{}
-	switch v := value.(type) {
-	case bson.A:
-		raw = []interface{}(v)
-	case []interface{}:
-		raw = v
-	default:
-		return nil
+	if view == viewTree {
+		// 上層類別的金額與筆數包含所有子類別
+		totals, counts = rollUp(tree, ownTotals), rollUp(tree, ownCounts)
+		ids = tree.withAncestors(ids)
 	}
 
-	out := make([]bson.M, 0, len(raw))
-	for _, item := range raw {
-		switch doc := item.(type) {
-		case bson.M:
-			out = append(out, doc)
-		case map[string]interface{}:
-			out = append(out, bson.M(doc))
+	less := func(a, b primitive.ObjectID) bool {
+		if totals[a] != totals[b] {
+			return totals[a] > totals[b]
 		}
+		return categories[a].Name < categories[b].Name
 	}
-	return out
-}
-
-func toFloat64(value interface{}) float64 {
-	switch v := value.(type) {
-	case float64:
-		return v
-	case float32:
-		return float64(v)
-	case int:
-		return float64(v)
-	case int32:
-		return float64(v)
-	case int64:
-		return float64(v)
-	case int16:
-		return float64(v)
-	case int8:
-		return float64(v)
-	case uint:
-		return float64(v)
-	case uint32:
-		return float64(v)
-	case uint64:
-		return float64(v)
-	case primitive.Decimal128:
-		parsed, err := strconv.ParseFloat(v.String(), 64)
-		if err != nil {
-			return 0
+	entry := func(id primitive.ObjectID) YearlyByCategory {
+		entry := YearlyByCategory{
+			CategoryID:   id.Hex(),
+			CategoryName: categories[id].Name,
+			Total:        totals[id],
+			Count:        counts[id],
+			AvgMonthly:   totals[id].DivRound(12),
 		}
-		return parsed
-	default:
-		return 0
+		if summary.TotalExpense > 0 {
+			entry.Percent = float64(entry.Total) / float64(summary.TotalExpense) * 100
+		}
+		if parent, ok := tree.parent(id); ok {
+			entry.ParentID = parent.Hex()
+		}
+		return entry
 	}
-}
 
-func toInt(value interface{}) int {
-	switch v := value.(type) {
-	case int:
-		return v
-	case int32:
-		return int(v)
-	case int64:
-		return int(v)
-	case float64:
-		return int(v)
-	case float32:
-		return int(v)
-	case uint:
-		return int(v)
-	case uint32:
-		return int(v)
-	case uint64:
-		return int(v)
-	default:
-		return 0
+	byCategory := []YearlyByCategory{}
+	if view == viewTree {
+		byCategory = nestCategories(tree, ids, less, func(id primitive.ObjectID, children []YearlyByCategory) YearlyByCategory {
+			entry := entry(id)
+			entry.OwnTotal = ownTotals[id]
+			entry.Children = children
+			return entry
+		})
+	} else {
+		sort.Slice(ids, func(i, j int) bool { return less(ids[i], ids[j]) })
+		for _, id := range ids {
+			byCategory = append(byCategory, entry(id))
+		}
 	}
-}
 
-func toInt64(value interface{}) int64 {
-	switch v := value.(type) {
-	case int64:
-		return v
-	case int32:
-		return int64(v)
-	case int:
-		return int64(v)
-	case float64:
-		return int64(v)
-	case float32:
-		return int64(v)
-	case uint:
-		return int64(v)
-	case uint32:
-		return int64(v)
-	case uint64:
-		return int64(v)
-	default:
-		return 0
+	response := YearlyReportResponse{
+		Year:       year,
+		Currency:   converter.base,
+		Summary:    summary,
+		Monthly:    monthly,
+		ByCategory: byCategory,
 	}
-}
 
-func toString(value interface{}) string {
-	switch v := value.(type) {
-	case string:
-		return v
-	case primitive.ObjectID:
-		return v.Hex()
-	default:
-		return ""
-	}
+	converter.writeMissingHeader(c)
+	c.JSON(http.StatusOK, response)
 }
@@ -0,0 +1,235 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"server/config"
+	"server/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// sessionTTL: 閒置多久後過期 (每次使用會重新計算)
+	sessionTTL = 7 * 24 * time.Hour
+	// sessionMaxLifetime: 不論是否持續使用，登入後最長可維持多久
+	sessionMaxLifetime = 30 * 24 * time.Hour
+	// reauthMaxAge: 沒有密碼的帳號要刪除帳號時，工作階段必須是在此時間內登入的
+	reauthMaxAge = 10 * time.Minute
+	// sessionRenewInterval: 距離上次展延超過此時間才寫回資料庫，避免每個請求都更新
+	sessionRenewInterval = 10 * time.Minute
+)
+
+var errSessionInvalid = errors.New("session invalid")
+
+// newSessionToken 產生 32 bytes 的隨機 token
+func newSessionToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func setSessionCookie(c *gin.Context, token string, maxAge time.Duration) {
+	// SameSite / Secure / Domain 由環境變數設定 (見 config.SessionCookieSettings)
+	// SetCookie(name, value, maxAge(秒), path, domain, secure, httpOnly)
+	// HttpOnly=true: 防止 XSS 攻擊 (JS 讀不到)
+	settings := config.SessionCookieSettings()
+	c.SetSameSite(settings.SameSite)
+	c.SetCookie(COOKIE_NAME, token, int(maxAge.Seconds()), "/", settings.Domain, settings.Secure, true)
+}
+
+func clearSessionCookie(c *gin.Context) {
+	// 將 Cookie 時間設為 -1 即為刪除 (屬性需與設定時相同，瀏覽器才會覆蓋)
+	settings := config.SessionCookieSettings()
+	c.SetSameSite(settings.SameSite)
+	c.SetCookie(COOKIE_NAME, "", -1, "/", settings.Domain, settings.Secure, true)
+}
+
+// createSession 建立新的工作階段並寫入 Cookie
+func createSession(ctx context.Context, c *gin.Context, username string) (models.Session, error) {
+	token, err := newSessionToken()
+	if err != nil {
+		return models.Session{}, err
+	}
+
+	now := time.Now()
+	session := models.Session{
+		ID:         primitive.NewObjectID(),
+		TokenHash:  hashToken(token),
+		Username:   username,
+		UserAgent:  c.Request.UserAgent(),
+		IP:         c.ClientIP(),
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(sessionTTL),
+	}
+
+	if _, err := config.GetCollection("sessions").InsertOne(ctx, session); err != nil {
+		return models.Session{}, err
+	}
+
+	setSessionCookie(c, token, sessionTTL)
+	return session, nil
+}
+
+// loadSession 依據 Cookie 取得有效的工作階段，並在需要時展延期限
+func loadSession(ctx context.Context, c *gin.Context) (models.Session, error) {
+	token, err := c.Cookie(COOKIE_NAME)
+	if err != nil || token == "" {
+		return models.Session{}, errSessionInvalid
+	}
+
+	collection := config.GetCollection("sessions")
+	var session models.Session
+	if err := collection.FindOne(ctx, bson.M{"token_hash": hashToken(token)}).Decode(&session); err != nil {
+		return models.Session{}, errSessionInvalid
+	}
+
+	now := time.Now()
+	if now.After(session.ExpiresAt) {
+		// TTL index 會定期清除，這裡直接刪掉避免等待
+		collection.DeleteOne(ctx, bson.M{"_id": session.ID})
+		return models.Session{}, errSessionInvalid
+	}
+
+	// Sliding expiration: 展延期限，但不超過最長有效時間
+	if now.Sub(session.LastSeenAt) >= sessionRenewInterval {
+		expiresAt := now.Add(sessionTTL)
+		if hardLimit := session.CreatedAt.Add(sessionMaxLifetime); expiresAt.After(hardLimit) {
+			expiresAt = hardLimit
+		}
+		_, err := collection.UpdateOne(ctx,
+			bson.M{"_id": session.ID},
+			bson.M{"$set": bson.M{"last_seen_at": now, "expires_at": expiresAt, "ip": c.ClientIP()}},
+		)
+		if err == nil {
+			session.LastSeenAt = now
+			session.ExpiresAt = expiresAt
+			session.IP = c.ClientIP()
+			setSessionCookie(c, token, time.Until(expiresAt))
+		}
+	}
+
+	return session, nil
+}
+
+// revokeSession 讓單一工作階段失效
+func revokeSession(ctx context.Context, id primitive.ObjectID) error {
+	_, err := config.GetCollection("sessions").DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+// revokeUserSessions 讓使用者所有工作階段失效，except 不為 NilObjectID 時保留該筆
+func revokeUserSessions(ctx context.Context, username string, except primitive.ObjectID) error {
+	filter := bson.M{"username": username}
+	if except != primitive.NilObjectID {
+		filter["_id"] = bson.M{"$ne": except}
+	}
+	_, err := config.GetCollection("sessions").DeleteMany(ctx, filter)
+	return err
+}
+
+// GetSessions 列出自己目前有效的工作階段 (裝置、IP、登入與最後使用時間)
+func GetSessions(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(string)
+	currentID := currentSessionID(c)
+	collection := config.GetCollection("sessions")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"username": currentUser, "expires_at": bson.M{"$gt": time.Now()}}
+	opts := options.Find().SetSort(bson.D{{Key: "last_seen_at", Value: -1}})
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法讀取工作階段"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var sessions []models.Session
+	if err = cursor.All(ctx, &sessions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "資料解析失敗"})
+		return
+	}
+
+	response := make([]gin.H, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, gin.H{
+			"id":           session.ID.Hex(),
+			"user_agent":   session.UserAgent,
+			"ip":           session.IP,
+			"created_at":   session.CreatedAt,
+			"last_seen_at": session.LastSeenAt,
+			"expires_at":   session.ExpiresAt,
+			"current":      session.ID == currentID,
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// RevokeSessionByID 登出指定的工作階段 (例如遺失或共用的裝置)
+func RevokeSessionByID(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(string)
+	objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的 ID"})
+		return
+	}
+
+	collection := config.GetCollection("sessions")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// 只能撤銷自己的工作階段
+	result, err := collection.DeleteOne(ctx, bson.M{"_id": objID, "username": currentUser})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "撤銷失敗"})
+		return
+	}
+	if result.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到該工作階段"})
+		return
+	}
+
+	recordAuthEvent(ctx, c, AuditLogout, currentUser, objID)
+
+	// 撤銷的是目前這個工作階段時，一併清除 Cookie
+	if objID == currentSessionID(c) {
+		clearSessionCookie(c)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已登出該裝置"})
+}
+
+// RevokeOtherSessions 登出目前這個工作階段以外的所有裝置
+func RevokeOtherSessions(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(string)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := revokeUserSessions(ctx, currentUser, currentSessionID(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "撤銷失敗"})
+		return
+	}
+
+	recordAuthEvent(ctx, c, AuditLogout, currentUser, primitive.NilObjectID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "已登出其他所有裝置"})
+}
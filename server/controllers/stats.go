@@ -3,28 +3,25 @@ package controllers
 import (
 	"context"
 	"net/http"
-	"server/config"
 	"server/models"
+	"server/repository"
 	"sort"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // WeeklyStat 回傳格式
 type WeeklyStat struct {
-	Day    string  `json:"day"`    // "Mon", "Tue"...
-	Amount float64 `json:"amount"` // 總金額
-	Order  int     `json:"-"`      // 排序用 (週一=1, 週日=7)
+	Day    string       `json:"day"`    // "Mon", "Tue"...
+	Amount models.Money `json:"amount"` // 總金額
+	Order  int          `json:"-"`      // 排序用 (週一=1, 週日=7)
 }
 
 // GetWeeklyHabits 取得每週消費習慣 (支援 range 參數)
-func GetWeeklyHabits(c *gin.Context) {
-	currentUser := c.MustGet("currentUser").(string)
-	collection := config.GetCollection("transactions")
+func (h *Handler) GetWeeklyHabits(c *gin.Context) {
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -53,66 +50,52 @@ func GetWeeklyHabits(c *gin.Context) {
 		startDate = todayEnd.AddDate(0, -3, 0).Format("2006-01-02")
 	}
 
-	catCollection := config.GetCollection("categories")
-	catCursor, err := catCollection.Find(ctx, bson.M{"owner": currentUser, "type": "expense"})
+	categories, err := h.categories.List(ctx, ledgerID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法取得分類資料"})
 		return
 	}
-	defer catCursor.Close(ctx)
 
-	var expenseCategories []models.Category
-	if err = catCursor.All(ctx, &expenseCategories); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "解析分類資料失敗"})
-		return
+	expenseIDs := make([]primitive.ObjectID, 0, len(categories))
+	for _, cat := range categories {
+		if cat.Type == "expense" {
+			expenseIDs = append(expenseIDs, cat.ID)
+		}
 	}
 
-	if len(expenseCategories) == 0 {
+	if len(expenseIDs) == 0 {
 		c.JSON(http.StatusOK, []WeeklyStat{})
 		return
 	}
 
-	expenseIDs := make([]primitive.ObjectID, 0, len(expenseCategories))
-	for _, cat := range expenseCategories {
-		expenseIDs = append(expenseIDs, cat.ID)
-	}
-
-	filter := bson.M{
-		"owner":       currentUser,
-		"category_id": bson.M{"$in": expenseIDs},
-		"date":        bson.M{"$gte": startDate},
-	}
-
-	// 最佳化: 只撈取需要的欄位 (date, amount)
-	opts := options.Find().
-		SetProjection(bson.M{"date": 1, "amount": 1}).
-		SetHint("idx_owner_cat_date")
-
-	cursor, err := collection.Find(ctx, filter, opts)
+	transactions, err := h.transactions.Find(ctx, repository.TransactionFilter{
+		LedgerID:    ledgerID,
+		StartDate:   startDate,
+		CategoryIDs: expenseIDs,
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法取得資料"})
 		return
 	}
-	defer cursor.Close(ctx)
-
-	var transactions []models.Transaction
-	if err = cursor.All(ctx, &transactions); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "解析失敗"})
-		return
-	}
 
 	// 2. 統計週一到週日
-	weekMap := map[time.Weekday]float64{
+	weekMap := map[time.Weekday]models.Money{
 		time.Monday: 0, time.Tuesday: 0, time.Wednesday: 0,
 		time.Thursday: 0, time.Friday: 0, time.Saturday: 0, time.Sunday: 0,
 	}
 
+	// 各幣別依交易日期的匯率換算成主要幣別
+	converter := h.newConverter(ctx, c)
 	for _, t := range transactions {
 		date, err := time.Parse("2006-01-02", t.Date)
-		if err == nil {
-			weekMap[date.Weekday()] += t.Amount
+		if err != nil {
+			continue
+		}
+		if amount, ok := converter.convert(ctx, t.Amount, t.Currency, t.Date); ok {
+			weekMap[date.Weekday()] += amount
 		}
 	}
+	converter.writeMissingHeader(c)
 
 	// 3. 轉換與排序
 	var results []WeeklyStat
@@ -0,0 +1,356 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"server/models"
+	"server/repository"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	maxTagLength          = 30 // 單一標籤的字數上限
+	maxTagsPerTransaction = 10 // 每筆交易的標籤數上限
+)
+
+// normalizeTag 去除前後空白並轉為小寫，格式錯誤時回傳錯誤訊息
+// 逗號用於查詢參數、斜線用於路徑，兩者都不能出現在標籤中
+func normalizeTag(tag string) (string, string) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	switch {
+	case tag == "":
+		return "", "標籤不可為空"
+	case utf8.RuneCountInString(tag) > maxTagLength:
+		return "", fmt.Sprintf("標籤最多 %d 個字", maxTagLength)
+	case strings.ContainsAny(tag, ",/"):
+		return "", "標籤不可包含逗號或斜線"
+	}
+	return tag, ""
+}
+
+// normalizeTags 整理交易的標籤 (略過空白、去除重複)，nil 維持 nil (修改時代表不變更標籤)
+func normalizeTags(tags []string) ([]string, string) {
+	if tags == nil {
+		return nil, ""
+	}
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		if strings.TrimSpace(tag) == "" {
+			continue
+		}
+		tag, msg := normalizeTag(tag)
+		if msg != "" {
+			return nil, msg
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	if len(normalized) > maxTagsPerTransaction {
+		return nil, fmt.Sprintf("每筆交易最多 %d 個標籤", maxTagsPerTransaction)
+	}
+	return normalized, ""
+}
+
+// parseTagFilters 讀取 tags_any / tags_all / tags_none (逗號分隔) 查詢參數，格式錯誤時直接回應錯誤
+func parseTagFilters(c *gin.Context, filter *repository.TransactionFilter) bool {
+	params := []struct {
+		name   string
+		target *[]string
+	}{
+		{"tags_any", &filter.TagsAny},
+		{"tags_all", &filter.TagsAll},
+		{"tags_none", &filter.TagsNone},
+	}
+	for _, param := range params {
+		raw := c.Query(param.name)
+		if raw == "" {
+			continue
+		}
+		tags, msg := normalizeTags(strings.Split(raw, ","))
+		if msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": param.name + ": " + msg})
+			return false
+		}
+		*param.target = tags
+	}
+	return true
+}
+
+// tagParam 讀取路徑中的標籤名稱
+func tagParam(c *gin.Context) (string, bool) {
+	tag, msg := normalizeTag(c.Param("tag"))
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return "", false
+	}
+	return tag, true
+}
+
+// renameTag 將交易與舊版本中的標籤 from 改為 to，沒有交易使用 from 時回傳 repository.ErrNotFound
+func (h *Handler) renameTag(ctx context.Context, c *gin.Context, ledgerID primitive.ObjectID, action, from, to string) (int64, error) {
+	count, err := h.transactions.RenameTag(ctx, ledgerID, from, to)
+	if err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		return 0, repository.ErrNotFound
+	}
+	if _, err := h.revisions.RenameTag(ctx, ledgerID, from, to); err != nil {
+		return count, err
+	}
+
+	h.recordAuditKey(ctx, c, action, "tag", from, gin.H{"tag": from}, gin.H{"tag": to, "transactions": count})
+	return count, nil
+}
+
+// GetTags 列出帳本中使用的標籤與交易筆數 (不含垃圾桶中的交易)
+func (h *Handler) GetTags(c *gin.Context) {
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tags, err := h.transactions.ListTags(ctx, ledgerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法讀取標籤"})
+		return
+	}
+
+	response := make([]gin.H, 0, len(tags))
+	for _, tag := range tags {
+		response = append(response, gin.H{"tag": tag.Tag, "count": tag.Count})
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// RenameTag 標籤改名 (body: {"name": "..."})，新名稱已存在時請改用合併
+func (h *Handler) RenameTag(c *gin.Context) {
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
+	from, ok := tagParam(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, msg := normalizeTag(input.Name)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if to == from {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "新名稱與原名稱相同"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tags, err := h.transactions.ListTags(ctx, ledgerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法讀取標籤"})
+		return
+	}
+	for _, tag := range tags {
+		if tag.Tag == to {
+			c.JSON(http.StatusConflict, gin.H{"error": "標籤已存在，請使用合併"})
+			return
+		}
+	}
+
+	count, err := h.renameTag(ctx, c, ledgerID, AuditUpdate, from, to)
+	if err == repository.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到標籤"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改失敗"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "修改成功", "tag": to, "transactions": count})
+}
+
+// MergeTag 將標籤合併到另一個標籤 (body: {"target": "..."})，同時有兩個標籤的交易只保留目標標籤
+func (h *Handler) MergeTag(c *gin.Context) {
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
+	from, ok := tagParam(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Target string `json:"target" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, msg := normalizeTag(input.Target)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if to == from {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "目標標籤不可與原標籤相同"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	count, err := h.renameTag(ctx, c, ledgerID, AuditMerge, from, to)
+	if err == repository.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到標籤"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "合併失敗"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "合併成功", "tag": to, "transactions": count})
+}
+
+// DeleteTag 從所有交易 (包含垃圾桶與舊版本) 移除標籤，交易本身不受影響
+func (h *Handler) DeleteTag(c *gin.Context) {
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
+	tag, ok := tagParam(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	count, err := h.transactions.DeleteTag(ctx, ledgerID, tag)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "刪除失敗"})
+		return
+	}
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到標籤"})
+		return
+	}
+	if _, err := h.revisions.DeleteTag(ctx, ledgerID, tag); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "刪除失敗"})
+		return
+	}
+
+	h.recordAuditKey(ctx, c, AuditDelete, "tag", tag, gin.H{"tag": tag, "transactions": count}, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "刪除成功", "transactions": count})
+}
+
+// GetTagStats godoc
+// @Summary      取得標籤統計
+// @Description  計算指定月份各標籤的支出總額 (一筆交易有多個標籤時每個標籤都會計入)
+// @Tags         Stats
+// @Produce      json
+// @Param        month query string false "月份 (YYYY-MM)"
+// @Success      200  {array}  map[string]interface{}
+// @Router       /stats/tags [get]
+func (h *Handler) GetTagStats(c *gin.Context) {
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	monthParam := c.Query("month")
+	now := time.Now()
+	location := now.Location()
+	var targetMonth time.Time
+
+	if monthParam == "" {
+		targetMonth = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, location)
+	} else {
+		parsedMonth, err := time.ParseInLocation("2006-01", monthParam, location)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "month 格式錯誤，請使用 YYYY-MM"})
+			return
+		}
+		targetMonth = time.Date(parsedMonth.Year(), parsedMonth.Month(), 1, 0, 0, 0, 0, location)
+	}
+
+	monthStart := targetMonth
+	monthEnd := monthStart.AddDate(0, 1, 0)
+
+	sums, err := h.transactions.SumByTag(ctx, repository.TransactionFilter{
+		LedgerID:  ledgerID,
+		StartDate: monthStart.Format("2006-01-02"),
+		EndDate:   monthEnd.AddDate(0, 0, -1).Format("2006-01-02"),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "統計計算失敗"})
+		return
+	}
+
+	categories, err := h.categoryIndex(ctx, ledgerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "解析統計失敗"})
+		return
+	}
+
+	type tagStat struct {
+		Tag   string
+		Total models.Money
+		Count int64
+	}
+	// 同一標籤會依類別、幣別與日期分成多筆，只保留支出並換算成主要幣別後合併
+	converter := h.newConverter(ctx, c)
+	merged := make(map[string]*tagStat)
+	for _, sum := range sums {
+		if category, ok := categories[sum.CategoryID]; !ok || category.Type != "expense" {
+			continue
+		}
+		amount, ok := converter.convert(ctx, sum.Total, sum.Currency, sum.Date)
+		if !ok {
+			continue
+		}
+		stat, ok := merged[sum.Tag]
+		if !ok {
+			stat = &tagStat{Tag: sum.Tag}
+			merged[sum.Tag] = stat
+		}
+		stat.Total += amount
+		stat.Count += sum.Count
+	}
+	results := make([]tagStat, 0, len(merged))
+	for _, stat := range merged {
+		results = append(results, *stat)
+	}
+
+	// 金額大的排前面
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Total != results[j].Total {
+			return results[i].Total > results[j].Total
+		}
+		return results[i].Tag < results[j].Tag
+	})
+
+	stats := make([]gin.H, 0, len(results))
+	for _, result := range results {
+		stats = append(stats, gin.H{
+			"tag":      result.Tag,
+			"amount":   result.Total,
+			"count":    result.Count,
+			"currency": converter.base,
+		})
+	}
+
+	converter.writeMissingHeader(c)
+	c.JSON(http.StatusOK, stats)
+}
@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTagEdits(t *testing.T) {
+	l := newTestLedger(t)
+	food := l.category("餐飲", "expense")
+
+	l.transaction(food, 100, "2026-03-05", "trip", "food-court")
+	l.transaction(food, 200, "2026-03-06", "trip-tokyo")
+	trashed := l.transaction(food, 300, "2026-03-07", "trip")
+	l.do(http.MethodDelete, "/transactions/"+trashed.Hex(), nil, http.StatusOK, nil)
+
+	tags := func() []tagCount {
+		var out []tagCount
+		l.do(http.MethodGet, "/tags", nil, http.StatusOK, &out)
+		return out
+	}
+
+	// 改名成已存在的標籤要改用合併
+	l.do(http.MethodPut, "/tags/trip", gin.H{"name": "trip-tokyo"}, http.StatusConflict, nil)
+	l.do(http.MethodPut, "/tags/missing", gin.H{"name": "other"}, http.StatusNotFound, nil)
+
+	var renamed struct {
+		Transactions int64 `json:"transactions"`
+	}
+	l.do(http.MethodPut, "/tags/Food-Court", gin.H{"name": " Dining "}, http.StatusOK, &renamed)
+	if renamed.Transactions != 1 {
+		t.Fatalf("rename count = %d, want 1", renamed.Transactions)
+	}
+
+	// 合併也會修改垃圾桶中的交易
+	var merged struct {
+		Transactions int64 `json:"transactions"`
+	}
+	l.do(http.MethodPost, "/tags/trip/merge", gin.H{"target": "trip-tokyo"}, http.StatusOK, &merged)
+	if merged.Transactions != 2 {
+		t.Fatalf("merge count = %d, want 2", merged.Transactions)
+	}
+	if got := tags(); len(got) != 2 || got[0] != (tagCount{"dining", 1}) || got[1] != (tagCount{"trip-tokyo", 2}) {
+		t.Fatalf("tags after merge = %+v", got)
+	}
+
+	l.do(http.MethodPost, "/trash/transactions/"+trashed.Hex()+"/restore", nil, http.StatusOK, nil)
+	if got := tags(); len(got) != 2 || got[1] != (tagCount{"trip-tokyo", 3}) {
+		t.Fatalf("tags after restore = %+v", got)
+	}
+
+	var deleted struct {
+		Transactions int64 `json:"transactions"`
+	}
+	l.do(http.MethodDelete, "/tags/trip-tokyo", nil, http.StatusOK, &deleted)
+	if deleted.Transactions != 3 {
+		t.Fatalf("delete count = %d, want 3", deleted.Transactions)
+	}
+	if got := tags(); len(got) != 1 || got[0] != (tagCount{"dining", 1}) {
+		t.Fatalf("tags after delete = %+v", got)
+	}
+	if list := l.listMarch(); list.Meta.Total != 3 {
+		t.Fatalf("deleting a tag must keep its transactions: total=%d", list.Meta.Total)
+	}
+}
@@ -3,17 +3,15 @@ package controllers
 import (
 	"context"
 	"net/http"
-	"server/config"
 	"server/models"
+	"server/repository"
+	"sort"
 	"time"
 
 	"strconv"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options" // 新增: 用於設定查詢選項 (排序)
 )
 
 // CreateTransaction godoc
@@ -25,30 +23,61 @@ import (
 // @Param        transaction body models.Transaction true "記帳資料"
 // @Success      200  {object}  models.Transaction
 // @Router       /transactions [post]
-func CreateTransaction(c *gin.Context) {
+func (h *Handler) CreateTransaction(c *gin.Context) {
 	currentUser := c.MustGet("currentUser").(string)
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
 	var input models.Transaction
 
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	tags, msg := normalizeTags(input.Tags)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	input.Tags = tags
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if !h.checkCategoryUsable(ctx, c, ledgerID, input.CategoryID) {
+		return
+	}
+	// 轉帳請使用 POST /transfers
+	input.Kind = ""
+	input.TransferID = nil
+	// 帳戶為選填
+	if input.AccountID != nil && input.AccountID.IsZero() {
+		input.AccountID = nil
+	}
+	if input.AccountID != nil && !h.checkAccountUsable(ctx, c, ledgerID, *input.AccountID) {
+		return
+	}
+
+	// 未指定幣別時使用使用者的主要幣別
+	currency, ok := h.resolveCurrency(ctx, c, input.Currency)
+	if !ok {
+		return
+	}
 
 	input.Owner = currentUser
+	input.LedgerID = ledgerID
 	input.ID = primitive.NewObjectID()
+	input.Currency = currency
+	input.DeletedAt = nil
+	input.Version = 1
 	input.CreatedAt = time.Now()
 	input.UpdatedAt = time.Now()
 
-	collection := config.GetCollection("transactions")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	_, err := collection.InsertOne(ctx, input)
-	if err != nil {
+	if err := h.transactions.Create(ctx, input); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法寫入資料庫"})
 		return
 	}
 
+	h.recordAudit(ctx, c, AuditCreate, "transaction", input.ID, nil, input)
+
 	c.JSON(http.StatusOK, input)
 }
 
@@ -57,11 +86,14 @@ func CreateTransaction(c *gin.Context) {
 // @Description  取得所有記帳紀錄 (依日期由新到舊排序)
 // @Tags         Transactions
 // @Produce      json
+// @Param        account_id query string false "帳戶 ID"
+// @Param        tags_any   query string false "含任一標籤 (逗號分隔)"
+// @Param        tags_all   query string false "含所有標籤 (逗號分隔)"
+// @Param        tags_none  query string false "不含這些標籤 (逗號分隔)"
 // @Success      200  {array}  models.Transaction
 // @Router       /transactions [get]
-func GetTransactions(c *gin.Context) {
-	currentUser := c.MustGet("currentUser").(string)
-	collection := config.GetCollection("transactions")
+func (h *Handler) GetTransactions(c *gin.Context) {
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -85,93 +117,54 @@ func GetTransactions(c *gin.Context) {
 
 	skip := (page - 1) * limit
 
-	// 2. Filter Parameters
-	filter := bson.M{"owner": currentUser}
-
-	// Date Range
-	startDate := c.Query("start_date")
-	endDate := c.Query("end_date")
-	if startDate != "" || endDate != "" {
-		dateFilter := bson.M{}
-		if startDate != "" {
-			dateFilter["$gte"] = startDate
-		}
-		if endDate != "" {
-			dateFilter["$lte"] = endDate
-		}
-		filter["date"] = dateFilter
+	// 2. Filter Parameters (Date Range 兩端皆包含)
+	filter := repository.TransactionFilter{
+		LedgerID:  ledgerID,
+		StartDate: c.Query("start_date"),
+		EndDate:   c.Query("end_date"),
 	}
 
 	// Category
 	categoryID := c.Query("category_id")
 	if categoryID != "" {
 		if oid, err := primitive.ObjectIDFromHex(categoryID); err == nil {
-			filter["category_id"] = oid
+			filter.CategoryIDs = []primitive.ObjectID{oid}
 		}
 	}
 
-	// 3. Count Total (before pagination)
-	total, err := collection.CountDocuments(ctx, filter)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法計算總數"})
-		return
-	}
-
-	// 4. Calculate Totals (Aggregated)
-	var totalIncome, totalExpense float64
-	aggregatePipeline := mongo.Pipeline{
-		{{Key: "$match", Value: filter}},
-		{{Key: "$lookup", Value: bson.D{
-			{Key: "from", Value: "categories"},
-			{Key: "localField", Value: "category_id"},
-			{Key: "foreignField", Value: "_id"},
-			{Key: "as", Value: "categoryDoc"},
-		}}},
-		{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$categoryDoc"}, {Key: "preserveNullAndEmptyArrays", Value: true}}}},
-		{{Key: "$group", Value: bson.D{
-			{Key: "_id", Value: "$categoryDoc.type"},
-			{Key: "total", Value: bson.D{{Key: "$sum", Value: "$amount"}}},
-		}}},
-	}
-
-	aggCursor, err := collection.Aggregate(ctx, aggregatePipeline)
-	if err == nil {
-		var aggResults []bson.M
-		if err := aggCursor.All(ctx, &aggResults); err == nil {
-			for _, res := range aggResults {
-				typ, _ := res["_id"].(string)
-				val, _ := res["total"].(float64)
-				if typ == "income" {
-					totalIncome = val
-				} else if typ == "expense" {
-					totalExpense = val
-				}
-			}
+	// Account
+	if accountID := c.Query("account_id"); accountID != "" {
+		oid, err := primitive.ObjectIDFromHex(accountID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "無效的帳戶 ID"})
+			return
 		}
+		filter.AccountIDs = []primitive.ObjectID{oid}
 	}
 
-	// 5. Query with Pagination
-	opts := options.Find().
-		SetSort(bson.D{{Key: "date", Value: -1}}).
-		SetSkip(int64(skip)).
-		SetLimit(int64(limit))
-
-	cursor, err := collection.Find(ctx, filter, opts)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法讀取資料"})
+	// Tags
+	if !parseTagFilters(c, &filter) {
 		return
 	}
-	defer cursor.Close(ctx)
 
-	var transactions []models.Transaction
-	if err = cursor.All(ctx, &transactions); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "資料解析失敗"})
+	// 3. Query with Pagination (同時回傳分頁前的總筆數)
+	transactions, total, err := h.transactions.List(ctx, filter, int64(skip), int64(limit))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法讀取資料"})
 		return
 	}
 
-	if transactions == nil {
-		transactions = []models.Transaction{}
+	// 4. Calculate Totals (Aggregated，換算成主要幣別)
+	converter := h.newConverter(ctx, c)
+	var totalIncome, totalExpense models.Money
+	if sums, err := h.transactions.SumByCategory(ctx, filter); err == nil {
+		if categories, err := h.categoryIndex(ctx, ledgerID); err == nil {
+			totals := totalsByType(converter.convertTotals(ctx, sums), categories)
+			totalIncome = totals["income"]
+			totalExpense = totals["expense"]
+		}
 	}
+	converter.writeMissingHeader(c)
 
 	// Return data with pagination info
 	c.JSON(http.StatusOK, gin.H{
@@ -183,6 +176,7 @@ func GetTransactions(c *gin.Context) {
 			"total_pages":   (int(total) + limit - 1) / limit,
 			"total_income":  totalIncome,
 			"total_expense": totalExpense,
+			"currency":      converter.base,
 		},
 	})
 }
@@ -195,9 +189,8 @@ func GetTransactions(c *gin.Context) {
 // @Param        month query string false "月份 (YYYY-MM)"
 // @Success      200  {object}  map[string]interface{}
 // @Router       /stats [get]
-func GetDashboardStats(c *gin.Context) {
-	currentUser := c.MustGet("currentUser").(string)
-	collection := config.GetCollection("transactions")
+func (h *Handler) GetDashboardStats(c *gin.Context) {
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -222,71 +215,25 @@ func GetDashboardStats(c *gin.Context) {
 	lastMonthStart := thisMonthStart.AddDate(0, -1, 0)
 	lastMonthEnd := thisMonthStart
 
-	getTotals := func(start, end time.Time) (map[string]float64, error) {
-		pipeline := mongo.Pipeline{
-			{{Key: "$match", Value: bson.D{
-				{Key: "owner", Value: currentUser},
-				{Key: "date", Value: bson.D{
-					{Key: "$gte", Value: start.Format("2006-01-02")},
-					{Key: "$lt", Value: end.Format("2006-01-02")},
-				}},
-			}}},
-			{{Key: "$lookup", Value: bson.D{
-				{Key: "from", Value: "categories"},
-				{Key: "let", Value: bson.D{
-					{Key: "catId", Value: "$category_id"},
-					{Key: "owner", Value: "$owner"},
-				}},
-				{Key: "pipeline", Value: bson.A{
-					bson.M{"$match": bson.M{"$expr": bson.M{"$and": bson.A{
-						bson.M{"$eq": bson.A{"$_id", "$$catId"}},
-						bson.M{"$eq": bson.A{"$owner", "$$owner"}},
-					}}}},
-					bson.M{"$project": bson.M{"_id": 1, "type": 1}},
-					bson.M{"$limit": 1},
-				}},
-				{Key: "as", Value: "categoryDoc"},
-			}}},
-			{{Key: "$unwind", Value: bson.D{
-				{Key: "path", Value: "$categoryDoc"},
-				{Key: "preserveNullAndEmptyArrays", Value: false},
-			}}},
-			{{Key: "$match", Value: bson.D{
-				{Key: "categoryDoc.type", Value: bson.D{{Key: "$in", Value: bson.A{"income", "expense"}}}},
-			}}},
-			{{Key: "$group", Value: bson.D{
-				{Key: "_id", Value: "$categoryDoc.type"},                       // 依照 type 分組 (income/expense)
-				{Key: "total", Value: bson.D{{Key: "$sum", Value: "$amount"}}}, // 加總 amount
-			}}},
-		}
+	categories, err := h.categoryIndex(ctx, ledgerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "統計計算失敗"})
+		return
+	}
 
-		cursor, err := collection.Aggregate(ctx, pipeline)
+	// 各幣別依交易日期的匯率換算成主要幣別後再加總
+	converter := h.newConverter(ctx, c)
+	getTotals := func(start, end time.Time) (map[string]models.Money, error) {
+		// 先依類別加總，再依類別的 type 分組 (income/expense)
+		sums, err := h.transactions.SumByCategory(ctx, repository.TransactionFilter{
+			LedgerID:  ledgerID,
+			StartDate: start.Format("2006-01-02"),
+			EndDate:   end.AddDate(0, 0, -1).Format("2006-01-02"),
+		})
 		if err != nil {
 			return nil, err
 		}
-		defer cursor.Close(ctx)
-
-		var results []bson.M
-		if err = cursor.All(ctx, &results); err != nil {
-			return nil, err
-		}
-
-		totals := map[string]float64{
-			"income":  0,
-			"expense": 0,
-		}
-
-		for _, result := range results {
-			typeStr := result["_id"].(string)
-			total := result["total"].(float64) // 注意：MongoDB 數字型別轉換
-			if typeStr == "income" {
-				totals["income"] = total
-			} else if typeStr == "expense" {
-				totals["expense"] = total
-			}
-		}
-
-		return totals, nil
+		return totalsByType(converter.convertTotals(ctx, sums), categories), nil
 	}
 
 	thisTotals, err := getTotals(thisMonthStart, thisMonthEnd)
@@ -301,11 +248,11 @@ func GetDashboardStats(c *gin.Context) {
 		return
 	}
 
-	calcTrend := func(current, previous float64) float64 {
+	calcTrend := func(current, previous models.Money) float64 {
 		if previous == 0 {
 			return 0
 		}
-		return (current - previous) / previous * 100
+		return float64(current-previous) / float64(previous) * 100
 	}
 
 	totalIncome := thisTotals["income"]
@@ -321,8 +268,10 @@ func GetDashboardStats(c *gin.Context) {
 		"expense_trend": calcTrend(totalExpense, lastTotals["expense"]),
 		"balance_trend": calcTrend(balance, lastBalance),
 		"month":         thisMonthStart.Format("2006-01"),
+		"currency":      converter.base,
 	}
 
+	converter.writeMissingHeader(c)
 	c.JSON(http.StatusOK, stats)
 }
 
@@ -332,11 +281,11 @@ func GetDashboardStats(c *gin.Context) {
 // @Tags         Stats
 // @Produce      json
 // @Param        month query string false "月份 (YYYY-MM)"
+// @Param        view  query string false "flat (預設，各類別本身的金額) 或 tree (上層類別包含子類別)"
 // @Success      200  {array}  map[string]interface{}
 // @Router       /stats/category [get]
-func GetCategoryStats(c *gin.Context) {
-	currentUser := c.MustGet("currentUser").(string)
-	collection := config.GetCollection("transactions")
+func (h *Handler) GetCategoryStats(c *gin.Context) {
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -356,92 +305,106 @@ func GetCategoryStats(c *gin.Context) {
 		targetMonth = time.Date(parsedMonth.Year(), parsedMonth.Month(), 1, 0, 0, 0, 0, location)
 	}
 
+	view, ok := statsView(c)
+	if !ok {
+		return
+	}
+
 	monthStart := targetMonth
 	monthEnd := monthStart.AddDate(0, 1, 0)
 
-	// Aggregation Pipeline:
-	// 1. $match: 先篩選日期區間
-	// 2. $lookup: 取得分類資訊並篩選 "expense"
-	// 3. $group: 依照 "category_id" 分組，並加總 "amount"
-	// 4. $sort: 依照總金額由大到小排序
-	pipeline := mongo.Pipeline{
-		{{Key: "$match", Value: bson.D{
-			{Key: "owner", Value: currentUser},
-			{Key: "date", Value: bson.D{
-				{Key: "$gte", Value: monthStart.Format("2006-01-02")},
-				{Key: "$lt", Value: monthEnd.Format("2006-01-02")},
-			}},
-		}}},
-		{{Key: "$lookup", Value: bson.D{
-			{Key: "from", Value: "categories"},
-			{Key: "let", Value: bson.D{
-				{Key: "catId", Value: "$category_id"},
-				{Key: "owner", Value: "$owner"},
-			}},
-			{Key: "pipeline", Value: bson.A{
-				bson.M{"$match": bson.M{"$expr": bson.M{"$and": bson.A{
-					bson.M{"$eq": bson.A{"$_id", "$$catId"}},
-					bson.M{"$eq": bson.A{"$owner", "$$owner"}},
-				}}}},
-				bson.M{"$project": bson.M{"_id": 1, "name": 1, "type": 1, "order": 1}},
-				bson.M{"$limit": 1},
-			}},
-			{Key: "as", Value: "categoryDoc"},
-		}}},
-		{{Key: "$unwind", Value: bson.D{
-			{Key: "path", Value: "$categoryDoc"},
-			{Key: "preserveNullAndEmptyArrays", Value: true},
-		}}},
-		{{Key: "$match", Value: bson.D{
-			{Key: "categoryDoc.type", Value: "expense"},
-		}}},
-		{{Key: "$group", Value: bson.D{
-			{Key: "_id", Value: "$categoryDoc._id"},
-			{Key: "name", Value: bson.D{{Key: "$first", Value: "$categoryDoc.name"}}},
-			{Key: "order", Value: bson.D{{Key: "$first", Value: "$categoryDoc.order"}}},
-			{Key: "total", Value: bson.D{{Key: "$sum", Value: "$amount"}}},
-		}}},
-		{{Key: "$sort", Value: bson.D{{Key: "total", Value: -1}, {Key: "order", Value: 1}, {Key: "name", Value: 1}}}}, // 金額大的排前面
-	}
-
-	cursor, err := collection.Aggregate(ctx, pipeline)
+	// 1. 依照類別加總當月金額
+	// 2. 只保留 "expense" 類別
+	// 3. 依照總金額由大到小排序
+	sums, err := h.transactions.SumByCategory(ctx, repository.TransactionFilter{
+		LedgerID:  ledgerID,
+		StartDate: monthStart.Format("2006-01-02"),
+		EndDate:   monthEnd.AddDate(0, 0, -1).Format("2006-01-02"),
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "統計計算失敗"})
 		return
 	}
-	defer cursor.Close(ctx)
 
-	var results []bson.M
-	if err = cursor.All(ctx, &results); err != nil {
+	categories, err := h.categoryIndex(ctx, ledgerID)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "解析統計失敗"})
 		return
 	}
 
+	// 同一類別會依幣別與日期分成多筆，換算成主要幣別後合併
+	converter := h.newConverter(ctx, c)
+	own := make(map[primitive.ObjectID]models.Money)
+	for _, sum := range converter.convertTotals(ctx, sums) {
+		category, ok := categories[sum.CategoryID]
+		if !ok || category.Type != "expense" {
+			continue
+		}
+		own[category.ID] += sum.Total
+	}
+
+	tree := newCategoryTree(categories)
+	totals := own
+	ids := make([]primitive.ObjectID, 0, len(own))
+	for id := range own {
+		ids = append(ids, id)
+	}
+	if view == viewTree {
+		// 上層類別的金額包含所有子類別
+		totals = rollUp(tree, own)
+		ids = tree.withAncestors(ids)
+	}
+
+	// 金額大的排前面
+	less := func(a, b primitive.ObjectID) bool {
+		if totals[a] != totals[b] {
+			return totals[a] > totals[b]
+		}
+		if categories[a].Order != categories[b].Order {
+			return categories[a].Order < categories[b].Order
+		}
+		return categories[a].Name < categories[b].Name
+	}
+
 	// 整理回傳格式
 	// 目標格式: [{"categoryId": "...", "category": "Food", "amount": 500}, ...]
-	var stats []gin.H
-	for _, result := range results {
-		categoryID := ""
-		if id, ok := result["_id"].(primitive.ObjectID); ok {
-			categoryID = id.Hex()
-		} else if id, ok := result["_id"].(string); ok {
-			categoryID = id
+	// 樹狀: amount 包含子類別，ownAmount 為類別本身的金額，子類別放在 children
+	stat := func(id primitive.ObjectID) gin.H {
+		item := gin.H{
+			"categoryId": id.Hex(),
+			"category":   categories[id].Name,
+			"amount":     totals[id],
+			"currency":   converter.base,
+		}
+		if parent, ok := tree.parent(id); ok {
+			item["parentId"] = parent.Hex()
 		}
-		stats = append(stats, gin.H{
-			"categoryId": categoryID,
-			"category":   result["name"],
-			"amount":     result["total"],
+		return item
+	}
+	var stats []gin.H
+	if view == viewTree {
+		stats = nestCategories(tree, ids, less, func(id primitive.ObjectID, children []gin.H) gin.H {
+			item := stat(id)
+			item["ownAmount"] = own[id]
+			item["children"] = children
+			return item
 		})
+	} else {
+		sort.SliceStable(ids, func(i, j int) bool { return less(ids[i], ids[j]) })
+		for _, id := range ids {
+			stats = append(stats, stat(id))
+		}
 	}
 
+	converter.writeMissingHeader(c)
 	c.JSON(http.StatusOK, stats)
 }
 
 // ... (保留原本的 create 和 get)
 
 // UpdateTransaction 修改交易
-func UpdateTransaction(c *gin.Context) {
-	currentUser := c.MustGet("currentUser").(string)
+func (h *Handler) UpdateTransaction(c *gin.Context) {
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
 	idParam := c.Param("id")
 	objID, err := primitive.ObjectIDFromHex(idParam)
 	if err != nil {
@@ -455,42 +418,67 @@ func UpdateTransaction(c *gin.Context) {
 		return
 	}
 
+	// 有指定幣別時才修改
+	if input.Currency != "" {
+		currency, err := models.NormalizeCurrency(input.Currency)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "幣別格式錯誤，請使用 ISO 4217 代碼 (例如 TWD)"})
+			return
+		}
+		input.Currency = currency
+	}
+
+	// 有帶 tags 時才修改 (空陣列代表清除)
+	tags, msg := normalizeTags(input.Tags)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	input.Tags = tags
+
 	// 更新時間
 	input.UpdatedAt = time.Now()
 
-	collection := config.GetCollection("transactions")
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	update := bson.M{
-		"$set": bson.M{
-			"amount":      input.Amount,
-			"category_id": input.CategoryID,
-			"date":        input.Date,
-			"note":        input.Note,
-			"owner":       currentUser,
-			"updated_at":  input.UpdatedAt,
-		},
+	current, err := h.transactions.Get(ctx, ledgerID, objID)
+	if err == repository.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到該筆資料"})
+		return
 	}
-
-	filter := bson.M{"_id": objID, "owner": currentUser}
-	result, err := collection.UpdateOne(ctx, filter, update)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失敗"})
 		return
 	}
+	// 轉帳的兩邊必須一起修改
+	if current.IsTransfer() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "轉帳請使用 PUT /transfers/:id 修改"})
+		return
+	}
+	// 已在封存類別中的交易可以修改其他欄位，但不能改到封存的類別
+	if input.CategoryID != current.CategoryID && !h.checkCategoryUsable(ctx, c, ledgerID, input.CategoryID) {
+		return
+	}
+	// account_id 傳空字串代表不指定帳戶；帳戶同理只檢查有變更的情況
+	if accountChanged(current.AccountID, input.AccountID) && !h.checkAccountUsable(ctx, c, ledgerID, *input.AccountID) {
+		return
+	}
 
-	if result.MatchedCount == 0 {
+	if _, err := h.updateTransaction(ctx, c, ledgerID, objID, input); err == repository.ErrNotFound {
 		c.JSON(http.StatusNotFound, gin.H{"error": "找不到該筆資料"})
 		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失敗"})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "更新成功"})
 }
 
 // DeleteTransaction 刪除交易
-func DeleteTransaction(c *gin.Context) {
-	currentUser := c.MustGet("currentUser").(string)
+func (h *Handler) DeleteTransaction(c *gin.Context) {
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
 	idParam := c.Param("id")
 	objID, err := primitive.ObjectIDFromHex(idParam)
 	if err != nil {
@@ -498,20 +486,27 @@ func DeleteTransaction(c *gin.Context) {
 		return
 	}
 
-	collection := config.GetCollection("transactions")
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	filter := bson.M{"_id": objID, "owner": currentUser}
-	result, err := collection.DeleteOne(ctx, filter)
+	before, err := h.transactions.Delete(ctx, ledgerID, objID)
+	if err == repository.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到該筆資料"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "刪除失敗"})
 		return
 	}
 
-	if result.DeletedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "找不到該筆資料"})
-		return
+	h.recordAudit(ctx, c, AuditDelete, "transaction", objID, before, nil)
+
+	// 轉帳的另一邊一起移到垃圾桶
+	if before.IsTransfer() {
+		if err := h.deleteTransfer(ctx, c, ledgerID, *before.TransferID); err != nil && err != repository.ErrNotFound {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "刪除失敗"})
+			return
+		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "刪除成功"})
@@ -523,11 +518,11 @@ func DeleteTransaction(c *gin.Context) {
 // @Tags         Stats
 // @Produce      json
 // @Param        month query string false "月份 (YYYY-MM)"
+// @Param        view  query string false "flat (預設，各類別本身的金額) 或 tree (上層類別包含子類別)"
 // @Success      200  {array}  map[string]interface{}
 // @Router       /stats/comparison [get]
-func GetMonthlyComparison(c *gin.Context) {
-	currentUser := c.MustGet("currentUser").(string)
-	collection := config.GetCollection("transactions")
+func (h *Handler) GetMonthlyComparison(c *gin.Context) {
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -548,6 +543,11 @@ func GetMonthlyComparison(c *gin.Context) {
 		targetMonth = time.Date(parsedMonth.Year(), parsedMonth.Month(), 1, 0, 0, 0, 0, location)
 	}
 
+	view, ok := statsView(c)
+	if !ok {
+		return
+	}
+
 	// 本月起訖
 	thisMonthStart := targetMonth
 	thisMonthEnd := thisMonthStart.AddDate(0, 1, 0) // 下個月1號即為本月結束點
@@ -556,76 +556,31 @@ func GetMonthlyComparison(c *gin.Context) {
 	lastMonthStart := thisMonthStart.AddDate(0, -1, 0)
 	lastMonthEnd := thisMonthStart
 
-	// 2. 定義 Aggregation 函式 (重用邏輯)
-	type categoryStat struct {
-		Name  string
-		Total float64
-	}
-
-	getStats := func(start, end time.Time) (map[string]categoryStat, error) {
-		pipeline := mongo.Pipeline{
-			{{Key: "$match", Value: bson.D{
-				{Key: "owner", Value: currentUser},
-				{Key: "date", Value: bson.D{
-					{Key: "$gte", Value: start.Format("2006-01-02")},
-					{Key: "$lt", Value: end.Format("2006-01-02")},
-				}},
-			}}},
-			{{Key: "$lookup", Value: bson.D{
-				{Key: "from", Value: "categories"},
-				{Key: "let", Value: bson.D{
-					{Key: "catId", Value: "$category_id"},
-					{Key: "owner", Value: "$owner"},
-				}},
-				{Key: "pipeline", Value: bson.A{
-					bson.M{"$match": bson.M{"$expr": bson.M{"$and": bson.A{
-						bson.M{"$eq": bson.A{"$_id", "$$catId"}},
-						bson.M{"$eq": bson.A{"$owner", "$$owner"}},
-					}}}},
-					bson.M{"$project": bson.M{"_id": 1, "name": 1, "type": 1, "order": 1}},
-					bson.M{"$limit": 1},
-				}},
-				{Key: "as", Value: "categoryDoc"},
-			}}},
-			{{Key: "$unwind", Value: bson.D{
-				{Key: "path", Value: "$categoryDoc"},
-				{Key: "preserveNullAndEmptyArrays", Value: false},
-			}}},
-			{{Key: "$match", Value: bson.D{
-				{Key: "categoryDoc.type", Value: "expense"},
-			}}},
-			{{Key: "$group", Value: bson.D{
-				{Key: "_id", Value: "$categoryDoc._id"},
-				{Key: "name", Value: bson.D{{Key: "$first", Value: "$categoryDoc.name"}}},
-				{Key: "total", Value: bson.D{{Key: "$sum", Value: "$amount"}}},
-			}}},
-		}
+	categoryIndex, err := h.categoryIndex(ctx, ledgerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "計算本月資料失敗"})
+		return
+	}
 
-		cursor, err := collection.Aggregate(ctx, pipeline)
+	// 2. 定義統計函式 (重用邏輯)，回傳各類別本身的金額
+	converter := h.newConverter(ctx, c)
+	getStats := func(start, end time.Time) (map[primitive.ObjectID]models.Money, error) {
+		sums, err := h.transactions.SumByCategory(ctx, repository.TransactionFilter{
+			LedgerID:  ledgerID,
+			StartDate: start.Format("2006-01-02"),
+			EndDate:   end.AddDate(0, 0, -1).Format("2006-01-02"),
+		})
 		if err != nil {
 			return nil, err
 		}
-		defer cursor.Close(ctx)
 
-		var results []bson.M
-		if err = cursor.All(ctx, &results); err != nil {
-			return nil, err
-		}
-
-		stats := make(map[string]categoryStat)
-		for _, r := range results {
-			id := ""
-			if objID, ok := r["_id"].(primitive.ObjectID); ok {
-				id = objID.Hex()
-			} else if strID, ok := r["_id"].(string); ok {
-				id = strID
-			}
-			if id == "" {
+		stats := make(map[primitive.ObjectID]models.Money)
+		for _, sum := range converter.convertTotals(ctx, sums) {
+			category, ok := categoryIndex[sum.CategoryID]
+			if !ok || category.Type != "expense" {
 				continue
 			}
-			name, _ := r["name"].(string)
-			total, _ := r["total"].(float64)
-			stats[id] = categoryStat{Name: name, Total: total}
+			stats[category.ID] += sum.Total
 		}
 		return stats, nil
 	}
@@ -645,39 +600,63 @@ func GetMonthlyComparison(c *gin.Context) {
 
 	// 4. 合併資料 (Merge)
 	// 找出所有出現過的類別
-	categories := make(map[string]string)
-	for k, v := range thisMonthStats {
-		categories[k] = v.Name
+	var ids []primitive.ObjectID
+	for id := range thisMonthStats {
+		ids = append(ids, id)
 	}
-	for k, v := range lastMonthStats {
-		if _, ok := categories[k]; !ok {
-			categories[k] = v.Name
+	for id := range lastMonthStats {
+		if _, ok := thisMonthStats[id]; !ok {
+			ids = append(ids, id)
 		}
 	}
 
-	var response []gin.H
-	for catID, catName := range categories {
-		current := 0.0
-		previous := 0.0
-		if stat, ok := thisMonthStats[catID]; ok {
-			current = stat.Total
-			if catName == "" {
-				catName = stat.Name
-			}
+	tree := newCategoryTree(categoryIndex)
+	currentTotals, previousTotals := thisMonthStats, lastMonthStats
+	if view == viewTree {
+		// 上層類別的金額包含所有子類別
+		currentTotals, previousTotals = rollUp(tree, thisMonthStats), rollUp(tree, lastMonthStats)
+		ids = tree.withAncestors(ids)
+	}
+
+	less := func(a, b primitive.ObjectID) bool {
+		if currentTotals[a] != currentTotals[b] {
+			return currentTotals[a] > currentTotals[b]
 		}
-		if stat, ok := lastMonthStats[catID]; ok {
-			previous = stat.Total
-			if catName == "" {
-				catName = stat.Name
-			}
+		if categoryIndex[a].Order != categoryIndex[b].Order {
+			return categoryIndex[a].Order < categoryIndex[b].Order
+		}
+		return categoryIndex[a].Name < categoryIndex[b].Name
+	}
+	comparison := func(id primitive.ObjectID) gin.H {
+		item := gin.H{
+			"categoryId": id.Hex(),
+			"category":   categoryIndex[id].Name,
+			"current":    currentTotals[id], // 若無 key 會回傳 0 (Money 預設值)
+			"previous":   previousTotals[id],
+			"currency":   converter.base,
 		}
-		response = append(response, gin.H{
-			"categoryId": catID,
-			"category":   catName,
-			"current":    current, // 若無 key 會回傳 0 (float64 預設值)
-			"previous":   previous,
+		if parent, ok := tree.parent(id); ok {
+			item["parentId"] = parent.Hex()
+		}
+		return item
+	}
+
+	var response []gin.H
+	if view == viewTree {
+		response = nestCategories(tree, ids, less, func(id primitive.ObjectID, children []gin.H) gin.H {
+			item := comparison(id)
+			item["ownCurrent"] = thisMonthStats[id]
+			item["ownPrevious"] = lastMonthStats[id]
+			item["children"] = children
+			return item
 		})
+	} else {
+		sort.SliceStable(ids, func(i, j int) bool { return less(ids[i], ids[j]) })
+		for _, id := range ids {
+			response = append(response, comparison(id))
+		}
 	}
 
+	converter.writeMissingHeader(c)
 	c.JSON(http.StatusOK, response)
 }
@@ -0,0 +1,286 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"server/models"
+	"server/repository"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fieldChange 與前一個版本相比有變動的欄位
+type fieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// transactionVersion 修改紀錄中的一個版本
+type transactionVersion struct {
+	Version      int                `json:"version"`
+	Amount       models.Money       `json:"amount"`
+	Currency     string             `json:"currency"`
+	CategoryID   primitive.ObjectID `json:"category_id"`
+	CategoryName string             `json:"category_name"`
+	// AccountID: null 代表沒有指定帳戶
+	AccountID *primitive.ObjectID `json:"account_id"`
+	Date      string              `json:"date"`
+	Note      string              `json:"note"`
+	Tags      []string            `json:"tags"`
+	// EditedBy / EditedAt: 產生此版本的使用者與時間 (第 1 版為建立者)
+	EditedBy string        `json:"edited_by"`
+	EditedAt time.Time     `json:"edited_at"`
+	Current  bool          `json:"current"`
+	Changes  []fieldChange `json:"changes"`
+}
+
+// updateTransaction 修改交易並保存修改前的版本與稽核紀錄，回傳修改後的資料
+func (h *Handler) updateTransaction(ctx context.Context, c *gin.Context, ledgerID, id primitive.ObjectID, changes models.Transaction) (models.Transaction, error) {
+	before, after, err := h.transactions.Update(ctx, ledgerID, id, changes)
+	if err != nil {
+		return after, err
+	}
+
+	// 交易已經修改，舊版本寫入失敗只記 log (與稽核紀錄相同)
+	revision := models.NewTransactionRevision(before, c.GetString("currentUser"), after.UpdatedAt)
+	if err := h.revisions.Create(ctx, revision); err != nil {
+		log.Printf("⚠️ 無法保存交易舊版本 (%s v%d): %v", id.Hex(), before.Version, err)
+	}
+
+	h.recordAudit(ctx, c, AuditUpdate, "transaction", id, before, after)
+	return after, nil
+}
+
+// transactionVersions 將舊版本與目前的交易依版本由新到舊排列，並計算每個版本改了哪些欄位
+func transactionVersions(current models.Transaction, revisions []models.TransactionRevision, categories map[primitive.ObjectID]models.Category) []transactionVersion {
+	versions := make([]transactionVersion, 0, len(revisions)+1)
+	editedBy, editedAt := current.Owner, current.CreatedAt
+	for _, revision := range revisions {
+		versions = append(versions, transactionVersion{
+			Version:    revision.Version,
+			Amount:     revision.Amount,
+			Currency:   revision.Currency,
+			CategoryID: revision.CategoryID,
+			AccountID:  revision.AccountID,
+			Date:       revision.Date,
+			Note:       revision.Note,
+			Tags:       revision.Tags,
+			EditedBy:   editedBy,
+			EditedAt:   editedAt,
+		})
+		editedBy, editedAt = revision.ReplacedBy, revision.ReplacedAt
+	}
+	versions = append(versions, transactionVersion{
+		Version:    current.Version,
+		Amount:     current.Amount,
+		Currency:   current.Currency,
+		CategoryID: current.CategoryID,
+		AccountID:  current.AccountID,
+		Date:       current.Date,
+		Note:       current.Note,
+		Tags:       current.Tags,
+		EditedBy:   editedBy,
+		EditedAt:   editedAt,
+		Current:    true,
+	})
+
+	for i := range versions {
+		versions[i].CategoryName = categories[versions[i].CategoryID].Name
+		if versions[i].Tags == nil {
+			versions[i].Tags = []string{}
+		}
+		versions[i].Changes = []fieldChange{}
+		if i > 0 {
+			versions[i].Changes = diffVersions(versions[i-1], versions[i])
+		}
+	}
+
+	// 由新到舊
+	for i, j := 0, len(versions)-1; i < j; i, j = i+1, j-1 {
+		versions[i], versions[j] = versions[j], versions[i]
+	}
+	return versions
+}
+
+// diffVersions 列出兩個版本間不同的欄位
+func diffVersions(from, to transactionVersion) []fieldChange {
+	changes := []fieldChange{}
+	if from.Amount != to.Amount {
+		changes = append(changes, fieldChange{Field: "amount", From: from.Amount, To: to.Amount})
+	}
+	if from.Currency != to.Currency {
+		changes = append(changes, fieldChange{Field: "currency", From: from.Currency, To: to.Currency})
+	}
+	if from.CategoryID != to.CategoryID {
+		changes = append(changes, fieldChange{Field: "category_id", From: from.CategoryID, To: to.CategoryID})
+	}
+	if !sameAccount(from.AccountID, to.AccountID) {
+		changes = append(changes, fieldChange{Field: "account_id", From: from.AccountID, To: to.AccountID})
+	}
+	if from.Date != to.Date {
+		changes = append(changes, fieldChange{Field: "date", From: from.Date, To: to.Date})
+	}
+	if from.Note != to.Note {
+		changes = append(changes, fieldChange{Field: "note", From: from.Note, To: to.Note})
+	}
+	if !slices.Equal(from.Tags, to.Tags) {
+		changes = append(changes, fieldChange{Field: "tags", From: from.Tags, To: to.Tags})
+	}
+	return changes
+}
+
+// sameAccount 兩個版本的帳戶是否相同 (nil 代表沒有指定帳戶)
+func sameAccount(a, b *primitive.ObjectID) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// GetTransactionHistory godoc
+// @Summary      取得交易修改紀錄
+// @Description  列出交易的所有版本 (由新到舊)，包含修改者、時間與和前一版相比變動的欄位
+// @Tags         Transactions
+// @Produce      json
+// @Param        id   path  string  true  "交易 ID"
+// @Success      200  {object}  map[string]interface{}
+// @Router       /transactions/{id}/history [get]
+func (h *Handler) GetTransactionHistory(c *gin.Context) {
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
+	objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的 ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	current, err := h.transactions.Get(ctx, ledgerID, objID)
+	if err == repository.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到該筆資料"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查詢失敗"})
+		return
+	}
+
+	revisions, err := h.revisions.List(ctx, ledgerID, objID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法讀取修改紀錄"})
+		return
+	}
+	categories, err := h.categoryIndex(ctx, ledgerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法讀取類別"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"transaction_id":  objID,
+		"current_version": current.Version,
+		"versions":        transactionVersions(current, revisions, categories),
+	})
+}
+
+// RevertTransaction godoc
+// @Summary      還原交易到指定版本
+// @Description  以指定舊版本的內容修改交易 (會產生新的版本，原本的內容仍保留在修改紀錄中)
+// @Tags         Transactions
+// @Produce      json
+// @Param        id       path  string   true  "交易 ID"
+// @Param        version  path  integer  true  "版本號"
+// @Success      200  {object}  models.Transaction
+// @Router       /transactions/{id}/history/{version}/revert [post]
+func (h *Handler) RevertTransaction(c *gin.Context) {
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
+	objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的 ID"})
+		return
+	}
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的版本號"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	current, err := h.transactions.Get(ctx, ledgerID, objID)
+	if err == repository.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到該筆資料"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查詢失敗"})
+		return
+	}
+	if version == current.Version {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "已是目前的版本"})
+		return
+	}
+	// 只還原一邊會讓轉帳的兩邊不一致
+	if current.IsTransfer() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "轉帳不支援還原舊版本，請使用 PUT /transfers/:id 修改"})
+		return
+	}
+
+	revision, err := h.revisions.Get(ctx, ledgerID, objID, version)
+	if err == repository.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到該版本"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法讀取修改紀錄"})
+		return
+	}
+
+	// 舊版本的類別可能已合併或封存
+	if revision.CategoryID != current.CategoryID && !h.checkCategoryUsable(ctx, c, ledgerID, revision.CategoryID) {
+		return
+	}
+
+	// 加入標籤之前的版本沒有 tags，還原為沒有標籤
+	tags := revision.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	// 舊版本沒有帳戶時清除帳戶；帳戶可能已封存或刪除
+	accountID := revision.AccountID
+	if accountID == nil {
+		none := primitive.NilObjectID
+		accountID = &none
+	}
+	if accountChanged(current.AccountID, accountID) && !h.checkAccountUsable(ctx, c, ledgerID, *accountID) {
+		return
+	}
+	after, err := h.updateTransaction(ctx, c, ledgerID, objID, models.Transaction{
+		Amount:     revision.Amount,
+		Currency:   revision.Currency,
+		CategoryID: revision.CategoryID,
+		AccountID:  accountID,
+		Date:       revision.Date,
+		Note:       revision.Note,
+		Tags:       tags,
+		UpdatedAt:  time.Now(),
+	})
+	if err == repository.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到該筆資料"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "還原失敗"})
+		return
+	}
+
+	c.JSON(http.StatusOK, after)
+}
@@ -0,0 +1,453 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"server/models"
+	"server/repository"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// transferLeg 轉帳的一邊 (一筆交易)，金額以該帳戶的幣別表示
+type transferLeg struct {
+	TransactionID primitive.ObjectID `json:"transaction_id"`
+	AccountID     primitive.ObjectID `json:"account_id"`
+	Amount        models.Money       `json:"amount" swaggertype:"number"`
+	Currency      string             `json:"currency"`
+}
+
+// transferResponse 一筆轉帳 (由轉出與轉入兩筆交易組成)
+type transferResponse struct {
+	ID   primitive.ObjectID `json:"id"`
+	Date string             `json:"date"`
+	Note string             `json:"note"`
+	Tags []string           `json:"tags"`
+	From transferLeg        `json:"from"`
+	To   transferLeg        `json:"to"`
+}
+
+func toTransferLeg(tx models.Transaction) transferLeg {
+	leg := transferLeg{TransactionID: tx.ID, Amount: tx.Amount, Currency: tx.Currency}
+	if tx.AccountID != nil {
+		leg.AccountID = *tx.AccountID
+	}
+	return leg
+}
+
+func toTransferResponse(out, in models.Transaction) transferResponse {
+	tags := out.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return transferResponse{
+		ID:   *out.TransferID,
+		Date: out.Date,
+		Note: out.Note,
+		Tags: tags,
+		From: toTransferLeg(out),
+		To:   toTransferLeg(in),
+	}
+}
+
+// transferToAmount 決定轉入金額：兩個帳戶幣別相同時必須等於轉出金額 (未指定時自動帶入)，不同時必須指定
+// keep 為修改時沿用的轉入金額 (兩邊幣別都沒有變更時才沿用)
+func transferToAmount(from, to models.Account, amount models.Money, toAmount, keep *models.Money) (models.Money, string) {
+	if from.Currency == to.Currency {
+		if toAmount != nil && *toAmount != amount {
+			return 0, "兩個帳戶幣別相同時，轉入金額必須等於轉出金額"
+		}
+		return amount, ""
+	}
+	if toAmount == nil {
+		toAmount = keep
+	}
+	if toAmount == nil {
+		return 0, "兩個帳戶幣別不同，請指定轉入金額 to_amount"
+	}
+	if *toAmount <= 0 {
+		return 0, "to_amount 必須大於 0"
+	}
+	return *toAmount, ""
+}
+
+// transferLegs 取得轉帳的轉出與轉入，找不到 (或只剩一邊) 時回傳 repository.ErrNotFound
+func (h *Handler) transferLegs(ctx context.Context, ledgerID, transferID primitive.ObjectID) (out, in models.Transaction, err error) {
+	legs, err := h.transactions.TransferLegs(ctx, ledgerID, transferID, false)
+	if err != nil {
+		return out, in, err
+	}
+	var hasOut, hasIn bool
+	for _, leg := range legs {
+		switch leg.Kind {
+		case models.TransactionTransferOut:
+			out, hasOut = leg, true
+		case models.TransactionTransferIn:
+			in, hasIn = leg, true
+		}
+	}
+	if !hasOut || !hasIn {
+		return out, in, repository.ErrNotFound
+	}
+	return out, in, nil
+}
+
+// transferAccount 取得轉帳使用的帳戶；改到其他帳戶時必須可使用，沿用原本的帳戶時可以是已封存的帳戶
+func (h *Handler) transferAccount(ctx context.Context, c *gin.Context, ledgerID primitive.ObjectID, current *primitive.ObjectID, id primitive.ObjectID) (models.Account, bool) {
+	if accountChanged(current, &id) {
+		return h.usableAccount(ctx, c, ledgerID, id)
+	}
+	account, err := h.accounts.Get(ctx, ledgerID, id)
+	if err == repository.ErrNotFound {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "找不到帳戶"})
+		return account, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法讀取帳戶"})
+		return account, false
+	}
+	return account, true
+}
+
+// deleteTransfer 將轉帳的兩邊一起移到垃圾桶，找不到時回傳 repository.ErrNotFound
+func (h *Handler) deleteTransfer(ctx context.Context, c *gin.Context, ledgerID, transferID primitive.ObjectID) error {
+	legs, err := h.transactions.TransferLegs(ctx, ledgerID, transferID, false)
+	if err != nil {
+		return err
+	}
+	if len(legs) == 0 {
+		return repository.ErrNotFound
+	}
+	for _, leg := range legs {
+		deleted, err := h.transactions.Delete(ctx, ledgerID, leg.ID)
+		if err != nil {
+			return err
+		}
+		h.recordAudit(ctx, c, AuditDelete, "transaction", leg.ID, deleted, nil)
+	}
+	return nil
+}
+
+// trashedTransferPartners 垃圾桶中與 item 同一筆轉帳的另一邊，item 不是轉帳時回傳 nil
+func (h *Handler) trashedTransferPartners(ctx context.Context, ledgerID primitive.ObjectID, item interface{}) ([]models.Transaction, error) {
+	tx, ok := item.(models.Transaction)
+	if !ok || !tx.IsTransfer() {
+		return nil, nil
+	}
+	legs, err := h.transactions.TransferLegs(ctx, ledgerID, *tx.TransferID, true)
+	if err != nil {
+		return nil, err
+	}
+	partners := make([]models.Transaction, 0, len(legs))
+	for _, leg := range legs {
+		if leg.ID != tx.ID {
+			partners = append(partners, leg)
+		}
+	}
+	return partners, nil
+}
+
+// CreateTransfer godoc
+// @Summary      新增轉帳
+// @Description  在兩個帳戶之間轉帳 (例如繳信用卡費、存到儲蓄帳戶)，會建立轉出與轉入兩筆交易，不計入收入與支出
+// @Description  兩個帳戶幣別不同時需指定轉入金額 to_amount
+// @Tags         Transfers
+// @Accept       json
+// @Produce      json
+// @Success      200  {object}  transferResponse
+// @Router       /transfers [post]
+func (h *Handler) CreateTransfer(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(string)
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
+	var input struct {
+		FromAccountID primitive.ObjectID `json:"from_account_id" binding:"required"`
+		ToAccountID   primitive.ObjectID `json:"to_account_id" binding:"required"`
+		// Amount: 轉出金額 (轉出帳戶的幣別)
+		Amount models.Money `json:"amount" binding:"required"`
+		// ToAmount: 轉入金額 (轉入帳戶的幣別)，兩個帳戶幣別相同時可省略
+		ToAmount *models.Money `json:"to_amount"`
+		Date     string        `json:"date" binding:"required"`
+		Note     string        `json:"note"`
+		Tags     []string      `json:"tags"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amount 必須大於 0"})
+		return
+	}
+	if !validDate(input.Date) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date 格式錯誤，請使用 YYYY-MM-DD"})
+		return
+	}
+	if input.FromAccountID == input.ToAccountID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "轉出與轉入帳戶不可相同"})
+		return
+	}
+	tags, msg := normalizeTags(input.Tags)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	from, ok := h.usableAccount(ctx, c, ledgerID, input.FromAccountID)
+	if !ok {
+		return
+	}
+	to, ok := h.usableAccount(ctx, c, ledgerID, input.ToAccountID)
+	if !ok {
+		return
+	}
+	toAmount, msg := transferToAmount(from, to, input.Amount, input.ToAmount, nil)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	transferID := primitive.NewObjectID()
+	now := time.Now()
+	leg := func(kind string, account models.Account, amount models.Money) models.Transaction {
+		return models.Transaction{
+			ID:         primitive.NewObjectID(),
+			Amount:     amount,
+			Currency:   account.Currency,
+			Date:       input.Date,
+			Note:       input.Note,
+			AccountID:  &account.ID,
+			Kind:       kind,
+			TransferID: &transferID,
+			Tags:       tags,
+			LedgerID:   ledgerID,
+			Owner:      currentUser,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+			Version:    1,
+		}
+	}
+	out := leg(models.TransactionTransferOut, from, input.Amount)
+	in := leg(models.TransactionTransferIn, to, toAmount)
+
+	if err := h.transactions.Create(ctx, out); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法寫入資料庫"})
+		return
+	}
+	if err := h.transactions.Create(ctx, in); err != nil {
+		// 不留下只有一邊的轉帳
+		if _, err := h.transactions.Delete(ctx, ledgerID, out.ID); err == nil {
+			h.transactions.Purge(ctx, ledgerID, out.ID)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法寫入資料庫"})
+		return
+	}
+
+	h.recordAudit(ctx, c, AuditCreate, "transaction", out.ID, nil, out)
+	h.recordAudit(ctx, c, AuditCreate, "transaction", in.ID, nil, in)
+
+	c.JSON(http.StatusOK, toTransferResponse(out, in))
+}
+
+// GetTransfer godoc
+// @Summary      取得轉帳
+// @Tags         Transfers
+// @Produce      json
+// @Param        id   path      string  true  "轉帳 ID (交易的 transfer_id)"
+// @Success      200  {object}  transferResponse
+// @Router       /transfers/{id} [get]
+func (h *Handler) GetTransfer(c *gin.Context) {
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
+	objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的 ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	out, in, err := h.transferLegs(ctx, ledgerID, objID)
+	if err == repository.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到轉帳"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查詢失敗"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toTransferResponse(out, in))
+}
+
+// UpdateTransfer godoc
+// @Summary      修改轉帳
+// @Description  同時修改轉出與轉入兩筆交易 (各自保存修改紀錄)，未帶的欄位不修改
+// @Tags         Transfers
+// @Accept       json
+// @Produce      json
+// @Param        id   path      string  true  "轉帳 ID (交易的 transfer_id)"
+// @Success      200  {object}  transferResponse
+// @Router       /transfers/{id} [put]
+func (h *Handler) UpdateTransfer(c *gin.Context) {
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
+	objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的 ID"})
+		return
+	}
+
+	var input struct {
+		FromAccountID *primitive.ObjectID `json:"from_account_id"`
+		ToAccountID   *primitive.ObjectID `json:"to_account_id"`
+		Amount        *models.Money       `json:"amount"`
+		ToAmount      *models.Money       `json:"to_amount"`
+		Date          *string             `json:"date"`
+		Note          *string             `json:"note"`
+		// Tags: 沒帶時不修改，空陣列代表清除
+		Tags []string `json:"tags"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Amount != nil && *input.Amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amount 必須大於 0"})
+		return
+	}
+	if input.Date != nil && !validDate(*input.Date) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date 格式錯誤，請使用 YYYY-MM-DD"})
+		return
+	}
+	if (input.FromAccountID != nil && input.FromAccountID.IsZero()) || (input.ToAccountID != nil && input.ToAccountID.IsZero()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "轉帳必須指定轉出與轉入帳戶"})
+		return
+	}
+	tags, msg := normalizeTags(input.Tags)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	out, in, err := h.transferLegs(ctx, ledgerID, objID)
+	if err == repository.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到轉帳"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失敗"})
+		return
+	}
+
+	fromID, toID := *out.AccountID, *in.AccountID
+	if input.FromAccountID != nil {
+		fromID = *input.FromAccountID
+	}
+	if input.ToAccountID != nil {
+		toID = *input.ToAccountID
+	}
+	if fromID == toID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "轉出與轉入帳戶不可相同"})
+		return
+	}
+	from, ok := h.transferAccount(ctx, c, ledgerID, out.AccountID, fromID)
+	if !ok {
+		return
+	}
+	to, ok := h.transferAccount(ctx, c, ledgerID, in.AccountID, toID)
+	if !ok {
+		return
+	}
+
+	amount := out.Amount
+	if input.Amount != nil {
+		amount = *input.Amount
+	}
+	var keep *models.Money
+	if from.Currency == out.Currency && to.Currency == in.Currency {
+		keep = &in.Amount
+	}
+	toAmount, msg := transferToAmount(from, to, amount, input.ToAmount, keep)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	date, note := out.Date, out.Note
+	if input.Date != nil {
+		date = *input.Date
+	}
+	if input.Note != nil {
+		note = *input.Note
+	}
+
+	// 兩邊分別修改 (各自保存舊版本)，沒有變動的一邊不產生新版本
+	now := time.Now()
+	next := func(current models.Transaction, account models.Account, amount models.Money) (models.Transaction, error) {
+		changes := models.Transaction{
+			Amount:    amount,
+			Currency:  account.Currency,
+			AccountID: &account.ID,
+			Date:      date,
+			Note:      note,
+			Tags:      tags,
+			UpdatedAt: now,
+		}
+		if current.Amount == changes.Amount && current.Currency == changes.Currency && *current.AccountID == account.ID &&
+			current.Date == date && current.Note == note && (tags == nil || slices.Equal(current.Tags, tags)) {
+			return current, nil
+		}
+		return h.updateTransaction(ctx, c, ledgerID, current.ID, changes)
+	}
+	if out, err = next(out, from, amount); err == nil {
+		in, err = next(in, to, toAmount)
+	}
+	if err == repository.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到轉帳"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失敗"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toTransferResponse(out, in))
+}
+
+// DeleteTransfer godoc
+// @Summary      刪除轉帳
+// @Description  將轉出與轉入兩筆交易一起移到垃圾桶
+// @Tags         Transfers
+// @Produce      json
+// @Param        id   path      string  true  "轉帳 ID (交易的 transfer_id)"
+// @Success      200  {object}  map[string]interface{}
+// @Router       /transfers/{id} [delete]
+func (h *Handler) DeleteTransfer(c *gin.Context) {
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
+	objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的 ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := h.deleteTransfer(ctx, c, ledgerID, objID); err == repository.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到轉帳"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "刪除失敗"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "刪除成功"})
+}
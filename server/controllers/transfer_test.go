@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"server/repository"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTransfersExcludedFromTotals(t *testing.T) {
+	l := newTestLedger(t)
+	food := l.category("餐飲", "expense")
+	salary := l.category("薪資", "income")
+	bank := l.account("銀行")
+	wallet := l.account("錢包")
+
+	l.transaction(food, 100, "2026-03-05", "trip")
+	l.transaction(salary, 1000, "2026-03-10")
+
+	var transfer transferResponse
+	l.do(http.MethodPost, "/transfers", gin.H{
+		"from_account_id": bank.Hex(),
+		"to_account_id":   wallet.Hex(),
+		"amount":          500,
+		"date":            "2026-03-12",
+		"tags":            []string{"trip"},
+	}, http.StatusOK, &transfer)
+
+	// 轉帳的兩邊會出現在列表中，但不計入收入與支出
+	list := l.listMarch()
+	if list.Meta.Total != 4 || list.Meta.TotalIncome != 1000 || list.Meta.TotalExpense != 100 {
+		t.Fatalf("list with transfer: total=%d income=%v expense=%v", list.Meta.Total, list.Meta.TotalIncome, list.Meta.TotalExpense)
+	}
+
+	// 轉帳沒有類別，handler 也會略過；這裡直接確認 repository 與 MongoDB 版本一樣不回傳轉帳
+	filter := repository.TransactionFilter{LedgerID: l.ledgerID}
+	sums, err := l.repos.Transactions.SumByCategory(context.Background(), filter)
+	if err != nil || len(sums) != 2 {
+		t.Fatalf("SumByCategory = %+v, %v", sums, err)
+	}
+	tagSums, err := l.repos.Transactions.SumByTag(context.Background(), filter)
+	if err != nil || len(tagSums) != 1 || tagSums[0].CategoryID != food {
+		t.Fatalf("SumByTag = %+v, %v", tagSums, err)
+	}
+
+	var stats []categoryStat
+	l.do(http.MethodGet, "/stats/categories?month=2026-03", nil, http.StatusOK, &stats)
+	if len(stats) != 1 || stats[0].CategoryID != food.Hex() || stats[0].Amount != 100 {
+		t.Fatalf("category stats with transfer = %+v", stats)
+	}
+
+	var tagStats []struct {
+		Tag    string  `json:"tag"`
+		Amount float64 `json:"amount"`
+		Count  int64   `json:"count"`
+	}
+	l.do(http.MethodGet, "/stats/tags?month=2026-03", nil, http.StatusOK, &tagStats)
+	if len(tagStats) != 1 || tagStats[0].Tag != "trip" || tagStats[0].Amount != 100 || tagStats[0].Count != 1 {
+		t.Fatalf("tag stats with transfer = %+v", tagStats)
+	}
+
+	// 餘額仍然計入轉帳
+	var balance struct {
+		Balance float64 `json:"balance"`
+	}
+	l.do(http.MethodGet, "/accounts/"+wallet.Hex()+"/balance", nil, http.StatusOK, &balance)
+	if balance.Balance != 500 {
+		t.Fatalf("wallet balance = %v, want 500", balance.Balance)
+	}
+
+	l.do(http.MethodDelete, "/transfers/"+transfer.ID.Hex(), nil, http.StatusOK, nil)
+	if list := l.listMarch(); list.Meta.Total != 2 {
+		t.Fatalf("list after deleting transfer: total=%d, want 2", list.Meta.Total)
+	}
+}
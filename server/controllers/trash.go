@@ -0,0 +1,268 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"server/config"
+	"server/repository"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// trashKind 垃圾桶中的一種資料 (路徑上的 :kind)
+type trashKind struct {
+	entity  string // 稽核紀錄的 entity
+	restore func(ctx context.Context, ledgerID, id primitive.ObjectID) (interface{}, error)
+	purge   func(ctx context.Context, ledgerID, id primitive.ObjectID) (interface{}, error)
+}
+
+func newTrashKind[T any](entity string, trash repository.Trash[T]) trashKind {
+	return trashKind{
+		entity: entity,
+		restore: func(ctx context.Context, ledgerID, id primitive.ObjectID) (interface{}, error) {
+			return trash.Restore(ctx, ledgerID, id)
+		},
+		purge: func(ctx context.Context, ledgerID, id primitive.ObjectID) (interface{}, error) {
+			return trash.Purge(ctx, ledgerID, id)
+		},
+	}
+}
+
+// trashKinds :kind 與路由名稱一致 (transactions、categories、budgets、fixed-expenses)
+func (h *Handler) trashKinds() map[string]trashKind {
+	transactions := newTrashKind("transaction", h.transactions)
+	purgeTransaction := transactions.purge
+	transactions.purge = func(ctx context.Context, ledgerID, id primitive.ObjectID) (interface{}, error) {
+		purged, err := purgeTransaction(ctx, ledgerID, id)
+		if err != nil {
+			return purged, err
+		}
+		// 舊版本刪除失敗時留給每日排程清除
+		if err := h.revisions.DeleteByTransaction(ctx, ledgerID, id); err != nil {
+			log.Printf("⚠️ 無法刪除交易舊版本 (%s): %v", id.Hex(), err)
+		}
+		return purged, nil
+	}
+
+	return map[string]trashKind{
+		"transactions":   transactions,
+		"categories":     newTrashKind("category", h.categories),
+		"budgets":        newTrashKind("budget", h.budgets),
+		"fixed-expenses": newTrashKind("fixed_expense", h.fixedExpenses),
+		"accounts":       newTrashKind("account", h.accounts),
+	}
+}
+
+// GetTrash 列出目前帳本垃圾桶中的資料 (依刪除時間由新到舊)
+func (h *Handler) GetTrash(c *gin.Context) {
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	transactions, err := h.transactions.ListDeleted(ctx, ledgerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法讀取垃圾桶"})
+		return
+	}
+	categories, err := h.categories.ListDeleted(ctx, ledgerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法讀取垃圾桶"})
+		return
+	}
+	budgets, err := h.budgets.ListDeleted(ctx, ledgerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法讀取垃圾桶"})
+		return
+	}
+	categoryIndex, err := h.categoryIndex(ctx, ledgerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法讀取垃圾桶"})
+		return
+	}
+	for i := range budgets {
+		budgets[i].CategoryName = categoryIndex[budgets[i].CategoryID].Name
+		budgets[i].CategoryType = categoryIndex[budgets[i].CategoryID].Type
+	}
+	fixedExpenses, err := h.fixedExpenses.ListDeleted(ctx, ledgerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法讀取垃圾桶"})
+		return
+	}
+	accounts, err := h.accounts.ListDeleted(ctx, ledgerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法讀取垃圾桶"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"transactions":   transactions,
+		"categories":     categories,
+		"budgets":        budgets,
+		"fixed_expenses": fixedExpenses,
+		"accounts":       accounts,
+		"retention_days": int(config.TrashRetention().Hours() / 24),
+	})
+}
+
+// RestoreTrashItem 從垃圾桶復原一筆資料
+func (h *Handler) RestoreTrashItem(c *gin.Context) {
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
+	kind, ok := h.trashKinds()[c.Param("kind")]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不支援的資料類型"})
+		return
+	}
+	objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的 ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// 同月份、同類別只能有一筆預算，已重新設定過時不可復原
+	if kind.entity == "budget" {
+		if conflict, err := h.budgetRestoreConflict(ctx, ledgerID, objID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "復原失敗"})
+			return
+		} else if conflict {
+			c.JSON(http.StatusConflict, gin.H{"error": "該月份已有相同類別的預算，請先刪除後再復原"})
+			return
+		}
+	}
+
+	restored, err := kind.restore(ctx, ledgerID, objID)
+	if err == repository.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "垃圾桶中找不到該筆資料"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "復原失敗"})
+		return
+	}
+
+	h.recordAudit(ctx, c, AuditRestore, kind.entity, objID, nil, restored)
+
+	// 轉帳的另一邊一起復原
+	partners, err := h.trashedTransferPartners(ctx, ledgerID, restored)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "復原失敗"})
+		return
+	}
+	for _, partner := range partners {
+		restoredPartner, err := kind.restore(ctx, ledgerID, partner.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "復原失敗"})
+			return
+		}
+		h.recordAudit(ctx, c, AuditRestore, kind.entity, partner.ID, nil, restoredPartner)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已復原", "data": restored})
+}
+
+// budgetRestoreConflict 垃圾桶中的預算是否已有相同月份、類別的新預算
+func (h *Handler) budgetRestoreConflict(ctx context.Context, ledgerID, id primitive.ObjectID) (bool, error) {
+	deleted, err := h.budgets.ListDeleted(ctx, ledgerID)
+	if err != nil {
+		return false, err
+	}
+	for _, budget := range deleted {
+		if budget.ID != id {
+			continue
+		}
+		_, err := h.budgets.Find(ctx, ledgerID, budget.YearMonth, budget.CategoryID)
+		if err == repository.ErrNotFound {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	return false, nil
+}
+
+// PurgeTrashItem 從垃圾桶永久刪除一筆資料 (無法復原)
+func (h *Handler) PurgeTrashItem(c *gin.Context) {
+	ledgerID := c.MustGet("ledgerID").(primitive.ObjectID)
+	kind, ok := h.trashKinds()[c.Param("kind")]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不支援的資料類型"})
+		return
+	}
+	objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的 ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	purged, err := kind.purge(ctx, ledgerID, objID)
+	if err == repository.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "垃圾桶中找不到該筆資料"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "永久刪除失敗"})
+		return
+	}
+
+	h.recordAudit(ctx, c, AuditPurge, kind.entity, objID, purged, nil)
+
+	// 轉帳的另一邊一起永久刪除
+	partners, err := h.trashedTransferPartners(ctx, ledgerID, purged)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "永久刪除失敗"})
+		return
+	}
+	for _, partner := range partners {
+		purgedPartner, err := kind.purge(ctx, ledgerID, partner.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "永久刪除失敗"})
+			return
+		}
+		h.recordAudit(ctx, c, AuditPurge, kind.entity, partner.ID, purgedPartner, nil)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已永久刪除"})
+}
+
+// PurgeExpiredTrash 永久刪除超過保留天數 (TRASH_RETENTION_DAYS) 的垃圾桶資料，由每日排程呼叫
+func (h *Handler) PurgeExpiredTrash() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	cutoff := time.Now().Add(-config.TrashRetention())
+	purges := []struct {
+		name  string
+		purge func(context.Context, time.Time) (int64, error)
+	}{
+		{"transactions", h.transactions.PurgeDeletedBefore},
+		{"categories", h.categories.PurgeDeletedBefore},
+		{"budgets", h.budgets.PurgeDeletedBefore},
+		{"fixed_expenses", h.fixedExpenses.PurgeDeletedBefore},
+		{"accounts", h.accounts.PurgeDeletedBefore},
+	}
+	for _, p := range purges {
+		count, err := p.purge(ctx, cutoff)
+		if err != nil {
+			log.Printf("⚠️ 清除垃圾桶 %s 失敗: %v", p.name, err)
+			continue
+		}
+		if count > 0 {
+			log.Printf("🗑️ 已永久刪除 %d 筆過期的 %s", count, p.name)
+		}
+	}
+
+	// 交易永久刪除後，其舊版本也一併清除
+	count, err := h.revisions.PurgeOrphaned(ctx)
+	if err != nil {
+		log.Printf("⚠️ 清除交易舊版本失敗: %v", err)
+	} else if count > 0 {
+		log.Printf("🗑️ 已永久刪除 %d 筆交易舊版本", count)
+	}
+}
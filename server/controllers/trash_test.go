@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"net/http"
+	"server/models"
+	"testing"
+)
+
+func TestTrashHidesDeletedTransactions(t *testing.T) {
+	l := newTestLedger(t)
+	food := l.category("餐飲", "expense")
+
+	deleted := l.transaction(food, 100, "2026-03-05", "trip")
+	l.transaction(food, 200, "2026-03-06")
+	l.do(http.MethodDelete, "/transactions/"+deleted.Hex(), nil, http.StatusOK, nil)
+
+	list := l.listMarch()
+	if list.Meta.Total != 1 || len(list.Data) != 1 || list.Meta.TotalExpense != 200 {
+		t.Fatalf("list after delete: total=%d len=%d expense=%v", list.Meta.Total, len(list.Data), list.Meta.TotalExpense)
+	}
+
+	var stats []categoryStat
+	l.do(http.MethodGet, "/stats/categories?month=2026-03", nil, http.StatusOK, &stats)
+	if len(stats) != 1 || stats[0].Amount != 200 {
+		t.Fatalf("category stats after delete = %+v", stats)
+	}
+
+	var tags []tagCount
+	l.do(http.MethodGet, "/tags", nil, http.StatusOK, &tags)
+	if len(tags) != 0 {
+		t.Fatalf("tags of trashed transactions should be hidden: %+v", tags)
+	}
+
+	var trash struct {
+		Transactions []models.Transaction `json:"transactions"`
+	}
+	l.do(http.MethodGet, "/trash", nil, http.StatusOK, &trash)
+	if len(trash.Transactions) != 1 || trash.Transactions[0].ID != deleted {
+		t.Fatalf("trash = %+v", trash.Transactions)
+	}
+
+	// 已在垃圾桶中的交易不能再刪除一次
+	l.do(http.MethodDelete, "/transactions/"+deleted.Hex(), nil, http.StatusNotFound, nil)
+
+	l.do(http.MethodPost, "/trash/transactions/"+deleted.Hex()+"/restore", nil, http.StatusOK, nil)
+	if list := l.listMarch(); list.Meta.Total != 2 || list.Meta.TotalExpense != 300 {
+		t.Fatalf("list after restore: total=%d expense=%v", list.Meta.Total, list.Meta.TotalExpense)
+	}
+}
@@ -0,0 +1,449 @@
+package controllers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/url"
+	"server/config"
+	"server/models"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	totpIssuer = "FinTrack"
+	totpDigits = 6
+	totpPeriod = 30 // 秒
+	// totpSkew: 允許前後各幾個時間區間，容忍手機時鐘誤差
+	totpSkew = 1
+
+	recoveryCodeCount = 10
+
+	// loginChallengeTTL: 輸入密碼後，需在此時間內完成兩步驟驗證
+	loginChallengeTTL = 5 * time.Minute
+	// loginChallengeMaxAttempts: 同一個 challenge 最多可嘗試幾次
+	loginChallengeMaxAttempts = 5
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type TwoFactorCodeInput struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type EnrollTwoFactorInput struct {
+	Password string `json:"password" binding:"required"`
+}
+
+type DisableTwoFactorInput struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"` // TOTP 驗證碼或復原碼
+}
+
+type VerifyLoginInput struct {
+	Challenge    string `json:"challenge" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// generateTOTPSecret 產生 160 bits 的 Base32 金鑰 (RFC 4226 建議長度)
+func generateTOTPSecret() (string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(buf), nil
+}
+
+// totpCode 依 RFC 6238 計算指定時間區間的驗證碼
+func totpCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000), nil
+}
+
+// verifyTOTP 驗證驗證碼，成功時回傳對應的時間區間
+func verifyTOTP(secret, code string, now time.Time) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := now.Unix() / totpPeriod
+	for i := -totpSkew; i <= totpSkew; i++ {
+		step := current + int64(i)
+		expected, err := totpCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpURI 產生驗證器 App 掃描用的 otpauth URI
+func totpURI(username, secret string) string {
+	label := url.PathEscape(totpIssuer + ":" + username)
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", totpIssuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// generateRecoveryCodes 產生一組新的復原碼，回傳明碼 (給使用者) 與雜湊 (存資料庫)
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(totpEncoding.EncodeToString(buf))
+		code := raw[:4] + "-" + raw[4:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashToken(code))
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.TrimSpace(code))
+}
+
+// secondFactorStore 將用過的 TOTP 時間區間與復原碼標記為已使用
+// 兩者都必須是條件式更新，兩個請求同時送出同一組驗證碼或復原碼時只有一個會成功
+type secondFactorStore interface {
+	// useTOTPStep 只有 step 比上次使用的時間區間新時才記錄並回傳 true
+	useTOTPStep(ctx context.Context, userID primitive.ObjectID, step int64) bool
+	// useRecoveryCode 移除復原碼，復原碼不存在 (或已經用過) 時回傳 false
+	useRecoveryCode(ctx context.Context, userID primitive.ObjectID, hash string) bool
+}
+
+// mongoSecondFactors 記錄在 users collection 的 totp_last_step 與 recovery_codes
+type mongoSecondFactors struct{}
+
+func (mongoSecondFactors) useTOTPStep(ctx context.Context, userID primitive.ObjectID, step int64) bool {
+	result, err := config.GetCollection("users").UpdateOne(ctx,
+		bson.M{"_id": userID, "totp_last_step": bson.M{"$not": bson.M{"$gte": step}}},
+		bson.M{"$set": bson.M{"totp_last_step": step}},
+	)
+	return err == nil && result.ModifiedCount == 1
+}
+
+func (mongoSecondFactors) useRecoveryCode(ctx context.Context, userID primitive.ObjectID, hash string) bool {
+	result, err := config.GetCollection("users").UpdateOne(ctx,
+		bson.M{"_id": userID, "recovery_codes": hash},
+		bson.M{"$pull": bson.M{"recovery_codes": hash}},
+	)
+	return err == nil && result.ModifiedCount == 1
+}
+
+// checkSecondFactor 驗證 TOTP 驗證碼或復原碼，並標記為已使用
+func checkSecondFactor(ctx context.Context, factors secondFactorStore, user models.User, code, recoveryCode string, now time.Time) bool {
+	if code != "" {
+		step, ok := verifyTOTP(user.TOTPSecret, code, now)
+		if !ok || step <= user.TOTPLastStep {
+			return false
+		}
+		return factors.useTOTPStep(ctx, user.ID, step)
+	}
+
+	if recoveryCode != "" {
+		return factors.useRecoveryCode(ctx, user.ID, hashToken(normalizeRecoveryCode(recoveryCode)))
+	}
+
+	return false
+}
+
+// createLoginChallenge 密碼正確但需要兩步驟驗證時，建立短效 challenge
+func createLoginChallenge(ctx context.Context, username string) (string, error) {
+	token, err := newSessionToken()
+	if err != nil {
+		return "", err
+	}
+
+	challenge := models.LoginChallenge{
+		ID:        primitive.NewObjectID(),
+		TokenHash: hashToken(token),
+		Username:  username,
+		ExpiresAt: time.Now().Add(loginChallengeTTL),
+	}
+	if _, err := config.GetCollection("login_challenges").InsertOne(ctx, challenge); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// VerifyLogin 登入第二步：以 TOTP 驗證碼或復原碼完成登入
+func VerifyLogin(c *gin.Context) {
+	var input VerifyLoginInput
+	if err := c.ShouldBindJSON(&input); err != nil || (input.Code == "" && input.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "請輸入驗證碼或復原碼"})
+		return
+	}
+
+	collection := config.GetCollection("login_challenges")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// 每次嘗試都先累加次數，超過上限的 challenge 直接失效
+	var challenge models.LoginChallenge
+	err := collection.FindOneAndUpdate(ctx,
+		bson.M{"token_hash": hashToken(input.Challenge), "expires_at": bson.M{"$gt": time.Now()}},
+		bson.M{"$inc": bson.M{"attempts": 1}},
+	).Decode(&challenge)
+	if err != nil || challenge.Attempts >= loginChallengeMaxAttempts {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "驗證逾時，請重新登入"})
+		return
+	}
+
+	user, err := findUser(ctx, challenge.Username)
+	if err != nil || !user.TOTPEnabled || user.Disabled {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "驗證逾時，請重新登入"})
+		return
+	}
+
+	result, wait := secondFactorLogin(ctx, mongoLoginAttempts{}, mongoSecondFactors{}, user, input, c.ClientIP(), time.Now())
+	switch result {
+	case loginLocked:
+		abortLoginLocked(c, wait)
+		return
+	case loginFailed:
+		recordAuthEvent(ctx, c, AuditLoginFailed, user.Username, primitive.NilObjectID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "驗證碼錯誤"})
+		return
+	}
+
+	collection.DeleteOne(ctx, bson.M{"_id": challenge.ID})
+
+	session, err := createSession(ctx, c, user.Username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法建立登入狀態"})
+		return
+	}
+	recordAuthEvent(ctx, c, AuditLogin, user.Username, session.ID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "登入成功", "user": user.Username})
+}
+
+// EnrollTwoFactor 開始設定兩步驟驗證，回傳金鑰與 otpauth URI (尚未啟用，需再呼叫 Confirm)
+func EnrollTwoFactor(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(string)
+	var input EnrollTwoFactorInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "請輸入密碼確認"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := findUser(ctx, currentUser)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到使用者"})
+		return
+	}
+	if !checkPassword(user, input.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "密碼錯誤"})
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "已啟用兩步驟驗證"})
+		return
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法產生金鑰"})
+		return
+	}
+
+	_, err = config.GetCollection("users").UpdateOne(ctx,
+		bson.M{"_id": user.ID},
+		bson.M{"$set": bson.M{"totp_secret": secret, "totp_enabled": false, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "設定失敗"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_uri": totpURI(user.Username, secret),
+	})
+}
+
+// ConfirmTwoFactor 以驗證碼確認設定，啟用兩步驟驗證並回傳復原碼
+func ConfirmTwoFactor(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(string)
+	var input TwoFactorCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "請輸入驗證碼"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := findUser(ctx, currentUser)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到使用者"})
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "已啟用兩步驟驗證"})
+		return
+	}
+	if user.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "請先開始設定兩步驟驗證"})
+		return
+	}
+
+	step, ok := verifyTOTP(user.TOTPSecret, input.Code, time.Now())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "驗證碼錯誤"})
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法產生復原碼"})
+		return
+	}
+
+	_, err = config.GetCollection("users").UpdateOne(ctx,
+		bson.M{"_id": user.ID},
+		bson.M{"$set": bson.M{
+			"totp_enabled":   true,
+			"totp_last_step": step,
+			"recovery_codes": hashes,
+			"updated_at":     time.Now(),
+		}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "啟用失敗"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已啟用兩步驟驗證", "recovery_codes": codes})
+}
+
+// RegenerateRecoveryCodes 重新產生復原碼 (舊的全部失效)
+func RegenerateRecoveryCodes(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(string)
+	var input TwoFactorCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "請輸入驗證碼"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := findUser(ctx, currentUser)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到使用者"})
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "尚未啟用兩步驟驗證"})
+		return
+	}
+	if !checkSecondFactor(ctx, mongoSecondFactors{}, user, input.Code, "", time.Now()) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "驗證碼錯誤"})
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法產生復原碼"})
+		return
+	}
+
+	_, err = config.GetCollection("users").UpdateOne(ctx,
+		bson.M{"_id": user.ID},
+		bson.M{"$set": bson.M{"recovery_codes": hashes, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新復原碼失敗"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// DisableTwoFactor 停用兩步驟驗證 (需密碼 + 驗證碼或復原碼)
+func DisableTwoFactor(c *gin.Context) {
+	currentUser := c.MustGet("currentUser").(string)
+	var input DisableTwoFactorInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "請輸入密碼與驗證碼"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := findUser(ctx, currentUser)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到使用者"})
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "尚未啟用兩步驟驗證"})
+		return
+	}
+	if !checkPassword(user, input.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "密碼錯誤"})
+		return
+	}
+
+	// code 可以是 6 位數驗證碼，也可以是復原碼 (手機遺失時)
+	if !checkSecondFactor(ctx, mongoSecondFactors{}, user, input.Code, "", time.Now()) &&
+		!checkSecondFactor(ctx, mongoSecondFactors{}, user, "", input.Code, time.Now()) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "驗證碼錯誤"})
+		return
+	}
+
+	_, err = config.GetCollection("users").UpdateOne(ctx,
+		bson.M{"_id": user.ID},
+		bson.M{
+			"$set":   bson.M{"totp_enabled": false, "updated_at": time.Now()},
+			"$unset": bson.M{"totp_secret": "", "totp_last_step": "", "recovery_codes": ""},
+		},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "停用失敗"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已停用兩步驟驗證"})
+}
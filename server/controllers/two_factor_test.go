@@ -0,0 +1,182 @@
+package controllers
+
+import (
+	"context"
+	"server/models"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// rfc6238Secret RFC 6238 附錄 B 的 SHA1 金鑰 "12345678901234567890" (Base32)
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// memorySecondFactors 記憶體版的 secondFactorStore，條件與 MongoDB 的條件式更新相同
+type memorySecondFactors struct {
+	lastStep      map[primitive.ObjectID]int64
+	recoveryCodes map[primitive.ObjectID]map[string]bool
+}
+
+func newMemorySecondFactors() *memorySecondFactors {
+	return &memorySecondFactors{
+		lastStep:      make(map[primitive.ObjectID]int64),
+		recoveryCodes: make(map[primitive.ObjectID]map[string]bool),
+	}
+}
+
+func (m *memorySecondFactors) useTOTPStep(ctx context.Context, userID primitive.ObjectID, step int64) bool {
+	if step <= m.lastStep[userID] {
+		return false
+	}
+	m.lastStep[userID] = step
+	return true
+}
+
+func (m *memorySecondFactors) useRecoveryCode(ctx context.Context, userID primitive.ObjectID, hash string) bool {
+	if !m.recoveryCodes[userID][hash] {
+		return false
+	}
+	delete(m.recoveryCodes[userID], hash)
+	return true
+}
+
+// mustTOTP 計算指定時間的驗證碼
+func mustTOTP(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+	code, err := totpCode(secret, at.Unix()/totpPeriod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 附錄 B 的 8 位數驗證碼取後 6 位
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := totpCode(rfc6238Secret, tt.unix/totpPeriod)
+		if err != nil || got != tt.want {
+			t.Errorf("totpCode(T=%d) = %q, %v, want %q", tt.unix, got, err, tt.want)
+		}
+	}
+
+	// 金鑰不分大小寫
+	if got, err := totpCode(strings.ToLower(rfc6238Secret), 59/totpPeriod); err != nil || got != "287082" {
+		t.Errorf("totpCode(lowercase secret) = %q, %v", got, err)
+	}
+	if _, err := totpCode("not base32!", 1); err == nil {
+		t.Error("totpCode(invalid secret) error = nil")
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / totpPeriod
+
+	tests := []struct {
+		name     string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{"目前的時間區間", mustTOTP(t, rfc6238Secret, now), current, true},
+		{"前一個時間區間", mustTOTP(t, rfc6238Secret, now.Add(-totpPeriod*time.Second)), current - 1, true},
+		{"後一個時間區間", mustTOTP(t, rfc6238Secret, now.Add(totpPeriod*time.Second)), current + 1, true},
+		{"超過容許的誤差 (前兩個區間)", mustTOTP(t, rfc6238Secret, now.Add(-2*totpPeriod*time.Second)), 0, false},
+		{"超過容許的誤差 (後兩個區間)", mustTOTP(t, rfc6238Secret, now.Add(2*totpPeriod*time.Second)), 0, false},
+		{"忽略空白", " 050 471 ", current, true},
+		{"位數不對", "50471", 0, false},
+		{"錯誤的驗證碼", "000000", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := verifyTOTP(rfc6238Secret, tt.code, now)
+			if step != tt.wantStep || ok != tt.wantOK {
+				t.Errorf("verifyTOTP(%q) = %d, %v, want %d, %v", tt.code, step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestCheckSecondFactorRejectsReplayedStep(t *testing.T) {
+	ctx := context.Background()
+	factors := newMemorySecondFactors()
+	user := models.User{ID: primitive.NewObjectID(), TOTPSecret: rfc6238Secret}
+	now := time.Unix(1111111111, 0)
+	code := mustTOTP(t, rfc6238Secret, now)
+
+	if !checkSecondFactor(ctx, factors, user, code, "", now) {
+		t.Fatal("first use of the code was rejected")
+	}
+	// 同時送出的請求讀到的仍是舊的 totp_last_step，由條件式更新擋下
+	if checkSecondFactor(ctx, factors, user, code, "", now.Add(10*time.Second)) {
+		t.Fatal("the same code was accepted twice")
+	}
+
+	// 重新讀取使用者後，同一個區間與較舊的區間都不能再使用
+	user.TOTPLastStep = factors.lastStep[user.ID]
+	previous := mustTOTP(t, rfc6238Secret, now.Add(-totpPeriod*time.Second))
+	for _, replayed := range []string{code, previous} {
+		if checkSecondFactor(ctx, factors, user, replayed, "", now) {
+			t.Errorf("code %s of a used step was accepted", replayed)
+		}
+	}
+
+	// 下一個區間的新驗證碼可以使用
+	next := now.Add(totpPeriod * time.Second)
+	if !checkSecondFactor(ctx, factors, user, mustTOTP(t, rfc6238Secret, next), "", next) {
+		t.Error("code of the next step was rejected")
+	}
+}
+
+func TestCheckSecondFactorRecoveryCodesAreSingleUse(t *testing.T) {
+	ctx := context.Background()
+	factors := newMemorySecondFactors()
+	user := models.User{ID: primitive.NewObjectID(), TOTPSecret: rfc6238Secret}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("generateRecoveryCodes() = %d codes, %d hashes, want %d", len(codes), len(hashes), recoveryCodeCount)
+	}
+	factors.recoveryCodes[user.ID] = make(map[string]bool)
+	for _, hash := range hashes {
+		factors.recoveryCodes[user.ID][hash] = true
+	}
+
+	now := time.Now()
+	// 輸入時不分大小寫、忽略前後空白
+	if !checkSecondFactor(ctx, factors, user, "", " "+strings.ToUpper(codes[0])+" ", now) {
+		t.Fatal("unused recovery code was rejected")
+	}
+	if checkSecondFactor(ctx, factors, user, "", codes[0], now) {
+		t.Fatal("recovery code was accepted twice")
+	}
+	if !checkSecondFactor(ctx, factors, user, "", codes[1], now) {
+		t.Error("another unused recovery code was rejected")
+	}
+	if len(factors.recoveryCodes[user.ID]) != recoveryCodeCount-2 {
+		t.Errorf("remaining recovery codes = %d, want %d", len(factors.recoveryCodes[user.ID]), recoveryCodeCount-2)
+	}
+
+	if checkSecondFactor(ctx, factors, user, "", "aaaa-bbbb", now) {
+		t.Error("unknown recovery code was accepted")
+	}
+	if checkSecondFactor(ctx, factors, user, "", "", now) {
+		t.Error("empty code was accepted")
+	}
+}
@@ -0,0 +1,128 @@
+package fxrates
+
+import (
+	"context"
+	"server/models"
+	"server/repository"
+	"sort"
+	"time"
+)
+
+// MaxCarryDays 超過這個天數的空缺不補齊 (避免把很久以前的匯率一路延用)
+const MaxCarryDays = 31
+
+// Options 匯入選項
+type Options struct {
+	// Source 覆蓋檔案格式預設的來源名稱 (空字串則沿用)
+	Source string
+	// FillGaps 以前一天的匯率補齊假日等沒有報價的日子
+	FillGaps bool
+}
+
+// Result 匯入結果
+type Result struct {
+	Imported int      `json:"imported"` // 寫入的實際匯率筆數
+	Filled   int      `json:"filled"`   // 補齊的日數 (各幣別分開計算)
+	Pairs    []string `json:"pairs"`    // 匯入的幣別組合，例如 "EUR/USD"
+	From     string   `json:"from"`
+	To       string   `json:"to"`
+}
+
+// Import 寫入已解析的匯率 (同一天、同一組幣別則覆蓋)，並視需要補齊空缺
+func Import(ctx context.Context, repo repository.ExchangeRateRepository, rates []models.ExchangeRate, opts Options) (Result, error) {
+	var result Result
+	now := time.Now()
+
+	pairs := make(map[string][]models.ExchangeRate)
+	for _, rate := range rates {
+		if opts.Source != "" {
+			rate.Source = opts.Source
+		}
+		rate.Carried = false
+		rate.UpdatedAt = now
+
+		key := pairKey(rate.Base, rate.Quote)
+		pairs[key] = append(pairs[key], rate)
+		if result.From == "" || rate.Date < result.From {
+			result.From = rate.Date
+		}
+		if rate.Date > result.To {
+			result.To = rate.Date
+		}
+	}
+
+	for key, series := range pairs {
+		result.Pairs = append(result.Pairs, key)
+		sort.Slice(series, func(i, j int) bool { return series[i].Date < series[j].Date })
+
+		for _, rate := range series {
+			if err := repo.Upsert(ctx, rate); err != nil {
+				return result, err
+			}
+			result.Imported++
+		}
+
+		if !opts.FillGaps {
+			continue
+		}
+
+		// 從資料庫中這段期間之前最近的一筆匯率開始補，銜接上一次匯入的資料
+		first := series[0]
+		if previous, err := repo.Latest(ctx, first.Base, first.Quote, addDays(first.Date, -1)); err == nil {
+			series = append([]models.ExchangeRate{previous}, series...)
+		} else if err != repository.ErrNotFound {
+			return result, err
+		}
+
+		for _, carried := range carryForward(series) {
+			carried.UpdatedAt = now
+			if err := repo.Upsert(ctx, carried); err != nil {
+				return result, err
+			}
+			result.Filled++
+		}
+	}
+
+	sort.Strings(result.Pairs)
+	return result, nil
+}
+
+// carryForward 回傳同一組幣別 (已依日期排序) 中間缺少的日子，每一天沿用前一筆匯率
+func carryForward(series []models.ExchangeRate) []models.ExchangeRate {
+	var filled []models.ExchangeRate
+	for i := 1; i < len(series); i++ {
+		previous, next := series[i-1], series[i]
+		gap := daysBetween(previous.Date, next.Date) - 1
+		if gap <= 0 || gap > MaxCarryDays {
+			continue
+		}
+		for d := 1; d <= gap; d++ {
+			filled = append(filled, models.ExchangeRate{
+				Date:    addDays(previous.Date, d),
+				Base:    previous.Base,
+				Quote:   previous.Quote,
+				Rate:    previous.Rate,
+				Source:  previous.Source,
+				Carried: true,
+			})
+		}
+	}
+	return filled
+}
+
+func addDays(date string, days int) string {
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return date
+	}
+	return t.AddDate(0, 0, days).Format("2006-01-02")
+}
+
+func daysBetween(from, to string) int {
+	start, err1 := time.Parse("2006-01-02", from)
+	end, err2 := time.Parse("2006-01-02", to)
+	if err1 != nil || err2 != nil {
+		return 0
+	}
+	return int(end.Sub(start).Hours() / 24)
+}
@@ -0,0 +1,122 @@
+package fxrates
+
+import (
+	"context"
+	"reflect"
+	"server/models"
+	"server/repository"
+	"testing"
+)
+
+func TestCarryForward(t *testing.T) {
+	carried := func(date string, value float64) models.ExchangeRate {
+		r := rate(date, "USD", "TWD", value, "ecb")
+		r.Carried = true
+		return r
+	}
+
+	tests := []struct {
+		name   string
+		series []models.ExchangeRate
+		want   []models.ExchangeRate
+	}{
+		{
+			name:   "週末沿用週五的匯率",
+			series: []models.ExchangeRate{rate("2026-01-02", "USD", "TWD", 32.1, "ecb"), rate("2026-01-05", "USD", "TWD", 32.4, "ecb")},
+			want:   []models.ExchangeRate{carried("2026-01-03", 32.1), carried("2026-01-04", 32.1)},
+		},
+		{
+			name: "每段空缺各自沿用前一筆",
+			series: []models.ExchangeRate{
+				rate("2026-01-30", "USD", "TWD", 32.1, "ecb"),
+				rate("2026-02-01", "USD", "TWD", 32.2, "ecb"),
+				rate("2026-02-03", "USD", "TWD", 32.3, "ecb"),
+			},
+			want: []models.ExchangeRate{carried("2026-01-31", 32.1), carried("2026-02-02", 32.2)},
+		},
+		{
+			name:   "連續的日子不需補齊",
+			series: []models.ExchangeRate{rate("2026-01-05", "USD", "TWD", 32.4, "ecb"), rate("2026-01-06", "USD", "TWD", 32.5, "ecb")},
+		},
+		{
+			name:   "空缺超過 MaxCarryDays 不補齊",
+			series: []models.ExchangeRate{rate("2026-01-01", "USD", "TWD", 32.1, "ecb"), rate("2026-02-03", "USD", "TWD", 32.4, "ecb")},
+		},
+		{
+			name:   "只有一筆",
+			series: []models.ExchangeRate{rate("2026-01-01", "USD", "TWD", 32.1, "ecb")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := carryForward(tt.series); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("carryForward() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImportFillGaps(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepositories().ExchangeRates
+
+	// 已有的實際匯率不會被補齊的匯率覆蓋
+	if err := repo.Upsert(ctx, rate("2026-01-03", "USD", "TWD", 31.9, "manual")); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Import(ctx, repo, []models.ExchangeRate{
+		rate("2026-01-05", "USD", "TWD", 32.4, "ecb"),
+		rate("2026-01-02", "USD", "TWD", 32.1, "ecb"),
+		rate("2026-01-02", "EUR", "USD", 1.03, "ecb"),
+	}, Options{FillGaps: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Imported != 3 || result.From != "2026-01-02" || result.To != "2026-01-05" ||
+		!reflect.DeepEqual(result.Pairs, []string{"EUR/USD", "USD/TWD"}) {
+		t.Fatalf("Import() = %+v", result)
+	}
+
+	// 第二次匯入從資料庫中前一筆匯率接著補
+	result, err = Import(ctx, repo, []models.ExchangeRate{rate("2026-01-08", "USD", "TWD", 32.7, "ecb")}, Options{FillGaps: true, Source: "bank"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Imported != 1 || result.Filled != 2 {
+		t.Fatalf("second Import() = %+v, want 1 imported and 2 filled", result)
+	}
+
+	// 沒有要求補齊時保留空缺
+	if _, err := Import(ctx, repo, []models.ExchangeRate{rate("2026-01-12", "USD", "TWD", 33.0, "ecb")}, Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		date    string
+		want    float64
+		carried bool
+		source  string
+	}{
+		{"2026-01-02", 32.1, false, "ecb"},
+		{"2026-01-03", 31.9, false, "manual"},
+		{"2026-01-04", 32.1, true, "ecb"},
+		{"2026-01-05", 32.4, false, "ecb"},
+		{"2026-01-06", 32.4, true, "ecb"},
+		{"2026-01-07", 32.4, true, "ecb"},
+		{"2026-01-08", 32.7, false, "bank"},
+		{"2026-01-10", 32.7, false, "bank"}, // 沒有補齊，Latest 回傳 01-08 的匯率
+		{"2026-01-12", 33.0, false, "ecb"},
+	}
+	for _, tt := range tests {
+		got, err := repo.Latest(ctx, "USD", "TWD", tt.date)
+		if err != nil {
+			t.Fatalf("Latest(%s) error = %v", tt.date, err)
+		}
+		if got.Rate != tt.want || got.Carried != tt.carried || got.Source != tt.source {
+			t.Errorf("Latest(%s) = %v (carried=%v, source=%s), want %v (carried=%v, source=%s)",
+				tt.date, got.Rate, got.Carried, got.Source, tt.want, tt.carried, tt.source)
+		}
+	}
+}
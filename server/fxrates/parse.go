@@ -0,0 +1,343 @@
+// Package fxrates 匯入離線匯率檔案 (ECB XML/CSV 與簡單 CSV)，並提供任意兩個幣別在某一天的匯率查詢
+package fxrates
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"server/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 支援的檔案格式
+const (
+	FormatAuto   = "auto"    // 依內容自動判斷
+	FormatECBXML = "ecb-xml" // ECB eurofxref-daily.xml / eurofxref-hist.xml
+	FormatECBCSV = "ecb-csv" // ECB eurofxref.csv / eurofxref-hist.csv (第一欄為日期，其餘欄位為幣別)
+	FormatCSV    = "csv"     // date,base,quote,rate
+)
+
+// ECBBase ECB 參考匯率皆為 1 EUR 可換多少外幣
+const ECBBase = "EUR"
+
+// maxReportedProblems 錯誤訊息最多列出的筆數
+const maxReportedProblems = 20
+
+// ValidationError 檔案內容有誤時回傳，列出每一個有問題的位置 (整個檔案都不會匯入)
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	shown := e.Problems
+	if len(shown) > 5 {
+		shown = shown[:5]
+	}
+	return fmt.Sprintf("匯率檔案有 %d 個錯誤: %s", len(e.Problems), strings.Join(shown, "; "))
+}
+
+// problems 收集解析時的錯誤
+type problems []string
+
+func (p *problems) add(format string, args ...interface{}) {
+	if len(*p) < maxReportedProblems {
+		*p = append(*p, fmt.Sprintf(format, args...))
+	}
+}
+
+func (p problems) err() error {
+	if len(p) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: p}
+}
+
+// Parse 讀取匯率檔案，format 為空字串或 FormatAuto 時依內容判斷格式
+// 回傳的匯率已驗證日期、幣別與數值，Source 依格式預設為 "ecb" 或 "import"
+func Parse(r io.Reader, format string) ([]models.ExchangeRate, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // UTF-8 BOM
+
+	if format == "" || format == FormatAuto {
+		format, err = detectFormat(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var rates []models.ExchangeRate
+	switch format {
+	case FormatECBXML:
+		rates, err = parseECBXML(data)
+	case FormatECBCSV:
+		rates, err = parseECBCSV(data)
+	case FormatCSV:
+		rates, err = parseCSV(data)
+	default:
+		return nil, fmt.Errorf("不支援的格式: %q (可用 %s、%s、%s)", format, FormatECBXML, FormatECBCSV, FormatCSV)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(rates) == 0 {
+		return nil, fmt.Errorf("檔案中沒有任何匯率")
+	}
+	return dedupe(rates)
+}
+
+// detectFormat 以 < 開頭視為 ECB XML，CSV 則依標題列判斷
+func detectFormat(data []byte) (string, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return "", fmt.Errorf("檔案是空的")
+	}
+	if trimmed[0] == '<' {
+		return FormatECBXML, nil
+	}
+
+	header, err := newCSVReader(trimmed).Read()
+	if err != nil {
+		return "", fmt.Errorf("無法判斷檔案格式: %w", err)
+	}
+	columns := normalizeHeader(header)
+	if _, ok := columns["base"]; ok {
+		return FormatCSV, nil
+	}
+	if strings.EqualFold(strings.TrimSpace(header[0]), "date") {
+		return FormatECBCSV, nil
+	}
+	// 沒有標題列的簡單 CSV: 2026-01-02,USD,TWD,32.1
+	if len(header) == 4 {
+		if _, err := parseDate(header[0]); err == nil {
+			return FormatCSV, nil
+		}
+	}
+	return "", fmt.Errorf("無法判斷檔案格式，請指定 format")
+}
+
+type ecbEnvelope struct {
+	Cube struct {
+		Days []struct {
+			Time  string `xml:"time,attr"`
+			Rates []struct {
+				Currency string `xml:"currency,attr"`
+				Rate     string `xml:"rate,attr"`
+			} `xml:"Cube"`
+		} `xml:"Cube"`
+	} `xml:"Cube"`
+}
+
+// parseECBXML 解析 ECB 的 <Cube time="..."><Cube currency="USD" rate="1.09"/></Cube>
+func parseECBXML(data []byte) ([]models.ExchangeRate, error) {
+	var envelope ecbEnvelope
+	if err := xml.Unmarshal(data, &envelope); err != nil {
+		return nil, fmt.Errorf("XML 格式錯誤: %w", err)
+	}
+
+	var rates []models.ExchangeRate
+	var errs problems
+	for _, day := range envelope.Cube.Days {
+		date, err := parseDate(day.Time)
+		if err != nil {
+			errs.add("time=%q: %v", day.Time, err)
+			continue
+		}
+		for _, item := range day.Rates {
+			rate, err := newRate(date, ECBBase, item.Currency, item.Rate)
+			if err != nil {
+				errs.add("%s %s: %v", date, item.Currency, err)
+				continue
+			}
+			rate.Source = "ecb"
+			rates = append(rates, rate)
+		}
+	}
+	return rates, errs.err()
+}
+
+// parseECBCSV 解析 ECB 的 CSV: 標題列為 Date, USD, JPY, ...，缺值為 N/A
+func parseECBCSV(data []byte) ([]models.ExchangeRate, error) {
+	records, err := newCSVReader(data).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("CSV 格式錯誤: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	var errs problems
+	header := records[0]
+	currencies := make([]string, len(header))
+	for i, name := range header[1:] {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue // ECB 的檔案每一列最後都有多餘的逗號
+		}
+		code, err := models.NormalizeCurrency(name)
+		if err != nil {
+			errs.add("第 1 行第 %d 欄: %v", i+2, err)
+			continue
+		}
+		currencies[i+1] = code
+	}
+
+	var rates []models.ExchangeRate
+	for n, record := range records[1:] {
+		line := n + 2
+		date, err := parseDate(record[0])
+		if err != nil {
+			errs.add("第 %d 行: %v", line, err)
+			continue
+		}
+		for i := 1; i < len(record) && i < len(currencies); i++ {
+			value := strings.TrimSpace(record[i])
+			if currencies[i] == "" || value == "" || strings.EqualFold(value, "N/A") {
+				continue
+			}
+			rate, err := newRate(date, ECBBase, currencies[i], value)
+			if err != nil {
+				errs.add("第 %d 行 %s: %v", line, currencies[i], err)
+				continue
+			}
+			rate.Source = "ecb"
+			rates = append(rates, rate)
+		}
+	}
+	return rates, errs.err()
+}
+
+// parseCSV 解析 date,base,quote,rate (標題列可省略，有標題列時欄位順序不拘)
+func parseCSV(data []byte) ([]models.ExchangeRate, error) {
+	records, err := newCSVReader(data).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("CSV 格式錯誤: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	columns := map[string]int{"date": 0, "base": 1, "quote": 2, "rate": 3}
+	start := 0
+	if header := normalizeHeader(records[0]); len(header) > 0 {
+		if _, ok := header["date"]; ok {
+			for _, name := range []string{"date", "base", "quote", "rate"} {
+				index, ok := header[name]
+				if !ok {
+					return nil, fmt.Errorf("標題列缺少 %s 欄位", name)
+				}
+				columns[name] = index
+			}
+			start = 1
+		}
+	}
+
+	var rates []models.ExchangeRate
+	var errs problems
+	for n, record := range records[start:] {
+		line := n + start + 1
+		field := func(name string) string {
+			if columns[name] < len(record) {
+				return strings.TrimSpace(record[columns[name]])
+			}
+			return ""
+		}
+
+		date, err := parseDate(field("date"))
+		if err != nil {
+			errs.add("第 %d 行: %v", line, err)
+			continue
+		}
+		rate, err := newRate(date, field("base"), field("quote"), field("rate"))
+		if err != nil {
+			errs.add("第 %d 行: %v", line, err)
+			continue
+		}
+		rate.Source = "import"
+		rates = append(rates, rate)
+	}
+	return rates, errs.err()
+}
+
+func newCSVReader(data []byte) *csv.Reader {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+	return reader
+}
+
+// normalizeHeader 標題列名稱 (小寫) -> 欄位位置
+func normalizeHeader(header []string) map[string]int {
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	return columns
+}
+
+// dateLayouts ECB 的每日 CSV 使用 "02 January 2006"，其餘為 ISO 日期
+var dateLayouts = []string{"2006-01-02", "02 January 2006", "2 January 2006"}
+
+// parseDate 轉為 "YYYY-MM-DD"
+func parseDate(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Format("2006-01-02"), nil
+		}
+	}
+	return "", fmt.Errorf("無效的日期: %q", value)
+}
+
+// newRate 驗證幣別與匯率並建立 ExchangeRate
+func newRate(date, base, quote, value string) (models.ExchangeRate, error) {
+	base, err := models.NormalizeCurrency(base)
+	if err != nil {
+		return models.ExchangeRate{}, err
+	}
+	quote, err = models.NormalizeCurrency(quote)
+	if err != nil {
+		return models.ExchangeRate{}, err
+	}
+	if base == quote {
+		return models.ExchangeRate{}, fmt.Errorf("base 與 quote 相同 (%s)", base)
+	}
+
+	rate, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || math.IsNaN(rate) || math.IsInf(rate, 0) || rate <= 0 {
+		return models.ExchangeRate{}, fmt.Errorf("無效的匯率: %q", value)
+	}
+
+	return models.ExchangeRate{Date: date, Base: base, Quote: quote, Rate: rate}, nil
+}
+
+// dedupe 同一天、同一組幣別重複出現時只保留一筆，數值不同則視為錯誤
+func dedupe(rates []models.ExchangeRate) ([]models.ExchangeRate, error) {
+	seen := make(map[string]int, len(rates))
+	unique := rates[:0]
+	var errs problems
+	for _, rate := range rates {
+		key := pairKey(rate.Base, rate.Quote) + "/" + rate.Date
+		if i, ok := seen[key]; ok {
+			if unique[i].Rate != rate.Rate {
+				errs.add("%s %s 有兩個不同的匯率 (%v、%v)", rate.Date, pairKey(rate.Base, rate.Quote), unique[i].Rate, rate.Rate)
+			}
+			continue
+		}
+		seen[key] = len(unique)
+		unique = append(unique, rate)
+	}
+	return unique, errs.err()
+}
+
+func pairKey(base, quote string) string {
+	return base + "/" + quote
+}
@@ -0,0 +1,165 @@
+package fxrates
+
+import (
+	"errors"
+	"reflect"
+	"server/models"
+	"strings"
+	"testing"
+)
+
+const ecbXML = `<?xml version="1.0" encoding="UTF-8"?>
+<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01" xmlns="http://www.ecb.int/vocabulary/2002-08-01/eurofxref">
+	<gesmes:subject>Reference rates</gesmes:subject>
+	<Cube>
+		<Cube time="2026-01-05">
+			<Cube currency="USD" rate="1.0321"/>
+			<Cube currency="JPY" rate="162.5"/>
+		</Cube>
+		<Cube time="2026-01-02">
+			<Cube currency="USD" rate="1.0299"/>
+		</Cube>
+	</Cube>
+</gesmes:Envelope>`
+
+// rate 只比較解析會設定的欄位
+func rate(date, base, quote string, value float64, source string) models.ExchangeRate {
+	return models.ExchangeRate{Date: date, Base: base, Quote: quote, Rate: value, Source: source}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		input  string
+		want   []models.ExchangeRate
+	}{
+		{
+			name:   "ECB XML",
+			format: FormatAuto,
+			input:  ecbXML,
+			want: []models.ExchangeRate{
+				rate("2026-01-05", "EUR", "USD", 1.0321, "ecb"),
+				rate("2026-01-05", "EUR", "JPY", 162.5, "ecb"),
+				rate("2026-01-02", "EUR", "USD", 1.0299, "ecb"),
+			},
+		},
+		{
+			name:   "ECB 每日 CSV (日期為 02 January 2006，行尾多一個逗號)",
+			format: FormatAuto,
+			input:  "Date, USD, JPY, \n05 January 2026, 1.0321, 162.5, \n",
+			want: []models.ExchangeRate{
+				rate("2026-01-05", "EUR", "USD", 1.0321, "ecb"),
+				rate("2026-01-05", "EUR", "JPY", 162.5, "ecb"),
+			},
+		},
+		{
+			name:   "ECB 歷史 CSV (N/A 與空白略過)",
+			format: FormatECBCSV,
+			input:  "Date,USD,ISK,\n2026-01-05,1.0321,N/A,\n2026-01-02,1.0299,,\n",
+			want: []models.ExchangeRate{
+				rate("2026-01-05", "EUR", "USD", 1.0321, "ecb"),
+				rate("2026-01-02", "EUR", "USD", 1.0299, "ecb"),
+			},
+		},
+		{
+			name:   "簡單 CSV 有標題列 (欄位順序不拘、幣別轉大寫)",
+			format: FormatAuto,
+			input:  "quote,date,rate,base\ntwd,2026-01-02,32.1,usd\n# 註解\nJPY,2026-01-02,4.7,TWD\n",
+			want: []models.ExchangeRate{
+				rate("2026-01-02", "USD", "TWD", 32.1, "import"),
+				rate("2026-01-02", "TWD", "JPY", 4.7, "import"),
+			},
+		},
+		{
+			name:   "簡單 CSV 沒有標題列",
+			format: FormatAuto,
+			input:  "2026-01-02,USD,TWD,32.1\n2026-01-05,USD,TWD,32.4\n",
+			want: []models.ExchangeRate{
+				rate("2026-01-02", "USD", "TWD", 32.1, "import"),
+				rate("2026-01-05", "USD", "TWD", 32.4, "import"),
+			},
+		},
+		{
+			name:   "重複且數值相同的匯率只保留一筆 (含 UTF-8 BOM)",
+			format: FormatCSV,
+			input:  "\xef\xbb\xbfdate,base,quote,rate\n2026-01-02,USD,TWD,32.1\n2026-01-02,usd,twd,32.1\n",
+			want: []models.ExchangeRate{
+				rate("2026-01-02", "USD", "TWD", 32.1, "import"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(strings.NewReader(tt.input), tt.format)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		input  string
+		// problems: 預期的 ValidationError 筆數 (0 代表一般錯誤)
+		problems int
+	}{
+		{name: "空檔案", format: FormatAuto, input: "  \n"},
+		{name: "無法判斷格式", format: FormatAuto, input: "foo,bar\n1,2\n"},
+		{name: "不支援的格式", format: "json", input: "{}"},
+		{name: "XML 格式錯誤", format: FormatECBXML, input: "<Cube><Cube time="},
+		{name: "沒有任何匯率", format: FormatECBXML, input: "<Envelope><Cube></Cube></Envelope>"},
+		{name: "標題列缺少欄位", format: FormatCSV, input: "date,base,rate\n2026-01-02,USD,32.1\n"},
+		{
+			name:     "XML 日期與匯率錯誤",
+			format:   FormatECBXML,
+			input:    `<Envelope><Cube><Cube time="2026-13-01"><Cube currency="USD" rate="1"/></Cube><Cube time="2026-01-02"><Cube currency="USD" rate="-1"/><Cube currency="US" rate="1"/></Cube></Cube></Envelope>`,
+			problems: 3,
+		},
+		{
+			name:     "ECB CSV 幣別與數值錯誤",
+			format:   FormatECBCSV,
+			input:    "Date,USD,1X\nyesterday,1.03,1\n2026-01-02,abc,1\n",
+			problems: 3,
+		},
+		{
+			name:     "簡單 CSV 各種錯誤",
+			format:   FormatCSV,
+			input:    "2026-01-02,USD,USD,1\n2026-01-02,USD,TWD,0\n2026-01-02,USD,JPY,NaN\n2026/01/02,USD,TWD,32\n",
+			problems: 4,
+		},
+		{
+			name:     "同一天有兩個不同的匯率",
+			format:   FormatCSV,
+			input:    "2026-01-02,USD,TWD,32.1\n2026-01-02,USD,TWD,32.2\n",
+			problems: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rates, err := Parse(strings.NewReader(tt.input), tt.format)
+			if err == nil {
+				t.Fatalf("Parse() = %+v, want error", rates)
+			}
+			var validation *ValidationError
+			isValidation := errors.As(err, &validation)
+			if tt.problems == 0 {
+				if isValidation {
+					t.Errorf("Parse() error = %v, want a non-validation error", err)
+				}
+				return
+			}
+			if !isValidation || len(validation.Problems) != tt.problems {
+				t.Errorf("Parse() error = %v, want %d problems", err, tt.problems)
+			}
+		})
+	}
+}
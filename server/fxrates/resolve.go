@@ -0,0 +1,104 @@
+package fxrates
+
+import (
+	"context"
+	"server/models"
+	"server/repository"
+)
+
+// Pivots 兩個幣別之間沒有直接匯率時，依序嘗試透過這些幣別交叉換算
+// (ECB 只提供 EUR 對其他幣別，USD/TWD 需經由 EUR 計算)
+var Pivots = []string{"EUR", "USD"}
+
+// 匯率的取得方式
+const (
+	MethodIdentity = "identity" // 相同幣別
+	MethodDirect   = "direct"   // 直接使用 base -> quote
+	MethodInverse  = "inverse"  // 以 quote -> base 取倒數
+	MethodCross    = "cross"    // 透過 Pivots 交叉換算
+)
+
+// Resolved 某一天實際採用的匯率: 1 Base = Rate Quote
+type Resolved struct {
+	Base   string  `json:"base"`
+	Quote  string  `json:"quote"`
+	Date   string  `json:"date"`
+	Rate   float64 `json:"rate"`
+	Method string  `json:"method"`
+	// Legs 計算時用到的匯率資料 (日期為當天或之前最近一筆)
+	Legs []models.ExchangeRate `json:"legs"`
+}
+
+// maxCrossDepth 交叉換算最多經過幾個中間幣別 (例如 JPY -> EUR -> USD -> TWD)
+const maxCrossDepth = 2
+
+// Resolve 取得 date 當天 (或之前最近一天) 1 base 等於多少 quote
+// 依序嘗試直接、反向與交叉匯率，都找不到時回傳 repository.ErrNotFound
+func Resolve(ctx context.Context, repo repository.ExchangeRateRepository, base, quote, date string) (Resolved, error) {
+	resolved := Resolved{Base: base, Quote: quote, Date: date, Legs: []models.ExchangeRate{}}
+	if base == quote {
+		resolved.Rate = 1
+		resolved.Method = MethodIdentity
+		return resolved, nil
+	}
+
+	rate, method, legs, err := chainRate(ctx, repo, base, quote, date, maxCrossDepth)
+	if err != nil {
+		return resolved, err
+	}
+	resolved.Rate = rate
+	resolved.Method = method
+	resolved.Legs = legs
+	return resolved, nil
+}
+
+// chainRate 先找 base/quote 這一組，找不到時透過 Pivots 交叉換算 (最多 depth 層)
+func chainRate(ctx context.Context, repo repository.ExchangeRateRepository, base, quote, date string, depth int) (float64, string, []models.ExchangeRate, error) {
+	rate, method, leg, err := pairRate(ctx, repo, base, quote, date)
+	if err == nil {
+		return rate, method, []models.ExchangeRate{leg}, nil
+	}
+	if err != repository.ErrNotFound || depth == 0 {
+		return 0, "", nil, err
+	}
+
+	for _, pivot := range Pivots {
+		if pivot == base || pivot == quote {
+			continue
+		}
+		toPivot, _, first, err := pairRate(ctx, repo, base, pivot, date)
+		if err == repository.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return 0, "", nil, err
+		}
+		fromPivot, _, rest, err := chainRate(ctx, repo, pivot, quote, date, depth-1)
+		if err == repository.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return 0, "", nil, err
+		}
+		return toPivot * fromPivot, MethodCross, append([]models.ExchangeRate{first}, rest...), nil
+	}
+
+	return 0, "", nil, repository.ErrNotFound
+}
+
+// pairRate 只看 base/quote 這一組 (直接或反向)
+func pairRate(ctx context.Context, repo repository.ExchangeRateRepository, base, quote, date string) (float64, string, models.ExchangeRate, error) {
+	if rate, err := repo.Latest(ctx, base, quote, date); err == nil && rate.Rate > 0 {
+		return rate.Rate, MethodDirect, rate, nil
+	} else if err != nil && err != repository.ErrNotFound {
+		return 0, "", models.ExchangeRate{}, err
+	}
+
+	if rate, err := repo.Latest(ctx, quote, base, date); err == nil && rate.Rate > 0 {
+		return 1 / rate.Rate, MethodInverse, rate, nil
+	} else if err != nil && err != repository.ErrNotFound {
+		return 0, "", models.ExchangeRate{}, err
+	}
+
+	return 0, "", models.ExchangeRate{}, repository.ErrNotFound
+}
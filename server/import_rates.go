@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"server/config"
+	"server/fxrates"
+	"server/repository"
+	"strings"
+	"time"
+)
+
+// runImportRatesCommand 處理 `import-rates` 子命令，回傳 exit code
+//
+//	import-rates eurofxref-hist.csv          匯入 ECB 匯率 (格式自動判斷)
+//	import-rates -format csv trip.csv        匯入 date,base,quote,rate
+//	import-rates -fill=false rates.xml       不補齊假日等沒有報價的日子
+func runImportRatesCommand(args []string) int {
+	fs := flag.NewFlagSet("import-rates", flag.ContinueOnError)
+	format := fs.String("format", fxrates.FormatAuto, "檔案格式: auto、ecb-xml、ecb-csv、csv")
+	source := fs.String("source", "", "來源名稱 (預設 ECB 檔案為 ecb，其餘為 import)")
+	fill := fs.Bool("fill", true, "以前一天的匯率補齊沒有報價的日子")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: import-rates [-format auto] [-source name] [-fill=false] file...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+	repo := repository.NewMongoRepositories(config.DB.Database(config.DBName)).ExchangeRates
+
+	for _, path := range fs.Args() {
+		file, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		rates, err := fxrates.Parse(file, *format)
+		file.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			var validation *fxrates.ValidationError
+			if errors.As(err, &validation) {
+				for _, problem := range validation.Problems {
+					fmt.Fprintf(os.Stderr, "  - %s\n", problem)
+				}
+			}
+			return 1
+		}
+
+		result, err := fxrates.Import(ctx, repo, rates, fxrates.Options{Source: *source, FillGaps: *fill})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: 匯入失敗: %v\n", path, err)
+			return 1
+		}
+		fmt.Printf("%s: 匯入 %d 筆、補齊 %d 筆 (%s ~ %s，%s)\n",
+			path, result.Imported, result.Filled, result.From, result.To, strings.Join(result.Pairs, ", "))
+	}
+	return 0
+}
@@ -10,7 +10,9 @@ import (
 	"server/config"
 	"server/controllers"
 	_ "server/docs"
+	"server/migrations"
 	"server/models"
+	"server/repository"
 	"strings"
 	"time"
 
@@ -31,12 +33,36 @@ func main() {
 	}
 
 	config.ConnectDB()
-	config.CreateIndexes()
+
+	// go run . migrate [status|up] [-dry-run]
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrateCommand(os.Args[2:]))
+	}
+
+	// go run . import-rates [-format auto] [-source name] [-fill=false] file...
+	if len(os.Args) > 1 && os.Args[1] == "import-rates" {
+		os.Exit(runImportRatesCommand(os.Args[2:]))
+	}
+
+	// 依序執行尚未套用的資料庫 migration (包含索引建立)
+	// 多實例部署時可設定 MIGRATE_ON_START=false，改由部署流程執行 migrate up
+	if os.Getenv("MIGRATE_ON_START") != "false" {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+		_, err := migrations.Up(ctx, config.DB.Database(config.DBName), false)
+		cancel()
+		if err != nil {
+			log.Fatalf("資料庫 migration 失敗: %v", err)
+		}
+	}
+
+	// 依環境變數 ADMIN_USERS 設定管理員
+	controllers.EnsureAdminUsers()
 
 	// 初始化預設類別種子資料
 	seedCategories()
 
-	r := GinRouter()
+	handler := controllers.NewHandler(repository.NewMongoRepositories(config.DB.Database(config.DBName)))
+	r := GinRouter(handler)
 
 	// 2. 動態獲取 Port (雲端平台通常會透過環境變數 PORT 指定)
 	port := os.Getenv("PORT")
@@ -70,26 +96,15 @@ func seedCategories() {
 	}
 }
 
-func GinRouter() *gin.Engine {
+func GinRouter(handler *controllers.Handler) *gin.Engine {
 	r := gin.Default()
 
 	// 3. 處理 CORS (跨域問題)
-	// 讀取環境變數中的允許網域，例如 "https://fintrack.com,http://localhost:5173"
-	allowOrigins := os.Getenv("ALLOWED_ORIGINS")
-	var origins []string
-
-	if allowOrigins == "" {
-		// 如果沒設定，預設只允許本機 (開發用)
-		origins = []string{"http://localhost:5173"}
-	} else {
-		// 支援多個來源，用逗號分隔
-		origins = strings.Split(allowOrigins, ",")
-	}
-
+	// 允許的網域由環境變數 ALLOWED_ORIGINS 設定，見 config.AllowedOrigins
 	r.Use(cors.New(cors.Config{
-		AllowOrigins:     origins,
+		AllowOrigins:     config.AllowedOrigins(),
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", controllers.LEDGER_HEADER},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
@@ -104,48 +119,96 @@ func GinRouter() *gin.Engine {
 	// }
 
 	v1 := r.Group("/api/v1")
+	// 以 Cookie 驗證的 POST/PUT/DELETE 需來自允許的網域 (CSRF 防護)
+	v1.Use(controllers.CSRFProtection)
 	{
 		v1.GET("/ping", controllers.Ping)
 
 		auth := v1.Group("/auth")
 		{
 			auth.POST("/login", controllers.Login)
+			auth.POST("/login/verify", controllers.VerifyLogin)
 			auth.POST("/logout", controllers.Logout)
+			auth.POST("/register", controllers.Register)
 			auth.GET("/me", controllers.CheckAuth)
+
+			// OpenID Connect (單一登入)
+			auth.GET("/oidc", controllers.GetOIDCStatus)
+			auth.GET("/oidc/login", controllers.OIDCLogin)
+			auth.GET("/oidc/callback", controllers.OIDCCallback)
 		}
 
 		protected := v1.Group("/")
 		protected.Use(controllers.AuthRequired)
 		{
-			// Transaction CRUD
-			protected.POST("/transactions", controllers.CreateTransaction)
-			protected.GET("/transactions", controllers.GetTransactions)
-			protected.PUT("/transactions/:id", controllers.UpdateTransaction)
-			protected.DELETE("/transactions/:id", controllers.DeleteTransaction)
-
-			// Stats
-			protected.GET("/stats", controllers.GetDashboardStats)
-			protected.GET("/stats/category", controllers.GetCategoryStats)
-			protected.GET("/stats/comparison", controllers.GetMonthlyComparison)
-			protected.GET("/stats/weekly", controllers.GetWeeklyHabits)
-			protected.GET("/reports/yearly", controllers.GetYearlyReport)
-
-			// Category
-			protected.GET("/categories", controllers.GetCategories)
-			protected.POST("/categories", controllers.CreateCategory)
-			protected.PUT("/categories/:id", controllers.UpdateCategory)
-			protected.DELETE("/categories/:id", controllers.DeleteCategory)
-
-			// Budgets
-			protected.POST("/budgets", controllers.SetBudget)
-			protected.GET("/budgets/status", controllers.GetBudgetStatus)
-			protected.DELETE("/budgets/:id", controllers.DeleteBudget)
-
-			// Fixed Expenses
-			protected.POST("/fixed-expenses", controllers.CreateFixedExpense)
-			protected.GET("/fixed-expenses", controllers.GetFixedExpenses)
-			protected.PUT("/fixed-expenses/:id", controllers.UpdateFixedExpense)
-			protected.DELETE("/fixed-expenses/:id", controllers.DeleteFixedExpense)
+			// Account (權杖需具備 admin scope)
+			account := protected.Group("/auth")
+			account.Use(controllers.SessionRequired)
+			{
+				account.PUT("/password", controllers.ChangePassword)
+				account.DELETE("/account", controllers.DeleteAccount)
+				account.PUT("/currency", handler.UpdateBaseCurrency)
+
+				// Active Sessions
+				account.GET("/sessions", controllers.GetSessions)
+				account.DELETE("/sessions", controllers.RevokeOtherSessions)
+				account.DELETE("/sessions/:id", controllers.RevokeSessionByID)
+
+				// Linked External Identities (OIDC)
+				account.GET("/identities", controllers.GetIdentities)
+				account.POST("/identities", controllers.LinkIdentity)
+				account.DELETE("/identities/:subject", controllers.UnlinkIdentity)
+
+				// Personal Access Tokens
+				account.GET("/tokens", controllers.GetAccessTokens)
+				account.POST("/tokens", controllers.CreateAccessToken)
+				account.DELETE("/tokens/:id", controllers.RevokeAccessToken)
+
+				// Two-Factor Authentication (TOTP)
+				account.POST("/2fa/enroll", controllers.EnrollTwoFactor)
+				account.POST("/2fa/confirm", controllers.ConfirmTwoFactor)
+				account.POST("/2fa/recovery-codes", controllers.RegenerateRecoveryCodes)
+				account.POST("/2fa/disable", controllers.DisableTwoFactor)
+
+				// Audit Log (登入/登出紀錄)
+				account.GET("/audit-logs", controllers.GetAuthAuditLogs)
+			}
+
+			// Exchange Rates (不分帳本)
+			protected.GET("/exchange-rates", handler.GetExchangeRate)
+
+			// Ledgers
+			protected.GET("/ledgers", controllers.GetLedgers)
+			protected.POST("/ledgers", controllers.CreateLedger)
+			protected.PUT("/ledgers/:ledgerId", controllers.RenameLedger)
+			protected.POST("/ledgers/:ledgerId/archive", controllers.ArchiveLedger)
+			protected.POST("/ledgers/:ledgerId/unarchive", controllers.UnarchiveLedger)
+			protected.POST("/ledgers/:ledgerId/switch", controllers.SwitchLedger)
+			protected.POST("/ledgers/:ledgerId/members", controllers.AddLedgerMember)
+			protected.PUT("/ledgers/:ledgerId/members/:username", controllers.UpdateLedgerMember)
+			protected.DELETE("/ledgers/:ledgerId/members/:username", controllers.RemoveLedgerMember)
+
+			// 帳本資料 API 提供兩種選擇帳本的方式：
+			// 1. /api/v1/transactions + X-Ledger-ID header (未帶時為預設帳本)
+			// 2. /api/v1/ledgers/:ledgerId/transactions
+			registerLedgerRoutes(protected.Group("/"), handler)
+			registerLedgerRoutes(protected.Group("/ledgers/:ledgerId"), handler)
+		}
+
+		admin := v1.Group("/admin")
+		admin.Use(controllers.AuthRequired, controllers.SessionRequired, controllers.AdminRequired)
+		{
+			admin.GET("/users", controllers.GetUsers)
+			admin.POST("/users", controllers.AdminCreateUser)
+			admin.PUT("/users/:username", controllers.AdminUpdateUser)
+			admin.POST("/users/:username/password", controllers.AdminResetPassword)
+			admin.POST("/users/:username/wipe", controllers.WipeUserData)
+			admin.POST("/users/:username/unlock", controllers.UnlockUser)
+			admin.POST("/guest/reset", controllers.ResetGuest)
+
+			// Exchange Rates
+			admin.POST("/exchange-rates", handler.SetExchangeRate)
+			admin.POST("/exchange-rates/import", handler.ImportExchangeRates)
 		}
 	}
 
@@ -156,8 +219,15 @@ func GinRouter() *gin.Engine {
 	// 每天凌晨 00:01 執行
 	_, err := c.AddFunc("1 0 * * *", func() {
 		log.Println("[Cron] 開始執行每日固定支出檢查...")
-		controllers.ProcessFixedExpenses()
+		handler.ProcessFixedExpenses()
 	})
+	if err == nil {
+		// 每天凌晨 03:30 永久刪除超過保留天數的垃圾桶資料
+		_, err = c.AddFunc("30 3 * * *", func() {
+			log.Println("[Cron] 開始清除過期的垃圾桶資料...")
+			handler.PurgeExpiredTrash()
+		})
+	}
 	if err != nil {
 		log.Printf("無法啟動 Cron: %v", err)
 	} else {
@@ -168,6 +238,75 @@ func GinRouter() *gin.Engine {
 	return r
 }
 
+// registerLedgerRoutes 註冊作用在單一帳本上的 API
+func registerLedgerRoutes(rg *gin.RouterGroup, handler *controllers.Handler) {
+	rg.Use(controllers.LedgerRequired)
+
+	// Transaction CRUD
+	rg.POST("/transactions", handler.CreateTransaction)
+	rg.GET("/transactions", handler.GetTransactions)
+	rg.PUT("/transactions/:id", handler.UpdateTransaction)
+	rg.DELETE("/transactions/:id", handler.DeleteTransaction)
+	rg.GET("/transactions/:id/history", handler.GetTransactionHistory)
+	rg.POST("/transactions/:id/history/:version/revert", handler.RevertTransaction)
+
+	// Stats
+	rg.GET("/stats", handler.GetDashboardStats)
+	rg.GET("/stats/category", handler.GetCategoryStats)
+	rg.GET("/stats/comparison", handler.GetMonthlyComparison)
+	rg.GET("/stats/tags", handler.GetTagStats)
+	rg.GET("/stats/weekly", handler.GetWeeklyHabits)
+	rg.GET("/reports/yearly", handler.GetYearlyReport)
+
+	// Category
+	rg.GET("/categories", handler.GetCategories)
+	rg.POST("/categories", handler.CreateCategory)
+	rg.PUT("/categories/:id", handler.UpdateCategory)
+	rg.DELETE("/categories/:id", handler.DeleteCategory)
+	rg.POST("/categories/:id/merge", handler.MergeCategory)
+	rg.POST("/categories/:id/archive", handler.ArchiveCategory)
+	rg.POST("/categories/:id/unarchive", handler.UnarchiveCategory)
+
+	// Tags
+	rg.GET("/tags", handler.GetTags)
+	rg.PUT("/tags/:tag", handler.RenameTag)
+	rg.DELETE("/tags/:tag", handler.DeleteTag)
+	rg.POST("/tags/:tag/merge", handler.MergeTag)
+
+	// Budgets
+	rg.POST("/budgets", handler.SetBudget)
+	rg.GET("/budgets/status", handler.GetBudgetStatus)
+	rg.DELETE("/budgets/:id", handler.DeleteBudget)
+
+	// Fixed Expenses
+	rg.POST("/fixed-expenses", handler.CreateFixedExpense)
+	rg.GET("/fixed-expenses", handler.GetFixedExpenses)
+	rg.PUT("/fixed-expenses/:id", handler.UpdateFixedExpense)
+	rg.DELETE("/fixed-expenses/:id", handler.DeleteFixedExpense)
+
+	// Transfers (:id 為交易的 transfer_id)
+	rg.POST("/transfers", handler.CreateTransfer)
+	rg.GET("/transfers/:id", handler.GetTransfer)
+	rg.PUT("/transfers/:id", handler.UpdateTransfer)
+	rg.DELETE("/transfers/:id", handler.DeleteTransfer)
+
+	// Accounts
+	rg.GET("/accounts", handler.GetAccounts)
+	rg.POST("/accounts", handler.CreateAccount)
+	rg.PUT("/accounts/:id", handler.UpdateAccount)
+	rg.DELETE("/accounts/:id", handler.DeleteAccount)
+	rg.GET("/accounts/:id/balance", handler.GetAccountBalance)
+	rg.GET("/accounts/:id/balance/history", handler.GetAccountBalanceHistory)
+
+	// Trash (軟刪除的資料，:kind 為 transactions / categories / budgets / fixed-expenses / accounts)
+	rg.GET("/trash", handler.GetTrash)
+	rg.POST("/trash/:kind/:id/restore", handler.RestoreTrashItem)
+	rg.DELETE("/trash/:kind/:id", handler.PurgeTrashItem)
+
+	// Audit Log
+	rg.GET("/audit-logs", controllers.GetAuditLogs)
+}
+
 func registerStaticRoutes(r *gin.Engine) {
 	distDir, ok := resolveDistDir()
 	if !ok {
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"server/config"
+	"server/migrations"
+	"text/tabwriter"
+	"time"
+)
+
+// runMigrateCommand 處理 `migrate` 子命令，回傳 exit code
+//
+//	migrate status         列出所有 migration 與執行狀態
+//	migrate up             執行尚未執行的 migration
+//	migrate up -dry-run    只列出將會執行的 migration，不修改資料
+func runMigrateCommand(args []string) int {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "只列出將會執行的 migration，不修改資料")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: migrate [status|up] [-dry-run]")
+		fs.PrintDefaults()
+	}
+
+	action := "status"
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		action = args[0]
+		args = args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+	db := config.DB.Database(config.DBName)
+
+	switch action {
+	case "status":
+		statuses, err := migrations.GetStatus(ctx, db)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "讀取 migration 狀態失敗: %v\n", err)
+			return 1
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		pending := 0
+		for _, s := range statuses {
+			state := "pending"
+			appliedAt := "-"
+			if s.Applied {
+				state = "applied"
+				appliedAt = s.AppliedAt.Local().Format("2006-01-02 15:04:05")
+			} else {
+				pending++
+			}
+			if s.Unknown {
+				state = "unknown"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", s.Version, s.Name, state, appliedAt)
+		}
+		w.Flush()
+		fmt.Printf("共 %d 個 migration，%d 個尚未執行\n", len(statuses), pending)
+		return 0
+
+	case "up":
+		done, err := migrations.Up(ctx, db, *dryRun)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		if *dryRun {
+			fmt.Printf("[dry-run] 將會執行 %d 個 migration\n", len(done))
+		} else {
+			fmt.Printf("已執行 %d 個 migration\n", len(done))
+		}
+		return 0
+
+	default:
+		fs.Usage()
+		return 2
+	}
+}
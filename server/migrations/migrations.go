@@ -0,0 +1,235 @@
+// Package migrations 依版本順序執行資料庫的結構與資料調整。
+// 已執行的版本記錄在 schema_migrations collection，每個版本只會執行一次。
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"server/models"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// CollectionName 記錄已執行 migration 的 collection
+const CollectionName = "schema_migrations"
+
+// migrationTimeout 單一 migration 的執行時間上限 (建立索引、大量更新可能較久)
+const migrationTimeout = 10 * time.Minute
+
+// Migration 代表一個版本的資料庫調整
+type Migration struct {
+	// Version: 版本號，依小到大執行，發佈後不可更改
+	Version int
+	// Name: 簡短名稱 (snake_case)
+	Name string
+	// Up: 執行調整。中途失敗時不會寫入紀錄，下次會整個重新執行，因此必須可重複執行
+	Up func(ctx context.Context, db *mongo.Database) error
+	// Plan (選用): dry-run 時說明將會異動的內容，例如受影響的筆數
+	Plan func(ctx context.Context, db *mongo.Database) (string, error)
+}
+
+// Status 單一 migration 的執行狀態
+type Status struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	// Unknown: 資料庫中有紀錄，但程式中已找不到此版本 (例如降版部署)
+	Unknown bool
+}
+
+// registry 所有 migration。新增時請附加在最後並使用下一個版本號
+// 帳號匯入 (3) 與帳本搬移 (4) 在資料轉換之前執行，之後的 migration 可假設資料都有 ledger_id
+// (找不到建立者帳號的舊資料除外，這些資料沒有人能存取)
+var registry = []Migration{
+	initialIndexes,
+	dropTransactionDateAt,
+	legacyUsers,
+	ledgers,
+	amountsToMinorUnits,
+	currencyDefaults,
+	exchangeRatesIndex,
+	trashIndexes,
+	transactionVersions,
+	budgetCategoryIDs,
+	transactionTags,
+	accountIndexes,
+	transactionTransfers,
+}
+
+// All 回傳依版本排序的所有 migration
+func All() []Migration {
+	all := make([]Migration, len(registry))
+	copy(all, registry)
+	sort.Slice(all, func(i, j int) bool { return all[i].Version < all[j].Version })
+	return all
+}
+
+// validate 檢查版本號是否重複
+func validate(all []Migration) error {
+	seen := make(map[int]string, len(all))
+	for _, m := range all {
+		if m.Version <= 0 {
+			return fmt.Errorf("migration %q 的版本號必須大於 0", m.Name)
+		}
+		if name, ok := seen[m.Version]; ok {
+			return fmt.Errorf("migration 版本 %d 重複: %s / %s", m.Version, name, m.Name)
+		}
+		seen[m.Version] = m.Name
+	}
+	return nil
+}
+
+// applied 讀取已執行的 migration 紀錄
+func applied(ctx context.Context, db *mongo.Database) (map[int]models.SchemaMigration, error) {
+	cursor, err := db.Collection(CollectionName).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var records []models.SchemaMigration
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+
+	result := make(map[int]models.SchemaMigration, len(records))
+	for _, record := range records {
+		result[record.Version] = record
+	}
+	return result, nil
+}
+
+// Pending 回傳尚未執行的 migration (依版本排序)
+func Pending(ctx context.Context, db *mongo.Database) ([]Migration, error) {
+	all := All()
+	if err := validate(all); err != nil {
+		return nil, err
+	}
+
+	done, err := applied(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, m := range all {
+		if _, ok := done[m.Version]; !ok {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// GetStatus 列出所有 migration 與其執行狀態
+func GetStatus(ctx context.Context, db *mongo.Database) ([]Status, error) {
+	all := All()
+	if err := validate(all); err != nil {
+		return nil, err
+	}
+
+	done, err := applied(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(all))
+	known := make(map[int]bool, len(all))
+	for _, m := range all {
+		known[m.Version] = true
+		status := Status{Version: m.Version, Name: m.Name}
+		if record, ok := done[m.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = record.AppliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	for version, record := range done {
+		if !known[version] {
+			statuses = append(statuses, Status{
+				Version:   version,
+				Name:      record.Name,
+				Applied:   true,
+				AppliedAt: record.AppliedAt,
+				Unknown:   true,
+			})
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// Up 依版本順序執行所有尚未執行的 migration，遇到錯誤即停止
+// dryRun 為 true 時只列出將會執行的 migration (有 Plan 時一併說明異動內容)，不會修改資料
+// 回傳已執行 (或 dry-run 時將會執行) 的 migration
+func Up(ctx context.Context, db *mongo.Database, dryRun bool) ([]Migration, error) {
+	pending, err := Pending(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pending) == 0 {
+		log.Println("✅ 資料庫 migration 已是最新版本")
+		return nil, nil
+	}
+
+	var done []Migration
+	for _, m := range pending {
+		if dryRun {
+			plan := ""
+			if m.Plan != nil {
+				plan, err = runPlan(ctx, db, m)
+				if err != nil {
+					return done, fmt.Errorf("migration %d (%s) dry-run 失敗: %w", m.Version, m.Name, err)
+				}
+			}
+			if plan != "" {
+				log.Printf("[dry-run] %d %s: %s", m.Version, m.Name, plan)
+			} else {
+				log.Printf("[dry-run] %d %s", m.Version, m.Name)
+			}
+			done = append(done, m)
+			continue
+		}
+
+		log.Printf("[Migration] 執行 %d %s ...", m.Version, m.Name)
+		if err := apply(ctx, db, m); err != nil {
+			return done, fmt.Errorf("migration %d (%s) 失敗: %w", m.Version, m.Name, err)
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+func runPlan(ctx context.Context, db *mongo.Database, m Migration) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, migrationTimeout)
+	defer cancel()
+	return m.Plan(ctx, db)
+}
+
+// apply 執行單一 migration，成功後寫入紀錄
+func apply(ctx context.Context, db *mongo.Database, m Migration) error {
+	ctx, cancel := context.WithTimeout(ctx, migrationTimeout)
+	defer cancel()
+
+	started := time.Now()
+	if err := m.Up(ctx, db); err != nil {
+		return err
+	}
+
+	// _id 即為版本號，多個實例同時啟動時只會有一筆紀錄
+	_, err := db.Collection(CollectionName).InsertOne(ctx, models.SchemaMigration{
+		Version:    m.Version,
+		Name:       m.Name,
+		AppliedAt:  time.Now(),
+		DurationMs: time.Since(started).Milliseconds(),
+	})
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+	return nil
+}
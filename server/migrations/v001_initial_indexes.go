@@ -0,0 +1,18 @@
+package migrations
+
+import (
+	"context"
+	"server/config"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// initialIndexes 建立既有的所有索引 (原本每次啟動都會執行的 config.CreateIndexes)
+// 之後新增或調整索引請另外新增 migration
+var initialIndexes = Migration{
+	Version: 1,
+	Name:    "initial_indexes",
+	Up: func(ctx context.Context, db *mongo.Database) error {
+		return config.CreateIndexes(ctx, db)
+	},
+}
@@ -0,0 +1,56 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// dropTransactionDateAt 移除交易上的 dateAt 欄位
+// 年度報表原本優先使用 dateAt，但目前沒有任何程式會寫入這個欄位，日期一律以 date ("YYYY-MM-DD") 為準。
+// 舊資料若只有 dateAt 而 date 為空，先以本地時區換算補上 date 再移除。
+var dropTransactionDateAt = Migration{
+	Version: 2,
+	Name:    "drop_transaction_date_at",
+	Up: func(ctx context.Context, db *mongo.Database) error {
+		coll := db.Collection("transactions")
+		opts := options.Find().SetProjection(bson.M{"_id": 1, "date": 1, "dateAt": 1})
+		cursor, err := coll.Find(ctx, bson.M{"dateAt": bson.M{"$exists": true}}, opts)
+		if err != nil {
+			return err
+		}
+		defer cursor.Close(ctx)
+
+		for cursor.Next(ctx) {
+			var doc struct {
+				ID     primitive.ObjectID `bson:"_id"`
+				Date   string             `bson:"date"`
+				DateAt time.Time          `bson:"dateAt"`
+			}
+			if err := cursor.Decode(&doc); err != nil {
+				return err
+			}
+
+			update := bson.M{"$unset": bson.M{"dateAt": ""}}
+			if doc.Date == "" && !doc.DateAt.IsZero() {
+				update["$set"] = bson.M{"date": doc.DateAt.In(time.Local).Format("2006-01-02")}
+			}
+			if _, err := coll.UpdateOne(ctx, bson.M{"_id": doc.ID}, update); err != nil {
+				return err
+			}
+		}
+		return cursor.Err()
+	},
+	Plan: func(ctx context.Context, db *mongo.Database) (string, error) {
+		count, err := db.Collection("transactions").CountDocuments(ctx, bson.M{"dateAt": bson.M{"$exists": true}})
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%d 筆交易含有 dateAt 欄位", count), nil
+	},
+}
@@ -0,0 +1,64 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"server/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// LegacyUsers 是舊版寫死在程式中的帳號 (帳號 -> 密碼)
+// 僅供 legacyUsers 一次性匯入 users collection，登入流程已不再讀取
+var LegacyUsers = map[string]string{
+	"chongzhe": "20001025Jonas",
+	"yunchen":  "20000722Jenny",
+	"moon":     "19670706Moon",
+	"guest":    "guest123456",
+}
+
+// legacyUsers 將 LegacyUsers 匯入 users collection
+// 只有在 users collection 為空時才會匯入，避免已刪除的帳號又被加回來
+var legacyUsers = Migration{
+	Version: 3,
+	Name:    "legacy_users",
+	Up: func(ctx context.Context, db *mongo.Database) error {
+		collection := db.Collection("users")
+		count, err := collection.CountDocuments(ctx, bson.M{})
+		if err != nil || count > 0 {
+			return err
+		}
+
+		docs := make([]interface{}, 0, len(LegacyUsers))
+		for username, password := range LegacyUsers {
+			hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+			if err != nil {
+				return fmt.Errorf("%s: %w", username, err)
+			}
+			docs = append(docs, models.User{
+				ID:           primitive.NewObjectID(),
+				Username:     username,
+				PasswordHash: string(hash),
+				Role:         models.RoleUser,
+				CreatedAt:    time.Now(),
+				UpdatedAt:    time.Now(),
+			})
+		}
+		_, err = collection.InsertMany(ctx, docs)
+		return err
+	},
+	Plan: func(ctx context.Context, db *mongo.Database) (string, error) {
+		count, err := db.Collection("users").CountDocuments(ctx, bson.M{})
+		if err != nil {
+			return "", err
+		}
+		if count > 0 {
+			return fmt.Sprintf("已有 %d 個帳號，不匯入", count), nil
+		}
+		return fmt.Sprintf("將匯入 %d 個舊版帳號", len(LegacyUsers)), nil
+	},
+}
@@ -0,0 +1,103 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"server/models"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ownerCollections 加入帳本前以 owner 區分的 collection (之後新增的 collection 一律有 ledger_id)
+var ownerCollections = []string{"transactions", "categories", "budgets", "fixed_expenses"}
+
+// withoutLedger 還沒有帳本的舊資料
+var withoutLedger = bson.M{"ledger_id": bson.M{"$exists": false}}
+
+// defaultLedger 回傳使用者的預設帳本，沒有的話建立一本個人帳本
+func defaultLedger(ctx context.Context, db *mongo.Database, user models.User) (primitive.ObjectID, error) {
+	if !user.DefaultLedgerID.IsZero() {
+		return user.DefaultLedgerID, nil
+	}
+
+	now := time.Now()
+	ledger := models.Ledger{
+		ID:    primitive.NewObjectID(),
+		Name:  "個人帳本",
+		Owner: user.Username,
+		Members: []models.LedgerMember{
+			{Username: user.Username, Role: models.LedgerRoleOwner, JoinedAt: now},
+		},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if _, err := db.Collection("ledgers").InsertOne(ctx, ledger); err != nil {
+		return primitive.NilObjectID, err
+	}
+	if _, err := db.Collection("users").UpdateOne(ctx,
+		bson.M{"_id": user.ID},
+		bson.M{"$set": bson.M{"default_ledger_id": ledger.ID}},
+	); err != nil {
+		return primitive.NilObjectID, err
+	}
+	return ledger.ID, nil
+}
+
+// ledgers 將加入帳本前以 owner 區分的資料搬到每位使用者的個人帳本
+// 找不到 owner 帳號的資料 (例如舊版沒有 owner 的預設類別) 維持原狀，列在 log 中
+var ledgers = Migration{
+	Version: 4,
+	Name:    "ledgers",
+	Up: func(ctx context.Context, db *mongo.Database) error {
+		cursor, err := db.Collection("users").Find(ctx, bson.M{})
+		if err != nil {
+			return err
+		}
+		var users []models.User
+		if err := cursor.All(ctx, &users); err != nil {
+			return err
+		}
+
+		for _, user := range users {
+			ledgerID, err := defaultLedger(ctx, db, user)
+			if err != nil {
+				return fmt.Errorf("%s: %w", user.Username, err)
+			}
+			for _, name := range ownerCollections {
+				if _, err := db.Collection(name).UpdateMany(ctx,
+					bson.M{"owner": user.Username, "ledger_id": bson.M{"$exists": false}},
+					bson.M{"$set": bson.M{"ledger_id": ledgerID}},
+				); err != nil {
+					return fmt.Errorf("%s %s: %w", user.Username, name, err)
+				}
+			}
+		}
+
+		for _, name := range ownerCollections {
+			count, err := db.Collection(name).CountDocuments(ctx, withoutLedger)
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				log.Printf("⚠️ %s 有 %d 筆資料找不到建立者帳號，未搬到帳本", name, count)
+			}
+		}
+		return nil
+	},
+	Plan: func(ctx context.Context, db *mongo.Database) (string, error) {
+		parts := make([]string, 0, len(ownerCollections))
+		for _, name := range ownerCollections {
+			count, err := db.Collection(name).CountDocuments(ctx, withoutLedger)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, fmt.Sprintf("%s %d 筆", name, count))
+		}
+		return "搬到個人帳本: " + strings.Join(parts, "、"), nil
+	},
+}
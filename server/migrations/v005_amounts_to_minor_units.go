@@ -0,0 +1,53 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"server/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// amountCollections 含有 amount 欄位的 collection
+var amountCollections = []string{"transactions", "budgets", "fixed_expenses"}
+
+// legacyAmountFilter 舊版以元為單位的金額 (double，或從 Mongo Express 手動輸入的 int32 / decimal)。
+// 新版一律寫入 int64 (models.Money)，已轉換過的資料不會再被選到，因此可重複執行。
+var legacyAmountFilter = bson.M{"amount": bson.M{"$type": bson.A{"double", "int", "decimal"}}}
+
+// amountsToMinorUnits 將金額從浮點數 (元) 轉為 1/100 元的整數 (models.Money)
+var amountsToMinorUnits = Migration{
+	Version: 5,
+	Name:    "amounts_to_minor_units",
+	Up: func(ctx context.Context, db *mongo.Database) error {
+		// $round 以 half-to-even 取整，對已經是小數第 2 位的金額不會有差別
+		update := mongo.Pipeline{
+			{{Key: "$set", Value: bson.M{
+				"amount": bson.M{"$toLong": bson.M{"$round": bson.A{
+					bson.M{"$multiply": bson.A{"$amount", models.MoneyScale}}, 0,
+				}}},
+			}}},
+		}
+		for _, name := range amountCollections {
+			if _, err := db.Collection(name).UpdateMany(ctx, legacyAmountFilter, update); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		return nil
+	},
+	Plan: func(ctx context.Context, db *mongo.Database) (string, error) {
+		plan := ""
+		for i, name := range amountCollections {
+			count, err := db.Collection(name).CountDocuments(ctx, legacyAmountFilter)
+			if err != nil {
+				return "", err
+			}
+			if i > 0 {
+				plan += "，"
+			}
+			plan += fmt.Sprintf("%s %d 筆", name, count)
+		}
+		return "將轉換金額: " + plan, nil
+	},
+}
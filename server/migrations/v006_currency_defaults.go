@@ -0,0 +1,48 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"server/config"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// currencyCollections 需要幣別欄位的 collection
+var currencyCollections = []string{"transactions", "budgets", "fixed_expenses"}
+
+// missingCurrency 尚未設定幣別的文件
+var missingCurrency = bson.M{"$or": bson.A{
+	bson.M{"currency": bson.M{"$exists": false}},
+	bson.M{"currency": ""},
+}}
+
+// currencyDefaults 為加入多幣別前建立的交易、預算與固定支出補上 DEFAULT_CURRENCY
+var currencyDefaults = Migration{
+	Version: 6,
+	Name:    "currency_defaults",
+	Up: func(ctx context.Context, db *mongo.Database) error {
+		currency := config.DefaultCurrency()
+		for _, name := range currencyCollections {
+			if _, err := db.Collection(name).UpdateMany(ctx, missingCurrency,
+				bson.M{"$set": bson.M{"currency": currency}},
+			); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		return nil
+	},
+	Plan: func(ctx context.Context, db *mongo.Database) (string, error) {
+		parts := make([]string, 0, len(currencyCollections))
+		for _, name := range currencyCollections {
+			count, err := db.Collection(name).CountDocuments(ctx, missingCurrency)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, fmt.Sprintf("%s %d 筆", name, count))
+		}
+		return fmt.Sprintf("補上幣別 %s: %s", config.DefaultCurrency(), strings.Join(parts, "、")), nil
+	},
+}
@@ -0,0 +1,27 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// exchangeRatesIndex 匯率以 (base, quote, date) 唯一
+// 用於: 依交易日期查詢當天或之前最近一筆匯率
+var exchangeRatesIndex = Migration{
+	Version: 7,
+	Name:    "exchange_rates_index",
+	Up: func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection("exchange_rates").Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "base", Value: 1},
+				{Key: "quote", Value: 1},
+				{Key: "date", Value: -1},
+			},
+			Options: options.Index().SetName("idx_base_quote_date").SetUnique(true),
+		})
+		return err
+	},
+}
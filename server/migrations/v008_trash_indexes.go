@@ -0,0 +1,32 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// trashCollections 採用軟刪除 (deleted_at) 的 collection
+var trashCollections = []string{"transactions", "categories", "budgets", "fixed_expenses"}
+
+// trashIndexes 垃圾桶列表與每日清除過期資料都以 deleted_at 查詢
+// 大部分文件沒有 deleted_at，使用 sparse index 只索引已刪除的資料
+var trashIndexes = Migration{
+	Version: 8,
+	Name:    "trash_indexes",
+	Up: func(ctx context.Context, db *mongo.Database) error {
+		for _, name := range trashCollections {
+			_, err := db.Collection(name).Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: "deleted_at", Value: 1}},
+				Options: options.Index().SetName("idx_deleted_at").SetSparse(true),
+			})
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		return nil
+	},
+}
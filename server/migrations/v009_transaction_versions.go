@@ -0,0 +1,42 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// missingVersion 加入修改紀錄前建立、還沒有版本號的交易
+var missingVersion = bson.M{"version": bson.M{"$exists": false}}
+
+// transactionVersions 為既有交易補上第 1 版，並建立舊版本的索引
+// 用於: 依交易列出修改紀錄、還原到指定版本
+var transactionVersions = Migration{
+	Version: 9,
+	Name:    "transaction_versions",
+	Up: func(ctx context.Context, db *mongo.Database) error {
+		if _, err := db.Collection("transactions").UpdateMany(ctx, missingVersion,
+			bson.M{"$set": bson.M{"version": 1}},
+		); err != nil {
+			return fmt.Errorf("transactions: %w", err)
+		}
+		_, err := db.Collection("transaction_revisions").Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "transaction_id", Value: 1},
+				{Key: "version", Value: 1},
+			},
+			Options: options.Index().SetName("idx_transaction_version").SetUnique(true),
+		})
+		return err
+	},
+	Plan: func(ctx context.Context, db *mongo.Database) (string, error) {
+		count, err := db.Collection("transactions").CountDocuments(ctx, missingVersion)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("補上版本號: transactions %d 筆", count), nil
+	},
+}
@@ -0,0 +1,190 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// legacyBudgetFilter 還以類別名稱 (category) 參照類別的預算
+// 找不到建立者帳號、沒有 ledger_id 的預算 (migration 4 已列在 log 中) 沒有人能存取，維持原狀
+var legacyBudgetFilter = bson.M{
+	"category_id": bson.M{"$exists": false},
+	"ledger_id":   bson.M{"$exists": true},
+}
+
+// budgetCategoryMatch 同帳本、同類別名稱的舊預算對應到的類別
+type budgetCategoryMatch struct {
+	LedgerID primitive.ObjectID
+	Name     string
+	Budgets  int64
+	// Candidates: 帳本中同名的類別數 (大於 1 代表名稱重複，0 代表類別已不存在)
+	Candidates int
+	CategoryID primitive.ObjectID
+}
+
+func (m budgetCategoryMatch) String() string {
+	switch {
+	case m.Candidates == 0:
+		return fmt.Sprintf("帳本 %s 的類別 %q 已不存在 (%d 筆預算移到垃圾桶)", m.LedgerID.Hex(), m.Name, m.Budgets)
+	case m.Candidates > 1:
+		return fmt.Sprintf("帳本 %s 有 %d 個名為 %q 的類別 (%d 筆預算使用 %s)", m.LedgerID.Hex(), m.Candidates, m.Name, m.Budgets, m.CategoryID.Hex())
+	default:
+		return fmt.Sprintf("帳本 %s 的類別 %q (%d 筆預算)", m.LedgerID.Hex(), m.Name, m.Budgets)
+	}
+}
+
+// matchBudgetCategories 依帳本與類別名稱找出舊預算對應的類別
+// 名稱重複時依序選擇未刪除、排序較前、較早建立的類別
+func matchBudgetCategories(ctx context.Context, db *mongo.Database) ([]budgetCategoryMatch, error) {
+	cursor, err := db.Collection("budgets").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: legacyBudgetFilter}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{
+				{Key: "ledger_id", Value: "$ledger_id"},
+				{Key: "name", Value: "$category"},
+			}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var groups []struct {
+		ID struct {
+			LedgerID primitive.ObjectID `bson:"ledger_id"`
+			Name     string             `bson:"name"`
+		} `bson:"_id"`
+		Count int64 `bson:"count"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+
+	// deleted_at 遞增排序時 null 在前，即未刪除的類別優先
+	opts := options.Find().SetSort(bson.D{
+		{Key: "deleted_at", Value: 1},
+		{Key: "order", Value: 1},
+		{Key: "_id", Value: 1},
+	}).SetProjection(bson.M{"_id": 1})
+
+	matches := make([]budgetCategoryMatch, 0, len(groups))
+	for _, group := range groups {
+		// 以帳本對應，owner 只代表建立者 (共用帳本中可能是其他成員)
+		match := budgetCategoryMatch{
+			LedgerID: group.ID.LedgerID,
+			Name:     group.ID.Name,
+			Budgets:  group.Count,
+		}
+
+		cursor, err := db.Collection("categories").Find(ctx, bson.M{"ledger_id": match.LedgerID, "name": match.Name}, opts)
+		if err != nil {
+			return nil, err
+		}
+		var candidates []struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cursor.All(ctx, &candidates); err != nil {
+			return nil, err
+		}
+
+		match.Candidates = len(candidates)
+		if len(candidates) > 0 {
+			match.CategoryID = candidates[0].ID
+		}
+		matches = append(matches, match)
+	}
+	return matches, nil
+}
+
+// budgetCategoryIDs 預算改以 category_id 參照類別 (原本以類別名稱對應，改名或名稱重複時會對不上)
+// 類別名稱重複的會列在 log 中；找不到類別的預算移到垃圾桶，保留 category 欄位供查詢
+var budgetCategoryIDs = Migration{
+	Version: 10,
+	Name:    "budget_category_ids",
+	Up: func(ctx context.Context, db *mongo.Database) error {
+		matches, err := matchBudgetCategories(ctx, db)
+		if err != nil {
+			return err
+		}
+
+		budgets := db.Collection("budgets")
+		now := time.Now()
+		for _, match := range matches {
+			filter := bson.M{
+				"ledger_id":   match.LedgerID,
+				"category":    match.Name,
+				"category_id": bson.M{"$exists": false},
+			}
+			if match.Candidates == 0 {
+				log.Printf("⚠️ %s", match)
+				filter["deleted_at"] = nil
+				if _, err := budgets.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"deleted_at": now}}); err != nil {
+					return err
+				}
+				continue
+			}
+			if match.Candidates > 1 {
+				log.Printf("⚠️ %s", match)
+			}
+			if _, err := budgets.UpdateMany(ctx, filter, bson.M{
+				"$set":   bson.M{"category_id": match.CategoryID},
+				"$unset": bson.M{"category": ""},
+			}); err != nil {
+				return err
+			}
+		}
+
+		// 每一筆未刪除的舊預算都必須已轉換，否則不記錄為已執行，下次啟動時重新執行
+		remaining, err := budgets.CountDocuments(ctx, bson.M{
+			"category_id": bson.M{"$exists": false},
+			"ledger_id":   bson.M{"$exists": true},
+			"deleted_at":  nil,
+		})
+		if err != nil {
+			return err
+		}
+		if remaining > 0 {
+			return fmt.Errorf("仍有 %d 筆預算無法對應到類別", remaining)
+		}
+
+		_, err = budgets.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "ledger_id", Value: 1},
+				{Key: "year_month", Value: 1},
+				{Key: "category_id", Value: 1},
+			},
+			Options: options.Index().SetName("idx_ledger_month_category"),
+		})
+		return err
+	},
+	Plan: func(ctx context.Context, db *mongo.Database) (string, error) {
+		matches, err := matchBudgetCategories(ctx, db)
+		if err != nil {
+			return "", err
+		}
+
+		var converted int64
+		var problems []string
+		for _, match := range matches {
+			if match.Candidates > 0 {
+				converted += match.Budgets
+			}
+			if match.Candidates != 1 {
+				problems = append(problems, match.String())
+			}
+		}
+		plan := fmt.Sprintf("將轉換預算 %d 筆", converted)
+		if len(problems) > 0 {
+			plan += "，需要確認:\n  - " + strings.Join(problems, "\n  - ")
+		}
+		return plan, nil
+	},
+}
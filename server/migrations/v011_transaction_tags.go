@@ -0,0 +1,22 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// transactionTags 依標籤篩選交易、標籤改名與刪除都以 ledger_id + tags 查詢 (multikey index)
+var transactionTags = Migration{
+	Version: 11,
+	Name:    "transaction_tags",
+	Up: func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection("transactions").Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    bson.D{{Key: "ledger_id", Value: 1}, {Key: "tags", Value: 1}},
+			Options: options.Index().SetName("idx_ledger_tags"),
+		})
+		return err
+	},
+}
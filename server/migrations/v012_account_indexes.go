@@ -0,0 +1,36 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// accountIndexes 帳戶列表依 ledger_id + order 排序，垃圾桶以 deleted_at 查詢 (與 v008 相同的 sparse index)
+// 帳戶餘額與依帳戶篩選交易以 ledger_id + account_id + date 查詢
+var accountIndexes = Migration{
+	Version: 12,
+	Name:    "account_indexes",
+	Up: func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection("accounts").Indexes().CreateMany(ctx, []mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "ledger_id", Value: 1}, {Key: "order", Value: 1}},
+				Options: options.Index().SetName("idx_ledger_order"),
+			},
+			{
+				Keys:    bson.D{{Key: "deleted_at", Value: 1}},
+				Options: options.Index().SetName("idx_deleted_at").SetSparse(true),
+			},
+		})
+		if err != nil {
+			return err
+		}
+		_, err = db.Collection("transactions").Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    bson.D{{Key: "ledger_id", Value: 1}, {Key: "account_id", Value: 1}, {Key: "date", Value: 1}},
+			Options: options.Index().SetName("idx_ledger_account_date"),
+		})
+		return err
+	},
+}
@@ -0,0 +1,24 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// transactionTransfers 轉帳的兩邊以 ledger_id + transfer_id 查詢
+// 大部分交易不是轉帳，使用 partial index 只索引有 transfer_id 的交易
+var transactionTransfers = Migration{
+	Version: 13,
+	Name:    "transaction_transfers",
+	Up: func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection("transactions").Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.D{{Key: "ledger_id", Value: 1}, {Key: "transfer_id", Value: 1}},
+			Options: options.Index().SetName("idx_ledger_transfer").
+				SetPartialFilterExpression(bson.M{"transfer_id": bson.M{"$exists": true}}),
+		})
+		return err
+	},
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AccessToken 代表一組個人存取權杖 (給腳本、捷徑等無法使用 Cookie 的用戶端)
+type AccessToken struct {
+	ID primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+
+	// Username: 權杖所屬的使用者
+	Username string `bson:"username" json:"username"`
+
+	// Name: 使用者自訂的名稱，例如 "iPhone 捷徑"
+	Name string `bson:"name" json:"name"`
+
+	// TokenHash: 權杖的 SHA-256，資料庫不存放原始權杖
+	TokenHash string `bson:"token_hash" json:"-"`
+
+	// Prefix: 權杖前幾個字元，方便使用者辨識
+	Prefix string `bson:"prefix" json:"prefix"`
+
+	// Scopes: 權限範圍，"read" / "transactions:write" / "admin"
+	Scopes []string `bson:"scopes" json:"scopes"`
+
+	// ExpiresAt: 過期時間，nil 代表永不過期
+	ExpiresAt *time.Time `bson:"expires_at,omitempty" json:"expires_at"`
+
+	// LastUsedAt: 最後使用時間
+	LastUsedAt *time.Time `bson:"last_used_at,omitempty" json:"last_used_at"`
+
+	// CreatedAt: 建立時間
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 帳戶類型
+const (
+	AccountCash       = "cash"
+	AccountBank       = "bank"
+	AccountCreditCard = "credit_card"
+	AccountEWallet    = "e_wallet"
+)
+
+// ValidAccountType 檢查帳戶類型是否合法
+func ValidAccountType(accountType string) bool {
+	switch accountType {
+	case AccountCash, AccountBank, AccountCreditCard, AccountEWallet:
+		return true
+	}
+	return false
+}
+
+// Account 代表一個存放金錢的帳戶 (現金、銀行帳戶、信用卡、電子錢包)
+type Account struct {
+	ID   primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name string             `bson:"name" json:"name" binding:"required"`
+	// Type: cash / bank / credit_card / e_wallet
+	Type string `bson:"type" json:"type" binding:"required" example:"bank"`
+	// Currency: 帳戶幣別 (ISO 4217)，餘額以此幣別計算；未指定時使用建立者的主要幣別
+	Currency string `bson:"currency" json:"currency" example:"TWD"`
+	// OpeningBalance: 開帳餘額 (信用卡的欠款以負數表示)
+	OpeningBalance Money `bson:"opening_balance" json:"opening_balance" swaggertype:"number"`
+	// OpeningDate: 開帳日 "YYYY-MM-DD" (選填)，餘額只計算這天 (含) 之後的交易
+	OpeningDate string `bson:"opening_date,omitempty" json:"opening_date,omitempty" example:"2026-01-01"`
+	// Order: 用於排序
+	Order int `bson:"order" json:"order"`
+	// LedgerID: 所屬帳本
+	LedgerID primitive.ObjectID `bson:"ledger_id" json:"ledger_id"`
+	// Owner: 建立這個帳戶的使用者
+	Owner string `bson:"owner" json:"owner"`
+	// Archived: 已封存的帳戶不能用於新的交易，但既有資料與餘額仍保留
+	Archived  bool      `bson:"archived" json:"archived"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+	// DeletedAt: 移到垃圾桶的時間 (nil 代表未刪除)
+	DeletedAt *time.Time `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AuditLog 代表一筆稽核紀錄 (只新增、不修改也不刪除)
+type AuditLog struct {
+	ID primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+
+	// Action: "create" / "update" / "delete" / "login" / "login_failed" / "logout"
+	Action string `bson:"action" json:"action"`
+
+	// Entity: "transaction" / "category" / "budget" / "fixed_expense" / "session"
+	Entity string `bson:"entity" json:"entity"`
+
+	// EntityID: 被操作資料的 ID
+	EntityID string `bson:"entity_id,omitempty" json:"entity_id,omitempty"`
+
+	// LedgerID: 資料所屬帳本 (登入登出等帳號事件沒有帳本)
+	LedgerID *primitive.ObjectID `bson:"ledger_id,omitempty" json:"ledger_id,omitempty"`
+
+	// Actor: 執行操作的使用者，排程產生的資料為 "system"
+	Actor string `bson:"actor" json:"actor"`
+
+	// IP / UserAgent: 請求來源
+	IP        string `bson:"ip,omitempty" json:"ip,omitempty"`
+	UserAgent string `bson:"user_agent,omitempty" json:"user_agent,omitempty"`
+
+	// Before / After: 異動前後的完整資料快照
+	Before interface{} `bson:"before,omitempty" json:"before,omitempty"`
+	After  interface{} `bson:"after,omitempty" json:"after,omitempty"`
+
+	// CreatedAt: 發生時間
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
@@ -1,12 +1,27 @@
 package models
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 type Budget struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	Category  string             `bson:"category" json:"category" binding:"required"`
-	Amount    float64            `bson:"amount" json:"amount" binding:"required"`
-	YearMonth string             `bson:"year_month" json:"year_month" binding:"required"` // 格式: "2026-01"
-	// Owner: 這筆預算的擁有者
+	ID primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	// CategoryID: 預算所屬的類別
+	CategoryID primitive.ObjectID `bson:"category_id" json:"category_id" binding:"required"`
+	Amount     Money              `bson:"amount" json:"amount" binding:"required" swaggertype:"number"`
+	YearMonth  string             `bson:"year_month" json:"year_month" binding:"required"` // 格式: "2026-01"
+	// Currency: 預算金額的幣別 (ISO 4217)，未指定時使用主要幣別
+	Currency string `bson:"currency,omitempty" json:"currency"`
+	// LedgerID: 所屬帳本
+	LedgerID primitive.ObjectID `bson:"ledger_id" json:"ledger_id"`
+	// Owner: 建立這筆預算的使用者
 	Owner string `bson:"owner" json:"owner"`
+	// DeletedAt: 移到垃圾桶的時間 (nil 代表未刪除)
+	DeletedAt *time.Time `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+
+	// CategoryName / CategoryType: 回應時帶入的類別名稱與型別 (不儲存)
+	CategoryName string `bson:"-" json:"category_name,omitempty"`
+	CategoryType string `bson:"-" json:"category_type,omitempty"`
 }
@@ -1,13 +1,25 @@
 package models
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 type Category struct {
-	ID    primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	Name  string             `bson:"name" json:"name" binding:"required"`
-	Type  string             `bson:"type" json:"type"` // "income" 或 "expense" (選填，用於分類顯示)
+	ID   primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name string             `bson:"name" json:"name" binding:"required"`
+	Type string             `bson:"type" json:"type"` // "income" 或 "expense" (選填，用於分類顯示)
 	// Order: 用於排序分類標籤
 	Order int `bson:"order" json:"order"`
-	// Owner: 這個類別的擁有者
+	// ParentID: 上層類別 (nil 代表最上層)，子類別的型別與上層相同
+	ParentID *primitive.ObjectID `bson:"parent_id,omitempty" json:"parent_id,omitempty"`
+	// LedgerID: 所屬帳本
+	LedgerID primitive.ObjectID `bson:"ledger_id" json:"ledger_id"`
+	// Owner: 建立這個類別的使用者
 	Owner string `bson:"owner" json:"owner"`
+	// Archived: 已封存的類別不會出現在選單中，但既有資料與報表仍會使用
+	Archived bool `bson:"archived" json:"archived"`
+	// DeletedAt: 移到垃圾桶的時間 (nil 代表未刪除)
+	DeletedAt *time.Time `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
 }
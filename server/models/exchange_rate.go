@@ -0,0 +1,47 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ExchangeRate 代表某一天的匯率: 1 單位 Base = Rate 單位 Quote
+type ExchangeRate struct {
+	ID primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+
+	// Date: 日期字串 "YYYY-MM-DD"
+	Date string `bson:"date" json:"date" binding:"required" example:"2026-01-14"`
+
+	// Base / Quote: ISO 4217 幣別代碼
+	Base  string `bson:"base" json:"base" binding:"required" example:"USD"`
+	Quote string `bson:"quote" json:"quote" binding:"required" example:"TWD"`
+
+	// Rate: 1 Base 可換多少 Quote
+	Rate float64 `bson:"rate" json:"rate" binding:"required,gt=0" example:"32.5"`
+
+	// Source: 資料來源 (例如 "manual"、"ecb")
+	Source string `bson:"source,omitempty" json:"source,omitempty"`
+
+	// Carried: 假日等沒有報價的日子，以前一天的匯率補上
+	Carried bool `bson:"carried,omitempty" json:"carried,omitempty"`
+
+	// UpdatedAt: 最後更新時間
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// NormalizeCurrency 檢查並轉為大寫的 ISO 4217 幣別代碼 (三個英文字母)
+func NormalizeCurrency(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != 3 {
+		return "", fmt.Errorf("無效的幣別: %q", code)
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return "", fmt.Errorf("無效的幣別: %q", code)
+		}
+	}
+	return code, nil
+}
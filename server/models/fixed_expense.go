@@ -8,14 +8,18 @@ import (
 
 // FixedExpense 代表每月固定支出
 type FixedExpense struct {
-	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	Amount     float64            `bson:"amount" json:"amount" binding:"required"`
-	CategoryID primitive.ObjectID `bson:"category_id" json:"category_id" binding:"required"`
-	Note       string             `bson:"note" json:"note"`
-	Owner      string             `bson:"owner" json:"owner"`
-	Day        int                `bson:"day" json:"day" binding:"required,min=1,max=31"` // 每月幾號扣款
-	Type       string             `bson:"type" json:"type"`                               // "income" 或 "expense"
-	Order      int                `bson:"order" json:"order"`                             // 排序
-	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
-	UpdatedAt  time.Time          `bson:"updated_at" json:"updated_at"`
+	ID         primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	Amount     Money               `bson:"amount" json:"amount" binding:"required" swaggertype:"number"`
+	CategoryID primitive.ObjectID  `bson:"category_id" json:"category_id" binding:"required"`
+	Currency   string              `bson:"currency,omitempty" json:"currency"` // 幣別 (ISO 4217)
+	Note       string              `bson:"note" json:"note"`
+	AccountID  *primitive.ObjectID `bson:"account_id,omitempty" json:"account_id,omitempty"` // 扣款帳戶 (選填)，產生的交易沿用
+	LedgerID   primitive.ObjectID  `bson:"ledger_id" json:"ledger_id"`                       // 所屬帳本
+	Owner      string              `bson:"owner" json:"owner"`                               // 建立者
+	Day        int                 `bson:"day" json:"day" binding:"required,min=1,max=31"`   // 每月幾號扣款
+	Type       string              `bson:"type" json:"type"`                                 // "income" 或 "expense"
+	Order      int                 `bson:"order" json:"order"`                               // 排序
+	CreatedAt  time.Time           `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time           `bson:"updated_at" json:"updated_at"`
+	DeletedAt  *time.Time          `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"` // 移到垃圾桶的時間 (nil 代表未刪除)
 }
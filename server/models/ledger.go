@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 帳本成員角色
+const (
+	LedgerRoleOwner  = "owner"  // 可管理成員與所有資料
+	LedgerRoleEditor = "editor" // 可新增/修改/刪除資料
+	LedgerRoleViewer = "viewer" // 只能檢視
+)
+
+// LedgerMember 帳本成員
+type LedgerMember struct {
+	Username string    `bson:"username" json:"username"`
+	Role     string    `bson:"role" json:"role"`
+	JoinedAt time.Time `bson:"joined_at" json:"joined_at"`
+}
+
+// Ledger 代表一本帳本，交易、類別、預算與固定支出都屬於某一本帳本
+type Ledger struct {
+	ID primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+
+	// Name: 帳本名稱，例如 "個人帳本"、"家庭共同帳本"
+	Name string `bson:"name" json:"name" binding:"required"`
+
+	// Owner: 建立者
+	Owner string `bson:"owner" json:"owner"`
+
+	// Members: 成員與角色 (建立者預設為 owner)
+	Members []LedgerMember `bson:"members" json:"members"`
+
+	// Archived: 封存的帳本只能檢視，不能再新增或修改資料
+	Archived bool `bson:"archived" json:"archived"`
+
+	// ArchivedAt: 封存時間
+	ArchivedAt *time.Time `bson:"archived_at,omitempty" json:"archived_at,omitempty"`
+
+	// CreatedAt: 建立時間
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+
+	// UpdatedAt: 更新時間
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// MemberRole 回傳使用者在帳本中的角色，非成員回傳空字串
+func (l Ledger) MemberRole(username string) string {
+	for _, m := range l.Members {
+		if m.Username == username {
+			return m.Role
+		}
+	}
+	return ""
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// LoginAttempt 記錄某個帳號或 IP 連續登入失敗的狀況
+type LoginAttempt struct {
+	// ID: 計數器的 key，格式為 "user:<帳號>" 或 "ip:<IP>"
+	ID string `bson:"_id" json:"id"`
+
+	// Failures: 連續失敗次數 (登入成功後歸零)
+	Failures int `bson:"failures" json:"failures"`
+
+	// LockedUntil: 在此時間前拒絕登入
+	LockedUntil time.Time `bson:"locked_until" json:"locked_until"`
+
+	// LastFailureAt: 最後一次失敗時間 (TTL index 以此欄位自動清除過舊的紀錄)
+	LastFailureAt time.Time `bson:"last_failure_at" json:"last_failure_at"`
+}
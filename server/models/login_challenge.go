@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LoginChallenge 代表密碼驗證通過、等待兩步驟驗證碼的登入流程
+type LoginChallenge struct {
+	ID primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+
+	// TokenHash: 回傳給前端的 challenge 的 SHA-256
+	TokenHash string `bson:"token_hash" json:"-"`
+
+	// Username: 正在登入的使用者
+	Username string `bson:"username" json:"username"`
+
+	// Attempts: 已嘗試輸入驗證碼的次數
+	Attempts int `bson:"attempts" json:"attempts"`
+
+	// ExpiresAt: 過期時間 (短效)
+	ExpiresAt time.Time `bson:"expires_at" json:"expires_at"`
+}
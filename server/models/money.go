@@ -0,0 +1,134 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// MoneyScale 每 1 元等於幾個最小單位 (固定到小數第 2 位)
+const MoneyScale = 100
+
+// Money 金額，以最小單位 (1/100 元) 的整數儲存，加總與比較都不會有浮點誤差
+//
+// 資料庫中存為 int64；JSON 則維持一般數字 (例如 12.5)，前端不需要換算。
+// 輸入超過小數第 2 位時四捨五入 (遠離 0)。
+type Money int64
+
+// NewMoneyFromFloat 將浮點數金額轉為 Money (四捨五入到小數第 2 位)
+func NewMoneyFromFloat(value float64) Money {
+	return Money(math.Round(value * MoneyScale))
+}
+
+// ParseMoney 解析十進位字串 (例如 "12.34"、"-5"、"1e3")，四捨五入到小數第 2 位
+func ParseMoney(value string) (Money, error) {
+	value = strings.TrimSpace(value)
+	r, ok := new(big.Rat).SetString(value)
+	if !ok {
+		return 0, fmt.Errorf("無效的金額: %q", value)
+	}
+
+	r.Mul(r, big.NewRat(MoneyScale, 1))
+	num := new(big.Int).Set(r.Num())
+	den := r.Denom()
+
+	// 四捨五入 (遠離 0): (|num| * 2 + den) / (den * 2)
+	negative := num.Sign() < 0
+	num.Abs(num)
+	num.Mul(num, big.NewInt(2))
+	num.Add(num, den)
+	num.Quo(num, new(big.Int).Mul(den, big.NewInt(2)))
+	if negative {
+		num.Neg(num)
+	}
+
+	if !num.IsInt64() {
+		return 0, fmt.Errorf("金額超出範圍: %q", value)
+	}
+	return Money(num.Int64()), nil
+}
+
+// Float64 轉為浮點數 (只用於計算比例，不可再拿來加總)
+func (m Money) Float64() float64 {
+	return float64(m) / MoneyScale
+}
+
+// Mul 乘上比例後四捨五入 (例如匯率換算)
+func (m Money) Mul(rate float64) Money {
+	return Money(math.Round(float64(m) * rate))
+}
+
+// DivRound 除以整數後四捨五入 (例如月平均)
+func (m Money) DivRound(n int64) Money {
+	if n == 0 {
+		return 0
+	}
+	q, r := int64(m)/n, int64(m)%n
+	if r != 0 && 2*abs64(r) >= abs64(n) {
+		if (r < 0) != (n < 0) {
+			q--
+		} else {
+			q++
+		}
+	}
+	return Money(q)
+}
+
+func abs64(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// String 十進位字串，去掉多餘的 0 (例如 1250 -> "12.5"、1200 -> "12")
+func (m Money) String() string {
+	v := int64(m)
+	sign := ""
+	if v < 0 {
+		sign = "-"
+	}
+	u := uint64(v)
+	if v < 0 {
+		// -v 在 v 為 math.MinInt64 時會溢位，先加 1 再取負號
+		u = uint64(-(v + 1)) + 1
+	}
+
+	whole := strconv.FormatUint(u/MoneyScale, 10)
+	frac := u % MoneyScale
+	if frac == 0 {
+		return sign + whole
+	}
+	return sign + whole + "." + strings.TrimRight(fmt.Sprintf("%02d", frac), "0")
+}
+
+// MarshalJSON 輸出為 JSON 數字
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON 接受 JSON 數字或數字字串
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	text := string(data)
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+	}
+
+	parsed, err := ParseMoney(text)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
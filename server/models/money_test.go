@@ -0,0 +1,32 @@
+package models
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{0, "0"},
+		{1250, "12.5"},
+		{1200, "12"},
+		{5, "0.05"},
+		{-1234, "-12.34"},
+		{-5, "-0.05"},
+		{math.MaxInt64, "92233720368547758.07"},
+		{math.MinInt64, "-92233720368547758.08"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.money.String(); got != tt.want {
+			t.Errorf("Money(%d).String() = %q, want %q", int64(tt.money), got, tt.want)
+		}
+		// 輸出的字串必須能解析回相同的金額
+		if parsed, err := ParseMoney(tt.want); err != nil || parsed != tt.money {
+			t.Errorf("ParseMoney(%q) = %d, %v, want %d", tt.want, int64(parsed), err, int64(tt.money))
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OIDCState 代表一次進行中的 OIDC 登入 (導向 IdP 到 callback 之間)
+type OIDCState struct {
+	ID primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+
+	// StateHash: state 參數的 SHA-256 (原始值只存在瀏覽器 Cookie 與 IdP 的導向網址)
+	StateHash string `bson:"state_hash" json:"-"`
+
+	// CodeVerifier: PKCE 的 code_verifier，交換 token 時使用
+	CodeVerifier string `bson:"code_verifier" json:"-"`
+
+	// Nonce: 需與 ID token 中的 nonce 相同，避免重送攻擊
+	Nonce string `bson:"nonce" json:"-"`
+
+	// LinkUsername: 不為空時代表要把外部身分連結到此本地帳號，而不是登入
+	LinkUsername string `bson:"link_username,omitempty" json:"-"`
+
+	// ExpiresAt: 過期時間 (TTL index 自動清除)
+	ExpiresAt time.Time `bson:"expires_at" json:"expires_at"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// SchemaMigration 代表一個已執行過的資料庫 migration
+type SchemaMigration struct {
+	// Version: migration 版本號 (同時作為 _id，避免重複紀錄)
+	Version int `bson:"_id" json:"version"`
+
+	// Name: migration 名稱
+	Name string `bson:"name" json:"name"`
+
+	// AppliedAt: 執行完成時間
+	AppliedAt time.Time `bson:"applied_at" json:"applied_at"`
+
+	// DurationMs: 執行耗時 (毫秒)
+	DurationMs int64 `bson:"duration_ms" json:"duration_ms"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Session 代表一個登入工作階段 (對應瀏覽器中的 fintrack_session Cookie)
+type Session struct {
+	ID primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+
+	// TokenHash: Cookie 中隨機 token 的 SHA-256，資料庫不存放原始 token
+	TokenHash string `bson:"token_hash" json:"-"`
+
+	// Username: 工作階段所屬的使用者
+	Username string `bson:"username" json:"username"`
+
+	// UserAgent: 登入時的瀏覽器/裝置資訊
+	UserAgent string `bson:"user_agent,omitempty" json:"user_agent"`
+
+	// IP: 最後一次使用此工作階段的來源 IP
+	IP string `bson:"ip,omitempty" json:"ip"`
+
+	// CreatedAt: 登入時間
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+
+	// LastSeenAt: 最後一次使用此工作階段的時間
+	LastSeenAt time.Time `bson:"last_seen_at" json:"last_seen_at"`
+
+	// ExpiresAt: 過期時間，每次使用時會往後展延 (sliding expiration)
+	ExpiresAt time.Time `bson:"expires_at" json:"expires_at"`
+}
@@ -6,14 +6,23 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// 交易種類 (Kind)，一般的收入與支出為空字串
+const (
+	TransactionTransferOut = "transfer_out" // 轉帳的轉出方 (從 account_id 流出)
+	TransactionTransferIn  = "transfer_in"  // 轉帳的轉入方 (流入 account_id)
+)
+
 // Transaction 代表一筆記帳資料
 type Transaction struct {
 	// ID: MongoDB 自動生成的唯一識別碼
 	// omitempty: 如果是空的 (建立時) 就不傳這個欄位給 MongoDB，讓它自己生
 	ID primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 
-	// Amount: 金額
-	Amount float64 `bson:"amount" json:"amount" binding:"required" example:"150"`
+	// Amount: 金額 (以 1/100 元的整數儲存，JSON 仍為一般數字)
+	Amount Money `bson:"amount" json:"amount" binding:"required" swaggertype:"number" example:"150"`
+
+	// Currency: 幣別 (ISO 4217)，未指定時使用建立者的主要幣別
+	Currency string `bson:"currency,omitempty" json:"currency" example:"TWD"`
 
 	// CategoryID: 類別 ID
 	CategoryID primitive.ObjectID `bson:"category_id" json:"category_id" binding:"required" example:"64cfe3f1f1f1f1f1f1f1f1f1"`
@@ -25,7 +34,22 @@ type Transaction struct {
 	// Note: 備註 (選填)
 	Note string `bson:"note" json:"note" example:"午餐吃牛肉麵"`
 
-	// Owner: 這筆資料的擁有者
+	// AccountID: 帳戶 (選填)，有指定時計入該帳戶的餘額
+	AccountID *primitive.ObjectID `bson:"account_id,omitempty" json:"account_id,omitempty" swaggertype:"string"`
+
+	// Kind: 空字串為一般收支；transfer_out / transfer_in 為轉帳的一邊，沒有類別，不計入收入與支出
+	Kind string `bson:"kind,omitempty" json:"kind,omitempty" example:"transfer_out"`
+
+	// TransferID: 同一筆轉帳的兩邊共用的 ID
+	TransferID *primitive.ObjectID `bson:"transfer_id,omitempty" json:"transfer_id,omitempty" swaggertype:"string"`
+
+	// Tags: 標籤 (選填，小寫)，用來標記跨類別的屬性，例如旅行、可報帳
+	Tags []string `bson:"tags,omitempty" json:"tags,omitempty" example:"trip-tokyo,reimbursable"`
+
+	// LedgerID: 所屬帳本
+	LedgerID primitive.ObjectID `bson:"ledger_id" json:"ledger_id"`
+
+	// Owner: 建立這筆資料的使用者
 	Owner string `bson:"owner" json:"owner"`
 
 	// CreatedAt: 建立時間
@@ -33,4 +57,15 @@ type Transaction struct {
 
 	// UpdatedAt: 更新時間
 	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+
+	// Version: 版本號，建立時為 1，每次修改加 1 (舊版本保存在 transaction_revisions)
+	Version int `bson:"version" json:"version"`
+
+	// DeletedAt: 移到垃圾桶的時間 (nil 代表未刪除)
+	DeletedAt *time.Time `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+}
+
+// IsTransfer 是否為轉帳的一邊
+func (t Transaction) IsTransfer() bool {
+	return t.TransferID != nil
 }
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TransactionRevision 交易被修改前的某一個版本
+type TransactionRevision struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TransactionID primitive.ObjectID `bson:"transaction_id" json:"transaction_id"`
+	LedgerID      primitive.ObjectID `bson:"ledger_id" json:"ledger_id"`
+
+	// Version: 此版本的版本號 (與當時 Transaction.Version 相同)
+	Version int `bson:"version" json:"version"`
+
+	// 此版本的內容
+	Amount     Money               `bson:"amount" json:"amount" swaggertype:"number"`
+	Currency   string              `bson:"currency" json:"currency"`
+	CategoryID primitive.ObjectID  `bson:"category_id" json:"category_id"`
+	Date       string              `bson:"date" json:"date"`
+	Note       string              `bson:"note" json:"note"`
+	Tags       []string            `bson:"tags,omitempty" json:"tags,omitempty"`
+	AccountID  *primitive.ObjectID `bson:"account_id,omitempty" json:"account_id,omitempty"`
+
+	// ReplacedBy / ReplacedAt: 誰在什麼時候把這個版本改掉
+	ReplacedBy string    `bson:"replaced_by" json:"replaced_by"`
+	ReplacedAt time.Time `bson:"replaced_at" json:"replaced_at"`
+}
+
+// NewTransactionRevision 以修改前的交易建立版本紀錄
+func NewTransactionRevision(before Transaction, replacedBy string, replacedAt time.Time) TransactionRevision {
+	return TransactionRevision{
+		ID:            primitive.NewObjectID(),
+		TransactionID: before.ID,
+		LedgerID:      before.LedgerID,
+		Version:       before.Version,
+		Amount:        before.Amount,
+		Currency:      before.Currency,
+		CategoryID:    before.CategoryID,
+		Date:          before.Date,
+		Note:          before.Note,
+		Tags:          before.Tags,
+		AccountID:     before.AccountID,
+		ReplacedBy:    replacedBy,
+		ReplacedAt:    replacedAt,
+	}
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 使用者角色
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// User 代表一個登入帳號
+type User struct {
+	ID primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+
+	// Username: 登入帳號 (唯一)
+	Username string `bson:"username" json:"username"`
+
+	// PasswordHash: bcrypt 雜湊後的密碼，永遠不回傳給前端
+	PasswordHash string `bson:"password_hash" json:"-"`
+
+	// Role: "user" 或 "admin"
+	Role string `bson:"role" json:"role"`
+
+	// Disabled: 被管理員停用的帳號無法登入
+	Disabled bool `bson:"disabled,omitempty" json:"disabled"`
+
+	// BaseCurrency: 主要幣別，統計與報表都換算成此幣別 (未設定時使用 DEFAULT_CURRENCY)
+	BaseCurrency string `bson:"base_currency,omitempty" json:"base_currency,omitempty"`
+
+	// DefaultLedgerID: 未指定帳本時使用的帳本
+	DefaultLedgerID primitive.ObjectID `bson:"default_ledger_id,omitempty" json:"default_ledger_id"`
+
+	// TOTPSecret: 兩步驟驗證的 Base32 金鑰 (申請中或已啟用時才有值)
+	TOTPSecret string `bson:"totp_secret,omitempty" json:"-"`
+
+	// TOTPEnabled: 是否已完成兩步驟驗證設定
+	TOTPEnabled bool `bson:"totp_enabled" json:"totp_enabled"`
+
+	// TOTPLastStep: 最後一次使用的 TOTP 時間區間，避免同一組驗證碼被重複使用
+	TOTPLastStep int64 `bson:"totp_last_step,omitempty" json:"-"`
+
+	// RecoveryCodes: 復原碼的 SHA-256，每組只能使用一次
+	RecoveryCodes []string `bson:"recovery_codes,omitempty" json:"-"`
+
+	// Identities: 已連結的外部身分 (OIDC)
+	Identities []ExternalIdentity `bson:"identities,omitempty" json:"identities,omitempty"`
+
+	// CreatedAt: 建立時間
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+
+	// UpdatedAt: 更新時間
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// ExternalIdentity 代表外部身分提供者 (IdP) 上的一個帳號
+type ExternalIdentity struct {
+	// Issuer / Subject: OIDC 的 iss 與 sub，兩者合起來唯一識別一個外部帳號
+	Issuer  string `bson:"issuer" json:"issuer"`
+	Subject string `bson:"subject" json:"subject"`
+
+	// Email: 連結時 IdP 提供的 email (僅供顯示)
+	Email string `bson:"email,omitempty" json:"email,omitempty"`
+
+	// LinkedAt: 連結時間
+	LinkedAt time.Time `bson:"linked_at" json:"linked_at"`
+}
@@ -0,0 +1,1179 @@
+package repository
+
+import (
+	"context"
+	"server/models"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryStore 記憶體中的資料，所有 repository 共用同一把鎖
+type memoryStore struct {
+	mu            sync.RWMutex
+	transactions  map[primitive.ObjectID]models.Transaction
+	revisions     []models.TransactionRevision
+	categories    map[primitive.ObjectID]models.Category
+	budgets       map[primitive.ObjectID]models.Budget
+	fixedExpenses map[primitive.ObjectID]models.FixedExpense
+	accounts      map[primitive.ObjectID]models.Account
+	exchangeRates map[string]models.ExchangeRate
+	auditLogs     []models.AuditLog
+	// baseCurrencies 使用者 -> 主要幣別 (記憶體實作沒有帳號資料，任何使用者都視為存在)
+	baseCurrencies map[string]string
+}
+
+// NewMemoryRepositories 建立存放在記憶體中的 repositories (單元測試或本機試用，重啟後資料消失)
+func NewMemoryRepositories() Repositories {
+	store := &memoryStore{
+		transactions:   make(map[primitive.ObjectID]models.Transaction),
+		categories:     make(map[primitive.ObjectID]models.Category),
+		budgets:        make(map[primitive.ObjectID]models.Budget),
+		fixedExpenses:  make(map[primitive.ObjectID]models.FixedExpense),
+		accounts:       make(map[primitive.ObjectID]models.Account),
+		exchangeRates:  make(map[string]models.ExchangeRate),
+		baseCurrencies: make(map[string]string),
+	}
+	return Repositories{
+		Transactions: &memoryTransactionRepository{store: store, memoryTrash: memoryTrash[models.Transaction]{
+			store: store,
+			items: func(s *memoryStore) map[primitive.ObjectID]models.Transaction { return s.transactions },
+			fields: func(tx *models.Transaction) (primitive.ObjectID, **time.Time) {
+				return tx.LedgerID, &tx.DeletedAt
+			},
+		}, memoryCategoryDependents: memoryCategoryDependents[models.Transaction]{
+			store: store,
+			items: func(s *memoryStore) map[primitive.ObjectID]models.Transaction { return s.transactions },
+			fields: func(tx *models.Transaction) (primitive.ObjectID, *primitive.ObjectID) {
+				return tx.LedgerID, &tx.CategoryID
+			},
+		}, memoryAccountDependents: memoryAccountDependents[models.Transaction]{
+			store: store,
+			items: func(s *memoryStore) map[primitive.ObjectID]models.Transaction { return s.transactions },
+			fields: func(tx *models.Transaction) (primitive.ObjectID, *primitive.ObjectID) {
+				return tx.LedgerID, tx.AccountID
+			},
+		}},
+		Categories: &memoryCategoryRepository{store: store, memoryTrash: memoryTrash[models.Category]{
+			store: store,
+			items: func(s *memoryStore) map[primitive.ObjectID]models.Category { return s.categories },
+			fields: func(category *models.Category) (primitive.ObjectID, **time.Time) {
+				return category.LedgerID, &category.DeletedAt
+			},
+		}},
+		Budgets: &memoryBudgetRepository{store: store, memoryTrash: memoryTrash[models.Budget]{
+			store: store,
+			items: func(s *memoryStore) map[primitive.ObjectID]models.Budget { return s.budgets },
+			fields: func(budget *models.Budget) (primitive.ObjectID, **time.Time) {
+				return budget.LedgerID, &budget.DeletedAt
+			},
+		}},
+		FixedExpenses: &memoryFixedExpenseRepository{store: store, memoryTrash: memoryTrash[models.FixedExpense]{
+			store: store,
+			items: func(s *memoryStore) map[primitive.ObjectID]models.FixedExpense { return s.fixedExpenses },
+			fields: func(expense *models.FixedExpense) (primitive.ObjectID, **time.Time) {
+				return expense.LedgerID, &expense.DeletedAt
+			},
+		}, memoryCategoryDependents: memoryCategoryDependents[models.FixedExpense]{
+			store: store,
+			items: func(s *memoryStore) map[primitive.ObjectID]models.FixedExpense { return s.fixedExpenses },
+			fields: func(expense *models.FixedExpense) (primitive.ObjectID, *primitive.ObjectID) {
+				return expense.LedgerID, &expense.CategoryID
+			},
+		}, memoryAccountDependents: memoryAccountDependents[models.FixedExpense]{
+			store: store,
+			items: func(s *memoryStore) map[primitive.ObjectID]models.FixedExpense { return s.fixedExpenses },
+			fields: func(expense *models.FixedExpense) (primitive.ObjectID, *primitive.ObjectID) {
+				return expense.LedgerID, expense.AccountID
+			},
+		}},
+		Accounts: &memoryAccountRepository{store: store, memoryTrash: memoryTrash[models.Account]{
+			store: store,
+			items: func(s *memoryStore) map[primitive.ObjectID]models.Account { return s.accounts },
+			fields: func(account *models.Account) (primitive.ObjectID, **time.Time) {
+				return account.LedgerID, &account.DeletedAt
+			},
+		}},
+		TransactionRevisions: &memoryTransactionRevisionRepository{store: store},
+		ExchangeRates:        &memoryExchangeRateRepository{store: store},
+		AuditLogs:            &memoryAuditLogRepository{store: store},
+		UserSettings:         &memoryUserSettingsRepository{store: store},
+	}
+}
+
+// ---- Trash ----
+
+// memoryTrash 各型別共用的垃圾桶操作，透過 fields 讀寫 ledger_id 與 deleted_at
+type memoryTrash[T any] struct {
+	store  *memoryStore
+	items  func(*memoryStore) map[primitive.ObjectID]T
+	fields func(*T) (ledgerID primitive.ObjectID, deletedAt **time.Time)
+}
+
+// softDelete 標記 deleted_at，回傳刪除前的資料
+func (t memoryTrash[T]) softDelete(ledgerID, id primitive.ObjectID) (T, error) {
+	t.store.mu.Lock()
+	defer t.store.mu.Unlock()
+
+	var zero T
+	item, ok := t.items(t.store)[id]
+	if !ok {
+		return zero, ErrNotFound
+	}
+	itemLedger, deletedAt := t.fields(&item)
+	if itemLedger != ledgerID || *deletedAt != nil {
+		return zero, ErrNotFound
+	}
+	before := item
+	now := time.Now()
+	*deletedAt = &now
+	t.items(t.store)[id] = item
+	return before, nil
+}
+
+// deleted 取得帳本中在垃圾桶裡的單筆資料 (呼叫端需持有鎖)
+func (t memoryTrash[T]) deleted(ledgerID, id primitive.ObjectID) (T, bool) {
+	item, ok := t.items(t.store)[id]
+	if !ok {
+		return item, false
+	}
+	itemLedger, deletedAt := t.fields(&item)
+	return item, itemLedger == ledgerID && *deletedAt != nil
+}
+
+func (t memoryTrash[T]) ListDeleted(ctx context.Context, ledgerID primitive.ObjectID) ([]T, error) {
+	t.store.mu.RLock()
+	defer t.store.mu.RUnlock()
+
+	items := []T{}
+	for id := range t.items(t.store) {
+		if item, ok := t.deleted(ledgerID, id); ok {
+			items = append(items, item)
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		_, a := t.fields(&items[i])
+		_, b := t.fields(&items[j])
+		return (*a).After(**b)
+	})
+	return items, nil
+}
+
+func (t memoryTrash[T]) Restore(ctx context.Context, ledgerID, id primitive.ObjectID) (T, error) {
+	t.store.mu.Lock()
+	defer t.store.mu.Unlock()
+
+	item, ok := t.deleted(ledgerID, id)
+	if !ok {
+		var zero T
+		return zero, ErrNotFound
+	}
+	_, deletedAt := t.fields(&item)
+	*deletedAt = nil
+	t.items(t.store)[id] = item
+	return item, nil
+}
+
+func (t memoryTrash[T]) Purge(ctx context.Context, ledgerID, id primitive.ObjectID) (T, error) {
+	t.store.mu.Lock()
+	defer t.store.mu.Unlock()
+
+	item, ok := t.deleted(ledgerID, id)
+	if !ok {
+		var zero T
+		return zero, ErrNotFound
+	}
+	delete(t.items(t.store), id)
+	return item, nil
+}
+
+func (t memoryTrash[T]) PurgeDeletedBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	t.store.mu.Lock()
+	defer t.store.mu.Unlock()
+
+	var purged int64
+	items := t.items(t.store)
+	for id, item := range items {
+		if _, deletedAt := t.fields(&item); *deletedAt != nil && (*deletedAt).Before(cutoff) {
+			delete(items, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// ---- Category dependents ----
+
+// memoryCategoryDependents 交易與固定支出共用的類別參照操作，透過 fields 讀寫 ledger_id 與 category_id
+type memoryCategoryDependents[T any] struct {
+	store  *memoryStore
+	items  func(*memoryStore) map[primitive.ObjectID]T
+	fields func(*T) (ledgerID primitive.ObjectID, categoryID *primitive.ObjectID)
+}
+
+func (d memoryCategoryDependents[T]) CountByCategory(ctx context.Context, ledgerID, categoryID primitive.ObjectID) (int64, error) {
+	d.store.mu.RLock()
+	defer d.store.mu.RUnlock()
+
+	var count int64
+	for _, item := range d.items(d.store) {
+		if itemLedger, itemCategory := d.fields(&item); itemLedger == ledgerID && *itemCategory == categoryID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (d memoryCategoryDependents[T]) ReassignCategory(ctx context.Context, ledgerID, from, to primitive.ObjectID) (int64, error) {
+	d.store.mu.Lock()
+	defer d.store.mu.Unlock()
+
+	var count int64
+	items := d.items(d.store)
+	for id, item := range items {
+		if itemLedger, itemCategory := d.fields(&item); itemLedger == ledgerID && *itemCategory == from {
+			*itemCategory = to
+			items[id] = item
+			count++
+		}
+	}
+	return count, nil
+}
+
+// ---- Account dependents ----
+
+// memoryAccountDependents 交易與固定支出共用的帳戶參照操作，透過 fields 讀取 ledger_id 與 account_id (nil 代表沒有帳戶)
+type memoryAccountDependents[T any] struct {
+	store  *memoryStore
+	items  func(*memoryStore) map[primitive.ObjectID]T
+	fields func(*T) (ledgerID primitive.ObjectID, accountID *primitive.ObjectID)
+}
+
+func (d memoryAccountDependents[T]) CountByAccount(ctx context.Context, ledgerID, accountID primitive.ObjectID) (int64, error) {
+	d.store.mu.RLock()
+	defer d.store.mu.RUnlock()
+
+	var count int64
+	for _, item := range d.items(d.store) {
+		if itemLedger, itemAccount := d.fields(&item); itemLedger == ledgerID && itemAccount != nil && *itemAccount == accountID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// ---- Tag dependents ----
+
+// renameTag 回傳把 from 改為 to 的新標籤列表 (已有 to 時只移除 from)，沒有 from 時 ok 為 false
+func renameTag(tags []string, from, to string) ([]string, bool) {
+	found, hasTarget := false, false
+	for _, tag := range tags {
+		found = found || tag == from
+		hasTarget = hasTarget || tag == to
+	}
+	if !found {
+		return tags, false
+	}
+	renamed := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		switch {
+		case tag != from:
+			renamed = append(renamed, tag)
+		case !hasTarget:
+			renamed = append(renamed, to)
+		}
+	}
+	return renamed, true
+}
+
+// removeTag 回傳移除 tag 後的新標籤列表，沒有 tag 時 ok 為 false
+func removeTag(tags []string, tag string) ([]string, bool) {
+	removed := make([]string, 0, len(tags))
+	for _, t := range tags {
+		if t != tag {
+			removed = append(removed, t)
+		}
+	}
+	return removed, len(removed) != len(tags)
+}
+
+// ---- Transactions ----
+
+type memoryTransactionRepository struct {
+	store *memoryStore
+	memoryTrash[models.Transaction]
+	memoryCategoryDependents[models.Transaction]
+	memoryAccountDependents[models.Transaction]
+}
+
+func (f TransactionFilter) matches(tx models.Transaction) bool {
+	if tx.LedgerID != f.LedgerID || tx.DeletedAt != nil {
+		return false
+	}
+	if f.StartDate != "" && tx.Date < f.StartDate {
+		return false
+	}
+	if f.EndDate != "" && tx.Date > f.EndDate {
+		return false
+	}
+	if len(f.CategoryIDs) > 0 {
+		found := false
+		for _, id := range f.CategoryIDs {
+			if tx.CategoryID == id {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(f.AccountIDs) > 0 {
+		found := false
+		for _, id := range f.AccountIDs {
+			if tx.AccountID != nil && *tx.AccountID == id {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	hasTag := func(tag string) bool {
+		for _, t := range tx.Tags {
+			if t == tag {
+				return true
+			}
+		}
+		return false
+	}
+	if len(f.TagsAny) > 0 {
+		found := false
+		for _, tag := range f.TagsAny {
+			found = found || hasTag(tag)
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, tag := range f.TagsAll {
+		if !hasTag(tag) {
+			return false
+		}
+	}
+	for _, tag := range f.TagsNone {
+		if hasTag(tag) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *memoryTransactionRepository) Create(ctx context.Context, tx models.Transaction) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	if tx.ID.IsZero() {
+		tx.ID = primitive.NewObjectID()
+	}
+	if tx.Version == 0 {
+		tx.Version = 1
+	}
+	r.store.transactions[tx.ID] = tx
+	return nil
+}
+
+func (r *memoryTransactionRepository) Get(ctx context.Context, ledgerID, id primitive.ObjectID) (models.Transaction, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	tx, ok := r.store.transactions[id]
+	if !ok || tx.LedgerID != ledgerID || tx.DeletedAt != nil {
+		return models.Transaction{}, ErrNotFound
+	}
+	return tx, nil
+}
+
+func (r *memoryTransactionRepository) Find(ctx context.Context, f TransactionFilter) ([]models.Transaction, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	transactions := []models.Transaction{}
+	for _, tx := range r.store.transactions {
+		if f.matches(tx) {
+			transactions = append(transactions, tx)
+		}
+	}
+	sort.SliceStable(transactions, func(i, j int) bool {
+		if transactions[i].Date != transactions[j].Date {
+			return transactions[i].Date > transactions[j].Date
+		}
+		return transactions[i].ID.Hex() > transactions[j].ID.Hex()
+	})
+	return transactions, nil
+}
+
+func (r *memoryTransactionRepository) List(ctx context.Context, f TransactionFilter, skip, limit int64) ([]models.Transaction, int64, error) {
+	all, _ := r.Find(ctx, f)
+	total := int64(len(all))
+	if skip >= total {
+		return []models.Transaction{}, total, nil
+	}
+	end := skip + limit
+	if limit <= 0 || end > total {
+		end = total
+	}
+	return all[skip:end], total, nil
+}
+
+func (r *memoryTransactionRepository) Update(ctx context.Context, ledgerID, id primitive.ObjectID, changes models.Transaction) (models.Transaction, models.Transaction, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	before, ok := r.store.transactions[id]
+	if !ok || before.LedgerID != ledgerID || before.DeletedAt != nil {
+		return models.Transaction{}, models.Transaction{}, ErrNotFound
+	}
+	after := before
+	after.Amount = changes.Amount
+	after.CategoryID = changes.CategoryID
+	after.Date = changes.Date
+	after.Note = changes.Note
+	after.UpdatedAt = changes.UpdatedAt
+	after.Version = before.Version + 1
+	if changes.Currency != "" {
+		after.Currency = changes.Currency
+	}
+	if changes.Tags != nil {
+		after.Tags = changes.Tags
+	}
+	if changes.AccountID != nil {
+		after.AccountID = nil
+		if !changes.AccountID.IsZero() {
+			accountID := *changes.AccountID
+			after.AccountID = &accountID
+		}
+	}
+	r.store.transactions[id] = after
+	return before, after, nil
+}
+
+func (r *memoryTransactionRepository) Delete(ctx context.Context, ledgerID, id primitive.ObjectID) (models.Transaction, error) {
+	return r.softDelete(ledgerID, id)
+}
+
+func (r *memoryTransactionRepository) SumByCategory(ctx context.Context, f TransactionFilter) ([]CategoryTotal, error) {
+	transactions, _ := r.Find(ctx, f)
+
+	type key struct {
+		categoryID primitive.ObjectID
+		currency   string
+		date       string
+	}
+	index := make(map[key]int)
+	totals := []CategoryTotal{}
+	for _, tx := range transactions {
+		if tx.IsTransfer() {
+			continue
+		}
+		k := key{categoryID: tx.CategoryID, currency: tx.Currency, date: tx.Date}
+		i, ok := index[k]
+		if !ok {
+			i = len(totals)
+			index[k] = i
+			totals = append(totals, CategoryTotal{CategoryID: k.categoryID, Currency: k.currency, Date: k.date})
+		}
+		totals[i].Total += tx.Amount
+		totals[i].Count++
+	}
+	return totals, nil
+}
+
+func (r *memoryTransactionRepository) SumByTag(ctx context.Context, f TransactionFilter) ([]TagTotal, error) {
+	transactions, _ := r.Find(ctx, f)
+
+	type key struct {
+		tag        string
+		categoryID primitive.ObjectID
+		currency   string
+		date       string
+	}
+	index := make(map[key]int)
+	totals := []TagTotal{}
+	for _, tx := range transactions {
+		if tx.IsTransfer() {
+			continue
+		}
+		for _, tag := range tx.Tags {
+			k := key{tag: tag, categoryID: tx.CategoryID, currency: tx.Currency, date: tx.Date}
+			i, ok := index[k]
+			if !ok {
+				i = len(totals)
+				index[k] = i
+				totals = append(totals, TagTotal{Tag: tag, CategoryTotal: CategoryTotal{CategoryID: k.categoryID, Currency: k.currency, Date: k.date}})
+			}
+			totals[i].Total += tx.Amount
+			totals[i].Count++
+		}
+	}
+	return totals, nil
+}
+
+func (r *memoryTransactionRepository) SumByAccount(ctx context.Context, f TransactionFilter) ([]AccountTotal, error) {
+	transactions, _ := r.Find(ctx, f)
+
+	type key struct {
+		accountID  primitive.ObjectID
+		kind       string
+		categoryID primitive.ObjectID
+		currency   string
+		date       string
+	}
+	index := make(map[key]int)
+	totals := []AccountTotal{}
+	for _, tx := range transactions {
+		if tx.AccountID == nil {
+			continue
+		}
+		k := key{accountID: *tx.AccountID, kind: tx.Kind, categoryID: tx.CategoryID, currency: tx.Currency, date: tx.Date}
+		i, ok := index[k]
+		if !ok {
+			i = len(totals)
+			index[k] = i
+			totals = append(totals, AccountTotal{AccountID: k.accountID, Kind: k.kind, CategoryTotal: CategoryTotal{CategoryID: k.categoryID, Currency: k.currency, Date: k.date}})
+		}
+		totals[i].Total += tx.Amount
+		totals[i].Count++
+	}
+	return totals, nil
+}
+
+func (r *memoryTransactionRepository) TransferLegs(ctx context.Context, ledgerID, transferID primitive.ObjectID, deleted bool) ([]models.Transaction, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	legs := []models.Transaction{}
+	for _, tx := range r.store.transactions {
+		if tx.LedgerID == ledgerID && tx.TransferID != nil && *tx.TransferID == transferID && (tx.DeletedAt != nil) == deleted {
+			legs = append(legs, tx)
+		}
+	}
+	return legs, nil
+}
+
+func (r *memoryTransactionRepository) ListTags(ctx context.Context, ledgerID primitive.ObjectID) ([]TagCount, error) {
+	transactions, _ := r.Find(ctx, TransactionFilter{LedgerID: ledgerID})
+
+	counts := make(map[string]int64)
+	for _, tx := range transactions {
+		for _, tag := range tx.Tags {
+			counts[tag]++
+		}
+	}
+	tags := make([]TagCount, 0, len(counts))
+	for tag, count := range counts {
+		tags = append(tags, TagCount{Tag: tag, Count: count})
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Tag < tags[j].Tag })
+	return tags, nil
+}
+
+func (r *memoryTransactionRepository) RenameTag(ctx context.Context, ledgerID primitive.ObjectID, from, to string) (int64, error) {
+	return r.editTags(ledgerID, func(tags []string) ([]string, bool) { return renameTag(tags, from, to) })
+}
+
+func (r *memoryTransactionRepository) DeleteTag(ctx context.Context, ledgerID primitive.ObjectID, tag string) (int64, error) {
+	return r.editTags(ledgerID, func(tags []string) ([]string, bool) { return removeTag(tags, tag) })
+}
+
+// editTags 對帳本中所有交易 (包含垃圾桶) 的標籤套用 edit，回傳有修改的筆數
+func (r *memoryTransactionRepository) editTags(ledgerID primitive.ObjectID, edit func([]string) ([]string, bool)) (int64, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	var count int64
+	for id, tx := range r.store.transactions {
+		if tx.LedgerID != ledgerID {
+			continue
+		}
+		if tags, ok := edit(tx.Tags); ok {
+			tx.Tags = tags
+			r.store.transactions[id] = tx
+			count++
+		}
+	}
+	return count, nil
+}
+
+// ---- Transaction revisions ----
+
+type memoryTransactionRevisionRepository struct {
+	store *memoryStore
+}
+
+func (r *memoryTransactionRevisionRepository) Create(ctx context.Context, revision models.TransactionRevision) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	if revision.ID.IsZero() {
+		revision.ID = primitive.NewObjectID()
+	}
+	r.store.revisions = append(r.store.revisions, revision)
+	return nil
+}
+
+func (r *memoryTransactionRevisionRepository) List(ctx context.Context, ledgerID, transactionID primitive.ObjectID) ([]models.TransactionRevision, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	revisions := []models.TransactionRevision{}
+	for _, revision := range r.store.revisions {
+		if revision.LedgerID == ledgerID && revision.TransactionID == transactionID {
+			revisions = append(revisions, revision)
+		}
+	}
+	sort.SliceStable(revisions, func(i, j int) bool { return revisions[i].Version < revisions[j].Version })
+	return revisions, nil
+}
+
+func (r *memoryTransactionRevisionRepository) Get(ctx context.Context, ledgerID, transactionID primitive.ObjectID, version int) (models.TransactionRevision, error) {
+	revisions, _ := r.List(ctx, ledgerID, transactionID)
+	for _, revision := range revisions {
+		if revision.Version == version {
+			return revision, nil
+		}
+	}
+	return models.TransactionRevision{}, ErrNotFound
+}
+
+func (r *memoryTransactionRevisionRepository) DeleteByTransaction(ctx context.Context, ledgerID, transactionID primitive.ObjectID) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	kept := r.store.revisions[:0]
+	for _, revision := range r.store.revisions {
+		if revision.LedgerID != ledgerID || revision.TransactionID != transactionID {
+			kept = append(kept, revision)
+		}
+	}
+	r.store.revisions = kept
+	return nil
+}
+
+func (r *memoryTransactionRevisionRepository) RenameTag(ctx context.Context, ledgerID primitive.ObjectID, from, to string) (int64, error) {
+	return r.editTags(ledgerID, func(tags []string) ([]string, bool) { return renameTag(tags, from, to) })
+}
+
+func (r *memoryTransactionRevisionRepository) DeleteTag(ctx context.Context, ledgerID primitive.ObjectID, tag string) (int64, error) {
+	return r.editTags(ledgerID, func(tags []string) ([]string, bool) { return removeTag(tags, tag) })
+}
+
+// editTags 對帳本中所有舊版本的標籤套用 edit，回傳有修改的筆數
+func (r *memoryTransactionRevisionRepository) editTags(ledgerID primitive.ObjectID, edit func([]string) ([]string, bool)) (int64, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	var count int64
+	for i, revision := range r.store.revisions {
+		if revision.LedgerID != ledgerID {
+			continue
+		}
+		if tags, ok := edit(revision.Tags); ok {
+			r.store.revisions[i].Tags = tags
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *memoryTransactionRevisionRepository) PurgeOrphaned(ctx context.Context) (int64, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	var purged int64
+	kept := r.store.revisions[:0]
+	for _, revision := range r.store.revisions {
+		if _, ok := r.store.transactions[revision.TransactionID]; ok {
+			kept = append(kept, revision)
+		} else {
+			purged++
+		}
+	}
+	r.store.revisions = kept
+	return purged, nil
+}
+
+// ---- Categories ----
+
+type memoryCategoryRepository struct {
+	store *memoryStore
+	memoryTrash[models.Category]
+}
+
+func (r *memoryCategoryRepository) List(ctx context.Context, ledgerID primitive.ObjectID) ([]models.Category, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	categories := []models.Category{}
+	for _, category := range r.store.categories {
+		if category.LedgerID == ledgerID && category.DeletedAt == nil {
+			categories = append(categories, category)
+		}
+	}
+	sort.SliceStable(categories, func(i, j int) bool {
+		if categories[i].Order != categories[j].Order {
+			return categories[i].Order < categories[j].Order
+		}
+		return categories[i].Name < categories[j].Name
+	})
+	return categories, nil
+}
+
+func (r *memoryCategoryRepository) Get(ctx context.Context, ledgerID, id primitive.ObjectID) (models.Category, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	category, ok := r.store.categories[id]
+	if !ok || category.LedgerID != ledgerID || category.DeletedAt != nil {
+		return models.Category{}, ErrNotFound
+	}
+	return category, nil
+}
+
+func (r *memoryCategoryRepository) MaxOrder(ctx context.Context, ledgerID primitive.ObjectID) (int, error) {
+	categories, _ := r.List(ctx, ledgerID)
+	if len(categories) == 0 {
+		return 0, nil
+	}
+	return categories[len(categories)-1].Order, nil
+}
+
+func (r *memoryCategoryRepository) Create(ctx context.Context, category models.Category) error {
+	return r.CreateMany(ctx, []models.Category{category})
+}
+
+func (r *memoryCategoryRepository) CreateMany(ctx context.Context, categories []models.Category) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	for _, category := range categories {
+		if category.ID.IsZero() {
+			category.ID = primitive.NewObjectID()
+		}
+		r.store.categories[category.ID] = category
+	}
+	return nil
+}
+
+func (r *memoryCategoryRepository) Update(ctx context.Context, ledgerID, id primitive.ObjectID, changes CategoryUpdate) (models.Category, models.Category, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	before, ok := r.store.categories[id]
+	if !ok || before.LedgerID != ledgerID || before.DeletedAt != nil {
+		return models.Category{}, models.Category{}, ErrNotFound
+	}
+	after := before
+	if changes.Name != nil {
+		after.Name = *changes.Name
+	}
+	if changes.Type != nil {
+		after.Type = *changes.Type
+	}
+	if changes.Order != nil {
+		after.Order = *changes.Order
+	}
+	if changes.Archived != nil {
+		after.Archived = *changes.Archived
+	}
+	if changes.ParentID != nil {
+		after.ParentID = nil
+		if !changes.ParentID.IsZero() {
+			parentID := *changes.ParentID
+			after.ParentID = &parentID
+		}
+	}
+	r.store.categories[id] = after
+	return before, after, nil
+}
+
+func (r *memoryCategoryRepository) Delete(ctx context.Context, ledgerID, id primitive.ObjectID) (models.Category, error) {
+	return r.softDelete(ledgerID, id)
+}
+
+// ---- Accounts ----
+
+type memoryAccountRepository struct {
+	store *memoryStore
+	memoryTrash[models.Account]
+}
+
+func (r *memoryAccountRepository) List(ctx context.Context, ledgerID primitive.ObjectID) ([]models.Account, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	accounts := []models.Account{}
+	for _, account := range r.store.accounts {
+		if account.LedgerID == ledgerID && account.DeletedAt == nil {
+			accounts = append(accounts, account)
+		}
+	}
+	sort.SliceStable(accounts, func(i, j int) bool {
+		if accounts[i].Order != accounts[j].Order {
+			return accounts[i].Order < accounts[j].Order
+		}
+		return accounts[i].Name < accounts[j].Name
+	})
+	return accounts, nil
+}
+
+func (r *memoryAccountRepository) Get(ctx context.Context, ledgerID, id primitive.ObjectID) (models.Account, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	account, ok := r.store.accounts[id]
+	if !ok || account.LedgerID != ledgerID || account.DeletedAt != nil {
+		return models.Account{}, ErrNotFound
+	}
+	return account, nil
+}
+
+func (r *memoryAccountRepository) MaxOrder(ctx context.Context, ledgerID primitive.ObjectID) (int, error) {
+	accounts, _ := r.List(ctx, ledgerID)
+	if len(accounts) == 0 {
+		return 0, nil
+	}
+	return accounts[len(accounts)-1].Order, nil
+}
+
+func (r *memoryAccountRepository) Create(ctx context.Context, account models.Account) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	if account.ID.IsZero() {
+		account.ID = primitive.NewObjectID()
+	}
+	r.store.accounts[account.ID] = account
+	return nil
+}
+
+func (r *memoryAccountRepository) Update(ctx context.Context, ledgerID, id primitive.ObjectID, changes AccountUpdate) (models.Account, models.Account, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	before, ok := r.store.accounts[id]
+	if !ok || before.LedgerID != ledgerID || before.DeletedAt != nil {
+		return models.Account{}, models.Account{}, ErrNotFound
+	}
+	after := before
+	after.UpdatedAt = time.Now()
+	if changes.Name != nil {
+		after.Name = *changes.Name
+	}
+	if changes.Type != nil {
+		after.Type = *changes.Type
+	}
+	if changes.Currency != nil {
+		after.Currency = *changes.Currency
+	}
+	if changes.OpeningBalance != nil {
+		after.OpeningBalance = *changes.OpeningBalance
+	}
+	if changes.OpeningDate != nil {
+		after.OpeningDate = *changes.OpeningDate
+	}
+	if changes.Order != nil {
+		after.Order = *changes.Order
+	}
+	if changes.Archived != nil {
+		after.Archived = *changes.Archived
+	}
+	r.store.accounts[id] = after
+	return before, after, nil
+}
+
+func (r *memoryAccountRepository) Delete(ctx context.Context, ledgerID, id primitive.ObjectID) (models.Account, error) {
+	return r.softDelete(ledgerID, id)
+}
+
+// ---- Budgets ----
+
+type memoryBudgetRepository struct {
+	store *memoryStore
+	memoryTrash[models.Budget]
+}
+
+func (r *memoryBudgetRepository) ListByMonth(ctx context.Context, ledgerID primitive.ObjectID, yearMonth string) ([]models.Budget, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	budgets := []models.Budget{}
+	for _, budget := range r.store.budgets {
+		if budget.LedgerID == ledgerID && budget.YearMonth == yearMonth && budget.DeletedAt == nil {
+			budgets = append(budgets, budget)
+		}
+	}
+	sort.SliceStable(budgets, func(i, j int) bool { return budgets[i].ID.Hex() < budgets[j].ID.Hex() })
+	return budgets, nil
+}
+
+func (r *memoryBudgetRepository) Upsert(ctx context.Context, budget models.Budget) (*models.Budget, models.Budget, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for id, existing := range r.store.budgets {
+		if existing.LedgerID == budget.LedgerID && existing.YearMonth == budget.YearMonth && existing.CategoryID == budget.CategoryID && existing.DeletedAt == nil {
+			before := existing
+			budget.ID = id
+			r.store.budgets[id] = budget
+			return &before, budget, nil
+		}
+	}
+
+	if budget.ID.IsZero() {
+		budget.ID = primitive.NewObjectID()
+	}
+	r.store.budgets[budget.ID] = budget
+	return nil, budget, nil
+}
+
+func (r *memoryBudgetRepository) Find(ctx context.Context, ledgerID primitive.ObjectID, yearMonth string, categoryID primitive.ObjectID) (models.Budget, error) {
+	budgets, _ := r.ListByMonth(ctx, ledgerID, yearMonth)
+	for _, budget := range budgets {
+		if budget.CategoryID == categoryID {
+			return budget, nil
+		}
+	}
+	return models.Budget{}, ErrNotFound
+}
+
+func (r *memoryBudgetRepository) Delete(ctx context.Context, ledgerID, id primitive.ObjectID) (models.Budget, error) {
+	return r.softDelete(ledgerID, id)
+}
+
+func (r *memoryBudgetRepository) CountByCategory(ctx context.Context, ledgerID, categoryID primitive.ObjectID) (int64, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var count int64
+	for _, budget := range r.store.budgets {
+		if budget.LedgerID == ledgerID && budget.CategoryID == categoryID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *memoryBudgetRepository) MergeCategory(ctx context.Context, ledgerID, from, to primitive.ObjectID) (int64, int64, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	// 同月份 to 已有的預算
+	existing := make(map[string]bool)
+	for _, budget := range r.store.budgets {
+		if budget.LedgerID == ledgerID && budget.CategoryID == to && budget.DeletedAt == nil {
+			existing[budget.YearMonth] = true
+		}
+	}
+
+	var moved, trashed int64
+	now := time.Now()
+	for id, budget := range r.store.budgets {
+		if budget.LedgerID != ledgerID || budget.CategoryID != from {
+			continue
+		}
+		if budget.DeletedAt == nil && existing[budget.YearMonth] {
+			deletedAt := now
+			budget.DeletedAt = &deletedAt
+			trashed++
+		} else if budget.DeletedAt == nil {
+			moved++
+		}
+		budget.CategoryID = to
+		r.store.budgets[id] = budget
+	}
+	return moved, trashed, nil
+}
+
+// ---- Fixed Expenses ----
+
+type memoryFixedExpenseRepository struct {
+	store *memoryStore
+	memoryTrash[models.FixedExpense]
+	memoryCategoryDependents[models.FixedExpense]
+	memoryAccountDependents[models.FixedExpense]
+}
+
+func (r *memoryFixedExpenseRepository) filter(match func(models.FixedExpense) bool) []models.FixedExpense {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	expenses := []models.FixedExpense{}
+	for _, expense := range r.store.fixedExpenses {
+		if expense.DeletedAt == nil && match(expense) {
+			expenses = append(expenses, expense)
+		}
+	}
+	sort.SliceStable(expenses, func(i, j int) bool { return expenses[i].ID.Hex() < expenses[j].ID.Hex() })
+	return expenses
+}
+
+func (r *memoryFixedExpenseRepository) List(ctx context.Context, ledgerID primitive.ObjectID) ([]models.FixedExpense, error) {
+	return r.filter(func(e models.FixedExpense) bool { return e.LedgerID == ledgerID }), nil
+}
+
+func (r *memoryFixedExpenseRepository) Get(ctx context.Context, ledgerID, id primitive.ObjectID) (models.FixedExpense, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	expense, ok := r.store.fixedExpenses[id]
+	if !ok || expense.LedgerID != ledgerID || expense.DeletedAt != nil {
+		return models.FixedExpense{}, ErrNotFound
+	}
+	return expense, nil
+}
+
+func (r *memoryFixedExpenseRepository) ListByDay(ctx context.Context, day int) ([]models.FixedExpense, error) {
+	return r.filter(func(e models.FixedExpense) bool { return e.Day == day }), nil
+}
+
+func (r *memoryFixedExpenseRepository) MaxOrder(ctx context.Context, ledgerID primitive.ObjectID) (int, error) {
+	maxOrder := 0
+	for _, expense := range r.filter(func(e models.FixedExpense) bool { return e.LedgerID == ledgerID }) {
+		if expense.Order > maxOrder {
+			maxOrder = expense.Order
+		}
+	}
+	return maxOrder, nil
+}
+
+func (r *memoryFixedExpenseRepository) Create(ctx context.Context, expense models.FixedExpense) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	if expense.ID.IsZero() {
+		expense.ID = primitive.NewObjectID()
+	}
+	r.store.fixedExpenses[expense.ID] = expense
+	return nil
+}
+
+func (r *memoryFixedExpenseRepository) Update(ctx context.Context, ledgerID, id primitive.ObjectID, changes FixedExpenseUpdate) (models.FixedExpense, models.FixedExpense, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	before, ok := r.store.fixedExpenses[id]
+	if !ok || before.LedgerID != ledgerID || before.DeletedAt != nil {
+		return models.FixedExpense{}, models.FixedExpense{}, ErrNotFound
+	}
+	after := before
+	after.UpdatedAt = time.Now()
+	if changes.Order != nil {
+		after.Order = *changes.Order
+	}
+	if changes.Amount != nil {
+		after.Amount = *changes.Amount
+	}
+	if changes.Day != nil {
+		after.Day = *changes.Day
+	}
+	if changes.Currency != nil {
+		after.Currency = *changes.Currency
+	}
+	if changes.Note != nil {
+		after.Note = *changes.Note
+	}
+	if changes.Type != nil {
+		after.Type = *changes.Type
+	}
+	if changes.CategoryID != nil {
+		after.CategoryID = *changes.CategoryID
+	}
+	if changes.AccountID != nil {
+		after.AccountID = nil
+		if !changes.AccountID.IsZero() {
+			accountID := *changes.AccountID
+			after.AccountID = &accountID
+		}
+	}
+	r.store.fixedExpenses[id] = after
+	return before, after, nil
+}
+
+func (r *memoryFixedExpenseRepository) Delete(ctx context.Context, ledgerID, id primitive.ObjectID) (models.FixedExpense, error) {
+	return r.softDelete(ledgerID, id)
+}
+
+// ---- Exchange Rates ----
+
+type memoryExchangeRateRepository struct {
+	store *memoryStore
+}
+
+func (r *memoryExchangeRateRepository) Upsert(ctx context.Context, rate models.ExchangeRate) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	key := rate.Base + "/" + rate.Quote + "/" + rate.Date
+	if existing, ok := r.store.exchangeRates[key]; ok {
+		if rate.Carried && !existing.Carried {
+			return nil
+		}
+		rate.ID = existing.ID
+	} else if rate.ID.IsZero() {
+		rate.ID = primitive.NewObjectID()
+	}
+	r.store.exchangeRates[key] = rate
+	return nil
+}
+
+func (r *memoryExchangeRateRepository) Latest(ctx context.Context, base, quote, date string) (models.ExchangeRate, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var latest models.ExchangeRate
+	found := false
+	for _, rate := range r.store.exchangeRates {
+		if rate.Base != base || rate.Quote != quote || rate.Date > date {
+			continue
+		}
+		if !found || rate.Date > latest.Date {
+			latest = rate
+			found = true
+		}
+	}
+	if !found {
+		return models.ExchangeRate{}, ErrNotFound
+	}
+	return latest, nil
+}
+
+// ---- Audit Log ----
+
+type memoryAuditLogRepository struct {
+	store *memoryStore
+}
+
+func (r *memoryAuditLogRepository) Insert(ctx context.Context, entry models.AuditLog) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	r.store.auditLogs = append(r.store.auditLogs, entry)
+	return nil
+}
+
+// ---- User Settings ----
+
+type memoryUserSettingsRepository struct {
+	store *memoryStore
+}
+
+func (r *memoryUserSettingsRepository) BaseCurrency(ctx context.Context, username string) (string, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+	return r.store.baseCurrencies[username], nil
+}
+
+func (r *memoryUserSettingsRepository) SetBaseCurrency(ctx context.Context, username, currency string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	r.store.baseCurrencies[username] = currency
+	return nil
+}
@@ -0,0 +1,351 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"server/models"
+	"sort"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 這些測試確認記憶體實作與 MongoDB 實作的查詢語意一致 (排序、分頁、篩選、垃圾桶與帳本隔離)，
+// controllers 的單元測試才能以記憶體 repositories 代替資料庫
+
+// ids 依序取出交易 ID，方便比對順序
+func ids(transactions []models.Transaction) []primitive.ObjectID {
+	result := make([]primitive.ObjectID, 0, len(transactions))
+	for _, tx := range transactions {
+		result = append(result, tx.ID)
+	}
+	return result
+}
+
+// transactionFixture 建立一個帳本的交易，另外放一筆已刪除的交易與一筆其他帳本的交易
+type transactionFixture struct {
+	repos    Repositories
+	ledgerID primitive.ObjectID
+	food     primitive.ObjectID
+	salary   primitive.ObjectID
+	// 三月的交易，依日期由舊到新
+	march1, march5, march6, march10 primitive.ObjectID
+}
+
+func newTransactionFixture(t *testing.T) transactionFixture {
+	t.Helper()
+	ctx := context.Background()
+	f := transactionFixture{
+		repos:    NewMemoryRepositories(),
+		ledgerID: primitive.NewObjectID(),
+		food:     primitive.NewObjectID(),
+		salary:   primitive.NewObjectID(),
+	}
+
+	create := func(ledgerID, categoryID primitive.ObjectID, amount models.Money, currency, date string, tags ...string) primitive.ObjectID {
+		t.Helper()
+		tx := models.Transaction{
+			ID:         primitive.NewObjectID(),
+			LedgerID:   ledgerID,
+			CategoryID: categoryID,
+			Amount:     amount,
+			Currency:   currency,
+			Date:       date,
+			Tags:       tags,
+		}
+		if err := f.repos.Transactions.Create(ctx, tx); err != nil {
+			t.Fatal(err)
+		}
+		return tx.ID
+	}
+
+	f.march1 = create(f.ledgerID, f.food, 10000, "TWD", "2026-03-01", "trip")
+	f.march5 = create(f.ledgerID, f.food, 25000, "TWD", "2026-03-05", "trip", "tokyo")
+	f.march6 = create(f.ledgerID, f.food, 5000, "USD", "2026-03-06")
+	f.march10 = create(f.ledgerID, f.salary, 100000, "TWD", "2026-03-10")
+	create(f.ledgerID, f.food, 7000, "TWD", "2026-04-01", "trip")
+	create(primitive.NewObjectID(), f.food, 50000, "TWD", "2026-03-02", "trip")
+
+	trashed := create(f.ledgerID, f.food, 99900, "TWD", "2026-03-03", "trip")
+	if _, err := f.repos.Transactions.Delete(ctx, f.ledgerID, trashed); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func (f transactionFixture) march() TransactionFilter {
+	return TransactionFilter{LedgerID: f.ledgerID, StartDate: "2026-03-01", EndDate: "2026-03-31"}
+}
+
+func TestMemoryTransactionList(t *testing.T) {
+	f := newTransactionFixture(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name        string
+		skip, limit int64
+		want        []primitive.ObjectID
+	}{
+		{"依日期由新到舊", 0, 10, []primitive.ObjectID{f.march10, f.march6, f.march5, f.march1}},
+		{"分頁", 1, 2, []primitive.ObjectID{f.march6, f.march5}},
+		{"limit 為 0 代表不限筆數", 2, 0, []primitive.ObjectID{f.march5, f.march1}},
+		{"超過最後一頁", 10, 10, []primitive.ObjectID{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, total, err := f.repos.Transactions.List(ctx, f.march(), tt.skip, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 總筆數不受分頁影響，也不含已刪除與其他帳本的交易
+			if total != 4 {
+				t.Errorf("List() total = %d, want 4", total)
+			}
+			if !reflect.DeepEqual(ids(got), tt.want) {
+				t.Errorf("List() = %v, want %v", ids(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryTransactionFind(t *testing.T) {
+	f := newTransactionFixture(t)
+	ctx := context.Background()
+
+	withFilter := func(edit func(*TransactionFilter)) TransactionFilter {
+		filter := f.march()
+		edit(&filter)
+		return filter
+	}
+
+	tests := []struct {
+		name   string
+		filter TransactionFilter
+		want   []primitive.ObjectID
+	}{
+		{
+			name:   "不限日期",
+			filter: TransactionFilter{LedgerID: f.ledgerID, CategoryIDs: []primitive.ObjectID{f.salary}},
+			want:   []primitive.ObjectID{f.march10},
+		},
+		{
+			name:   "日期兩端皆包含",
+			filter: TransactionFilter{LedgerID: f.ledgerID, StartDate: "2026-03-05", EndDate: "2026-03-06"},
+			want:   []primitive.ObjectID{f.march6, f.march5},
+		},
+		{
+			name:   "類別",
+			filter: withFilter(func(filter *TransactionFilter) { filter.CategoryIDs = []primitive.ObjectID{f.food} }),
+			want:   []primitive.ObjectID{f.march6, f.march5, f.march1},
+		},
+		{
+			name:   "含任一標籤",
+			filter: withFilter(func(filter *TransactionFilter) { filter.TagsAny = []string{"tokyo", "missing"} }),
+			want:   []primitive.ObjectID{f.march5},
+		},
+		{
+			name:   "含所有標籤",
+			filter: withFilter(func(filter *TransactionFilter) { filter.TagsAll = []string{"trip", "tokyo"} }),
+			want:   []primitive.ObjectID{f.march5},
+		},
+		{
+			name:   "不含標籤",
+			filter: withFilter(func(filter *TransactionFilter) { filter.TagsNone = []string{"trip"} }),
+			want:   []primitive.ObjectID{f.march10, f.march6},
+		},
+		{
+			name:   "沒有符合的交易時回傳空陣列",
+			filter: withFilter(func(filter *TransactionFilter) { filter.AccountIDs = []primitive.ObjectID{primitive.NewObjectID()} }),
+			want:   []primitive.ObjectID{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := f.repos.Transactions.Find(ctx, tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(ids(got), tt.want) {
+				t.Errorf("Find() = %v, want %v", ids(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryTransactionSumByCategory(t *testing.T) {
+	f := newTransactionFixture(t)
+	ctx := context.Background()
+
+	// 同一類別、幣別、日期再加一筆，確認會合併成一組
+	if err := f.repos.Transactions.Create(ctx, models.Transaction{
+		LedgerID: f.ledgerID, CategoryID: f.food, Amount: 1500, Currency: "TWD", Date: "2026-03-05",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := f.repos.Transactions.SumByCategory(ctx, f.march())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// MongoDB 的 $group 不保證順序，比對前先排序
+	sort.Slice(got, func(i, j int) bool { return got[i].Date < got[j].Date })
+
+	want := []CategoryTotal{
+		{CategoryID: f.food, Currency: "TWD", Date: "2026-03-01", Total: 10000, Count: 1},
+		{CategoryID: f.food, Currency: "TWD", Date: "2026-03-05", Total: 26500, Count: 2},
+		{CategoryID: f.food, Currency: "USD", Date: "2026-03-06", Total: 5000, Count: 1},
+		{CategoryID: f.salary, Currency: "TWD", Date: "2026-03-10", Total: 100000, Count: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SumByCategory() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestMemoryCategoryCRUD(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepositories().Categories
+	ledgerID := primitive.NewObjectID()
+	otherLedger := primitive.NewObjectID()
+
+	if order, err := repo.MaxOrder(ctx, ledgerID); err != nil || order != 0 {
+		t.Fatalf("MaxOrder() of an empty ledger = %d, %v, want 0", order, err)
+	}
+
+	transport := models.Category{ID: primitive.NewObjectID(), LedgerID: ledgerID, Name: "交通", Type: "expense", Order: 2}
+	food := models.Category{ID: primitive.NewObjectID(), LedgerID: ledgerID, Name: "餐飲", Type: "expense", Order: 1}
+	salary := models.Category{ID: primitive.NewObjectID(), LedgerID: ledgerID, Name: "薪資", Type: "income", Order: 2}
+	other := models.Category{ID: primitive.NewObjectID(), LedgerID: otherLedger, Name: "其他", Type: "expense", Order: 9}
+	if err := repo.Create(ctx, transport); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.CreateMany(ctx, []models.Category{food, salary, other}); err != nil {
+		t.Fatal(err)
+	}
+
+	list := func() []string {
+		t.Helper()
+		categories, err := repo.List(ctx, ledgerID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := []string{}
+		for _, category := range categories {
+			names = append(names, category.Name)
+		}
+		return names
+	}
+
+	// 依 order、name 排序，不含其他帳本的類別
+	if got, want := list(), []string{"餐飲", "交通", "薪資"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("List() = %v, want %v", got, want)
+	}
+	if order, err := repo.MaxOrder(ctx, ledgerID); err != nil || order != 2 {
+		t.Fatalf("MaxOrder() = %d, %v, want 2", order, err)
+	}
+	if _, err := repo.Get(ctx, ledgerID, other.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get() from another ledger error = %v, want ErrNotFound", err)
+	}
+
+	name := "外食"
+	archived := true
+	before, after, err := repo.Update(ctx, ledgerID, food.ID, CategoryUpdate{Name: &name, Archived: &archived, ParentID: &transport.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before.Name != "餐飲" || after.Name != "外食" || !after.Archived || after.ParentID == nil || *after.ParentID != transport.ID ||
+		after.Type != "expense" || after.Order != 1 {
+		t.Fatalf("Update() = %+v -> %+v", before, after)
+	}
+	// 封存的類別仍會列出
+	if got, want := list(), []string{"外食", "交通", "薪資"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("List() after update = %v, want %v", got, want)
+	}
+
+	// NilObjectID 代表移到最上層
+	topLevel := primitive.NilObjectID
+	if _, after, err := repo.Update(ctx, ledgerID, food.ID, CategoryUpdate{ParentID: &topLevel}); err != nil || after.ParentID != nil {
+		t.Fatalf("Update() to top level = %+v, %v", after, err)
+	}
+	if _, _, err := repo.Update(ctx, otherLedger, food.ID, CategoryUpdate{Name: &name}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Update() from another ledger error = %v, want ErrNotFound", err)
+	}
+
+	deleted, err := repo.Delete(ctx, ledgerID, salary.ID)
+	if err != nil || deleted.ID != salary.ID || deleted.DeletedAt != nil {
+		t.Fatalf("Delete() = %+v, %v", deleted, err)
+	}
+	if _, err := repo.Get(ctx, ledgerID, salary.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get() of a trashed category error = %v, want ErrNotFound", err)
+	}
+	if _, err := repo.Delete(ctx, ledgerID, salary.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Delete() twice error = %v, want ErrNotFound", err)
+	}
+	if got, want := list(), []string{"外食", "交通"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("List() after delete = %v, want %v", got, want)
+	}
+	if trash, err := repo.ListDeleted(ctx, ledgerID); err != nil || len(trash) != 1 || trash[0].ID != salary.ID {
+		t.Fatalf("ListDeleted() = %+v, %v", trash, err)
+	}
+}
+
+func TestMemoryBudgetCRUD(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepositories().Budgets
+	ledgerID := primitive.NewObjectID()
+	food := primitive.NewObjectID()
+	transport := primitive.NewObjectID()
+
+	before, created, err := repo.Upsert(ctx, models.Budget{LedgerID: ledgerID, CategoryID: food, YearMonth: "2026-03", Amount: 500000})
+	if err != nil || before != nil || created.ID.IsZero() {
+		t.Fatalf("Upsert() new budget = %v, %+v, %v", before, created, err)
+	}
+
+	// 同帳本、同月份、同類別覆蓋原本的預算
+	before, updated, err := repo.Upsert(ctx, models.Budget{LedgerID: ledgerID, CategoryID: food, YearMonth: "2026-03", Amount: 600000})
+	if err != nil || before == nil || before.Amount != 500000 || updated.ID != created.ID || updated.Amount != 600000 {
+		t.Fatalf("Upsert() existing budget = %+v, %+v, %v", before, updated, err)
+	}
+
+	// 其他月份、其他類別與其他帳本各自獨立
+	for _, budget := range []models.Budget{
+		{LedgerID: ledgerID, CategoryID: food, YearMonth: "2026-04", Amount: 100},
+		{LedgerID: ledgerID, CategoryID: transport, YearMonth: "2026-03", Amount: 200},
+		{LedgerID: primitive.NewObjectID(), CategoryID: food, YearMonth: "2026-03", Amount: 300},
+	} {
+		if before, _, err := repo.Upsert(ctx, budget); err != nil || before != nil {
+			t.Fatalf("Upsert(%+v) = %+v, %v, want a new budget", budget, before, err)
+		}
+	}
+	if budgets, err := repo.ListByMonth(ctx, ledgerID, "2026-03"); err != nil || len(budgets) != 2 {
+		t.Fatalf("ListByMonth() = %+v, %v, want 2 budgets", budgets, err)
+	}
+
+	found, err := repo.Find(ctx, ledgerID, "2026-03", food)
+	if err != nil || found.ID != created.ID || found.Amount != 600000 {
+		t.Fatalf("Find() = %+v, %v", found, err)
+	}
+	if _, err := repo.Find(ctx, ledgerID, "2026-05", food); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Find() of a missing month error = %v, want ErrNotFound", err)
+	}
+
+	if _, err := repo.Delete(ctx, ledgerID, created.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Find(ctx, ledgerID, "2026-03", food); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Find() of a trashed budget error = %v, want ErrNotFound", err)
+	}
+	if budgets, err := repo.ListByMonth(ctx, ledgerID, "2026-03"); err != nil || len(budgets) != 1 || budgets[0].CategoryID != transport {
+		t.Fatalf("ListByMonth() after delete = %+v, %v", budgets, err)
+	}
+
+	// 垃圾桶中的預算不算重複，同類別可以再設定一筆新的
+	before, recreated, err := repo.Upsert(ctx, models.Budget{LedgerID: ledgerID, CategoryID: food, YearMonth: "2026-03", Amount: 700000})
+	if err != nil || before != nil || recreated.ID == created.ID {
+		t.Fatalf("Upsert() after delete = %+v, %+v, %v, want a new budget", before, recreated, err)
+	}
+	// 垃圾桶中的預算仍算在類別的預算筆數內
+	if count, err := repo.CountByCategory(ctx, ledgerID, food); err != nil || count != 3 {
+		t.Fatalf("CountByCategory() = %d, %v, want 3", count, err)
+	}
+}
@@ -0,0 +1,1020 @@
+package repository
+
+import (
+	"context"
+	"server/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// NewMongoRepositories 建立以 MongoDB 為儲存的 repositories
+func NewMongoRepositories(db *mongo.Database) Repositories {
+	transactions := db.Collection("transactions")
+	categories := db.Collection("categories")
+	budgets := db.Collection("budgets")
+	fixedExpenses := db.Collection("fixed_expenses")
+	revisions := db.Collection("transaction_revisions")
+	accounts := db.Collection("accounts")
+	return Repositories{
+		Transactions: &mongoTransactionRepository{
+			collection:              transactions,
+			mongoTrash:              mongoTrash[models.Transaction]{transactions},
+			mongoCategoryDependents: mongoCategoryDependents{transactions},
+			mongoAccountDependents:  mongoAccountDependents{transactions},
+			mongoTagDependents:      mongoTagDependents{transactions},
+		},
+		TransactionRevisions: &mongoTransactionRevisionRepository{
+			collection:         revisions,
+			transactions:       transactions,
+			mongoTagDependents: mongoTagDependents{revisions},
+		},
+		Categories: &mongoCategoryRepository{collection: categories, mongoTrash: mongoTrash[models.Category]{categories}},
+		Budgets:    &mongoBudgetRepository{collection: budgets, mongoTrash: mongoTrash[models.Budget]{budgets}},
+		FixedExpenses: &mongoFixedExpenseRepository{
+			collection:              fixedExpenses,
+			mongoTrash:              mongoTrash[models.FixedExpense]{fixedExpenses},
+			mongoCategoryDependents: mongoCategoryDependents{fixedExpenses},
+			mongoAccountDependents:  mongoAccountDependents{fixedExpenses},
+		},
+		Accounts:      &mongoAccountRepository{collection: accounts, mongoTrash: mongoTrash[models.Account]{accounts}},
+		ExchangeRates: &mongoExchangeRateRepository{collection: db.Collection("exchange_rates")},
+		AuditLogs:     &mongoAuditLogRepository{collection: db.Collection("audit_log")},
+		UserSettings:  &mongoUserSettingsRepository{collection: db.Collection("users")},
+	}
+}
+
+// notFound 將 mongo.ErrNoDocuments 轉為 ErrNotFound
+func notFound(err error) error {
+	if err == mongo.ErrNoDocuments {
+		return ErrNotFound
+	}
+	return err
+}
+
+// live 加上「未刪除」條件 (deleted_at 不存在或為 null)
+func live(filter bson.M) bson.M {
+	filter["deleted_at"] = nil
+	return filter
+}
+
+// withoutTransfers 排除轉帳 (轉帳沒有類別，不計入收入與支出)
+func withoutTransfers(filter bson.M) bson.M {
+	filter["kind"] = bson.M{"$nin": bson.A{models.TransactionTransferOut, models.TransactionTransferIn}}
+	return filter
+}
+
+// ---- Trash ----
+
+// mongoTrash 各 collection 共用的垃圾桶操作
+type mongoTrash[T any] struct {
+	collection *mongo.Collection
+}
+
+// softDelete 標記 deleted_at，回傳刪除前的資料
+func (t mongoTrash[T]) softDelete(ctx context.Context, ledgerID, id primitive.ObjectID) (T, error) {
+	var deleted T
+	err := t.collection.FindOneAndUpdate(ctx,
+		live(bson.M{"_id": id, "ledger_id": ledgerID}),
+		bson.M{"$set": bson.M{"deleted_at": time.Now()}},
+	).Decode(&deleted)
+	return deleted, notFound(err)
+}
+
+func (t mongoTrash[T]) ListDeleted(ctx context.Context, ledgerID primitive.ObjectID) ([]T, error) {
+	cursor, err := t.collection.Find(ctx,
+		bson.M{"ledger_id": ledgerID, "deleted_at": bson.M{"$ne": nil}},
+		options.Find().SetSort(bson.D{{Key: "deleted_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	items := []T{}
+	if err = cursor.All(ctx, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (t mongoTrash[T]) Restore(ctx context.Context, ledgerID, id primitive.ObjectID) (T, error) {
+	var restored T
+	err := t.collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "ledger_id": ledgerID, "deleted_at": bson.M{"$ne": nil}},
+		bson.M{"$unset": bson.M{"deleted_at": ""}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&restored)
+	return restored, notFound(err)
+}
+
+func (t mongoTrash[T]) Purge(ctx context.Context, ledgerID, id primitive.ObjectID) (T, error) {
+	var purged T
+	err := t.collection.FindOneAndDelete(ctx,
+		bson.M{"_id": id, "ledger_id": ledgerID, "deleted_at": bson.M{"$ne": nil}},
+	).Decode(&purged)
+	return purged, notFound(err)
+}
+
+func (t mongoTrash[T]) PurgeDeletedBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	result, err := t.collection.DeleteMany(ctx, bson.M{"deleted_at": bson.M{"$lt": cutoff}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// ---- Category dependents ----
+
+// mongoCategoryDependents 交易與固定支出共用的類別參照操作
+type mongoCategoryDependents struct {
+	collection *mongo.Collection
+}
+
+func (d mongoCategoryDependents) CountByCategory(ctx context.Context, ledgerID, categoryID primitive.ObjectID) (int64, error) {
+	return d.collection.CountDocuments(ctx, bson.M{"ledger_id": ledgerID, "category_id": categoryID})
+}
+
+func (d mongoCategoryDependents) ReassignCategory(ctx context.Context, ledgerID, from, to primitive.ObjectID) (int64, error) {
+	result, err := d.collection.UpdateMany(ctx,
+		bson.M{"ledger_id": ledgerID, "category_id": from},
+		bson.M{"$set": bson.M{"category_id": to}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// ---- Account dependents ----
+
+// mongoAccountDependents 交易與固定支出共用的帳戶參照操作
+type mongoAccountDependents struct {
+	collection *mongo.Collection
+}
+
+func (d mongoAccountDependents) CountByAccount(ctx context.Context, ledgerID, accountID primitive.ObjectID) (int64, error) {
+	return d.collection.CountDocuments(ctx, bson.M{"ledger_id": ledgerID, "account_id": accountID})
+}
+
+// ---- Tag dependents ----
+
+// mongoTagDependents 交易與交易舊版本共用的標籤操作
+type mongoTagDependents struct {
+	collection *mongo.Collection
+}
+
+func (d mongoTagDependents) RenameTag(ctx context.Context, ledgerID primitive.ObjectID, from, to string) (int64, error) {
+	// 已有 to 的資料直接移除 from，其餘將 from 改為 to
+	merged, err := d.collection.UpdateMany(ctx,
+		bson.M{"ledger_id": ledgerID, "tags": bson.M{"$all": bson.A{from, to}}},
+		bson.M{"$pull": bson.M{"tags": from}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	renamed, err := d.collection.UpdateMany(ctx,
+		bson.M{"ledger_id": ledgerID, "tags": from},
+		bson.M{"$set": bson.M{"tags.$": to}},
+	)
+	if err != nil {
+		return merged.ModifiedCount, err
+	}
+	return merged.ModifiedCount + renamed.ModifiedCount, nil
+}
+
+func (d mongoTagDependents) DeleteTag(ctx context.Context, ledgerID primitive.ObjectID, tag string) (int64, error) {
+	result, err := d.collection.UpdateMany(ctx,
+		bson.M{"ledger_id": ledgerID, "tags": tag},
+		bson.M{"$pull": bson.M{"tags": tag}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// ---- Transactions ----
+
+type mongoTransactionRepository struct {
+	collection *mongo.Collection
+	mongoTrash[models.Transaction]
+	mongoCategoryDependents
+	mongoAccountDependents
+	mongoTagDependents
+}
+
+func (r *mongoTransactionRepository) filter(f TransactionFilter) bson.M {
+	filter := live(bson.M{"ledger_id": f.LedgerID})
+	if f.StartDate != "" || f.EndDate != "" {
+		dateFilter := bson.M{}
+		if f.StartDate != "" {
+			dateFilter["$gte"] = f.StartDate
+		}
+		if f.EndDate != "" {
+			dateFilter["$lte"] = f.EndDate
+		}
+		filter["date"] = dateFilter
+	}
+	if len(f.CategoryIDs) > 0 {
+		filter["category_id"] = bson.M{"$in": f.CategoryIDs}
+	}
+	if len(f.AccountIDs) > 0 {
+		filter["account_id"] = bson.M{"$in": f.AccountIDs}
+	}
+	tags := bson.M{}
+	if len(f.TagsAny) > 0 {
+		tags["$in"] = f.TagsAny
+	}
+	if len(f.TagsAll) > 0 {
+		tags["$all"] = f.TagsAll
+	}
+	if len(f.TagsNone) > 0 {
+		tags["$nin"] = f.TagsNone
+	}
+	if len(tags) > 0 {
+		filter["tags"] = tags
+	}
+	return filter
+}
+
+func (r *mongoTransactionRepository) Create(ctx context.Context, tx models.Transaction) error {
+	if tx.Version == 0 {
+		tx.Version = 1
+	}
+	_, err := r.collection.InsertOne(ctx, tx)
+	return err
+}
+
+func (r *mongoTransactionRepository) Get(ctx context.Context, ledgerID, id primitive.ObjectID) (models.Transaction, error) {
+	var tx models.Transaction
+	err := r.collection.FindOne(ctx, live(bson.M{"_id": id, "ledger_id": ledgerID})).Decode(&tx)
+	return tx, notFound(err)
+}
+
+func (r *mongoTransactionRepository) List(ctx context.Context, f TransactionFilter, skip, limit int64) ([]models.Transaction, int64, error) {
+	filter := r.filter(f)
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "date", Value: -1}}).
+		SetSkip(skip).
+		SetLimit(limit)
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	transactions := []models.Transaction{}
+	if err = cursor.All(ctx, &transactions); err != nil {
+		return nil, 0, err
+	}
+	return transactions, total, nil
+}
+
+func (r *mongoTransactionRepository) Find(ctx context.Context, f TransactionFilter) ([]models.Transaction, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "date", Value: -1}})
+	if len(f.CategoryIDs) > 0 {
+		// 使用索引優化查詢
+		opts.SetHint("idx_ledger_cat_date")
+	}
+	cursor, err := r.collection.Find(ctx, r.filter(f), opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	transactions := []models.Transaction{}
+	if err = cursor.All(ctx, &transactions); err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
+func (r *mongoTransactionRepository) Update(ctx context.Context, ledgerID, id primitive.ObjectID, changes models.Transaction) (models.Transaction, models.Transaction, error) {
+	set := bson.M{
+		"amount":      changes.Amount,
+		"category_id": changes.CategoryID,
+		"date":        changes.Date,
+		"note":        changes.Note,
+		"updated_at":  changes.UpdatedAt,
+	}
+	if changes.Currency != "" {
+		set["currency"] = changes.Currency
+	}
+	if changes.Tags != nil {
+		set["tags"] = changes.Tags
+	}
+	update := bson.M{"$set": set, "$inc": bson.M{"version": 1}}
+	if changes.AccountID != nil {
+		if changes.AccountID.IsZero() {
+			update["$unset"] = bson.M{"account_id": ""}
+		} else {
+			set["account_id"] = *changes.AccountID
+		}
+	}
+
+	var before, after models.Transaction
+	err := r.collection.FindOneAndUpdate(ctx, live(bson.M{"_id": id, "ledger_id": ledgerID}), update).Decode(&before)
+	if err != nil {
+		return before, after, notFound(err)
+	}
+	err = r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&after)
+	return before, after, notFound(err)
+}
+
+func (r *mongoTransactionRepository) Delete(ctx context.Context, ledgerID, id primitive.ObjectID) (models.Transaction, error) {
+	return r.softDelete(ctx, ledgerID, id)
+}
+
+func (r *mongoTransactionRepository) SumByCategory(ctx context.Context, f TransactionFilter) ([]CategoryTotal, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: withoutTransfers(r.filter(f))}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{
+				{Key: "c", Value: "$category_id"},
+				{Key: "cur", Value: "$currency"},
+				{Key: "d", Value: "$date"},
+			}},
+			{Key: "total", Value: bson.D{{Key: "$sum", Value: "$amount"}}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+		{{Key: "$project", Value: bson.D{
+			{Key: "_id", Value: 0},
+			{Key: "category_id", Value: "$_id.c"},
+			{Key: "currency", Value: "$_id.cur"},
+			{Key: "date", Value: "$_id.d"},
+			{Key: "total", Value: 1},
+			{Key: "count", Value: 1},
+		}}},
+	}
+
+	opts := options.Aggregate()
+	if len(f.CategoryIDs) > 0 {
+		// 使用索引優化查詢
+		opts.SetHint("idx_ledger_cat_date")
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	totals := []CategoryTotal{}
+	if err = cursor.All(ctx, &totals); err != nil {
+		return nil, err
+	}
+	return totals, nil
+}
+
+func (r *mongoTransactionRepository) SumByTag(ctx context.Context, f TransactionFilter) ([]TagTotal, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: withoutTransfers(r.filter(f))}},
+		{{Key: "$unwind", Value: "$tags"}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{
+				{Key: "t", Value: "$tags"},
+				{Key: "c", Value: "$category_id"},
+				{Key: "cur", Value: "$currency"},
+				{Key: "d", Value: "$date"},
+			}},
+			{Key: "total", Value: bson.D{{Key: "$sum", Value: "$amount"}}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+		{{Key: "$project", Value: bson.D{
+			{Key: "_id", Value: 0},
+			{Key: "tag", Value: "$_id.t"},
+			{Key: "category_id", Value: "$_id.c"},
+			{Key: "currency", Value: "$_id.cur"},
+			{Key: "date", Value: "$_id.d"},
+			{Key: "total", Value: 1},
+			{Key: "count", Value: 1},
+		}}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	totals := []TagTotal{}
+	if err = cursor.All(ctx, &totals); err != nil {
+		return nil, err
+	}
+	return totals, nil
+}
+
+func (r *mongoTransactionRepository) SumByAccount(ctx context.Context, f TransactionFilter) ([]AccountTotal, error) {
+	filter := r.filter(f)
+	if _, ok := filter["account_id"]; !ok {
+		filter["account_id"] = bson.M{"$ne": nil}
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{
+				{Key: "a", Value: "$account_id"},
+				{Key: "k", Value: "$kind"},
+				{Key: "c", Value: "$category_id"},
+				{Key: "cur", Value: "$currency"},
+				{Key: "d", Value: "$date"},
+			}},
+			{Key: "total", Value: bson.D{{Key: "$sum", Value: "$amount"}}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+		{{Key: "$project", Value: bson.D{
+			{Key: "_id", Value: 0},
+			{Key: "account_id", Value: "$_id.a"},
+			{Key: "kind", Value: "$_id.k"},
+			{Key: "category_id", Value: "$_id.c"},
+			{Key: "currency", Value: "$_id.cur"},
+			{Key: "date", Value: "$_id.d"},
+			{Key: "total", Value: 1},
+			{Key: "count", Value: 1},
+		}}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	totals := []AccountTotal{}
+	if err = cursor.All(ctx, &totals); err != nil {
+		return nil, err
+	}
+	return totals, nil
+}
+
+func (r *mongoTransactionRepository) TransferLegs(ctx context.Context, ledgerID, transferID primitive.ObjectID, deleted bool) ([]models.Transaction, error) {
+	filter := bson.M{"ledger_id": ledgerID, "transfer_id": transferID}
+	if deleted {
+		filter["deleted_at"] = bson.M{"$ne": nil}
+	} else {
+		filter = live(filter)
+	}
+	cursor, err := r.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	legs := []models.Transaction{}
+	if err = cursor.All(ctx, &legs); err != nil {
+		return nil, err
+	}
+	return legs, nil
+}
+
+func (r *mongoTransactionRepository) ListTags(ctx context.Context, ledgerID primitive.ObjectID) ([]TagCount, error) {
+	cursor, err := r.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: live(bson.M{"ledger_id": ledgerID})}},
+		{{Key: "$unwind", Value: "$tags"}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$tags"},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+		{{Key: "$project", Value: bson.D{
+			{Key: "_id", Value: 0},
+			{Key: "tag", Value: "$_id"},
+			{Key: "count", Value: 1},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	tags := []TagCount{}
+	if err = cursor.All(ctx, &tags); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// ---- Transaction revisions ----
+
+type mongoTransactionRevisionRepository struct {
+	collection   *mongo.Collection
+	transactions *mongo.Collection
+	mongoTagDependents
+}
+
+func (r *mongoTransactionRevisionRepository) Create(ctx context.Context, revision models.TransactionRevision) error {
+	_, err := r.collection.InsertOne(ctx, revision)
+	return err
+}
+
+func (r *mongoTransactionRevisionRepository) List(ctx context.Context, ledgerID, transactionID primitive.ObjectID) ([]models.TransactionRevision, error) {
+	cursor, err := r.collection.Find(ctx,
+		bson.M{"ledger_id": ledgerID, "transaction_id": transactionID},
+		options.Find().SetSort(bson.D{{Key: "version", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	revisions := []models.TransactionRevision{}
+	if err = cursor.All(ctx, &revisions); err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+func (r *mongoTransactionRevisionRepository) Get(ctx context.Context, ledgerID, transactionID primitive.ObjectID, version int) (models.TransactionRevision, error) {
+	var revision models.TransactionRevision
+	err := r.collection.FindOne(ctx, bson.M{
+		"ledger_id":      ledgerID,
+		"transaction_id": transactionID,
+		"version":        version,
+	}).Decode(&revision)
+	return revision, notFound(err)
+}
+
+func (r *mongoTransactionRevisionRepository) DeleteByTransaction(ctx context.Context, ledgerID, transactionID primitive.ObjectID) error {
+	_, err := r.collection.DeleteMany(ctx, bson.M{"ledger_id": ledgerID, "transaction_id": transactionID})
+	return err
+}
+
+func (r *mongoTransactionRevisionRepository) PurgeOrphaned(ctx context.Context) (int64, error) {
+	ids, err := r.collection.Distinct(ctx, "transaction_id", bson.M{})
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	existing, err := r.transactions.Distinct(ctx, "_id", bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, err
+	}
+	result, err := r.collection.DeleteMany(ctx, bson.M{"transaction_id": bson.M{"$nin": existing}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// ---- Categories ----
+
+type mongoCategoryRepository struct {
+	collection *mongo.Collection
+	mongoTrash[models.Category]
+}
+
+func (r *mongoCategoryRepository) List(ctx context.Context, ledgerID primitive.ObjectID) ([]models.Category, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "order", Value: 1}, {Key: "name", Value: 1}})
+	cursor, err := r.collection.Find(ctx, live(bson.M{"ledger_id": ledgerID}), opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	categories := []models.Category{}
+	if err = cursor.All(ctx, &categories); err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+func (r *mongoCategoryRepository) Get(ctx context.Context, ledgerID, id primitive.ObjectID) (models.Category, error) {
+	var category models.Category
+	err := r.collection.FindOne(ctx, live(bson.M{"_id": id, "ledger_id": ledgerID})).Decode(&category)
+	return category, notFound(err)
+}
+
+func (r *mongoCategoryRepository) MaxOrder(ctx context.Context, ledgerID primitive.ObjectID) (int, error) {
+	var last models.Category
+	err := r.collection.FindOne(ctx,
+		live(bson.M{"ledger_id": ledgerID}),
+		options.FindOne().SetSort(bson.D{{Key: "order", Value: -1}}),
+	).Decode(&last)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	return last.Order, err
+}
+
+func (r *mongoCategoryRepository) Create(ctx context.Context, category models.Category) error {
+	_, err := r.collection.InsertOne(ctx, category)
+	return err
+}
+
+func (r *mongoCategoryRepository) CreateMany(ctx context.Context, categories []models.Category) error {
+	docs := make([]interface{}, 0, len(categories))
+	for _, category := range categories {
+		docs = append(docs, category)
+	}
+	_, err := r.collection.InsertMany(ctx, docs)
+	return err
+}
+
+func (r *mongoCategoryRepository) Update(ctx context.Context, ledgerID, id primitive.ObjectID, changes CategoryUpdate) (models.Category, models.Category, error) {
+	updateFields := bson.M{}
+	if changes.Name != nil {
+		updateFields["name"] = *changes.Name
+	}
+	if changes.Type != nil {
+		updateFields["type"] = *changes.Type
+	}
+	if changes.Order != nil {
+		updateFields["order"] = *changes.Order
+	}
+	if changes.Archived != nil {
+		updateFields["archived"] = *changes.Archived
+	}
+	update := bson.M{"$set": updateFields}
+	if changes.ParentID != nil {
+		if changes.ParentID.IsZero() {
+			update["$unset"] = bson.M{"parent_id": ""}
+		} else {
+			updateFields["parent_id"] = *changes.ParentID
+		}
+	}
+
+	var before, after models.Category
+	err := r.collection.FindOneAndUpdate(ctx,
+		live(bson.M{"_id": id, "ledger_id": ledgerID}),
+		update,
+	).Decode(&before)
+	if err != nil {
+		return before, after, notFound(err)
+	}
+	err = r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&after)
+	return before, after, notFound(err)
+}
+
+func (r *mongoCategoryRepository) Delete(ctx context.Context, ledgerID, id primitive.ObjectID) (models.Category, error) {
+	return r.softDelete(ctx, ledgerID, id)
+}
+
+// ---- Accounts ----
+
+type mongoAccountRepository struct {
+	collection *mongo.Collection
+	mongoTrash[models.Account]
+}
+
+func (r *mongoAccountRepository) List(ctx context.Context, ledgerID primitive.ObjectID) ([]models.Account, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "order", Value: 1}, {Key: "name", Value: 1}})
+	cursor, err := r.collection.Find(ctx, live(bson.M{"ledger_id": ledgerID}), opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	accounts := []models.Account{}
+	if err = cursor.All(ctx, &accounts); err != nil {
+		return nil, err
+	}
+	return accounts, nil
+}
+
+func (r *mongoAccountRepository) Get(ctx context.Context, ledgerID, id primitive.ObjectID) (models.Account, error) {
+	var account models.Account
+	err := r.collection.FindOne(ctx, live(bson.M{"_id": id, "ledger_id": ledgerID})).Decode(&account)
+	return account, notFound(err)
+}
+
+func (r *mongoAccountRepository) MaxOrder(ctx context.Context, ledgerID primitive.ObjectID) (int, error) {
+	var last models.Account
+	err := r.collection.FindOne(ctx,
+		live(bson.M{"ledger_id": ledgerID}),
+		options.FindOne().SetSort(bson.D{{Key: "order", Value: -1}}),
+	).Decode(&last)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	return last.Order, err
+}
+
+func (r *mongoAccountRepository) Create(ctx context.Context, account models.Account) error {
+	_, err := r.collection.InsertOne(ctx, account)
+	return err
+}
+
+func (r *mongoAccountRepository) Update(ctx context.Context, ledgerID, id primitive.ObjectID, changes AccountUpdate) (models.Account, models.Account, error) {
+	updateFields := bson.M{"updated_at": time.Now()}
+	if changes.Name != nil {
+		updateFields["name"] = *changes.Name
+	}
+	if changes.Type != nil {
+		updateFields["type"] = *changes.Type
+	}
+	if changes.Currency != nil {
+		updateFields["currency"] = *changes.Currency
+	}
+	if changes.OpeningBalance != nil {
+		updateFields["opening_balance"] = *changes.OpeningBalance
+	}
+	if changes.Order != nil {
+		updateFields["order"] = *changes.Order
+	}
+	if changes.Archived != nil {
+		updateFields["archived"] = *changes.Archived
+	}
+	update := bson.M{"$set": updateFields}
+	if changes.OpeningDate != nil {
+		if *changes.OpeningDate == "" {
+			update["$unset"] = bson.M{"opening_date": ""}
+		} else {
+			updateFields["opening_date"] = *changes.OpeningDate
+		}
+	}
+
+	var before, after models.Account
+	err := r.collection.FindOneAndUpdate(ctx,
+		live(bson.M{"_id": id, "ledger_id": ledgerID}),
+		update,
+	).Decode(&before)
+	if err != nil {
+		return before, after, notFound(err)
+	}
+	err = r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&after)
+	return before, after, notFound(err)
+}
+
+func (r *mongoAccountRepository) Delete(ctx context.Context, ledgerID, id primitive.ObjectID) (models.Account, error) {
+	return r.softDelete(ctx, ledgerID, id)
+}
+
+// ---- Budgets ----
+
+type mongoBudgetRepository struct {
+	collection *mongo.Collection
+	mongoTrash[models.Budget]
+}
+
+func (r *mongoBudgetRepository) ListByMonth(ctx context.Context, ledgerID primitive.ObjectID, yearMonth string) ([]models.Budget, error) {
+	cursor, err := r.collection.Find(ctx, live(bson.M{"year_month": yearMonth, "ledger_id": ledgerID}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	budgets := []models.Budget{}
+	if err = cursor.All(ctx, &budgets); err != nil {
+		return nil, err
+	}
+	return budgets, nil
+}
+
+func (r *mongoBudgetRepository) Upsert(ctx context.Context, budget models.Budget) (*models.Budget, models.Budget, error) {
+	// 搜尋條件：同一個月 + 同一個類別 (垃圾桶中的預算不算)
+	filter := live(bson.M{
+		"category_id": budget.CategoryID,
+		"year_month":  budget.YearMonth,
+		"ledger_id":   budget.LedgerID,
+	})
+
+	var before *models.Budget
+	var existing models.Budget
+	if err := r.collection.FindOne(ctx, filter).Decode(&existing); err == nil {
+		before = &existing
+	}
+
+	var after models.Budget
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := r.collection.FindOneAndUpdate(ctx, filter, bson.M{"$set": budget}, opts).Decode(&after)
+	return before, after, err
+}
+
+func (r *mongoBudgetRepository) Find(ctx context.Context, ledgerID primitive.ObjectID, yearMonth string, categoryID primitive.ObjectID) (models.Budget, error) {
+	var budget models.Budget
+	err := r.collection.FindOne(ctx, live(bson.M{
+		"category_id": categoryID,
+		"year_month":  yearMonth,
+		"ledger_id":   ledgerID,
+	})).Decode(&budget)
+	return budget, notFound(err)
+}
+
+func (r *mongoBudgetRepository) Delete(ctx context.Context, ledgerID, id primitive.ObjectID) (models.Budget, error) {
+	return r.softDelete(ctx, ledgerID, id)
+}
+
+func (r *mongoBudgetRepository) CountByCategory(ctx context.Context, ledgerID, categoryID primitive.ObjectID) (int64, error) {
+	return r.collection.CountDocuments(ctx, bson.M{"category_id": categoryID, "ledger_id": ledgerID})
+}
+
+func (r *mongoBudgetRepository) MergeCategory(ctx context.Context, ledgerID, from, to primitive.ObjectID) (int64, int64, error) {
+	cursor, err := r.collection.Find(ctx, live(bson.M{"category_id": from, "ledger_id": ledgerID}))
+	if err != nil {
+		return 0, 0, err
+	}
+	var budgets []models.Budget
+	if err = cursor.All(ctx, &budgets); err != nil {
+		return 0, 0, err
+	}
+
+	var moved, trashed int64
+	for _, budget := range budgets {
+		_, err := r.Find(ctx, ledgerID, budget.YearMonth, to)
+		if err == nil {
+			if _, err := r.softDelete(ctx, ledgerID, budget.ID); err != nil && err != ErrNotFound {
+				return moved, trashed, err
+			}
+			trashed++
+			continue
+		}
+		if err != ErrNotFound {
+			return moved, trashed, err
+		}
+		if _, err := r.collection.UpdateByID(ctx, budget.ID, bson.M{"$set": bson.M{"category_id": to}}); err != nil {
+			return moved, trashed, err
+		}
+		moved++
+	}
+
+	// 垃圾桶中的預算也改為新類別，復原時再檢查是否重複
+	_, err = r.collection.UpdateMany(ctx,
+		bson.M{"category_id": from, "ledger_id": ledgerID, "deleted_at": bson.M{"$ne": nil}},
+		bson.M{"$set": bson.M{"category_id": to}},
+	)
+	return moved, trashed, err
+}
+
+// ---- Fixed Expenses ----
+
+type mongoFixedExpenseRepository struct {
+	collection *mongo.Collection
+	mongoTrash[models.FixedExpense]
+	mongoCategoryDependents
+	mongoAccountDependents
+}
+
+func (r *mongoFixedExpenseRepository) find(ctx context.Context, filter bson.M) ([]models.FixedExpense, error) {
+	cursor, err := r.collection.Find(ctx, live(filter))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	expenses := []models.FixedExpense{}
+	if err = cursor.All(ctx, &expenses); err != nil {
+		return nil, err
+	}
+	return expenses, nil
+}
+
+func (r *mongoFixedExpenseRepository) List(ctx context.Context, ledgerID primitive.ObjectID) ([]models.FixedExpense, error) {
+	return r.find(ctx, bson.M{"ledger_id": ledgerID})
+}
+
+func (r *mongoFixedExpenseRepository) Get(ctx context.Context, ledgerID, id primitive.ObjectID) (models.FixedExpense, error) {
+	var expense models.FixedExpense
+	err := r.collection.FindOne(ctx, live(bson.M{"_id": id, "ledger_id": ledgerID})).Decode(&expense)
+	return expense, notFound(err)
+}
+
+func (r *mongoFixedExpenseRepository) ListByDay(ctx context.Context, day int) ([]models.FixedExpense, error) {
+	return r.find(ctx, bson.M{"day": day})
+}
+
+func (r *mongoFixedExpenseRepository) MaxOrder(ctx context.Context, ledgerID primitive.ObjectID) (int, error) {
+	var last models.FixedExpense
+	err := r.collection.FindOne(ctx,
+		live(bson.M{"ledger_id": ledgerID}),
+		options.FindOne().SetSort(bson.D{{Key: "order", Value: -1}}),
+	).Decode(&last)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	return last.Order, err
+}
+
+func (r *mongoFixedExpenseRepository) Create(ctx context.Context, expense models.FixedExpense) error {
+	_, err := r.collection.InsertOne(ctx, expense)
+	return err
+}
+
+func (r *mongoFixedExpenseRepository) Update(ctx context.Context, ledgerID, id primitive.ObjectID, changes FixedExpenseUpdate) (models.FixedExpense, models.FixedExpense, error) {
+	updateFields := bson.M{"updated_at": time.Now()}
+	if changes.Order != nil {
+		updateFields["order"] = *changes.Order
+	}
+	if changes.Amount != nil {
+		updateFields["amount"] = *changes.Amount
+	}
+	if changes.Day != nil {
+		updateFields["day"] = *changes.Day
+	}
+	if changes.Currency != nil {
+		updateFields["currency"] = *changes.Currency
+	}
+	if changes.Note != nil {
+		updateFields["note"] = *changes.Note
+	}
+	if changes.Type != nil {
+		updateFields["type"] = *changes.Type
+	}
+	if changes.CategoryID != nil {
+		updateFields["category_id"] = *changes.CategoryID
+	}
+	update := bson.M{"$set": updateFields}
+	if changes.AccountID != nil {
+		if changes.AccountID.IsZero() {
+			update["$unset"] = bson.M{"account_id": ""}
+		} else {
+			updateFields["account_id"] = *changes.AccountID
+		}
+	}
+
+	var before, after models.FixedExpense
+	err := r.collection.FindOneAndUpdate(ctx,
+		live(bson.M{"_id": id, "ledger_id": ledgerID}),
+		update,
+	).Decode(&before)
+	if err != nil {
+		return before, after, notFound(err)
+	}
+	err = r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&after)
+	return before, after, notFound(err)
+}
+
+func (r *mongoFixedExpenseRepository) Delete(ctx context.Context, ledgerID, id primitive.ObjectID) (models.FixedExpense, error) {
+	return r.softDelete(ctx, ledgerID, id)
+}
+
+// ---- Exchange Rates ----
+
+type mongoExchangeRateRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoExchangeRateRepository) Upsert(ctx context.Context, rate models.ExchangeRate) error {
+	filter := bson.M{"base": rate.Base, "quote": rate.Quote, "date": rate.Date}
+	if rate.Carried {
+		// 只更新同樣是補齊的資料；已有實際匯率時 upsert 會撞到唯一索引，直接略過
+		filter["carried"] = true
+	}
+	update := bson.M{"$set": bson.M{
+		"rate":       rate.Rate,
+		"source":     rate.Source,
+		"carried":    rate.Carried,
+		"updated_at": rate.UpdatedAt,
+	}}
+	_, err := r.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if rate.Carried && mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	return err
+}
+
+func (r *mongoExchangeRateRepository) Latest(ctx context.Context, base, quote, date string) (models.ExchangeRate, error) {
+	var rate models.ExchangeRate
+	err := r.collection.FindOne(ctx,
+		bson.M{"base": base, "quote": quote, "date": bson.M{"$lte": date}},
+		options.FindOne().SetSort(bson.D{{Key: "date", Value: -1}}),
+	).Decode(&rate)
+	return rate, notFound(err)
+}
+
+// ---- Audit Log ----
+
+type mongoAuditLogRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoAuditLogRepository) Insert(ctx context.Context, entry models.AuditLog) error {
+	_, err := r.collection.InsertOne(ctx, entry)
+	return err
+}
+
+// ---- User Settings ----
+
+type mongoUserSettingsRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoUserSettingsRepository) BaseCurrency(ctx context.Context, username string) (string, error) {
+	var user models.User
+	err := r.collection.FindOne(ctx,
+		bson.M{"username": username},
+		options.FindOne().SetProjection(bson.M{"base_currency": 1}),
+	).Decode(&user)
+	return user.BaseCurrency, notFound(err)
+}
+
+func (r *mongoUserSettingsRepository) SetBaseCurrency(ctx context.Context, username, currency string) error {
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"username": username},
+		bson.M{"$set": bson.M{"base_currency": currency, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+// Package repository 將交易、類別、預算、固定支出與帳戶的資料存取從 controllers 抽離。
+// 提供 MongoDB 與記憶體兩種實作，controllers 只依賴這裡定義的介面。
+//
+// 交易、類別、預算、固定支出與帳戶採用軟刪除：Delete 只標記 deleted_at (移到垃圾桶)，
+// 其餘查詢與統計都會排除已刪除的資料，直到 Restore 或 Purge。
+package repository
+
+import (
+	"context"
+	"errors"
+	"server/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrNotFound 找不到資料 (或資料不屬於指定帳本)
+var ErrNotFound = errors.New("repository: not found")
+
+// TransactionFilter 交易查詢條件，零值欄位代表不限
+type TransactionFilter struct {
+	LedgerID primitive.ObjectID
+	// StartDate / EndDate: "YYYY-MM-DD"，兩端皆包含
+	StartDate string
+	EndDate   string
+	// CategoryIDs: 只查詢這些類別
+	CategoryIDs []primitive.ObjectID
+	// AccountIDs: 只查詢這些帳戶
+	AccountIDs []primitive.ObjectID
+	// TagsAny / TagsAll / TagsNone: 含任一標籤 / 含所有標籤 / 不含任何一個標籤
+	TagsAny  []string
+	TagsAll  []string
+	TagsNone []string
+}
+
+// CategoryTotal 單一類別在某個幣別、某一天的金額加總
+// 依幣別與日期細分是為了以交易當天的匯率換算，呼叫端再依需要合併
+type CategoryTotal struct {
+	CategoryID primitive.ObjectID `bson:"category_id"`
+	Currency   string             `bson:"currency"`
+	Date       string             `bson:"date"`
+	Total      models.Money       `bson:"total"`
+	Count      int64              `bson:"count"`
+}
+
+// TagTotal 單一標籤在某個類別、幣別、某一天的金額加總 (一筆交易有多個標籤時每個標籤都會計入)
+type TagTotal struct {
+	Tag           string `bson:"tag"`
+	CategoryTotal `bson:",inline"`
+}
+
+// AccountTotal 單一帳戶在某個類別 (或轉帳方向)、幣別、某一天的金額加總
+type AccountTotal struct {
+	AccountID primitive.ObjectID `bson:"account_id"`
+	// Kind: 轉帳為 transfer_out / transfer_in (沒有類別)，一般收支為空字串
+	Kind          string `bson:"kind"`
+	CategoryTotal `bson:",inline"`
+}
+
+// TagCount 標籤與使用的交易筆數
+type TagCount struct {
+	Tag   string `bson:"tag"`
+	Count int64  `bson:"count"`
+}
+
+// CategoryUpdate 類別可修改的欄位，nil 代表不修改
+type CategoryUpdate struct {
+	Name     *string
+	Type     *string
+	Order    *int
+	Archived *bool
+	// ParentID: primitive.NilObjectID 代表移到最上層
+	ParentID *primitive.ObjectID
+}
+
+// FixedExpenseUpdate 固定支出可修改的欄位，nil 代表不修改
+type FixedExpenseUpdate struct {
+	Order      *int
+	Amount     *models.Money
+	Day        *int
+	Currency   *string
+	Note       *string
+	Type       *string
+	CategoryID *primitive.ObjectID
+	// AccountID: primitive.NilObjectID 代表不指定帳戶
+	AccountID *primitive.ObjectID
+}
+
+// AccountUpdate 帳戶可修改的欄位，nil 代表不修改
+type AccountUpdate struct {
+	Name           *string
+	Type           *string
+	Currency       *string
+	OpeningBalance *models.Money
+	// OpeningDate: 空字串代表不限開帳日
+	OpeningDate *string
+	Order       *int
+	Archived    *bool
+}
+
+// Trash 垃圾桶中 (已軟刪除) 的資料
+type Trash[T any] interface {
+	// ListDeleted 依刪除時間由新到舊列出帳本中已刪除的資料
+	ListDeleted(ctx context.Context, ledgerID primitive.ObjectID) ([]T, error)
+	// Restore 復原已刪除的資料，不在垃圾桶中時回傳 ErrNotFound
+	Restore(ctx context.Context, ledgerID, id primitive.ObjectID) (T, error)
+	// Purge 永久刪除垃圾桶中的資料，不在垃圾桶中時回傳 ErrNotFound
+	Purge(ctx context.Context, ledgerID, id primitive.ObjectID) (T, error)
+	// PurgeDeletedBefore 永久刪除所有帳本中刪除時間早於 cutoff 的資料 (排程使用)，回傳筆數
+	PurgeDeletedBefore(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+// CategoryDependents 以 category_id 參照類別的資料 (包含垃圾桶中的資料)
+type CategoryDependents interface {
+	// CountByCategory 回傳參照該類別的筆數
+	CountByCategory(ctx context.Context, ledgerID, categoryID primitive.ObjectID) (int64, error)
+	// ReassignCategory 將參照 from 的資料改為參照 to，回傳筆數
+	ReassignCategory(ctx context.Context, ledgerID, from, to primitive.ObjectID) (int64, error)
+}
+
+// AccountDependents 以 account_id 參照帳戶的資料
+type AccountDependents interface {
+	// CountByAccount 回傳參照該帳戶的筆數 (包含垃圾桶中的資料)
+	CountByAccount(ctx context.Context, ledgerID, accountID primitive.ObjectID) (int64, error)
+}
+
+// TagDependents 以 tags 參照標籤的資料 (包含垃圾桶中的資料)
+type TagDependents interface {
+	// RenameTag 將標籤 from 改為 to (已有 to 的資料只移除 from，即合併)，回傳筆數
+	RenameTag(ctx context.Context, ledgerID primitive.ObjectID, from, to string) (int64, error)
+	// DeleteTag 移除標籤，回傳筆數
+	DeleteTag(ctx context.Context, ledgerID primitive.ObjectID, tag string) (int64, error)
+}
+
+// TransactionRepository 交易資料存取
+type TransactionRepository interface {
+	Trash[models.Transaction]
+	CategoryDependents
+	AccountDependents
+	TagDependents
+	// Create 新增交易，未指定版本時為第 1 版
+	Create(ctx context.Context, tx models.Transaction) error
+	// Get 取得單筆未刪除的交易
+	Get(ctx context.Context, ledgerID, id primitive.ObjectID) (models.Transaction, error)
+	// List 依日期由新到舊分頁查詢，並回傳符合條件的總筆數
+	List(ctx context.Context, filter TransactionFilter, skip, limit int64) ([]models.Transaction, int64, error)
+	// Find 回傳所有符合條件的交易 (不分頁)
+	Find(ctx context.Context, filter TransactionFilter) ([]models.Transaction, error)
+	// Update 修改金額、類別、日期與備註 (幣別有值、標籤與帳戶不為 nil 時一併修改) 並將版本號加 1，回傳修改前後的資料
+	// 帳戶為 primitive.NilObjectID 時移除帳戶
+	Update(ctx context.Context, ledgerID, id primitive.ObjectID, changes models.Transaction) (before, after models.Transaction, err error)
+	// Delete 移到垃圾桶，回傳刪除前的資料
+	Delete(ctx context.Context, ledgerID, id primitive.ObjectID) (models.Transaction, error)
+	// SumByCategory 依類別、幣別與日期加總金額 (轉帳不計入)
+	SumByCategory(ctx context.Context, filter TransactionFilter) ([]CategoryTotal, error)
+	// SumByTag 依標籤、類別、幣別與日期加總金額 (沒有標籤的交易與轉帳不計入)
+	SumByTag(ctx context.Context, filter TransactionFilter) ([]TagTotal, error)
+	// SumByAccount 依帳戶、類別 (轉帳則為方向)、幣別與日期加總金額 (沒有帳戶的交易不計入)
+	SumByAccount(ctx context.Context, filter TransactionFilter) ([]AccountTotal, error)
+	// TransferLegs 回傳同一筆轉帳的兩邊，deleted 為 true 時查詢垃圾桶中的資料
+	TransferLegs(ctx context.Context, ledgerID, transferID primitive.ObjectID, deleted bool) ([]models.Transaction, error)
+	// ListTags 依名稱列出帳本中未刪除交易使用的標籤與筆數
+	ListTags(ctx context.Context, ledgerID primitive.ObjectID) ([]TagCount, error)
+}
+
+// TransactionRevisionRepository 交易的舊版本
+// 標籤改名、合併或刪除時舊版本也一併修改，避免還原時又出現舊標籤
+type TransactionRevisionRepository interface {
+	TagDependents
+	Create(ctx context.Context, revision models.TransactionRevision) error
+	// List 依版本由舊到新列出交易的所有舊版本
+	List(ctx context.Context, ledgerID, transactionID primitive.ObjectID) ([]models.TransactionRevision, error)
+	// Get 取得交易的指定版本，找不到時回傳 ErrNotFound
+	Get(ctx context.Context, ledgerID, transactionID primitive.ObjectID, version int) (models.TransactionRevision, error)
+	// DeleteByTransaction 交易永久刪除時一併刪除其舊版本
+	DeleteByTransaction(ctx context.Context, ledgerID, transactionID primitive.ObjectID) error
+	// PurgeOrphaned 刪除交易已不存在的舊版本 (排程清除垃圾桶後使用)，回傳筆數
+	PurgeOrphaned(ctx context.Context) (int64, error)
+}
+
+// CategoryRepository 類別資料存取
+type CategoryRepository interface {
+	Trash[models.Category]
+	// List 依 order、name 排序回傳帳本的所有類別 (包含已封存的類別)
+	List(ctx context.Context, ledgerID primitive.ObjectID) ([]models.Category, error)
+	Get(ctx context.Context, ledgerID, id primitive.ObjectID) (models.Category, error)
+	// MaxOrder 回傳帳本中最大的排序值，沒有類別時為 0
+	MaxOrder(ctx context.Context, ledgerID primitive.ObjectID) (int, error)
+	Create(ctx context.Context, category models.Category) error
+	CreateMany(ctx context.Context, categories []models.Category) error
+	Update(ctx context.Context, ledgerID, id primitive.ObjectID, changes CategoryUpdate) (before, after models.Category, err error)
+	// Delete 移到垃圾桶，回傳刪除前的資料
+	Delete(ctx context.Context, ledgerID, id primitive.ObjectID) (models.Category, error)
+}
+
+// BudgetRepository 預算資料存取
+type BudgetRepository interface {
+	Trash[models.Budget]
+	ListByMonth(ctx context.Context, ledgerID primitive.ObjectID, yearMonth string) ([]models.Budget, error)
+	// Upsert 同帳本、同月份、同類別則更新，否則新增；新增時 before 為 nil
+	Upsert(ctx context.Context, budget models.Budget) (before *models.Budget, after models.Budget, err error)
+	// Find 取得同帳本、同月份、同類別且未刪除的預算 (復原前檢查是否重複)
+	Find(ctx context.Context, ledgerID primitive.ObjectID, yearMonth string, categoryID primitive.ObjectID) (models.Budget, error)
+	// Delete 移到垃圾桶，回傳刪除前的資料
+	Delete(ctx context.Context, ledgerID, id primitive.ObjectID) (models.Budget, error)
+	// CountByCategory 回傳該類別的預算筆數 (包含垃圾桶中的預算)
+	CountByCategory(ctx context.Context, ledgerID, categoryID primitive.ObjectID) (int64, error)
+	// MergeCategory 將 from 類別的預算改為 to 類別；同月份 to 已有預算時，from 的預算移到垃圾桶
+	MergeCategory(ctx context.Context, ledgerID, from, to primitive.ObjectID) (moved, trashed int64, err error)
+}
+
+// FixedExpenseRepository 固定支出資料存取
+type FixedExpenseRepository interface {
+	Trash[models.FixedExpense]
+	CategoryDependents
+	AccountDependents
+	List(ctx context.Context, ledgerID primitive.ObjectID) ([]models.FixedExpense, error)
+	Get(ctx context.Context, ledgerID, id primitive.ObjectID) (models.FixedExpense, error)
+	// ListByDay 回傳所有帳本中指定扣款日的固定支出 (排程使用)
+	ListByDay(ctx context.Context, day int) ([]models.FixedExpense, error)
+	// MaxOrder 回傳帳本中最大的排序值，沒有資料時為 0
+	MaxOrder(ctx context.Context, ledgerID primitive.ObjectID) (int, error)
+	Create(ctx context.Context, expense models.FixedExpense) error
+	Update(ctx context.Context, ledgerID, id primitive.ObjectID, changes FixedExpenseUpdate) (before, after models.FixedExpense, err error)
+	// Delete 移到垃圾桶，回傳刪除前的資料
+	Delete(ctx context.Context, ledgerID, id primitive.ObjectID) (models.FixedExpense, error)
+}
+
+// AccountRepository 帳戶資料存取
+type AccountRepository interface {
+	Trash[models.Account]
+	// List 依 order、name 排序回傳帳本的所有帳戶 (包含已封存的帳戶)
+	List(ctx context.Context, ledgerID primitive.ObjectID) ([]models.Account, error)
+	Get(ctx context.Context, ledgerID, id primitive.ObjectID) (models.Account, error)
+	// MaxOrder 回傳帳本中最大的排序值，沒有帳戶時為 0
+	MaxOrder(ctx context.Context, ledgerID primitive.ObjectID) (int, error)
+	Create(ctx context.Context, account models.Account) error
+	Update(ctx context.Context, ledgerID, id primitive.ObjectID, changes AccountUpdate) (before, after models.Account, err error)
+	// Delete 移到垃圾桶，回傳刪除前的資料
+	Delete(ctx context.Context, ledgerID, id primitive.ObjectID) (models.Account, error)
+}
+
+// ExchangeRateRepository 匯率資料存取 (不分帳本)
+type ExchangeRateRepository interface {
+	// Upsert 同一天、同一組幣別則覆蓋；補齊的匯率 (Carried) 不會覆蓋實際匯率
+	Upsert(ctx context.Context, rate models.ExchangeRate) error
+	// Latest 回傳 date 當天或之前最近一筆 base -> quote 匯率，找不到時回傳 ErrNotFound
+	Latest(ctx context.Context, base, quote, date string) (models.ExchangeRate, error)
+}
+
+// AuditLogRepository 稽核紀錄寫入 (查詢仍由 controllers 直接讀取 audit_log)
+type AuditLogRepository interface {
+	Insert(ctx context.Context, entry models.AuditLog) error
+}
+
+// UserSettingsRepository 使用者的個人設定 (目前只有主要幣別)
+type UserSettingsRepository interface {
+	// BaseCurrency 回傳使用者的主要幣別，未設定時為空字串；找不到使用者時回傳 ErrNotFound
+	BaseCurrency(ctx context.Context, username string) (string, error)
+	// SetBaseCurrency 設定使用者的主要幣別，找不到使用者時回傳 ErrNotFound
+	SetBaseCurrency(ctx context.Context, username, currency string) error
+}
+
+// Repositories 集合所有 repository，供 controllers.NewHandler 注入
+type Repositories struct {
+	Transactions         TransactionRepository
+	TransactionRevisions TransactionRevisionRepository
+	Categories           CategoryRepository
+	Budgets              BudgetRepository
+	FixedExpenses        FixedExpenseRepository
+	Accounts             AccountRepository
+	ExchangeRates        ExchangeRateRepository
+	AuditLogs            AuditLogRepository
+	UserSettings         UserSettingsRepository
+}